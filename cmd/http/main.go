@@ -3,22 +3,43 @@ package main
 import (
 	"cmd/http/main.go/config"
 	_ "cmd/http/main.go/docs"
+	"cmd/http/main.go/internal/admin"
+	"cmd/http/main.go/internal/apiversion"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/audit"
+	"cmd/http/main.go/internal/auth"
+	"cmd/http/main.go/internal/challenge"
+	"cmd/http/main.go/internal/devicesync"
 	"cmd/http/main.go/internal/elevator"
 	"cmd/http/main.go/internal/finance"
+	"cmd/http/main.go/internal/health"
+	"cmd/http/main.go/internal/healthimport"
+	"cmd/http/main.go/internal/hydration"
+	"cmd/http/main.go/internal/idempotency"
+	"cmd/http/main.go/internal/journal"
+	"cmd/http/main.go/internal/leaderboard"
+	"cmd/http/main.go/internal/logging"
 	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/metrics"
+	"cmd/http/main.go/internal/organization"
 	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/ratelimit"
 	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/sleep"
+	"cmd/http/main.go/internal/social"
 	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/tracing"
 	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/workout"
 	"cmd/http/main.go/pkg/shutdown"
 
-	"fmt"
+	"context"
+	"log/slog"
 	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/swagger"
 )
 
@@ -27,7 +48,7 @@ import (
 // @description A backend for Wholesome Living written in Golang backend API using Fiber and MongoDB
 // @contact.name Wholesome Living
 // @license.name MIT
-// @BasePath /
+// @BasePath /v1
 func main() {
 	// setup exit code for graceful shutdown
 	var exitCode int
@@ -38,107 +59,338 @@ func main() {
 	// load config
 	env, err := config.LoadConfig()
 	if err != nil {
-		fmt.Printf("error: %v", err)
+		slog.Error("could not load config", "error", err)
 		exitCode = 1
 		return
 	}
 
-	// run the server
-	cleanup, err := run(env)
-
-	// run the cleanup after the server is terminated
-	defer cleanup()
+	// log structured lines of the configured level
+	logger, err := logging.New(env.LOG_LEVEL, env.LOG_FORMAT, os.Stdout)
 	if err != nil {
-		fmt.Printf("error: %v", err)
+		slog.Error("could not create logger", "error", err)
 		exitCode = 1
 		return
 	}
+	slog.SetDefault(logger)
+
+	// everything that is started adds a hook to stop it
+	hooks := shutdown.New()
 
-	// ensure the server is shutdown gracefully & app runs
-	shutdown.Gracefully()
+	// run the server, a server failing to start stops what was started so far
+	failed, err := run(env, hooks)
+	if err != nil {
+		slog.Error("could not start server", "error", err)
+		exitCode = 1
+	} else if err := shutdown.Gracefully(failed); err != nil {
+		// ensure the server is shutdown gracefully & app runs
+		slog.Error("server failed", "error", err)
+		exitCode = 1
+	}
 
+	// drain the requests, stop the workers, flush the spans and close mongo
+	slog.Info("shutting down", "timeout", env.SHUTDOWN_TIMEOUT)
+	if err := hooks.Run(env.SHUTDOWN_TIMEOUT); err != nil {
+		slog.Error("could not shut down", "error", err)
+		exitCode = 1
+	}
 }
 
-func run(env config.EnvVars) (func(), error) {
-	app, cleanup, err := buildServer(env)
+func run(env config.EnvVars, hooks *shutdown.Hooks) (<-chan error, error) {
+	app, err := buildServer(env, hooks)
 	if err != nil {
 		return nil, err
 	}
 
-	// start the server
+	// start the server, an error of listen ends the process
+	failed := make(chan error, 1)
 	go func() {
-		err := app.Listen("0.0.0.0:" + env.PORT)
-		if err != nil {
-			return
+		if err := app.Listen("0.0.0.0:" + env.PORT); err != nil {
+			failed <- err
 		}
 	}()
 
-	// return a function to close the server and database
-	return func() {
-		cleanup()
-		err := app.Shutdown()
-		if err != nil {
-			return
-		}
-	}, nil
+	// added last so it runs first: stop accepting and wait for the running requests
+	hooks.Add("server", func(ctx context.Context) error {
+		return app.Server().ShutdownWithContext(ctx)
+	})
+	return failed, nil
 }
 
-func buildServer(env config.EnvVars) (*fiber.App, func(), error) {
+func buildServer(env config.EnvVars, hooks *shutdown.Hooks) (*fiber.App, error) {
+	sunset, err := env.LegacySunset()
+	if err != nil {
+		return nil, err
+	}
+
 	// init the storage
 	db, err := storage.BootstrapMongo(env.MONGODB_URI, env.MONGODB_NAME, 10*time.Second)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	hooks.Add("mongo", func(ctx context.Context) error {
+		return storage.CloseMongo(db, ctx)
+	})
 
-	// create the fiber app
-	app := fiber.New()
+	// create the fiber app, every returned error is rendered as problem+json
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
 
-	// add middleware
+	// export the spans of the requests
+	var exporter tracing.Exporter
+	switch env.TRACING_EXPORTER {
+	case config.TracingExporterStdout:
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	case config.TracingExporterOTLP:
+		exporter = tracing.NewOTLPExporter(env.OTLP_ENDPOINT, "wholesome-living-backend")
+	}
+	var spans *tracing.Processor
+	if exporter != nil {
+		spans = tracing.NewProcessor(exporter)
+		spans.Start()
+		hooks.Add("spans", func(ctx context.Context) error {
+			spans.Stop()
+			return nil
+		})
+	}
+
+	// add middleware, the logger renders errors for the metrics and traces.
+	// requests are canceled if they outlast the shutdown
+	app.Use(hooks.Middleware())
 	app.Use(cors.New())
-	app.Use(logger.New())
+	app.Use(tracing.Middleware())
+	app.Use(metrics.Middleware())
+	app.Use(logging.Middleware(slog.Default()))
 
-	// add health check
+	// add health checks, /health is kept for older monitors
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.SendString("Healthy!")
 	})
+	app.Get("/health/live", health.Live)
+
+	// add metrics for prometheus
+	app.Get("/metrics", metrics.Handler)
 
 	// add docs
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
+	// retried create requests are answered from the stored response
+	idempotencyStore := idempotency.NewStorage(db)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := idempotencyStore.EnsureIndexes(ctx); err != nil {
+		return nil, err
+	}
+	idempotent := idempotency.New(idempotencyStore)
+
 	// create the user domain
 	userStore := user.NewStorage(db)
 	userController := user.NewController(userStore)
-	user.Routes(app, userController)
 
-	//create finance domain
+	//create progress domain
 	progressStore := progress.NewStorage(db)
 	progressController := progress.NewController(progressStore, userStore)
-	progress.Routes(app, progressController)
 
 	// create the settings domain
 	metadataStore := settings.NewStorage(db)
 	metadataController := settings.NewController(metadataStore, userStore)
-	settings.Routes(app, metadataController)
 
 	//create meditation domain
 	meditationStore := meditation.NewStorage(db)
 	meditationController := meditation.NewController(meditationStore, userStore, progressStore)
-	meditation.Routes(app, meditationController)
 
 	//create finance domain
 	financeStore := finance.NewStorage(db)
 	financeController := finance.NewController(financeStore, userStore, progressStore)
-	finance.Routes(app, financeController)
 
-	//create finance domain
+	//create elevator domain
 	elevatorStore := elevator.NewStorage(db)
 	elevatorController := elevator.NewController(elevatorStore, userStore, progressStore)
-	elevator.Routes(app, elevatorController)
 
-	return app, func() {
-		err := storage.CloseMongo(db)
-		if err != nil {
-			return
+	//create journal domain
+	journalStore := journal.NewStorage(db)
+	journalController := journal.NewController(journalStore, userStore, progressStore)
+
+	//create sleep domain
+	sleepStore := sleep.NewStorage(db)
+	sleepController := sleep.NewController(sleepStore, userStore, progressStore, metadataStore)
+
+	//create hydration domain
+	hydrationStore := hydration.NewStorage(db)
+	hydrationController := hydration.NewController(hydrationStore, userStore, progressStore, metadataStore)
+
+	//create workout domain
+	workoutStore := workout.NewStorage(db)
+	workoutController := workout.NewController(workoutStore, userStore, progressStore, metadataStore)
+
+	//create the import domain, jobs run in the background
+	importStore := healthimport.NewStorage(db)
+	importer, err := healthimport.NewImporter(env.IMPORT_DIR, importStore, meditationStore, elevatorStore, sleepStore, metadataStore)
+	if err != nil {
+		return nil, err
+	}
+	hooks.Add("importer", func(ctx context.Context) error {
+		importer.Stop()
+		return nil
+	})
+	importController := healthimport.NewController(importStore, userStore, importer)
+
+	//create social domain
+	socialStore := social.NewStorage(db)
+	socialController := social.NewController(socialStore, userStore, progressStore)
+
+	//create leaderboard domain, the snapshots are recomputed in the background
+	leaderboardStore := leaderboard.NewStorage(db)
+	leaderboardWorker := leaderboard.NewWorker(leaderboardStore, socialStore, meditationStore, elevatorStore, financeStore, env.LEADERBOARD_INTERVAL)
+	leaderboardController := leaderboard.NewController(leaderboardStore, userStore, socialStore)
+
+	//create challenge domain
+	challengeStore := challenge.NewStorage(db)
+	challengeController := challenge.NewController(challengeStore, userStore, meditationStore, elevatorStore, financeStore)
+
+	//create audit domain, entries expire after the retention
+	auditStore := audit.NewStorage(db, env.AUDIT_RETENTION)
+
+	//create organization domain
+	organizationStore := organization.NewStorage(db)
+	organizationController := organization.NewController(organizationStore, userStore, meditationStore, elevatorStore)
+
+	// backfill records of older versions and create the indexes for range queries
+	migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelMigrate()
+	if err := meditationStore.Migrate(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := elevatorStore.Migrate(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := journalStore.EnsureIndexes(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := sleepStore.EnsureIndexes(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := hydrationStore.EnsureIndexes(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := workoutStore.EnsureIndexes(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := progressStore.EnsureIndexes(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := socialStore.EnsureIndexes(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := leaderboardStore.EnsureIndexes(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := challengeStore.EnsureIndexes(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := organizationStore.EnsureIndexes(migrateCtx); err != nil {
+		return nil, err
+	}
+	if err := auditStore.EnsureIndexes(migrateCtx); err != nil {
+		return nil, err
+	}
+	// the admins of the config can grant roles to others
+	if err := userStore.GrantRole(env.AdminUserIDs(), auth.RoleAdmin, migrateCtx); err != nil {
+		return nil, err
+	}
+	// continue the imports interrupted by the last shutdown
+	if err := importer.Resume(migrateCtx); err != nil {
+		return nil, err
+	}
+	leaderboardWorker.Start()
+	hooks.Add("leaderboardWorker", func(ctx context.Context) error {
+		leaderboardWorker.Stop()
+		return nil
+	})
+
+	// the instance is ready while mongo answers, the records are migrated and the workers run
+	checker := health.New(2 * time.Second)
+	checker.Add("mongo", func(ctx context.Context) error {
+		return storage.Ping(db, ctx)
+	})
+	checker.Add("migrations", func(ctx context.Context) error {
+		if err := meditationStore.Migrated(ctx); err != nil {
+			return err
+		}
+		return elevatorStore.Migrated(ctx)
+	})
+	checker.Add("leaderboardWorker", leaderboardWorker.Check)
+	checker.Add("importer", importer.Check)
+	app.Get("/health/ready", checker.Ready)
+
+	//create sync domain
+	syncStore := devicesync.NewStorage(db)
+	syncController := devicesync.NewController(syncStore, userStore, progressStore, meditationStore, elevatorStore, financeStore)
+
+	//create admin domain, every admin request is recorded in the audit log
+	adminController := admin.NewController(userStore, metadataStore, progressStore, auditStore)
+
+	// the buckets of the rate limits are shared by all instances with mongo
+	var rateStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if env.RATE_LIMIT_STORE == config.RateLimitStoreMongo {
+		mongoRateStore := ratelimit.NewStorage(db)
+		if err := mongoRateStore.EnsureIndexes(migrateCtx); err != nil {
+			return nil, err
+		}
+		rateStore = mongoRateStore
+	}
+	limiter := ratelimit.New(rateStore)
+
+	// the userId header is only authenticated behind a trusted gateway, elsewhere
+	// nobody gets more permissions than a user
+	var accounts auth.Accounts = userStore
+	if !env.TRUSTED_IDENTITY {
+		accounts = auth.WithoutRoles(userStore)
+	}
+
+	// mount the routes of all domains on a router
+	mount := func(router fiber.Router) {
+		// suspended users are locked out of every route
+		router.Use(auth.Active(accounts))
+
+		// every caller has a budget of requests, entries that earn experience have their own.
+		// callers are known users after auth.Active, or else their IP
+		router.Use(limiter.Limit(ratelimit.Policy{Name: "default", Limit: 300, Period: time.Minute}))
+		for _, path := range []string{"/meditation", "/elevator", "/elevator/import", "/finance", "/journal", "/sleep", "/hydration", "/workout", "/sync"} {
+			router.Post(path, limiter.Limit(ratelimit.Policy{Name: "POST " + path, Limit: 30, Period: time.Minute}))
+		}
+		// the changes of successful requests are recorded in the audit log
+		router.Use(audit.Recorder(auditStore))
+
+		user.Routes(router, userController, accounts)
+		progress.Routes(router, progressController)
+		settings.Routes(router, metadataController)
+		meditation.Routes(router, meditationController, idempotent)
+		finance.Routes(router, financeController, idempotent)
+		elevator.Routes(router, elevatorController, idempotent)
+		journal.Routes(router, journalController, idempotent)
+		sleep.Routes(router, sleepController, idempotent)
+		hydration.Routes(router, hydrationController, idempotent)
+		workout.Routes(router, workoutController, idempotent)
+		devicesync.Routes(router, syncController)
+		healthimport.Routes(router, importController, idempotent)
+		social.Routes(router, socialController)
+		leaderboard.Routes(router, leaderboardController)
+		challenge.Routes(router, challengeController, idempotent)
+		organization.Routes(router, organizationController)
+		if env.TRUSTED_IDENTITY {
+			admin.Routes(router, adminController)
 		}
-	}, nil
+	}
+
+	// the current version of the api
+	mount(app.Group("/"+apiversion.V1, apiversion.Negotiate(apiversion.V1)))
+
+	// keep the unversioned paths as deprecated aliases during the transition, mounted last
+	// so versioned requests never run their middleware
+	if env.LEGACY_ROUTES {
+		mount(app.Group("/", apiversion.Legacy(apiversion.V1, sunset)))
+	}
+
+	return app, nil
 }
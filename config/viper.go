@@ -2,7 +2,12 @@ package config
 
 import (
 	"errors"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -11,15 +16,78 @@ type EnvVars struct {
 	MONGODB_URI  string `mapstructure:"MONGODB_URI"`
 	MONGODB_NAME string `mapstructure:"MONGODB_NAME"`
 	PORT         string `mapstructure:"PORT"`
+	// serve the unversioned paths as deprecated aliases of /v1
+	LEGACY_ROUTES bool `mapstructure:"LEGACY_ROUTES"`
+	// date (YYYY-MM-DD) after which the unversioned paths answer 410 Gone, empty for no sunset
+	LEGACY_ROUTES_SUNSET string `mapstructure:"LEGACY_ROUTES_SUNSET"`
+	// directory for uploaded health exports until they are imported
+	IMPORT_DIR string `mapstructure:"IMPORT_DIR"`
+	// how often the leaderboards are recomputed, like 15m
+	LEADERBOARD_INTERVAL time.Duration `mapstructure:"LEADERBOARD_INTERVAL"`
+	// comma separated ids of users that are made admins on start
+	ADMIN_USER_IDS string `mapstructure:"ADMIN_USER_IDS"`
+	// the userId header is set by a gateway that authenticated the caller, only then
+	// the roles of users are granted and the admin routes are served
+	TRUSTED_IDENTITY bool `mapstructure:"TRUSTED_IDENTITY"`
+	// how long the audit log is kept, like 8760h
+	AUDIT_RETENTION time.Duration `mapstructure:"AUDIT_RETENTION"`
+	// where the rate limits are kept, memory for one instance or mongo for several
+	RATE_LIMIT_STORE string `mapstructure:"RATE_LIMIT_STORE"`
+	// where the spans go: none, stdout or otlp
+	TRACING_EXPORTER string `mapstructure:"TRACING_EXPORTER"`
+	// traces endpoint of an OTLP/HTTP collector
+	OTLP_ENDPOINT string `mapstructure:"OTLP_ENDPOINT"`
+	// least level that is logged: debug, info, warn or error
+	LOG_LEVEL string `mapstructure:"LOG_LEVEL"`
+	// log lines as json or text
+	LOG_FORMAT string `mapstructure:"LOG_FORMAT"`
+	// how long running requests and workers get to finish on shutdown, like 30s
+	SHUTDOWN_TIMEOUT time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+}
+
+// AdminUserIDs splits ADMIN_USER_IDS
+func (e EnvVars) AdminUserIDs() []string {
+	ids := make([]string, 0)
+	for _, id := range strings.Split(e.ADMIN_USER_IDS, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// LegacySunset parses LEGACY_ROUTES_SUNSET, the zero time means no sunset
+func (e EnvVars) LegacySunset() (time.Time, error) {
+	if e.LEGACY_ROUTES_SUNSET == "" {
+		return time.Time{}, nil
+	}
+	sunset, err := time.Parse("2006-01-02", e.LEGACY_ROUTES_SUNSET)
+	if err != nil {
+		return time.Time{}, errors.New("LEGACY_ROUTES_SUNSET must be a date like 2027-01-31")
+	}
+	return sunset, nil
 }
 
 func LoadConfig() (config EnvVars, err error) {
 	env := os.Getenv("GO_ENV")
 	if env == "production" {
 		return EnvVars{
-			MONGODB_URI:  os.Getenv("MONGODB_URI"),
-			MONGODB_NAME: os.Getenv("MONGODB_NAME"),
-			PORT:         os.Getenv("PORT"),
+			MONGODB_URI:          os.Getenv("MONGODB_URI"),
+			MONGODB_NAME:         os.Getenv("MONGODB_NAME"),
+			PORT:                 os.Getenv("PORT"),
+			LEGACY_ROUTES:        envBool("LEGACY_ROUTES", true),
+			LEGACY_ROUTES_SUNSET: os.Getenv("LEGACY_ROUTES_SUNSET"),
+			IMPORT_DIR:           envString("IMPORT_DIR", defaultImportDir()),
+			LEADERBOARD_INTERVAL: envDuration("LEADERBOARD_INTERVAL", defaultLeaderboardInterval),
+			ADMIN_USER_IDS:       os.Getenv("ADMIN_USER_IDS"),
+			TRUSTED_IDENTITY:     envBool("TRUSTED_IDENTITY", false),
+			AUDIT_RETENTION:      envDuration("AUDIT_RETENTION", defaultAuditRetention),
+			RATE_LIMIT_STORE:     envString("RATE_LIMIT_STORE", RateLimitStoreMemory),
+			TRACING_EXPORTER:     envString("TRACING_EXPORTER", TracingExporterNone),
+			OTLP_ENDPOINT:        envString("OTLP_ENDPOINT", defaultOTLPEndpoint),
+			LOG_LEVEL:            envString("LOG_LEVEL", defaultLogLevel),
+			LOG_FORMAT:           envString("LOG_FORMAT", LogFormatJSON),
+			SHUTDOWN_TIMEOUT:     envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout),
 		}, nil
 	}
 
@@ -27,6 +95,16 @@ func LoadConfig() (config EnvVars, err error) {
 	viper.SetConfigName("app")
 	viper.SetConfigType("env")
 
+	viper.SetDefault("LEGACY_ROUTES", true)
+	viper.SetDefault("IMPORT_DIR", defaultImportDir())
+	viper.SetDefault("LEADERBOARD_INTERVAL", defaultLeaderboardInterval)
+	viper.SetDefault("AUDIT_RETENTION", defaultAuditRetention)
+	viper.SetDefault("RATE_LIMIT_STORE", RateLimitStoreMemory)
+	viper.SetDefault("TRACING_EXPORTER", TracingExporterNone)
+	viper.SetDefault("OTLP_ENDPOINT", defaultOTLPEndpoint)
+	viper.SetDefault("LOG_LEVEL", defaultLogLevel)
+	viper.SetDefault("LOG_FORMAT", LogFormatJSON)
+	viper.SetDefault("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
 	viper.AutomaticEnv()
 
 	err = viper.ReadInConfig()
@@ -47,5 +125,101 @@ func LoadConfig() (config EnvVars, err error) {
 		return
 	}
 
+	if config.LEADERBOARD_INTERVAL <= 0 {
+		err = errors.New("LEADERBOARD_INTERVAL must be a positive duration like 15m")
+		return
+	}
+
+	if config.AUDIT_RETENTION <= 0 {
+		err = errors.New("AUDIT_RETENTION must be a positive duration like 8760h")
+		return
+	}
+
+	if config.RATE_LIMIT_STORE != RateLimitStoreMemory && config.RATE_LIMIT_STORE != RateLimitStoreMongo {
+		err = errors.New("RATE_LIMIT_STORE must be memory or mongo")
+		return
+	}
+
+	if config.TRACING_EXPORTER != TracingExporterNone && config.TRACING_EXPORTER != TracingExporterStdout && config.TRACING_EXPORTER != TracingExporterOTLP {
+		err = errors.New("TRACING_EXPORTER must be none, stdout or otlp")
+		return
+	}
+
+	var level slog.Level
+	if level.UnmarshalText([]byte(config.LOG_LEVEL)) != nil {
+		err = errors.New("LOG_LEVEL must be debug, info, warn or error")
+		return
+	}
+
+	if config.LOG_FORMAT != LogFormatJSON && config.LOG_FORMAT != LogFormatText {
+		err = errors.New("LOG_FORMAT must be json or text")
+		return
+	}
+
+	if config.SHUTDOWN_TIMEOUT <= 0 {
+		err = errors.New("SHUTDOWN_TIMEOUT must be a positive duration like 30s")
+		return
+	}
+
+	_, err = config.LegacySunset()
+
 	return
 }
+
+// envBool reads a boolean environment variable, fallback if unset or invalid
+func envBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// envDuration reads a duration environment variable like 15m, fallback if unset or invalid
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// envString reads an environment variable, fallback if unset
+func envString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+const defaultLeaderboardInterval = 15 * time.Minute
+
+// a year
+const defaultAuditRetention = 365 * 24 * time.Hour
+
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreMongo  = "mongo"
+)
+
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+const defaultLogLevel = "info"
+
+const defaultShutdownTimeout = 30 * time.Second
+
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// the default port of a local collector
+const defaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+func defaultImportDir() string {
+	return filepath.Join(os.TempDir(), "wholesome-imports")
+}
@@ -1,6 +1,6 @@
 module cmd/http/main.go
 
-go 1.20
+go 1.21
 
 require (
 	github.com/gofiber/fiber/v2 v2.43.0
@@ -9,6 +9,7 @@ require (
 	github.com/stretchr/testify v1.8.2
 	github.com/swaggo/swag v1.8.11
 	go.mongodb.org/mongo-driver v1.11.3
+	golang.org/x/text v0.8.0
 )
 
 require (
@@ -77,7 +78,6 @@ require (
 	golang.org/x/net v0.8.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.6.0 // indirect
-	golang.org/x/text v0.8.0 // indirect
 	golang.org/x/tools v0.6.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
@@ -0,0 +1,207 @@
+package admin
+
+import (
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/audit"
+	"cmd/http/main.go/internal/auth"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Suite struct {
+	suite.Suite
+	app           *fiber.App
+	db            *mongo.Database
+	userStore     *user.Storage
+	progressStore *progress.Storage
+	testUserId    string
+	adminId       string
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-admin"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+	suite.db = db
+
+	suite.userStore = user.NewStorage(db)
+	suite.progressStore = progress.NewStorage(db)
+	adminCont := NewController(suite.userStore, settings.NewStorage(db), suite.progressStore, audit.NewStorage(db, time.Hour))
+	app.Use(auth.Active(suite.userStore))
+	Routes(app, adminCont)
+	app.Get("/ping", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	ctx := context.Background()
+	for _, collection := range []string{"users", "progress", "progressEvents", "audit"} {
+		if err := suite.db.Collection(collection).Drop(ctx); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+
+	// a user, a coach and an admin
+	suite.testUserId = "testId"
+	suite.adminId = "adminId"
+	roles := map[string]auth.Role{suite.testUserId: auth.RoleUser, "coachId": auth.RoleCoach, suite.adminId: auth.RoleAdmin}
+	for id, role := range roles {
+		_, err := suite.userStore.Create(user.CreateUserRequest{
+			ID:        id,
+			FirstName: "test",
+			LastName:  id,
+			Email:     id + "@example.com",
+		}, ctx)
+		if err != nil {
+			suite.T().Errorf("Could not create test user: %v", err)
+		}
+		if _, err := suite.userStore.SetRole(id, role, ctx); err != nil {
+			suite.T().Errorf("Could not set role: %v", err)
+		}
+	}
+	if err := suite.progressStore.AddExperience(suite.testUserId, ctx, settings.PluginNameMeditation, 60); err != nil {
+		suite.T().Errorf("Could not add experience: %v", err)
+	}
+}
+
+func (suite *Suite) request(method string, route string, userId string, body interface{}) (int, []byte) {
+	var reader io.Reader
+	if body != nil {
+		bodyJson, err := json.Marshal(body)
+		if err != nil {
+			suite.T().Errorf("Could not marshal body: %v", err)
+		}
+		reader = bytes.NewReader(bodyJson)
+	}
+
+	req := httptest.NewRequest(method, route, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if userId != "" {
+		req.Header.Set("userId", userId)
+	}
+
+	resp, err := suite.app.Test(req, -1)
+	if err != nil {
+		suite.T().Errorf("Could not make request: %v", err)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return resp.StatusCode, respBody
+}
+
+func (suite *Suite) TestPermissions() {
+	tests := []struct {
+		description  string
+		method       string
+		route        string
+		userId       string
+		body         interface{}
+		expectedCode int
+	}{
+		{description: "Search as admin", method: "GET", route: "/admin/users?query=COACH", userId: "adminId", expectedCode: fiber.StatusOK},
+		{description: "Search as user", method: "GET", route: "/admin/users", userId: "testId", expectedCode: fiber.StatusForbidden},
+		{description: "Search without caller", method: "GET", route: "/admin/users", expectedCode: fiber.StatusUnauthorized},
+		{description: "Limit too high", method: "GET", route: "/admin/users?limit=1000", userId: "adminId", expectedCode: fiber.StatusBadRequest},
+		{description: "Progress as coach", method: "GET", route: "/admin/users/testId/progress", userId: "coachId", expectedCode: fiber.StatusOK},
+		{description: "Settings as coach", method: "GET", route: "/admin/users/testId/settings", userId: "coachId", expectedCode: fiber.StatusForbidden},
+		{description: "Progress of unknown user", method: "GET", route: "/admin/users/unknownId/progress", userId: "adminId", expectedCode: fiber.StatusNotFound},
+		{description: "Role as coach", method: "PUT", route: "/admin/users/testId/role", userId: "coachId", body: UpdateRoleRequest{Role: auth.RoleAdmin}, expectedCode: fiber.StatusForbidden},
+		{description: "Unknown role", method: "PUT", route: "/admin/users/testId/role", userId: "adminId", body: UpdateRoleRequest{Role: "owner"}, expectedCode: fiber.StatusBadRequest},
+		{description: "Own role", method: "PUT", route: "/admin/users/adminId/role", userId: "adminId", body: UpdateRoleRequest{Role: auth.RoleUser}, expectedCode: fiber.StatusConflict},
+		{description: "Make coach", method: "PUT", route: "/admin/users/testId/role", userId: "adminId", body: UpdateRoleRequest{Role: auth.RoleCoach}, expectedCode: fiber.StatusOK},
+		{description: "Audit log as coach", method: "GET", route: "/admin/audit", userId: "coachId", expectedCode: fiber.StatusForbidden},
+		{description: "Audit log before invalid id", method: "GET", route: "/admin/audit?before=1", userId: "adminId", expectedCode: fiber.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		code, body := suite.request(test.method, test.route, test.userId, test.body)
+		suite.Equal(test.expectedCode, code, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+
+	code, body := suite.request("GET", "/admin/users?query=COACH", suite.adminId, nil)
+	suite.Equal(fiber.StatusOK, code)
+	var users []user.UserDB
+	suite.NoError(json.Unmarshal(body, &users))
+	suite.Len(users, 1)
+	suite.Equal("coachId", users[0].ID)
+}
+
+func (suite *Suite) TestSuspension() {
+	ctx := context.Background()
+
+	code, _ := suite.request("POST", "/admin/users/testId/suspend", suite.adminId, SuspendUserRequest{})
+	suite.Equal(fiber.StatusBadRequest, code)
+	code, _ = suite.request("POST", "/admin/users/adminId/suspend", suite.adminId, SuspendUserRequest{Reason: "test"})
+	suite.Equal(fiber.StatusConflict, code)
+
+	code, body := suite.request("POST", "/admin/users/testId/suspend", suite.adminId, SuspendUserRequest{Reason: "farming experience"})
+	suite.Equal(fiber.StatusOK, code, string(body))
+	code, _ = suite.request("GET", "/ping", suite.testUserId, nil)
+	suite.Equal(fiber.StatusForbidden, code)
+
+	code, _ = suite.request("POST", "/admin/users/testId/unsuspend", suite.adminId, nil)
+	suite.Equal(fiber.StatusOK, code)
+	code, _ = suite.request("GET", "/ping", suite.testUserId, nil)
+	suite.Equal(fiber.StatusOK, code)
+
+	// both changes and who made them are recorded
+	var entries []audit.EntryDB
+	cursor, err := suite.db.Collection("audit").Find(ctx, bson.M{"targetId": suite.testUserId})
+	suite.NoError(err)
+	suite.NoError(cursor.All(ctx, &entries))
+	suite.Len(entries, 2)
+	for _, entry := range entries {
+		suite.Equal(suite.adminId, entry.ActorID)
+	}
+	suite.Equal("users.suspend", entries[0].Action)
+	suite.Equal("/admin/users/:id/suspend", entries[0].Route)
+
+	// newest first, pages continue before the last entry
+	code, body = suite.request("GET", "/admin/audit?targetId=testId&limit=1", suite.adminId, nil)
+	suite.Equal(fiber.StatusOK, code, string(body))
+	var page []audit.EntryDB
+	suite.NoError(json.Unmarshal(body, &page))
+	suite.Len(page, 1)
+	suite.Equal("users.unsuspend", page[0].Action)
+	code, body = suite.request("GET", "/admin/audit?targetId=testId&before="+page[0].ID.Hex(), suite.adminId, nil)
+	suite.Equal(fiber.StatusOK, code, string(body))
+	suite.NoError(json.Unmarshal(body, &page))
+	suite.Len(page, 1)
+	suite.Equal("users.suspend", page[0].Action)
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestAdminTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
@@ -0,0 +1,278 @@
+package admin
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/audit"
+	"cmd/http/main.go/internal/auth"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Controller struct {
+	userStorage     *user.Storage
+	settingsStorage *settings.Storage
+	progressStorage *progress.Storage
+	auditStorage    *audit.Storage
+}
+
+func NewController(userStorage *user.Storage, settingsStorage *settings.Storage, progressStorage *progress.Storage, auditStorage *audit.Storage) *Controller {
+	return &Controller{
+		userStorage:     userStorage,
+		settingsStorage: settingsStorage,
+		progressStorage: progressStorage,
+		auditStorage:    auditStorage,
+	}
+}
+
+// users of a search page
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+const maxReasonLength = 500
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (r *SuspendUserRequest) Validate() error {
+	r.Reason = strings.TrimSpace(r.Reason)
+
+	var errs validation.Errors
+	errs.Check(r.Reason != "" && len(r.Reason) <= maxReasonLength, "reason", "must be between 1 and %d characters", maxReasonLength)
+	return errs.Err()
+}
+
+type UpdateRoleRequest struct {
+	Role auth.Role `json:"role"`
+}
+
+func (r UpdateRoleRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(r.Role.IsValid(), "role", "must be one of %s, %s, %s", auth.RoleUser, auth.RoleCoach, auth.RoleAdmin)
+	return errs.Err()
+}
+
+// record adds the request of an admin to the audit log, the request fails if
+// it cannot be recorded
+func (t *Controller) record(c *fiber.Ctx, action string, targetId string) error {
+	entry := audit.EntryDB{
+		ActorID:  string(c.Request().Header.Peek("userId")),
+		TargetID: targetId,
+		Action:   action,
+		Method:   c.Method(),
+		Route:    c.Route().Path,
+	}
+	if targetId != "" {
+		entry.EntityType = "user"
+		entry.EntityID = targetId
+	}
+	return t.auditStorage.Record(entry, c.UserContext())
+}
+
+// target returns the user of the id param
+func (t *Controller) target(c *fiber.Ctx) (user.UserDB, error) {
+	return t.userStorage.Get(c.Params("id"), c.UserContext())
+}
+
+// @Summary Search users
+// @Description Users whose name, email or id contains the query, sorted by id.
+// @Tags admin
+// @Param query query string false "part of the name, email or id"
+// @Param limit query int false "users per page, defaults to 20, at most 100"
+// @Param offset query int false "users to skip"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []user.UserDB
+// @Router /admin/users [get]
+func (t *Controller) searchUsers(c *fiber.Ctx) error {
+	query := strings.TrimSpace(c.Query("query"))
+	limit := c.QueryInt("limit", defaultLimit)
+	offset := c.QueryInt("offset", 0)
+
+	var errs validation.Errors
+	errs.Check(validation.InRange(int64(limit), 1, maxLimit), "limit", "must be between 1 and %d", maxLimit)
+	errs.Check(offset >= 0, "offset", "must not be negative")
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	if err := t.record(c, "users.search", ""); err != nil {
+		return err
+	}
+	users, err := t.userStorage.Search(query, int64(limit), int64(offset), c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(users)
+}
+
+// @Summary Suspend a user
+// @Description Suspended users cannot use the api until they are unsuspended.
+// @Tags admin
+// @Accept json
+// @Param id path string true "User ID of the suspended user"
+// @Param suspension body SuspendUserRequest true "reason"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} user.UserDB
+// @Router /admin/users/{id}/suspend [post]
+func (t *Controller) suspend(c *fiber.Ctx) error {
+	req := validation.Parsed[SuspendUserRequest](c)
+
+	if c.Params("id") == string(c.Request().Header.Peek("userId")) {
+		return apperror.Conflict("admins cannot suspend themselves")
+	}
+	if _, err := t.target(c); err != nil {
+		return err
+	}
+
+	if err := t.record(c, "users.suspend", c.Params("id")); err != nil {
+		return err
+	}
+	suspended, err := t.userStorage.Suspend(c.Params("id"), req.Reason, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(suspended)
+}
+
+// @Summary Unsuspend a user
+// @Tags admin
+// @Param id path string true "User ID of the suspended user"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} user.UserDB
+// @Router /admin/users/{id}/unsuspend [post]
+func (t *Controller) unsuspend(c *fiber.Ctx) error {
+	if _, err := t.target(c); err != nil {
+		return err
+	}
+
+	if err := t.record(c, "users.unsuspend", c.Params("id")); err != nil {
+		return err
+	}
+	unsuspended, err := t.userStorage.Unsuspend(c.Params("id"), c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(unsuspended)
+}
+
+// @Summary Change the role of a user
+// @Tags admin
+// @Accept json
+// @Param id path string true "User ID"
+// @Param role body UpdateRoleRequest true "new role"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} user.UserDB
+// @Router /admin/users/{id}/role [put]
+func (t *Controller) updateRole(c *fiber.Ctx) error {
+	req := validation.Parsed[UpdateRoleRequest](c)
+
+	// an admin that removes its own role could lock everyone out
+	if c.Params("id") == string(c.Request().Header.Peek("userId")) {
+		return apperror.Conflict("admins cannot change their own role")
+	}
+	if _, err := t.target(c); err != nil {
+		return err
+	}
+
+	if err := t.record(c, "users.role."+string(req.Role), c.Params("id")); err != nil {
+		return err
+	}
+	updated, err := t.userStorage.SetRole(c.Params("id"), req.Role, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(updated)
+}
+
+// @Summary Get the settings of a user
+// @Tags admin
+// @Param id path string true "User ID"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} settings.SettingsDB
+// @Router /admin/users/{id}/settings [get]
+func (t *Controller) getSettings(c *fiber.Ctx) error {
+	if err := t.record(c, "settings.read", c.Params("id")); err != nil {
+		return err
+	}
+	userSettings, err := t.settingsStorage.Get(c.Params("id"), "", c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(userSettings)
+}
+
+// @Summary Get the progress of a user
+// @Tags admin
+// @Param id path string true "User ID"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} progress.Response
+// @Router /admin/users/{id}/progress [get]
+func (t *Controller) getProgress(c *fiber.Ctx) error {
+	if err := t.record(c, "progress.read", c.Params("id")); err != nil {
+		return err
+	}
+	userProgress, err := t.progressStorage.Get(c.Params("id"), c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(userProgress)
+}
+
+// @Summary Get the audit log
+// @Description Entries of changes and admin requests, newest first. All filters are optional.
+// @Tags admin
+// @Param actorId query string false "User ID of the user that made the change"
+// @Param targetId query string false "User ID of the changed user"
+// @Param entityType query string false "like settings, user or friendship"
+// @Param entityId query string false "ID of the changed entity"
+// @Param action query string false "like settings.update"
+// @Param before query string false "id of the last entry of the previous page"
+// @Param limit query int false "entries of a page, defaults to 20, at most 100"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []audit.EntryDB
+// @Router /admin/audit [get]
+func (t *Controller) getAudit(c *fiber.Ctx) error {
+	query := audit.Query{
+		ActorID:    c.Query("actorId"),
+		TargetID:   c.Query("targetId"),
+		EntityType: c.Query("entityType"),
+		EntityID:   c.Query("entityId"),
+		Action:     c.Query("action"),
+		Limit:      int64(c.QueryInt("limit", defaultLimit)),
+	}
+
+	var errs validation.Errors
+	errs.Check(validation.InRange(query.Limit, 1, maxLimit), "limit", "must be between 1 and %d", maxLimit)
+	if before := c.Query("before"); before != "" {
+		id, err := primitive.ObjectIDFromHex(before)
+		errs.Check(err == nil, "before", "must be the id of an entry")
+		query.Before = id
+	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	if err := t.record(c, "audit.read", query.TargetID); err != nil {
+		return err
+	}
+	entries, err := t.auditStorage.Find(query, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(entries)
+}
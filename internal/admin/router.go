@@ -0,0 +1,25 @@
+package admin
+
+import (
+	"cmd/http/main.go/internal/auth"
+	"cmd/http/main.go/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// every route checks its permission, callers without one are forbidden
+func Routes(app fiber.Router, controller *Controller) {
+	admin := app.Group("/admin")
+	accounts := controller.userStorage
+
+	// add middlewares here
+
+	// add routes here
+	admin.Get("/users", auth.Require(accounts, auth.PermissionListUsers), controller.searchUsers)
+	admin.Post("/users/:id/suspend", auth.Require(accounts, auth.PermissionSuspendUsers), validation.Body[SuspendUserRequest](), controller.suspend)
+	admin.Post("/users/:id/unsuspend", auth.Require(accounts, auth.PermissionSuspendUsers), controller.unsuspend)
+	admin.Put("/users/:id/role", auth.Require(accounts, auth.PermissionManageRoles), validation.Body[UpdateRoleRequest](), controller.updateRole)
+	admin.Get("/users/:id/settings", auth.Require(accounts, auth.PermissionReadSettings), controller.getSettings)
+	admin.Get("/users/:id/progress", auth.Require(accounts, auth.PermissionReadProgress), controller.getProgress)
+	admin.Get("/audit", auth.Require(accounts, auth.PermissionReadAudit), controller.getAudit)
+}
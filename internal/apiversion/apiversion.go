@@ -0,0 +1,89 @@
+package apiversion
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// V1 is the current version, routes are mounted under /v1
+const V1 = "v1"
+
+// clients may ask for a version with this header, e.g. "Accept-Version: v1"
+const HeaderAcceptVersion = "Accept-Version"
+
+// the version that served the request is echoed in this header
+const HeaderAPIVersion = "API-Version"
+
+// UnversionedDeprecatedAt is when the unversioned paths were deprecated in favour of /v1
+var UnversionedDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// Negotiate is the middleware of a versioned group. A request asking
+// for another version with the Accept-Version header is not acceptable.
+func Negotiate(version string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := accept(c, version); err != nil {
+			return err
+		}
+		c.Set(HeaderAPIVersion, version)
+		return c.Next()
+	}
+}
+
+// Legacy serves the unversioned paths as aliases of the successor version.
+// Responses carry Deprecation, Sunset and successor Link headers, after the
+// sunset (if set) the aliases are gone. The group must be mounted after the
+// versioned one.
+func Legacy(successor string, sunset time.Time) fiber.Handler {
+	versionPrefix := "/" + successor + "/"
+	return func(c *fiber.Ctx) error {
+		// the aliases are mounted last, a versioned request that gets here matched
+		// no route and must not run the middleware of the aliases
+		if strings.HasPrefix(c.Path()+"/", versionPrefix) {
+			return fiber.NewError(fiber.StatusNotFound, "Cannot "+c.Method()+" "+html.EscapeString(c.Path()))
+		}
+
+		successorPath := "/" + successor + c.Path()
+		if !sunset.IsZero() && time.Now().After(sunset) {
+			return fiber.NewError(fiber.StatusGone, "Unversioned paths are gone, use "+successorPath)
+		}
+
+		if err := accept(c, successor); err != nil {
+			return err
+		}
+
+		c.Set("Deprecation", fmt.Sprintf("@%d", UnversionedDeprecatedAt.Unix()))
+		if !sunset.IsZero() {
+			c.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Append(fiber.HeaderLink, fmt.Sprintf(`<%s>; rel="successor-version"`, successorPath))
+		c.Set(HeaderAPIVersion, successor)
+		return c.Next()
+	}
+}
+
+// Unversioned returns a route path without its version prefix, so a route
+// and its legacy alias have the same path
+func Unversioned(path string) string {
+	prefix := "/" + V1
+	if path == prefix {
+		return "/"
+	}
+	if strings.HasPrefix(path, prefix+"/") {
+		return path[len(prefix):]
+	}
+	return path
+}
+
+// accept checks the Accept-Version header, "v1" and "1" both ask for v1
+func accept(c *fiber.Ctx, version string) error {
+	requested := c.Get(HeaderAcceptVersion)
+	if requested == "" || requested == version || "v"+requested == version {
+		return nil
+	}
+	return fiber.NewError(fiber.StatusNotAcceptable, "Unsupported API version "+requested+", supported is "+version)
+}
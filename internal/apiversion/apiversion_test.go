@@ -0,0 +1,141 @@
+package apiversion
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type Suite struct {
+	suite.Suite
+}
+
+// builds an app like main does, with an optional sunset for the legacy paths
+func newApp(sunset time.Time) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	mount := func(router fiber.Router) {
+		// like the limiter, counts the requests it runs for
+		router.Use(func(c *fiber.Ctx) error {
+			runs, _ := c.Locals("runs").(int)
+			c.Locals("runs", runs+1)
+			c.Set("Mounted-Middleware", strconv.Itoa(runs+1))
+			return c.Next()
+		})
+		router.Group("/users").Get("/", func(c *fiber.Ctx) error {
+			return c.SendString("users")
+		})
+	}
+	mount(app.Group("/"+V1, Negotiate(V1)))
+	mount(app.Group("/", Legacy(V1, sunset)))
+	return app
+}
+
+func (suite *Suite) TestVersions() {
+	tests := []struct {
+		description        string
+		sunset             time.Time
+		route              string
+		acceptVersion      string
+		expectedCode       int
+		expectDeprecation  bool
+		expectedSunset     string
+		expectedSuccessors string
+	}{
+		{
+			description:  "versioned route",
+			route:        "/v1/users",
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:   "versioned route with matching version",
+			route:         "/v1/users",
+			acceptVersion: "1",
+			expectedCode:  fiber.StatusOK,
+		},
+		{
+			description:   "versioned route with unknown version",
+			route:         "/v1/users",
+			acceptVersion: "v2",
+			expectedCode:  fiber.StatusNotAcceptable,
+		},
+		{
+			description:        "legacy alias without sunset",
+			route:              "/users",
+			expectedCode:       fiber.StatusOK,
+			expectDeprecation:  true,
+			expectedSuccessors: `</v1/users>; rel="successor-version"`,
+		},
+		{
+			description:        "legacy alias with upcoming sunset",
+			sunset:             time.Date(2999, time.January, 1, 0, 0, 0, 0, time.UTC),
+			route:              "/users",
+			expectedCode:       fiber.StatusOK,
+			expectDeprecation:  true,
+			expectedSunset:     "Tue, 01 Jan 2999 00:00:00 GMT",
+			expectedSuccessors: `</v1/users>; rel="successor-version"`,
+		},
+		{
+			description:  "legacy alias after sunset",
+			sunset:       time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+			route:        "/users",
+			expectedCode: fiber.StatusGone,
+		},
+	}
+
+	for _, test := range tests {
+		app := newApp(test.sunset)
+		req := httptest.NewRequest("GET", test.route, nil)
+		if test.acceptVersion != "" {
+			req.Header.Set(HeaderAcceptVersion, test.acceptVersion)
+		}
+
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, test.description)
+		suite.Equal(test.expectDeprecation, resp.Header.Get("Deprecation") != "", test.description)
+		suite.Equal(test.expectedSunset, resp.Header.Get("Sunset"), test.description)
+		suite.Equal(test.expectedSuccessors, resp.Header.Get(fiber.HeaderLink), test.description)
+		if resp.StatusCode == fiber.StatusOK {
+			suite.Equal(V1, resp.Header.Get(HeaderAPIVersion), test.description)
+		}
+	}
+}
+
+func (suite *Suite) TestVersionedMiss() {
+	app := newApp(time.Time{})
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/missing", nil), -1)
+	suite.NoError(err)
+	suite.Equal(fiber.StatusNotFound, resp.StatusCode)
+	suite.Empty(resp.Header.Get("Deprecation"))
+	// only the middleware of the versioned group ran
+	suite.Equal("1", resp.Header.Get("Mounted-Middleware"))
+}
+
+func TestUnversioned(t *testing.T) {
+	tests := map[string]string{
+		"/v1/sleep/":         "/sleep/",
+		"/sleep/":            "/sleep/",
+		"/v1":                "/",
+		"/v10/sleep":         "/v10/sleep",
+		"/v1/challenges/:id": "/challenges/:id",
+	}
+	for path, expected := range tests {
+		if unversioned := Unversioned(path); unversioned != expected {
+			t.Errorf("%s: got %q, want %q", path, unversioned, expected)
+		}
+	}
+}
+
+func TestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
@@ -0,0 +1,114 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Suite struct {
+	suite.Suite
+	app *fiber.App
+}
+
+func (suite *Suite) SetupSuite() {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: ErrorHandler,
+	})
+
+	app.Get("/not-found", func(c *fiber.Ctx) error {
+		return fmt.Errorf("wrapped: %w", FromMongo(mongo.ErrNoDocuments, "user"))
+	})
+	app.Get("/validation", func(c *fiber.Ctx) error {
+		return Validation("Missing userId header")
+	})
+	app.Get("/fields", func(c *fiber.Ctx) error {
+		return InvalidFields([]FieldError{{Field: "email", Message: "must be a valid email address"}})
+	})
+	app.Get("/raw", func(c *fiber.Ctx) error {
+		return errors.New("connection refused on 10.0.0.1")
+	})
+
+	suite.app = app
+}
+
+func (suite *Suite) TestErrorHandler() {
+	tests := []struct {
+		description    string
+		route          string
+		expectedCode   int
+		expectedType   string
+		expectedDetail string
+		expectedFields int
+	}{
+		{
+			description:    "domain error is unwrapped",
+			route:          "/not-found",
+			expectedCode:   fiber.StatusNotFound,
+			expectedType:   "/problems/not-found",
+			expectedDetail: "user does not exist",
+		},
+		{
+			description:    "validation error",
+			route:          "/validation",
+			expectedCode:   fiber.StatusBadRequest,
+			expectedType:   "/problems/validation",
+			expectedDetail: "Missing userId header",
+		},
+		{
+			description:    "field errors are listed",
+			route:          "/fields",
+			expectedCode:   fiber.StatusBadRequest,
+			expectedType:   "/problems/validation",
+			expectedDetail: "Invalid request body",
+			expectedFields: 1,
+		},
+		{
+			description:    "raw errors are not leaked",
+			route:          "/raw",
+			expectedCode:   fiber.StatusInternalServerError,
+			expectedType:   "about:blank",
+			expectedDetail: "Something went wrong",
+		},
+		{
+			description:    "fiber errors keep their status",
+			route:          "/unknown-route",
+			expectedCode:   fiber.StatusNotFound,
+			expectedType:   "about:blank",
+			expectedDetail: "Cannot GET /unknown-route",
+		},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.route, nil)
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			suite.T().Errorf("Could not read body: %v", err)
+		}
+
+		var problem Problem
+		suite.NoError(json.Unmarshal(body, &problem), test.description)
+		suite.Equal(test.expectedCode, resp.StatusCode, test.description)
+		suite.Equal(MIMEProblemJSON, resp.Header.Get(fiber.HeaderContentType), test.description)
+		suite.Equal(test.expectedCode, problem.Status, test.description)
+		suite.Equal(test.expectedType, problem.Type, test.description)
+		suite.Equal(test.expectedDetail, problem.Detail, test.description)
+		suite.Equal(test.route, problem.Instance, test.description)
+		suite.Len(problem.Errors, test.expectedFields, test.description)
+	}
+}
+
+func TestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
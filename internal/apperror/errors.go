@@ -0,0 +1,116 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Kind classifies a domain error, the error handler maps it to a status code
+type Kind string
+
+const (
+	KindInternal      Kind = "internal"
+	KindNotFound      Kind = "not-found"
+	KindConflict      Kind = "conflict"
+	KindValidation    Kind = "validation"
+	KindUnauthorized  Kind = "unauthorized"
+	KindForbidden     Kind = "forbidden"
+	KindUnprocessable Kind = "unprocessable"
+	KindRateLimited   Kind = "rate-limited"
+)
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is returned by storages and controllers for every expected failure.
+// Message and Fields are safe to show to clients, Err is only kept for logging.
+type Error struct {
+	Kind    Kind
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NotFound(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func Conflict(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+func Validation(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindValidation, Message: fmt.Sprintf(format, args...)}
+}
+
+// InvalidFields is a validation error carrying the offending fields
+func InvalidFields(fields []FieldError) *Error {
+	return &Error{Kind: KindValidation, Message: "Invalid request body", Fields: fields}
+}
+
+// Unauthorized is for requests without a known caller
+func Unauthorized(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindUnauthorized, Message: fmt.Sprintf(format, args...)}
+}
+
+func Forbidden(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+func Unprocessable(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindUnprocessable, Message: fmt.Sprintf(format, args...)}
+}
+
+// RateLimited is for callers that used up their requests for now
+func RateLimited(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindRateLimited, Message: fmt.Sprintf(format, args...)}
+}
+
+// Internal wraps an unexpected error, the client only sees the message
+func Internal(message string, err error) *Error {
+	return &Error{Kind: KindInternal, Message: message, Err: err}
+}
+
+// KindOf returns the kind of the first *Error in the chain or KindInternal
+func KindOf(err error) Kind {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Kind
+	}
+	return KindInternal
+}
+
+func IsNotFound(err error) bool {
+	return KindOf(err) == KindNotFound
+}
+
+// FromMongo translates driver errors into domain errors for the given entity,
+// e.g. FromMongo(err, "user") turns mongo.ErrNoDocuments into "user does not exist"
+func FromMongo(err error, entity string) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &Error{Kind: KindNotFound, Message: entity + " does not exist", Err: err}
+	case mongo.IsDuplicateKeyError(err):
+		return &Error{Kind: KindConflict, Message: entity + " already exists", Err: err}
+	default:
+		return Internal("Failed to access "+entity, err)
+	}
+}
@@ -0,0 +1,69 @@
+package apperror
+
+import (
+	"cmd/http/main.go/internal/logging"
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const MIMEProblemJSON = "application/problem+json"
+
+// Problem is the RFC 7807 body written for every failed request
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Errors lists the rejected fields of a validation problem
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+var kindToStatus = map[Kind]int{
+	KindInternal:     fiber.StatusInternalServerError,
+	KindNotFound:     fiber.StatusNotFound,
+	KindConflict:     fiber.StatusConflict,
+	KindValidation:   fiber.StatusBadRequest,
+	KindUnauthorized: fiber.StatusUnauthorized,
+	KindForbidden:    fiber.StatusForbidden,
+	// well-formed but not processable, e.g. a reused idempotency key
+	KindUnprocessable: fiber.StatusUnprocessableEntity,
+	KindRateLimited:   fiber.StatusTooManyRequests,
+}
+
+// ErrorHandler is the central fiber error handler, controllers just return errors
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	problem := Problem{
+		Type:     "about:blank",
+		Status:   fiber.StatusInternalServerError,
+		Instance: c.OriginalURL(),
+	}
+
+	var appErr *Error
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &appErr):
+		problem.Type = "/problems/" + string(appErr.Kind)
+		problem.Status = kindToStatus[appErr.Kind]
+		problem.Detail = appErr.Message
+		problem.Errors = appErr.Fields
+		if appErr.Kind == KindInternal {
+			logging.FromContext(c.UserContext()).Error("request failed", "error", err)
+		}
+	case errors.As(err, &fiberErr):
+		problem.Status = fiberErr.Code
+		problem.Detail = fiberErr.Message
+	default:
+		logging.FromContext(c.UserContext()).Error("request failed", "error", err)
+		problem.Detail = "Something went wrong"
+	}
+	problem.Title = http.StatusText(problem.Status)
+
+	if err := c.Status(problem.Status).JSON(problem); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, MIMEProblemJSON)
+	return nil
+}
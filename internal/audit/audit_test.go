@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/logging"
+	"cmd/http/main.go/internal/storage"
+	"context"
+	"log"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Suite struct {
+	suite.Suite
+	app   *fiber.App
+	store *Storage
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-audit"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	suite.store = NewStorage(db, time.Hour)
+	app.Use(Recorder(suite.store))
+	app.Put("/things/:id", func(c *fiber.Ctx) error {
+		Log(c, EntryDB{TargetID: "testId", Action: "things.update", EntityType: "thing", EntityID: c.Params("id")})
+		if c.Params("id") == "missing" {
+			return apperror.NotFound("thing does not exist")
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	if err := suite.store.db.Collection("audit").Drop(context.Background()); err != nil {
+		log.Println("Error: ", err)
+	}
+	if err := suite.store.EnsureIndexes(context.Background()); err != nil {
+		log.Println("Error: ", err)
+	}
+}
+
+func (suite *Suite) request(route string) int {
+	req := httptest.NewRequest("PUT", route, nil)
+	req.Header.Set("userId", "actorId")
+	resp, err := suite.app.Test(req, -1)
+	if err != nil {
+		suite.T().Errorf("Could not make request: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func (suite *Suite) TestRecorder() {
+	ctx := context.Background()
+
+	suite.Equal(fiber.StatusOK, suite.request("/things/1"))
+	suite.Equal(fiber.StatusNotFound, suite.request("/things/missing"))
+
+	// only the successful request is recorded
+	entries, err := suite.store.Find(Query{TargetID: "testId", Limit: 10}, ctx)
+	suite.NoError(err)
+	suite.Len(entries, 1)
+	suite.Equal("actorId", entries[0].ActorID)
+	suite.Equal("PUT", entries[0].Method)
+	suite.Equal("/things/:id", entries[0].Route)
+	suite.Equal("1", entries[0].EntityID)
+
+	// entries expire after the retention
+	var entry EntryDB
+	suite.NoError(suite.store.db.Collection("audit").FindOne(ctx, bson.M{"entityId": "1"}).Decode(&entry))
+	suite.WithinDuration(time.Unix(entry.Time, 0).Add(time.Hour), entry.ExpiresAt, time.Second)
+}
+
+func TestDiff(t *testing.T) {
+	type settings struct {
+		Goal    int  `json:"goal"`
+		Notify  bool `json:"notify"`
+		Nested  struct{ Amount float64 }
+		Plugins []string `json:"plugins"`
+	}
+	before := settings{Goal: 10, Notify: true, Plugins: []string{"meditation"}}
+	after := before
+	after.Goal = 20
+	after.Nested.Amount = 1.5
+	after.Plugins = []string{"meditation", "finance"}
+
+	expected := []Change{
+		{Field: "Nested.Amount", Before: 0.0, After: 1.5},
+		{Field: "goal", Before: 10.0, After: 20.0},
+		{Field: "plugins", Before: []interface{}{"meditation"}, After: []interface{}{"meditation", "finance"}},
+	}
+	if changes := Diff(before, after); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("got %v, want %v", changes, expected)
+	}
+
+	// a deleted entity has no fields after
+	var deleted *settings
+	for _, change := range Diff(&before, deleted) {
+		if change.After != nil {
+			t.Errorf("field %s of a deleted entity is %v", change.Field, change.After)
+		}
+	}
+	if changes := Diff(before, before); len(changes) != 0 {
+		t.Errorf("got %v for an unchanged entity", changes)
+	}
+
+	// personal fields only record that they changed
+	type profile struct {
+		FirstName string `json:"firstName"`
+		Contact   struct {
+			Email string `json:"email"`
+		} `json:"contact"`
+		DateOfBirth string `json:"dateOfBirth,omitempty"`
+		Locale      string `json:"locale"`
+	}
+	oldProfile := profile{FirstName: "Jane", Locale: "en"}
+	oldProfile.Contact.Email = "jane@example.com"
+	newProfile := profile{FirstName: "Janet", DateOfBirth: "1990-01-31", Locale: "de"}
+	newProfile.Contact.Email = "janet@example.com"
+
+	expected = []Change{
+		{Field: "contact.email", Before: logging.Redacted, After: logging.Redacted},
+		{Field: "dateOfBirth", After: logging.Redacted},
+		{Field: "firstName", Before: logging.Redacted, After: logging.Redacted},
+		{Field: "locale", Before: "en", After: "de"},
+	}
+	if changes := Diff(oldProfile, newProfile); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("got %v, want %v", changes, expected)
+	}
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestAuditTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"cmd/http/main.go/internal/logging"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is a field of an entity before and after a request, nil if it was
+// missing
+type Change struct {
+	// path of the field in the json of the entity, like meditation.meditationTime
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+// Diff returns the changed fields of two versions of an entity by their json,
+// nil is an entity that does not exist. Arrays are compared as a whole.
+// Personal fields like the email only record that they changed.
+func Diff(before interface{}, after interface{}) []Change {
+	beforeFields, afterFields := fields(before), fields(after)
+
+	changes := make([]Change, 0)
+	for field, value := range beforeFields {
+		if other, ok := afterFields[field]; !ok || !reflect.DeepEqual(value, other) {
+			changes = append(changes, redact(Change{Field: field, Before: value, After: other}))
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes = append(changes, redact(Change{Field: field, After: value}))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// fields flattens the json of value to the paths of its fields
+func fields(value interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	if value == nil {
+		return flat
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return flat
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return flat
+	}
+	flatten("", decoded, flat)
+	return flat
+}
+
+func flatten(prefix string, value interface{}, flat map[string]interface{}) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		if value != nil {
+			flat[prefix] = value
+		}
+		return
+	}
+	for key, field := range object {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flatten(key, field, flat)
+	}
+}
+
+// redact replaces the values of a personal field, a missing value stays nil
+func redact(change Change) Change {
+	name := change.Field[strings.LastIndex(change.Field, ".")+1:]
+	if !logging.Personal(name) {
+		return change
+	}
+	if change.Before != nil {
+		change.Before = logging.Redacted
+	}
+	if change.After != nil {
+		change.After = logging.Redacted
+	}
+	return change
+}
@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"cmd/http/main.go/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const pendingKey = "audit.pending"
+
+// Log adds entry to the audit log once the request succeeded, the actor,
+// method and route are the ones of the request
+func Log(c *fiber.Ctx, entry EntryDB) {
+	entries, _ := c.Locals(pendingKey).([]EntryDB)
+	c.Locals(pendingKey, append(entries, entry))
+}
+
+// Recorder writes the entries a handler logged after it succeeded. The change
+// is done at that point, so an entry that cannot be written is only reported.
+func Recorder(storage *Storage) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if err != nil || c.Response().StatusCode() >= fiber.StatusBadRequest {
+			return err
+		}
+
+		entries, _ := c.Locals(pendingKey).([]EntryDB)
+		for _, entry := range entries {
+			entry.ActorID = string(c.Request().Header.Peek("userId"))
+			entry.Method = c.Method()
+			entry.Route = c.Route().Path
+			if err := storage.Record(entry, c.UserContext()); err != nil {
+				logging.FromContext(c.UserContext()).Error("could not record audit entry", "action", entry.Action, "targetId", entry.TargetID, "error", err)
+			}
+		}
+		return nil
+	}
+}
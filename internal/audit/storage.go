@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EntryDB records who did what to which user
+type EntryDB struct {
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// unix seconds
+	Time     int64  `json:"time" bson:"time"`
+	ActorID  string `json:"actorId" bson:"actorId"`
+	TargetID string `json:"targetId,omitempty" bson:"targetId,omitempty"`
+	// like users.suspend
+	Action string `json:"action" bson:"action"`
+	Method string `json:"method" bson:"method"`
+	Route  string `json:"route" bson:"route"`
+	// the changed entity, like settings of the target
+	EntityType string `json:"entityType,omitempty" bson:"entityType,omitempty"`
+	EntityID   string `json:"entityId,omitempty" bson:"entityId,omitempty"`
+	// the changed fields, a deleted entity only has its id
+	Changes []Change `json:"changes,omitempty" bson:"changes,omitempty"`
+	// the entry is removed after the retention
+	ExpiresAt time.Time `json:"-" bson:"expiresAt"`
+}
+
+type Storage struct {
+	db *mongo.Database
+	// how long entries are kept
+	retention time.Duration
+}
+
+func NewStorage(db *mongo.Database, retention time.Duration) *Storage {
+	return &Storage{
+		db:        db,
+		retention: retention,
+	}
+}
+
+// EnsureIndexes creates the indexes of the queries and the retention, a new
+// retention applies to new entries only
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	collection := s.db.Collection("audit")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "targetId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "entityType", Value: 1}, {Key: "entityId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Record appends an entry, entries are never changed
+func (s *Storage) Record(entry EntryDB, ctx context.Context) error {
+	collection := s.db.Collection("audit")
+
+	entry.ID = primitive.NewObjectID()
+	if entry.Time == 0 {
+		entry.Time = time.Now().Unix()
+	}
+	entry.ExpiresAt = time.Unix(entry.Time, 0).Add(s.retention)
+	if _, err := collection.InsertOne(ctx, entry); err != nil {
+		return apperror.FromMongo(err, "audit entry")
+	}
+	return nil
+}
+
+// Query filters the entries, empty fields match all entries
+type Query struct {
+	ActorID    string
+	TargetID   string
+	EntityType string
+	EntityID   string
+	Action     string
+	// only entries older than this entry, for the next page
+	Before primitive.ObjectID
+	Limit  int64
+}
+
+// Find returns the entries of query, newest first
+func (s *Storage) Find(query Query, ctx context.Context) ([]EntryDB, error) {
+	collection := s.db.Collection("audit")
+
+	filter := bson.M{}
+	for field, value := range map[string]string{
+		"actorId":    query.ActorID,
+		"targetId":   query.TargetID,
+		"entityType": query.EntityType,
+		"entityId":   query.EntityID,
+		"action":     query.Action,
+	} {
+		if value != "" {
+			filter[field] = value
+		}
+	}
+	if !query.Before.IsZero() {
+		filter["_id"] = bson.M{"$lt": query.Before}
+	}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(query.Limit))
+	if err != nil {
+		return nil, apperror.FromMongo(err, "audit entries")
+	}
+	entries := make([]EntryDB, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, apperror.FromMongo(err, "audit entries")
+	}
+	return entries, nil
+}
@@ -0,0 +1,167 @@
+// Package auth checks what the caller of a request may do. The caller is the
+// user of the userId header, its role grants permissions. The header is not
+// authenticated here, roles are only trusted behind a gateway that sets it,
+// see WithoutRoles.
+package auth
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Role string
+
+const (
+	RoleUser Role = "user"
+	// follows the progress of users
+	RoleCoach Role = "coach"
+	RoleAdmin Role = "admin"
+)
+
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+type Permission string
+
+const (
+	// list and search users with their email and birth date
+	PermissionListUsers    Permission = "users:list"
+	PermissionDeleteUsers  Permission = "users:delete"
+	PermissionSuspendUsers Permission = "users:suspend"
+	PermissionManageRoles  Permission = "users:roles"
+	// of any user
+	PermissionReadSettings Permission = "settings:read"
+	PermissionReadProgress Permission = "progress:read"
+	// the audit log of all users
+	PermissionReadAudit Permission = "audit:read"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:  {},
+	RoleCoach: {PermissionReadProgress},
+	RoleAdmin: {
+		PermissionListUsers,
+		PermissionDeleteUsers,
+		PermissionSuspendUsers,
+		PermissionManageRoles,
+		PermissionReadSettings,
+		PermissionReadProgress,
+		PermissionReadAudit,
+	},
+}
+
+// Can checks if the role grants permission
+func (r Role) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Account is what the checks need to know of a user
+type Account struct {
+	Role      Role
+	Suspended bool
+}
+
+// Accounts looks up the account of a user, unknown users are not found
+type Accounts interface {
+	Account(userId string, ctx context.Context) (Account, error)
+}
+
+// withoutRoles reports every account with the role user
+type withoutRoles struct {
+	accounts Accounts
+}
+
+func (w withoutRoles) Account(userId string, ctx context.Context) (Account, error) {
+	account, err := w.accounts.Account(userId, ctx)
+	account.Role = RoleUser
+	return account, err
+}
+
+// WithoutRoles grants every caller only the permissions of a user, for
+// deployments where anyone can send the userId header of another user
+func WithoutRoles(accounts Accounts) Accounts {
+	return withoutRoles{accounts: accounts}
+}
+
+const accountKey = "auth.account"
+
+// caller returns the account of the caller, it is looked up once per request
+func caller(c *fiber.Ctx, accounts Accounts) (Account, error) {
+	if account, ok := c.Locals(accountKey).(Account); ok {
+		return account, nil
+	}
+
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return Account{}, apperror.Unauthorized("Missing userId header")
+	}
+	account, err := accounts.Account(userId, c.UserContext())
+	if apperror.IsNotFound(err) {
+		return account, apperror.Unauthorized("unknown user")
+	}
+	if err != nil {
+		return account, err
+	}
+	if account.Suspended {
+		return account, apperror.Forbidden("account is suspended")
+	}
+	c.Locals(accountKey, account)
+	return account, nil
+}
+
+// Known reports if a check before confirmed that the caller of the userId
+// header exists, like Active
+func Known(c *fiber.Ctx) bool {
+	_, ok := c.Locals(accountKey).(Account)
+	return ok
+}
+
+// Active rejects the requests of suspended users, requests without a known
+// caller are left to the routes
+func Active(accounts Accounts) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		_, err := caller(c, accounts)
+		if err != nil && apperror.KindOf(err) != apperror.KindUnauthorized {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// Require only lets callers with permission through
+func Require(accounts Accounts, permission Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		account, err := caller(c, accounts)
+		if err != nil {
+			return err
+		}
+		if !account.Role.Can(permission) {
+			return apperror.Forbidden("missing permission %s", permission)
+		}
+		return c.Next()
+	}
+}
+
+// RequireSelfOr lets callers through that are the user of the route param or
+// have permission
+func RequireSelfOr(accounts Accounts, permission Permission, param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		account, err := caller(c, accounts)
+		if err != nil {
+			return err
+		}
+		if c.Params(param) != string(c.Request().Header.Peek("userId")) && !account.Role.Can(permission) {
+			return apperror.Forbidden("missing permission %s", permission)
+		}
+		return c.Next()
+	}
+}
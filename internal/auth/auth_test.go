@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+// accounts is an in memory Accounts
+type accounts map[string]Account
+
+func (a accounts) Account(userId string, ctx context.Context) (Account, error) {
+	account, ok := a[userId]
+	if !ok {
+		return account, apperror.NotFound("user does not exist")
+	}
+	return account, nil
+}
+
+type Suite struct {
+	suite.Suite
+	app          *fiber.App
+	withoutRoles *fiber.App
+}
+
+func (suite *Suite) SetupSuite() {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	users := accounts{
+		"userId":      {Role: RoleUser},
+		"coachId":     {Role: RoleCoach},
+		"adminId":     {Role: RoleAdmin},
+		"suspendedId": {Role: RoleAdmin, Suspended: true},
+	}
+
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Use(Active(users))
+	app.Get("/open", ok)
+	app.Get("/progress", Require(users, PermissionReadProgress), ok)
+	app.Get("/users", Require(users, PermissionListUsers), ok)
+	app.Delete("/users/:id", RequireSelfOr(users, PermissionDeleteUsers, "id"), ok)
+
+	suite.app = app
+
+	// every check of a deployment without trusted roles uses the same accounts
+	untrusted := WithoutRoles(users)
+	withoutRoles := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	withoutRoles.Use(Active(untrusted))
+	withoutRoles.Get("/users", Require(untrusted, PermissionListUsers), ok)
+	withoutRoles.Delete("/users/:id", RequireSelfOr(untrusted, PermissionDeleteUsers, "id"), ok)
+	suite.withoutRoles = withoutRoles
+}
+
+func (suite *Suite) TestRequire() {
+	tests := []struct {
+		description  string
+		method       string
+		route        string
+		userId       string
+		expectedCode int
+	}{
+		{description: "Open route without caller", method: "GET", route: "/open", expectedCode: fiber.StatusOK},
+		{description: "Open route of unknown user", method: "GET", route: "/open", userId: "unknownId", expectedCode: fiber.StatusOK},
+		{description: "Suspended users are locked out", method: "GET", route: "/open", userId: "suspendedId", expectedCode: fiber.StatusForbidden},
+		{description: "Missing caller", method: "GET", route: "/users", expectedCode: fiber.StatusUnauthorized},
+		{description: "Unknown caller", method: "GET", route: "/users", userId: "unknownId", expectedCode: fiber.StatusUnauthorized},
+		{description: "Missing permission", method: "GET", route: "/users", userId: "coachId", expectedCode: fiber.StatusForbidden},
+		{description: "Admin lists users", method: "GET", route: "/users", userId: "adminId", expectedCode: fiber.StatusOK},
+		{description: "Coach reads progress", method: "GET", route: "/progress", userId: "coachId", expectedCode: fiber.StatusOK},
+		{description: "User cannot read progress", method: "GET", route: "/progress", userId: "userId", expectedCode: fiber.StatusForbidden},
+		{description: "User deletes itself", method: "DELETE", route: "/users/userId", userId: "userId", expectedCode: fiber.StatusOK},
+		{description: "User deletes another", method: "DELETE", route: "/users/coachId", userId: "userId", expectedCode: fiber.StatusForbidden},
+		{description: "Admin deletes another", method: "DELETE", route: "/users/coachId", userId: "adminId", expectedCode: fiber.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.route, nil)
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		}
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, test.description)
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+func (suite *Suite) TestWithoutRoles() {
+	tests := []struct {
+		description  string
+		method       string
+		route        string
+		userId       string
+		expectedCode int
+	}{
+		{description: "Admin cannot list users", method: "GET", route: "/users", userId: "adminId", expectedCode: fiber.StatusForbidden},
+		{description: "Admin cannot delete another", method: "DELETE", route: "/users/coachId", userId: "adminId", expectedCode: fiber.StatusForbidden},
+		{description: "User deletes itself", method: "DELETE", route: "/users/userId", userId: "userId", expectedCode: fiber.StatusOK},
+		{description: "Unknown caller", method: "GET", route: "/users", userId: "unknownId", expectedCode: fiber.StatusUnauthorized},
+		{description: "Suspended users are still locked out", method: "DELETE", route: "/users/suspendedId", userId: "suspendedId", expectedCode: fiber.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.route, nil)
+		req.Header.Set("userId", test.userId)
+		resp, err := suite.withoutRoles.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, test.description)
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+func TestAuthTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
@@ -0,0 +1,126 @@
+// Package calendar computes day, week and month boundaries in the time zone
+// of a user, so "today" means the day of the user and not the UTC day.
+package calendar
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/validation"
+	"strings"
+	"time"
+
+	// the production image has no zoneinfo
+	_ "time/tzdata"
+)
+
+// defaults for users without a time zone or week start
+const (
+	DefaultTimeZone  = "UTC"
+	DefaultWeekStart = time.Monday
+)
+
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodWeek  Period = "week"
+	PeriodMonth Period = "month"
+)
+
+func (p Period) IsValid() bool {
+	return p == PeriodDay || p == PeriodWeek || p == PeriodMonth
+}
+
+// Calendar is the time zone and week start of one user
+type Calendar struct {
+	Location  *time.Location
+	WeekStart time.Weekday
+}
+
+// New returns the calendar of a time zone (IANA name) and a week start
+// (weekday name), empty values fall back to the defaults
+func New(timeZone string, weekStart string) (Calendar, error) {
+	if timeZone == "" {
+		timeZone = DefaultTimeZone
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return Calendar{}, apperror.Validation("Unknown time zone %s", timeZone)
+	}
+
+	start := DefaultWeekStart
+	if weekStart != "" {
+		var ok bool
+		if start, ok = ParseWeekday(weekStart); !ok {
+			return Calendar{}, apperror.Validation("Unknown week start %s", weekStart)
+		}
+	}
+
+	return Calendar{Location: location, WeekStart: start}, nil
+}
+
+// IsTimeZone checks for an IANA time zone name like Europe/Berlin
+func IsTimeZone(value string) bool {
+	// LoadLocation treats "" and "Local" as the zone of the server
+	if value == "" || value == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(value)
+	return err == nil
+}
+
+// ParseWeekday parses an english weekday name like monday
+func ParseWeekday(value string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), value) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// StartOfDay returns midnight of the day of t
+func (c Calendar) StartOfDay(t time.Time) time.Time {
+	year, month, day := t.In(c.Location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, c.Location)
+}
+
+// Bounds returns the start of the period containing t and the start of the
+// next one. Days are calendar days, so they last 23 or 25 hours on DST changes.
+func (c Calendar) Bounds(period Period, t time.Time) (time.Time, time.Time) {
+	start := c.StartOfDay(t)
+	switch period {
+	case PeriodWeek:
+		offset := (int(start.Weekday()) - int(c.WeekStart) + 7) % 7
+		start = start.AddDate(0, 0, -offset)
+		return start, start.AddDate(0, 0, 7)
+	case PeriodMonth:
+		start = start.AddDate(0, 0, 1-start.Day())
+		return start, start.AddDate(0, 1, 0)
+	}
+	return start, start.AddDate(0, 0, 1)
+}
+
+// Range returns the first and last second (unix) of the period containing
+// date, an empty date is today
+func (c Calendar) Range(period Period, date string, now time.Time) (int64, int64, error) {
+	var errs validation.Errors
+	errs.Check(period.IsValid(), "period", "must be one of %s, %s, %s", PeriodDay, PeriodWeek, PeriodMonth)
+
+	at := now
+	if date != "" {
+		parsed, err := time.ParseInLocation(validation.DateLayout, date, c.Location)
+		errs.Check(err == nil, "date", "must be a date in the format %s", validation.DateLayout)
+		at = parsed
+	}
+	if err := errs.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	start, end := c.Bounds(period, at)
+	return start.Unix(), end.Unix() - 1, nil
+}
+
+// Date returns the day (validation.DateLayout) of a unix time, used to group by day
+func (c Calendar) Date(unix int64) string {
+	return time.Unix(unix, 0).In(c.Location).Format(validation.DateLayout)
+}
@@ -0,0 +1,111 @@
+package calendar
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type Suite struct {
+	suite.Suite
+}
+
+func (suite *Suite) TestBounds() {
+	berlin, err := New("Europe/Berlin", "")
+	suite.NoError(err)
+	newYork, err := New("America/New_York", "sunday")
+	suite.NoError(err)
+
+	tests := []struct {
+		description   string
+		calendar      Calendar
+		period        Period
+		at            string
+		expectedStart string
+		expectedEnd   string
+	}{
+		{
+			description:   "day",
+			calendar:      berlin,
+			period:        PeriodDay,
+			at:            "2023-05-10T23:30:00Z",
+			expectedStart: "2023-05-11T00:00:00+02:00",
+			expectedEnd:   "2023-05-12T00:00:00+02:00",
+		},
+		{
+			description:   "day with DST start has 23 hours",
+			calendar:      berlin,
+			period:        PeriodDay,
+			at:            "2023-03-26T12:00:00Z",
+			expectedStart: "2023-03-26T00:00:00+01:00",
+			expectedEnd:   "2023-03-27T00:00:00+02:00",
+		},
+		{
+			description:   "week starting monday",
+			calendar:      berlin,
+			period:        PeriodWeek,
+			at:            "2023-05-14T12:00:00Z",
+			expectedStart: "2023-05-08T00:00:00+02:00",
+			expectedEnd:   "2023-05-15T00:00:00+02:00",
+		},
+		{
+			description:   "week starting sunday",
+			calendar:      newYork,
+			period:        PeriodWeek,
+			at:            "2023-05-14T12:00:00Z",
+			expectedStart: "2023-05-14T00:00:00-04:00",
+			expectedEnd:   "2023-05-21T00:00:00-04:00",
+		},
+		{
+			description:   "month across DST end",
+			calendar:      newYork,
+			period:        PeriodMonth,
+			at:            "2023-11-30T12:00:00Z",
+			expectedStart: "2023-11-01T00:00:00-04:00",
+			expectedEnd:   "2023-12-01T00:00:00-05:00",
+		},
+	}
+
+	for _, test := range tests {
+		at, err := time.Parse(time.RFC3339, test.at)
+		suite.NoError(err)
+
+		start, end := test.calendar.Bounds(test.period, at)
+		suite.Equal(test.expectedStart, start.Format(time.RFC3339), test.description)
+		suite.Equal(test.expectedEnd, end.Format(time.RFC3339), test.description)
+	}
+}
+
+func (suite *Suite) TestRange() {
+	berlin, err := New("Europe/Berlin", "monday")
+	suite.NoError(err)
+
+	start, end, err := berlin.Range(PeriodDay, "2023-05-11", time.Now())
+	suite.NoError(err)
+	suite.Equal(int64(1683756000), start)
+	suite.Equal(int64(1683756000+24*60*60-1), end)
+
+	_, _, err = berlin.Range("year", "11.05.2023", time.Now())
+	suite.Equal(apperror.KindValidation, apperror.KindOf(err))
+}
+
+func (suite *Suite) TestNew() {
+	_, err := New("Mars/Olympus", "")
+	suite.Error(err)
+	_, err = New("", "someday")
+	suite.Error(err)
+
+	calendar, err := New("", "")
+	suite.NoError(err)
+	suite.Equal(DefaultTimeZone, calendar.Location.String())
+	suite.Equal(DefaultWeekStart, calendar.WeekStart)
+
+	suite.True(IsTimeZone("Asia/Kolkata"))
+	suite.False(IsTimeZone("Local"))
+}
+
+func TestCalendarTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
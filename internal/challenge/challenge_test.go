@@ -0,0 +1,300 @@
+package challenge
+
+import (
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/finance"
+	"cmd/http/main.go/internal/idempotency"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Suite struct {
+	suite.Suite
+	app           *fiber.App
+	store         *Storage
+	userStore     *user.Storage
+	elevatorStore *elevator.Storage
+	testUserId    string
+	challenge     ChallengeDB
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-challenges"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	userStore := user.NewStorage(db)
+	suite.userStore = userStore
+	suite.elevatorStore = elevator.NewStorage(db)
+
+	suite.store = NewStorage(db)
+	if err := suite.store.EnsureIndexes(context.Background()); err != nil {
+		suite.T().Errorf("Could not create indexes: %v", err)
+	}
+	challengeCont := NewController(suite.store, userStore, meditation.NewStorage(db), suite.elevatorStore, finance.NewStorage(db))
+	Routes(app, challengeCont, idempotency.New(idempotency.NewStorage(db)))
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	ctx := context.Background()
+	for _, collection := range []string{"users", "elevator", "challenges"} {
+		if _, err := suite.store.db.Collection(collection).DeleteMany(ctx, bson.M{}); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+
+	// create test users (just for userId purposes)
+	suite.testUserId = "testId"
+	for _, id := range []string{suite.testUserId, "colleagueId"} {
+		_, err := suite.userStore.Create(user.CreateUserRequest{
+			ID:        id,
+			FirstName: "test",
+			LastName:  id,
+		}, ctx)
+		if err != nil {
+			suite.T().Errorf("Could not create test user: %v", err)
+		}
+	}
+
+	// a collective challenge of the test user that started an hour ago
+	now := time.Now()
+	challenge, err := suite.store.Create(CreateChallengeRequest{
+		Name:      "Stairs together",
+		Metric:    MetricStairs,
+		Target:    100,
+		Mode:      ModeCollective,
+		StartTime: now.Add(-time.Hour).Unix(),
+		EndTime:   now.Add(time.Hour).Unix(),
+	}, suite.testUserId, ctx)
+	if err != nil {
+		suite.T().Errorf("Could not create test challenge: %v", err)
+	}
+	suite.challenge = challenge
+}
+
+func (suite *Suite) request(method string, route string, userId string, body interface{}) (int, []byte) {
+	var reader io.Reader
+	if body != nil {
+		bodyJson, err := json.Marshal(body)
+		if err != nil {
+			suite.T().Errorf("Could not marshal body: %v", err)
+		}
+		reader = bytes.NewReader(bodyJson)
+	}
+
+	req := httptest.NewRequest(method, route, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if userId != "" {
+		req.Header.Set("userId", userId)
+	}
+
+	resp, err := suite.app.Test(req, -1)
+	if err != nil {
+		suite.T().Errorf("Could not make request: %v", err)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return resp.StatusCode, respBody
+}
+
+func (suite *Suite) climb(userId string, stairs int) {
+	_, err := suite.elevatorStore.Create(elevator.CreateElevatorRequest{Stairs: true, AmountStairs: stairs}, userId, context.Background())
+	suite.NoError(err)
+}
+
+func (suite *Suite) TestPost() {
+	now := time.Now()
+	valid := CreateChallengeRequest{
+		Name:      "October stairs",
+		Metric:    MetricStairs,
+		Target:    10000,
+		Mode:      ModeCollective,
+		StartTime: now.Unix(),
+		EndTime:   now.AddDate(0, 1, 0).Unix(),
+	}
+
+	tests := []struct {
+		description  string
+		userId       string
+		body         func(r CreateChallengeRequest) CreateChallengeRequest
+		expectedCode int
+	}{
+		{
+			description:  "Create successfully",
+			body:         func(r CreateChallengeRequest) CreateChallengeRequest { return r },
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "User does not exist",
+			userId:       "doesntexist",
+			body:         func(r CreateChallengeRequest) CreateChallengeRequest { return r },
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:  "Unknown metric",
+			body:         func(r CreateChallengeRequest) CreateChallengeRequest { r.Metric = "steps"; return r },
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Unknown mode",
+			body:         func(r CreateChallengeRequest) CreateChallengeRequest { r.Mode = "team"; return r },
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "No target",
+			body:         func(r CreateChallengeRequest) CreateChallengeRequest { r.Target = 0; return r },
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Ends before it starts",
+			body:         func(r CreateChallengeRequest) CreateChallengeRequest { r.EndTime = r.StartTime - 1; return r },
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Already over",
+			body: func(r CreateChallengeRequest) CreateChallengeRequest {
+				r.StartTime -= 3600 * 48
+				r.EndTime = r.StartTime + 3600
+				return r
+			},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Longer than a year",
+			body: func(r CreateChallengeRequest) CreateChallengeRequest {
+				r.EndTime = now.AddDate(2, 0, 0).Unix()
+				return r
+			},
+			expectedCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		userId := test.userId
+		if userId == "" {
+			userId = suite.testUserId
+		}
+		code, body := suite.request("POST", "/challenges", userId, test.body(valid))
+		suite.Equal(test.expectedCode, code, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+func (suite *Suite) TestJoinAndProgress() {
+	route := "/challenges/" + suite.challenge.ID.Hex()
+
+	// strangers do not see the challenge
+	code, _ := suite.request("GET", route, "colleagueId", nil)
+	suite.Equal(fiber.StatusNotFound, code)
+
+	code, body := suite.request("POST", "/challenges/join", "colleagueId", JoinChallengeRequest{InviteCode: "wrongcod"})
+	suite.Equal(fiber.StatusNotFound, code, string(body))
+	code, body = suite.request("POST", "/challenges/join", "colleagueId", JoinChallengeRequest{InviteCode: suite.challenge.InviteCode})
+	suite.Equal(fiber.StatusOK, code, string(body))
+	code, body = suite.request("POST", "/challenges/join", "colleagueId", JoinChallengeRequest{InviteCode: suite.challenge.InviteCode})
+	suite.Equal(fiber.StatusConflict, code, string(body))
+
+	suite.climb(suite.testUserId, 40)
+	suite.climb("colleagueId", 70)
+
+	code, body = suite.request("GET", route, "colleagueId", nil)
+	suite.Equal(fiber.StatusOK, code, string(body))
+	var response challengeResponse
+	suite.NoError(json.Unmarshal(body, &response))
+	suite.Equal(110.0, response.Total)
+	suite.True(response.Completed)
+	suite.False(response.Final)
+	suite.Len(response.Participants, 2)
+	suite.Equal("colleagueId", response.Participants[0].UserID)
+
+	code, _ = suite.request("POST", route+"/leave", "colleagueId", nil)
+	suite.Equal(fiber.StatusNoContent, code)
+	code, _ = suite.request("GET", route, "colleagueId", nil)
+	suite.Equal(fiber.StatusNotFound, code)
+}
+
+func (suite *Suite) TestFrozenResults() {
+	suite.climb(suite.testUserId, 40)
+
+	// end the challenge, the first read freezes the results
+	ctx := context.Background()
+	_, err := suite.store.db.Collection("challenges").UpdateOne(ctx, bson.M{"_id": suite.challenge.ID}, bson.M{"$set": bson.M{"endTime": time.Now().Unix() - 1}})
+	suite.NoError(err)
+
+	route := "/challenges/" + suite.challenge.ID.Hex()
+	code, body := suite.request("GET", route, suite.testUserId, nil)
+	suite.Equal(fiber.StatusOK, code, string(body))
+	var response challengeResponse
+	suite.NoError(json.Unmarshal(body, &response))
+	suite.True(response.Final)
+	suite.Equal(40.0, response.Total)
+	suite.False(response.Completed)
+
+	// records after the end do not change the results
+	suite.climb(suite.testUserId, 100)
+	_, body = suite.request("GET", route, suite.testUserId, nil)
+	suite.NoError(json.Unmarshal(body, &response))
+	suite.Equal(40.0, response.Total)
+
+	code, _ = suite.request("POST", route+"/leave", suite.testUserId, nil)
+	suite.Equal(fiber.StatusConflict, code)
+	code, _ = suite.request("POST", "/challenges/join", "colleagueId", JoinChallengeRequest{InviteCode: suite.challenge.InviteCode})
+	suite.Equal(fiber.StatusConflict, code)
+}
+
+func TestProgress(t *testing.T) {
+	challenge := ChallengeDB{Target: 50, Mode: ModeIndividual, Participants: []string{"a", "b", "c"}}
+	values := map[string]float64{"a": 60, "b": 60}
+
+	results := Progress(challenge, values, 0)
+	if results.Total != 120 || results.Completed {
+		t.Errorf("got total %v completed %v, want 120 and not completed", results.Total, results.Completed)
+	}
+	ranks := map[string]int{}
+	for _, participant := range results.Participants {
+		ranks[participant.UserID] = participant.Rank
+	}
+	if ranks["a"] != 1 || ranks["b"] != 1 || ranks["c"] != 3 {
+		t.Errorf("got ranks %v, want a and b first and c third", ranks)
+	}
+
+	challenge.Mode = ModeCollective
+	if results := Progress(challenge, values, 0); !results.Completed {
+		t.Errorf("collective challenge with a total of %v should be completed", results.Total)
+	}
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestChallengeTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
@@ -0,0 +1,337 @@
+package challenge
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/finance"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// totals returns the value of each of userIds with records between startTime and endTime
+type totals func(userIds []string, startTime int64, endTime int64, ctx context.Context) (map[string]float64, error)
+
+type Controller struct {
+	storage     *Storage
+	userStorage *user.Storage
+	totals      map[Metric]totals
+}
+
+func NewController(storage *Storage, userStorage *user.Storage, meditationStorage *meditation.Storage, elevatorStorage *elevator.Storage, financeStorage *finance.Storage) *Controller {
+	return &Controller{
+		storage:     storage,
+		userStorage: userStorage,
+		totals: map[Metric]totals{
+			MetricStairs:     elevatorStorage.GetStairsOfUsers,
+			MetricHeightGain: elevatorStorage.GetHeightGainOfUsers,
+			MetricMinutes:    meditationStorage.GetMinutesOfUsers,
+			MetricSavings:    financeStorage.GetSavingsOfUsers,
+		},
+	}
+}
+
+// limits of a challenge
+const (
+	maxNameLength   = 100
+	maxTarget       = 1_000_000_000
+	maxDuration     = 366 * 24 * time.Hour
+	maxParticipants = 1000
+)
+
+type CreateChallengeRequest struct {
+	Name   string  `json:"name"`
+	Metric Metric  `json:"metric"`
+	Target float64 `json:"target"`
+	Mode   Mode    `json:"mode"`
+	// unix seconds, the window may have started already
+	StartTime int64 `json:"startTime"`
+	EndTime   int64 `json:"endTime"`
+}
+
+func (r *CreateChallengeRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+
+	var errs validation.Errors
+	_, isMetric := metricPlugins[r.Metric]
+	errs.Check(r.Name != "" && len(r.Name) <= maxNameLength, "name", "must be between 1 and %d characters", maxNameLength)
+	errs.Check(isMetric, "metric", "must be one of %s, %s, %s, %s", MetricStairs, MetricHeightGain, MetricMinutes, MetricSavings)
+	errs.Check(r.Target > 0 && r.Target <= maxTarget, "target", "must be between 0 and %d", maxTarget)
+	errs.Check(r.Mode.IsValid(), "mode", "must be one of %s, %s", ModeIndividual, ModeCollective)
+	errs.Check(r.StartTime > 0, "startTime", "must be a unix time")
+	errs.Check(r.EndTime > r.StartTime, "endTime", "must be after startTime")
+	errs.Check(r.EndTime-r.StartTime <= int64(maxDuration.Seconds()), "endTime", "must be at most %d days after startTime", int(maxDuration.Hours()/24))
+	errs.Check(r.EndTime > time.Now().Unix(), "endTime", "must be in the future")
+	return errs.Err()
+}
+
+type JoinChallengeRequest struct {
+	InviteCode string `json:"inviteCode"`
+}
+
+func (r *JoinChallengeRequest) Validate() error {
+	r.InviteCode = strings.ToUpper(strings.TrimSpace(r.InviteCode))
+
+	var errs validation.Errors
+	errs.Check(len(r.InviteCode) == codeLength, "inviteCode", "must have %d characters", codeLength)
+	return errs.Err()
+}
+
+type participantResponse struct {
+	ParticipantResult
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+type challengeResponse struct {
+	ChallengeDB
+	// the live progress of a running challenge, the frozen results of an ended one
+	Total        float64               `json:"total"`
+	Completed    bool                  `json:"completed"`
+	Participants []participantResponse `json:"participants"`
+	Final        bool                  `json:"final"`
+}
+
+// Progress computes the results of participants with values, collective
+// challenges are completed by the total, individual ones by every participant
+func Progress(challenge ChallengeDB, values map[string]float64, now int64) Results {
+	results := Results{Participants: make([]ParticipantResult, 0, len(challenge.Participants)), Time: now}
+	for _, userId := range challenge.Participants {
+		value := values[userId]
+		results.Total += value
+		results.Participants = append(results.Participants, ParticipantResult{
+			UserID:    userId,
+			Value:     value,
+			Completed: value >= challenge.Target,
+		})
+	}
+
+	sort.SliceStable(results.Participants, func(i, j int) bool {
+		return results.Participants[i].Value > results.Participants[j].Value
+	})
+	results.Completed = len(results.Participants) > 0
+	for i := range results.Participants {
+		if i > 0 && results.Participants[i].Value == results.Participants[i-1].Value {
+			results.Participants[i].Rank = results.Participants[i-1].Rank
+		} else {
+			results.Participants[i].Rank = i + 1
+		}
+		results.Completed = results.Completed && results.Participants[i].Completed
+	}
+	if challenge.Mode == ModeCollective {
+		results.Completed = results.Total >= challenge.Target
+	}
+	return results
+}
+
+// results returns the frozen results of an ended challenge and freezes them
+// on the first read after the end, running challenges get the live progress
+func (t *Controller) results(challenge ChallengeDB, ctx context.Context) (ChallengeDB, error) {
+	if challenge.Results != nil {
+		return challenge, nil
+	}
+
+	now := time.Now().Unix()
+	endTime := now
+	if challenge.Ended(now) {
+		endTime = challenge.EndTime
+	}
+	values, err := t.totals[challenge.Metric](challenge.Participants, challenge.StartTime, endTime, ctx)
+	if err != nil {
+		return challenge, err
+	}
+	results := Progress(challenge, values, endTime)
+
+	if !challenge.Ended(now) {
+		challenge.Results = &results
+		return challenge, nil
+	}
+	return t.storage.Freeze(challenge, results, ctx)
+}
+
+func (t *Controller) response(challenge ChallengeDB, ctx context.Context) (challengeResponse, error) {
+	now := time.Now().Unix()
+	challenge, err := t.results(challenge, ctx)
+	if err != nil {
+		return challengeResponse{}, err
+	}
+	results := challenge.Results
+	challenge.Results = nil
+
+	userIds := make([]string, 0, len(results.Participants))
+	for _, participant := range results.Participants {
+		userIds = append(userIds, participant.UserID)
+	}
+	users, err := t.userStorage.GetMany(userIds, ctx)
+	if err != nil {
+		return challengeResponse{}, err
+	}
+
+	response := challengeResponse{
+		ChallengeDB:  challenge,
+		Total:        results.Total,
+		Completed:    results.Completed,
+		Participants: make([]participantResponse, 0, len(results.Participants)),
+		Final:        challenge.Ended(now),
+	}
+	for _, participant := range results.Participants {
+		response.Participants = append(response.Participants, participantResponse{
+			ParticipantResult: participant,
+			FirstName:         users[participant.UserID].FirstName,
+			LastName:          users[participant.UserID].LastName,
+		})
+	}
+	return response, nil
+}
+
+func userID(c *fiber.Ctx) (string, error) {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return "", apperror.Validation("Missing userId header")
+	}
+	return userId, nil
+}
+
+// @Summary Create a challenge
+// @Description Creates a challenge with the user as first participant, others join with the invite code.
+// @Tags challenges
+// @Accept json
+// @Param challenge body CreateChallengeRequest true "challenge to create"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 201 {object} challengeResponse
+// @Router /challenges [post]
+func (t *Controller) create(c *fiber.Ctx) error {
+	req := validation.Parsed[CreateChallengeRequest](c)
+
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	//check if user exists
+	if _, err := t.userStorage.Get(userId, c.UserContext()); err != nil {
+		return err
+	}
+
+	challenge, err := t.storage.Create(req, userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	response, err := t.response(challenge, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// @Summary Get the challenges of a user
+// @Description The challenges the user participates in without their progress, the latest end first.
+// @Tags challenges
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []ChallengeDB
+// @Router /challenges [get]
+func (t *Controller) getAll(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	challenges, err := t.storage.GetAllOfOneUser(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(challenges)
+}
+
+// @Summary Get a challenge
+// @Description The live progress of a running challenge or the final results of an ended one, only for participants.
+// @Tags challenges
+// @Param id path string true "Challenge ID"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} challengeResponse
+// @Router /challenges/{id} [get]
+func (t *Controller) get(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	challenge, err := t.storage.Get(c.Params("id"), userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	response, err := t.response(challenge, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// @Summary Join a challenge
+// @Description Joins the running challenge of an invite code.
+// @Tags challenges
+// @Accept json
+// @Param invite body JoinChallengeRequest true "invite code"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} challengeResponse
+// @Router /challenges/join [post]
+func (t *Controller) join(c *fiber.Ctx) error {
+	req := validation.Parsed[JoinChallengeRequest](c)
+
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	//check if user exists
+	if _, err := t.userStorage.Get(userId, c.UserContext()); err != nil {
+		return err
+	}
+
+	challenge, err := t.storage.Join(req.InviteCode, userId, time.Now().Unix(), c.UserContext())
+	if err != nil {
+		return err
+	}
+	response, err := t.response(challenge, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// @Summary Leave a challenge
+// @Description Leaves a running challenge, the results of ended ones stay as they are.
+// @Tags challenges
+// @Param id path string true "Challenge ID"
+// @Param userId header string true "User ID"
+// @Success 204
+// @Router /challenges/{id}/leave [post]
+func (t *Controller) leave(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	challenge, err := t.storage.Get(c.Params("id"), userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	if challenge.Ended(time.Now().Unix()) {
+		return apperror.Conflict("challenge has ended")
+	}
+
+	if err := t.storage.Leave(challenge, userId, c.UserContext()); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
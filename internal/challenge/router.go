@@ -0,0 +1,21 @@
+package challenge
+
+import (
+	"cmd/http/main.go/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// idempotent guards the create route against duplicates from client retries
+func Routes(app fiber.Router, controller *Controller, idempotent fiber.Handler) {
+	challenges := app.Group("/challenges")
+
+	// add middlewares here
+
+	// add routes here
+	challenges.Post("/", idempotent, validation.Body[CreateChallengeRequest](), controller.create)
+	challenges.Get("/", controller.getAll)
+	challenges.Post("/join", validation.Body[JoinChallengeRequest](), controller.join)
+	challenges.Get("/:id", controller.get)
+	challenges.Post("/:id/leave", controller.leave)
+}
@@ -0,0 +1,272 @@
+package challenge
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/settings"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Metric string
+
+const (
+	// stairs climbed, elevator plugin
+	MetricStairs Metric = "stairs"
+	// meters climbed by stairs, elevator plugin
+	MetricHeightGain Metric = "heightGain"
+	// minutes meditated, meditation plugin
+	MetricMinutes Metric = "minutes"
+	// money saved, finance plugin
+	MetricSavings Metric = "savings"
+)
+
+// plugin of each metric
+var metricPlugins = map[Metric]settings.PluginName{
+	MetricStairs:     settings.PluginNameElevator,
+	MetricHeightGain: settings.PluginNameElevator,
+	MetricMinutes:    settings.PluginNameMeditation,
+	MetricSavings:    settings.PluginNameFinance,
+}
+
+type Mode string
+
+const (
+	// every participant has to reach the target
+	ModeIndividual Mode = "individual"
+	// the participants reach the target together
+	ModeCollective Mode = "collective"
+)
+
+func (m Mode) IsValid() bool {
+	return m == ModeIndividual || m == ModeCollective
+}
+
+type ChallengeDB struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id"`
+	CreatorID string              `json:"creatorId" bson:"creatorId"`
+	Name      string              `json:"name" bson:"name"`
+	Plugin    settings.PluginName `json:"plugin" bson:"plugin"`
+	Metric    Metric              `json:"metric" bson:"metric"`
+	Target    float64             `json:"target" bson:"target"`
+	Mode      Mode                `json:"mode" bson:"mode"`
+	// unix seconds of the window, records between count
+	StartTime int64 `json:"startTime" bson:"startTime"`
+	EndTime   int64 `json:"endTime" bson:"endTime"`
+	// shared with the people that should join
+	InviteCode   string   `json:"inviteCode" bson:"inviteCode"`
+	Participants []string `json:"participants" bson:"participants"`
+	CreatedAt    int64    `json:"createdAt" bson:"createdAt"`
+	// frozen after the end, nil before
+	Results *Results `json:"results,omitempty" bson:"results,omitempty"`
+}
+
+// Ended checks if the window of the challenge is over at now (unix seconds)
+func (c ChallengeDB) Ended(now int64) bool {
+	return now > c.EndTime
+}
+
+// Results is the progress of a challenge at a point in time
+type Results struct {
+	// of all participants
+	Total     float64 `json:"total" bson:"total"`
+	Completed bool    `json:"completed" bson:"completed"`
+	// sorted by rank
+	Participants []ParticipantResult `json:"participants" bson:"participants"`
+	// unix seconds, the end of the challenge or now
+	Time int64 `json:"time" bson:"time"`
+}
+
+type ParticipantResult struct {
+	UserID string  `json:"userId" bson:"userId"`
+	Value  float64 `json:"value" bson:"value"`
+	// participants with the same value share the rank
+	Rank int `json:"rank" bson:"rank"`
+	// reached the target on its own
+	Completed bool `json:"completed" bson:"completed"`
+}
+
+// alphabet of invite codes, without characters that are easy to confuse
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const codeLength = 8
+
+func newInviteCode() (string, error) {
+	random := make([]byte, codeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	code := make([]byte, codeLength)
+	for i, b := range random {
+		code[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(code), nil
+}
+
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+// EnsureIndexes creates the indexes for the challenges of a user and the invite codes
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	collection := s.db.Collection("challenges")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "participants", Value: 1}, {Key: "endTime", Value: -1}}},
+		{Keys: bson.D{{Key: "inviteCode", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	return err
+}
+
+// attempts to find an unused invite code
+const codeAttempts = 3
+
+// Create stores a challenge, the creator is the first participant
+func (s *Storage) Create(request CreateChallengeRequest, userId string, ctx context.Context) (ChallengeDB, error) {
+	collection := s.db.Collection("challenges")
+
+	challenge := ChallengeDB{
+		ID:           primitive.NewObjectID(),
+		CreatorID:    userId,
+		Name:         request.Name,
+		Plugin:       metricPlugins[request.Metric],
+		Metric:       request.Metric,
+		Target:       request.Target,
+		Mode:         request.Mode,
+		StartTime:    request.StartTime,
+		EndTime:      request.EndTime,
+		Participants: []string{userId},
+		CreatedAt:    time.Now().Unix(),
+	}
+
+	// a taken code fails on the unique index, try another one
+	var err error
+	for attempt := 0; attempt < codeAttempts; attempt++ {
+		if challenge.InviteCode, err = newInviteCode(); err != nil {
+			return challenge, apperror.Internal("could not create an invite code", err)
+		}
+		_, err = collection.InsertOne(ctx, challenge)
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		return challenge, apperror.FromMongo(err, "challenge")
+	}
+	return challenge, nil
+}
+
+// Get returns a challenge if userId participates, the challenge does not exist for others
+func (s *Storage) Get(challengeID string, userId string, ctx context.Context) (ChallengeDB, error) {
+	collection := s.db.Collection("challenges")
+	challenge := ChallengeDB{}
+
+	// an id that is no object id cannot exist
+	objectID, err := primitive.ObjectIDFromHex(challengeID)
+	if err != nil {
+		return challenge, apperror.NotFound("challenge does not exist")
+	}
+
+	err = collection.FindOne(ctx, bson.M{"_id": objectID, "participants": userId}).Decode(&challenge)
+	if err != nil {
+		return challenge, apperror.FromMongo(err, "challenge")
+	}
+	return challenge, nil
+}
+
+// GetAllOfOneUser returns the challenges userId participates in, the latest end first
+func (s *Storage) GetAllOfOneUser(userId string, ctx context.Context) ([]ChallengeDB, error) {
+	collection := s.db.Collection("challenges")
+
+	cursor, err := collection.Find(ctx, bson.M{"participants": userId}, options.Find().SetSort(bson.D{{Key: "endTime", Value: -1}}))
+	if err != nil {
+		return nil, apperror.FromMongo(err, "challenges")
+	}
+
+	challenges := make([]ChallengeDB, 0)
+	if err := cursor.All(ctx, &challenges); err != nil {
+		return nil, apperror.FromMongo(err, "challenges")
+	}
+	return challenges, nil
+}
+
+// Join adds userId to the running challenge of an invite code
+func (s *Storage) Join(inviteCode string, userId string, now int64, ctx context.Context) (ChallengeDB, error) {
+	collection := s.db.Collection("challenges")
+	challenge := ChallengeDB{}
+
+	err := collection.FindOne(ctx, bson.M{"inviteCode": inviteCode}).Decode(&challenge)
+	if err != nil {
+		return challenge, apperror.FromMongo(err, "challenge")
+	}
+	if challenge.Ended(now) {
+		return challenge, apperror.Conflict("challenge has ended")
+	}
+	for _, participant := range challenge.Participants {
+		if participant == userId {
+			return challenge, apperror.Conflict("already participating")
+		}
+	}
+	if len(challenge.Participants) >= maxParticipants {
+		return challenge, apperror.Conflict("challenge is full")
+	}
+
+	// the filter guards against a race with other joins at the limit
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": challenge.ID, "participants": bson.M{"$ne": userId}, fmt.Sprintf("participants.%d", maxParticipants-1): bson.M{"$exists": false}},
+		bson.M{"$push": bson.M{"participants": userId}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&challenge)
+	if err == mongo.ErrNoDocuments {
+		return challenge, apperror.Conflict("could not join the challenge, try again")
+	}
+	if err != nil {
+		return challenge, apperror.FromMongo(err, "challenge")
+	}
+	return challenge, nil
+}
+
+// Leave removes userId from a running challenge
+func (s *Storage) Leave(challenge ChallengeDB, userId string, ctx context.Context) error {
+	collection := s.db.Collection("challenges")
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": challenge.ID},
+		bson.M{"$pull": bson.M{"participants": userId}},
+	)
+	if err != nil {
+		return apperror.FromMongo(err, "challenge")
+	}
+	return nil
+}
+
+// Freeze stores the final results of a challenge, results that are already
+// frozen are kept and returned
+func (s *Storage) Freeze(challenge ChallengeDB, results Results, ctx context.Context) (ChallengeDB, error) {
+	collection := s.db.Collection("challenges")
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": challenge.ID, "results": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"results": results}},
+	)
+	if err != nil {
+		return challenge, apperror.FromMongo(err, "challenge")
+	}
+
+	err = collection.FindOne(ctx, bson.M{"_id": challenge.ID}).Decode(&challenge)
+	if err != nil {
+		return challenge, apperror.FromMongo(err, "challenge")
+	}
+	return challenge, nil
+}
@@ -0,0 +1,332 @@
+package devicesync
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/calendar"
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/finance"
+	"cmd/http/main.go/internal/logging"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Controller struct {
+	storage           *Storage
+	userStorage       *user.Storage
+	progressStorage   *progress.Storage
+	meditationStorage *meditation.Storage
+	elevatorStorage   *elevator.Storage
+	financeStorage    *finance.Storage
+}
+
+func NewController(storage *Storage, userStorage *user.Storage, progressStorage *progress.Storage,
+	meditationStorage *meditation.Storage, elevatorStorage *elevator.Storage, financeStorage *finance.Storage) *Controller {
+	return &Controller{
+		storage:           storage,
+		userStorage:       userStorage,
+		progressStorage:   progressStorage,
+		meditationStorage: meditationStorage,
+		elevatorStorage:   elevatorStorage,
+		financeStorage:    financeStorage,
+	}
+}
+
+// at most this many entries are synced with one request
+const maxItems = 500
+
+// result status of a synced entry
+const (
+	StatusCreated   = "created"
+	StatusDuplicate = "duplicate"
+	StatusRejected  = "rejected"
+)
+
+// SyncItem is one activity logged offline. Data is the create request of the
+// plugin named by type, e.g. a CreateMeditationRequest for "meditation".
+type SyncItem struct {
+	ClientID string              `json:"clientId"`
+	Type     settings.PluginName `json:"type"`
+	// when the client logged the entry (unix seconds), used if data has no time
+	ClientTime int64           `json:"clientTime"`
+	Data       json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+type SyncRequest struct {
+	Items []SyncItem `json:"items"`
+}
+
+func (r SyncRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(validation.InRange(int64(len(r.Items)), 1, maxItems), "items", "must contain between 1 and %d entries", maxItems)
+
+	clientIDs := make(map[string]bool, len(r.Items))
+	for i, item := range r.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		errs.Check(item.ClientID != "", field+".clientId", "is required")
+		errs.Check(!clientIDs[item.ClientID], field+".clientId", "is used twice in this batch")
+		errs.Check(item.Type == settings.PluginNameMeditation || item.Type == settings.PluginNameElevator || item.Type == settings.PluginNameFinance,
+			field+".type", "must be one of %s, %s, %s", settings.PluginNameMeditation, settings.PluginNameElevator, settings.PluginNameFinance)
+		errs.Check(item.ClientTime == 0 || validation.IsClientTime(item.ClientTime), field+".clientTime", "must be a unix time of the last %d days", int(validation.MaxClientAge.Hours()/24))
+		clientIDs[item.ClientID] = true
+	}
+	return errs.Err()
+}
+
+type ItemResult struct {
+	ClientID string `json:"clientId"`
+	Status   string `json:"status"`
+	// id of the created record, also set for duplicates
+	ID      string                `json:"id,omitempty"`
+	Message string                `json:"message,omitempty"`
+	Errors  []apperror.FieldError `json:"errors,omitempty"`
+}
+
+type SyncResponse struct {
+	Results []ItemResult `json:"results"`
+}
+
+type ChangesResponse struct {
+	Meditation []meditation.MeditationDB `json:"meditation"`
+	Elevator   []elevator.ElevatorDB     `json:"elevator"`
+	Finance    []finance.FinanceDB       `json:"finance"`
+	// record id to client id of the records created by a sync
+	ClientIDs map[string]string `json:"clientIds"`
+	// pass as since with the next request
+	ServerTime int64 `json:"serverTime"`
+}
+
+// @Summary Sync offline activity.
+// @Description Applies a batch of meditation, elevator and finance entries in order. Entries are identified by their client id, a client id that was synced before is reported as duplicate.
+// @Tags sync
+// @Accept */*
+// @Produce json
+// @Param userId header string true "User ID"
+// @Param sync body SyncRequest true "Entries to sync"
+// @Success 200 {object} SyncResponse
+// @Router /sync [post]
+func (t *Controller) sync(c *fiber.Ctx) error {
+	req := validation.Parsed[SyncRequest](c)
+
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	//check if user exists
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	results := make([]ItemResult, 0, len(req.Items))
+	for _, item := range req.Items {
+		results = append(results, t.apply(userId, item, profile.Calendar(), c.UserContext()))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(SyncResponse{Results: results})
+}
+
+// apply creates the record of one entry unless its client id was synced before
+func (t *Controller) apply(userId string, item SyncItem, cal calendar.Calendar, ctx context.Context) ItemResult {
+	result := ItemResult{ClientID: item.ClientID}
+
+	entry, started, err := t.storage.Start(userId, item.ClientID, item.Type, ctx)
+	if err != nil {
+		return rejected(result, err, ctx)
+	}
+	if !started {
+		if !entry.Completed {
+			return rejected(result, apperror.Conflict("Entry is already being synced"), ctx)
+		}
+		// a retry grants the experience an earlier sync could not
+		if entry.ExperiencePending {
+			if err := t.grant(entry, ctx); err != nil {
+				return rejected(result, err, ctx)
+			}
+		}
+		result.Status = StatusDuplicate
+		result.ID = entry.EntityID
+		return result
+	}
+
+	id, experience, err := t.create(userId, item, cal, ctx)
+	if err != nil {
+		if err := t.storage.Release(entry.ID, ctx); err != nil {
+			logging.FromContext(ctx).Error("could not release sync entry", "error", err)
+		}
+		return rejected(result, err, ctx)
+	}
+
+	// the entry stays reserved if this fails, a retry takes it over after the lease
+	if err := t.storage.Complete(entry.ID, id, experience, ctx); err != nil {
+		return rejected(result, err, ctx)
+	}
+	entry.Experience = experience
+	if err := t.grant(entry, ctx); err != nil {
+		return rejected(result, err, ctx)
+	}
+
+	result.Status = StatusCreated
+	result.ID = id
+	return result
+}
+
+// grant adds the pending experience of a completed entry once
+func (t *Controller) grant(entry EntryDB, ctx context.Context) error {
+	claimed, err := t.storage.ClaimExperience(entry.ID, ctx)
+	if err != nil || !claimed {
+		return err
+	}
+	if err := t.progressStorage.AddExperience(entry.UserID, ctx, entry.Type, entry.Experience); err != nil {
+		if err := t.storage.UnclaimExperience(entry.ID, ctx); err != nil {
+			logging.FromContext(ctx).Error("could not unclaim experience", "error", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// create stores the entry in its plugin and returns the id and earned experience,
+// entries are held to the same limits as the plugins
+func (t *Controller) create(userId string, item SyncItem, cal calendar.Calendar, ctx context.Context) (string, float64, error) {
+	switch item.Type {
+	case settings.PluginNameMeditation:
+		var req meditation.CreateMeditationRequest
+		if err := unmarshal(item, &req); err != nil {
+			return "", 0, err
+		}
+		if req.StartTime == 0 && req.EndTime == 0 {
+			req.EndTime = item.ClientTime
+		}
+		if err := req.Validate(); err != nil {
+			return "", 0, err
+		}
+		if err := t.meditationStorage.CheckLimit(req, userId, cal, time.Now(), ctx); err != nil {
+			return "", 0, err
+		}
+		id, err := t.meditationStorage.Create(req, userId, ctx)
+		return id, req.Experience(), err
+
+	case settings.PluginNameElevator:
+		var req elevator.CreateElevatorRequest
+		if err := unmarshal(item, &req); err != nil {
+			return "", 0, err
+		}
+		if req.Time == 0 {
+			req.Time = item.ClientTime
+		}
+		if err := req.Validate(); err != nil {
+			return "", 0, err
+		}
+		if err := t.elevatorStorage.CheckLimit(req, userId, time.Now(), ctx); err != nil {
+			return "", 0, err
+		}
+		id, err := t.elevatorStorage.Create(req, userId, ctx)
+		return id, req.Experience(), err
+
+	case settings.PluginNameFinance:
+		var req finance.CreateSpendingRequest
+		if err := unmarshal(item, &req); err != nil {
+			return "", 0, err
+		}
+		if req.SpendingTime == 0 {
+			req.SpendingTime = item.ClientTime
+		}
+		if err := req.Validate(); err != nil {
+			return "", 0, err
+		}
+		id, err := t.financeStorage.Create(req, userId, ctx)
+		return id, req.Experience(), err
+	}
+	return "", 0, apperror.Validation("Unknown type %s", item.Type)
+}
+
+// unmarshal parses the data of an entry into a create request
+func unmarshal(item SyncItem, req interface{}) error {
+	if err := json.Unmarshal(item.Data, req); err != nil {
+		return apperror.Validation("Invalid data")
+	}
+	return nil
+}
+
+func rejected(result ItemResult, err error, ctx context.Context) ItemResult {
+	result.Status = StatusRejected
+
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) || appErr.Kind == apperror.KindInternal {
+		logging.FromContext(ctx).Error("sync entry failed", "error", err)
+		result.Message = "Something went wrong"
+		return result
+	}
+	result.Message = appErr.Message
+	result.Errors = appErr.Fields
+	return result
+}
+
+// @Summary Get changes since the last sync.
+// @Description Fetch all records created since a point in time, so every device of a user converges.
+// @Tags sync
+// @Produce json
+// @Param userId header string true "User ID"
+// @Param since query int64 false "unix seconds, the serverTime of the previous response"
+// @Success 200 {object} ChangesResponse
+// @Router /sync [get]
+func (t *Controller) changes(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	var since int64
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		var err error
+		since, err = strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || since < 0 {
+			return apperror.Validation("Invalid since parameter")
+		}
+	}
+
+	//check if user exists
+	if _, err := t.userStorage.Get(userId, c.UserContext()); err != nil {
+		return err
+	}
+
+	// taken before reading, so nothing created meanwhile is missed next time
+	serverTime := time.Now().Unix()
+
+	meditations, err := t.meditationStorage.GetCreatedSince(userId, since, c.UserContext())
+	if err != nil {
+		return err
+	}
+	elevators, err := t.elevatorStorage.GetCreatedSince(userId, since, c.UserContext())
+	if err != nil {
+		return err
+	}
+	investments, err := t.financeStorage.GetCreatedSince(userId, since, c.UserContext())
+	if err != nil {
+		return err
+	}
+	clientIDs, err := t.storage.GetClientIDs(userId, since, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(ChangesResponse{
+		Meditation: meditations,
+		Elevator:   elevators,
+		Finance:    investments,
+		ClientIDs:  clientIDs,
+		ServerTime: serverTime,
+	})
+}
@@ -0,0 +1,348 @@
+package devicesync
+
+import (
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/finance"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Suite struct {
+	suite.Suite
+	app        *fiber.App
+	store      *Storage
+	userStore  *user.Storage
+	testUserId string
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-sync"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	userStore := user.NewStorage(db)
+	suite.userStore = userStore
+
+	suite.store = NewStorage(db)
+	syncCont := NewController(suite.store, userStore, progress.NewStorage(db),
+		meditation.NewStorage(db), elevator.NewStorage(db), finance.NewStorage(db))
+	Routes(app, syncCont)
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	for _, collection := range []string{"users", "sync", "meditation", "elevator", "investment"} {
+		if err := suite.store.db.Collection(collection).Drop(context.Background()); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+
+	// create a test user (just for userId purposes)
+	testId := "testId"
+	_, err := suite.userStore.Create(user.CreateUserRequest{
+		ID:        testId,
+		FirstName: "test",
+		LastName:  "testId",
+	}, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test user: %v", err)
+	}
+
+	suite.testUserId = testId
+}
+
+func item(clientId string, itemType settings.PluginName, data interface{}) SyncItem {
+	raw, _ := json.Marshal(data)
+	return SyncItem{
+		ClientID:   clientId,
+		Type:       itemType,
+		ClientTime: time.Now().Unix(),
+		Data:       raw,
+	}
+}
+
+func (suite *Suite) post(body interface{}, userId string) (int, SyncResponse) {
+	bodyJson, err := json.Marshal(body)
+	if err != nil {
+		suite.T().Errorf("Could not marshal sync: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/sync", bytes.NewReader(bodyJson))
+	if userId != "" {
+		req.Header.Set("userId", userId)
+	}
+
+	resp, err := suite.app.Test(req, -1)
+	if err != nil {
+		suite.T().Errorf("Could not make request: %v", err)
+	}
+
+	var response SyncResponse
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	_ = json.Unmarshal(respBody, &response)
+	return resp.StatusCode, response
+}
+
+func (suite *Suite) TestPost() {
+	tests := []struct {
+		description  string
+		userId       string
+		body         SyncRequest
+		expectedCode int
+	}{
+		{
+			description: "Mixed batch",
+			userId:      suite.testUserId,
+			body: SyncRequest{Items: []SyncItem{
+				item("m1", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 10}),
+				item("e1", settings.PluginNameElevator, elevator.CreateElevatorRequest{Stairs: true, AmountStairs: 20}),
+				item("f1", settings.PluginNameFinance, finance.CreateSpendingRequest{Amount: 5}),
+			}},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "Empty batch",
+			userId:       suite.testUserId,
+			body:         SyncRequest{},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Client id used twice",
+			userId:      suite.testUserId,
+			body: SyncRequest{Items: []SyncItem{
+				item("x", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 10}),
+				item("x", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 10}),
+			}},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Unknown type",
+			userId:      suite.testUserId,
+			body: SyncRequest{Items: []SyncItem{
+				item("x", "unknown", meditation.CreateMeditationRequest{MeditationTime: 10}),
+			}},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "User does not exist",
+			userId:      "doesntexist",
+			body: SyncRequest{Items: []SyncItem{
+				item("m1", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 10}),
+			}},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description: "Missing userId header",
+			body: SyncRequest{Items: []SyncItem{
+				item("m1", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 10}),
+			}},
+			expectedCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		code, _ := suite.post(test.body, test.userId)
+		suite.Equal(test.expectedCode, code, "Error for (%v)", test.description)
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+func (suite *Suite) TestPostResults() {
+	body := SyncRequest{Items: []SyncItem{
+		item("m1", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 10}),
+		item("m2", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: -1}),
+	}}
+
+	code, response := suite.post(body, suite.testUserId)
+	suite.Equal(fiber.StatusOK, code)
+	suite.Len(response.Results, 2)
+	suite.Equal(StatusCreated, response.Results[0].Status)
+	suite.NotEmpty(response.Results[0].ID)
+	suite.Equal(StatusRejected, response.Results[1].Status)
+	suite.NotEmpty(response.Results[1].Errors)
+
+	// syncing again only creates the rejected entry once it is fixed
+	body.Items[1] = item("m2", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 5})
+	code, retry := suite.post(body, suite.testUserId)
+	suite.Equal(fiber.StatusOK, code)
+	suite.Equal(StatusDuplicate, retry.Results[0].Status)
+	suite.Equal(response.Results[0].ID, retry.Results[0].ID)
+	suite.Equal(StatusCreated, retry.Results[1].Status)
+
+	count, err := suite.store.db.Collection("meditation").CountDocuments(context.Background(), map[string]string{"userId": suite.testUserId})
+	suite.NoError(err)
+	suite.Equal(int64(2), count)
+}
+
+func (suite *Suite) TestPostInterrupted() {
+	now := time.Now()
+	entries := []interface{}{
+		// a sync that crashed before its record was stored
+		EntryDB{ID: EntryID{UserID: suite.testUserId, ClientID: "stale"}, UserID: suite.testUserId, ClientID: "stale", Type: settings.PluginNameMeditation, CreatedAt: now.Add(-2 * lease).Unix()},
+		// a sync that is still running
+		EntryDB{ID: EntryID{UserID: suite.testUserId, ClientID: "running"}, UserID: suite.testUserId, ClientID: "running", Type: settings.PluginNameMeditation, CreatedAt: now.Unix()},
+		// a sync that could not grant its experience
+		EntryDB{ID: EntryID{UserID: suite.testUserId, ClientID: "pending"}, UserID: suite.testUserId, ClientID: "pending", Type: settings.PluginNameMeditation, EntityID: "entityId", Completed: true, CreatedAt: now.Unix(), Experience: 10, ExperiencePending: true},
+	}
+	_, err := suite.store.db.Collection("sync").InsertMany(context.Background(), entries)
+	suite.NoError(err)
+
+	body := SyncRequest{Items: []SyncItem{
+		item("stale", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 10}),
+		item("running", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 10}),
+		item("pending", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 10}),
+	}}
+	code, response := suite.post(body, suite.testUserId)
+	suite.Equal(fiber.StatusOK, code)
+	suite.Len(response.Results, 3)
+	suite.Equal(StatusCreated, response.Results[0].Status)
+	suite.Equal(StatusRejected, response.Results[1].Status)
+	suite.Equal(StatusDuplicate, response.Results[2].Status)
+	suite.Equal("entityId", response.Results[2].ID)
+
+	var entry EntryDB
+	suite.NoError(suite.store.db.Collection("sync").FindOne(context.Background(), bson.M{"_id": EntryID{UserID: suite.testUserId, ClientID: "pending"}}).Decode(&entry))
+	suite.False(entry.ExperiencePending)
+}
+
+func (suite *Suite) TestStartOtherUser() {
+	ctx := context.Background()
+	// joined with a separator both would be "a:b:c"
+	_, started, err := suite.store.Start("a", "b:c", settings.PluginNameMeditation, ctx)
+	suite.NoError(err)
+	suite.True(started)
+
+	entry, started, err := suite.store.Start("a:b", "c", settings.PluginNameMeditation, ctx)
+	suite.NoError(err)
+	suite.True(started, "the client id of another user is a new entry")
+	suite.Equal("a:b", entry.UserID)
+}
+
+func (suite *Suite) TestGet() {
+	body := SyncRequest{Items: []SyncItem{
+		item("m1", settings.PluginNameMeditation, meditation.CreateMeditationRequest{MeditationTime: 10}),
+		item("f1", settings.PluginNameFinance, finance.CreateSpendingRequest{Amount: 5}),
+	}}
+	_, synced := suite.post(body, suite.testUserId)
+
+	tests := []struct {
+		missingHeader bool
+		userId        string
+		description   string
+		expectedCode  int
+		query         map[string]string
+	}{
+		{
+			description:  "All changes",
+			query:        map[string]string{},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "Changes since",
+			query:        map[string]string{"since": "10"},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "Invalid since",
+			query:        map[string]string{"since": "yesterday"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "User does not exist",
+			userId:       "doesntexist",
+			query:        map[string]string{},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "Missing userId header",
+			missingHeader: true,
+			query:         map[string]string{},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		url := url.URL{
+			Path: "/sync",
+		}
+
+		// Add query
+		q := url.Query()
+		for key, value := range test.query {
+			q.Add(key, value)
+		}
+		url.RawQuery = q.Encode()
+
+		req := httptest.NewRequest("GET", url.String(), nil)
+
+		// Add header
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		} else {
+			req.Header.Set("userId", suite.testUserId)
+		}
+
+		if test.missingHeader {
+			req.Header.Del("userId")
+		}
+
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, "Error for (%v): %v ", test.description, string(body[:]))
+
+		if resp.StatusCode == fiber.StatusOK {
+			var changes ChangesResponse
+			suite.NoError(json.Unmarshal(body, &changes))
+			suite.Len(changes.Meditation, 1, test.description)
+			suite.Len(changes.Finance, 1, test.description)
+			suite.Equal("m1", changes.ClientIDs[synced.Results[0].ID], test.description)
+		}
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestSyncTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
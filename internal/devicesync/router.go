@@ -0,0 +1,17 @@
+package devicesync
+
+import (
+	"cmd/http/main.go/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func Routes(app fiber.Router, controller *Controller) {
+	sync := app.Group("/sync")
+
+	// add middlewares here
+
+	// add routes here
+	sync.Post("/", validation.Body[SyncRequest](), controller.sync)
+	sync.Get("/", controller.changes)
+}
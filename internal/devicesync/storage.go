@@ -0,0 +1,148 @@
+package devicesync
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/settings"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// how long a client id stays reserved while its record is created, a sync
+// that crashed in between is taken over after it
+const lease = time.Minute
+
+// EntryID is one client id of one user, as separate fields of the _id, so
+// the client ids of different users never collide
+type EntryID struct {
+	UserID   string `json:"userId" bson:"userId"`
+	ClientID string `json:"clientId" bson:"clientId"`
+}
+
+// EntryDB remembers which record was created for a client id
+type EntryDB struct {
+	// a client id is applied once per user
+	ID        EntryID             `json:"id" bson:"_id"`
+	UserID    string              `json:"userId" bson:"userId"`
+	ClientID  string              `json:"clientId" bson:"clientId"`
+	Type      settings.PluginName `json:"type" bson:"type"`
+	EntityID  string              `json:"entityId" bson:"entityId"`
+	Completed bool                `json:"completed" bson:"completed"`
+	CreatedAt int64               `json:"createdAt" bson:"createdAt"`
+	// experience of the record that was not granted yet, a retry grants it
+	Experience        float64 `json:"-" bson:"experience,omitempty"`
+	ExperiencePending bool    `json:"-" bson:"experiencePending,omitempty"`
+}
+
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+// Start reserves a client id. If it was already synced or is being synced the
+// existing entry is returned and started is false. A reservation older than
+// the lease is taken over, its record may then be created twice.
+func (s *Storage) Start(userId string, clientId string, entryType settings.PluginName, ctx context.Context) (EntryDB, bool, error) {
+	collection := s.db.Collection("sync")
+
+	entry := EntryDB{
+		ID:        EntryID{UserID: userId, ClientID: clientId},
+		UserID:    userId,
+		ClientID:  clientId,
+		Type:      entryType,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	_, err := collection.InsertOne(ctx, entry)
+	if err == nil {
+		return entry, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return entry, false, apperror.FromMongo(err, "sync entry")
+	}
+
+	var existing EntryDB
+	if err := collection.FindOne(ctx, bson.M{"_id": entry.ID}).Decode(&existing); err != nil {
+		return entry, false, apperror.FromMongo(err, "sync entry")
+	}
+
+	if !existing.Completed && time.Since(time.Unix(existing.CreatedAt, 0)) > lease {
+		result, err := collection.ReplaceOne(ctx, bson.M{"_id": entry.ID, "completed": false, "createdAt": existing.CreatedAt}, entry)
+		if err != nil {
+			return entry, false, apperror.FromMongo(err, "sync entry")
+		}
+		if result.MatchedCount == 1 {
+			return entry, true, nil
+		}
+		// another retry took over the entry in the meantime
+		return existing, false, nil
+	}
+
+	return existing, false, nil
+}
+
+// Complete links the client id to the created record, its experience is
+// pending until it is granted
+func (s *Storage) Complete(id EntryID, entityId string, experience float64, ctx context.Context) error {
+	collection := s.db.Collection("sync")
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"entityId":          entityId,
+		"completed":         true,
+		"experience":        experience,
+		"experiencePending": true,
+	}})
+	return apperror.FromMongo(err, "sync entry")
+}
+
+// ClaimExperience clears the pending experience of an entry, claimed is false
+// if another request claimed it before
+func (s *Storage) ClaimExperience(id EntryID, ctx context.Context) (bool, error) {
+	collection := s.db.Collection("sync")
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id, "experiencePending": true}, bson.M{"$set": bson.M{"experiencePending": false}})
+	if err != nil {
+		return false, apperror.FromMongo(err, "sync entry")
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// UnclaimExperience marks the experience as pending again after granting it failed
+func (s *Storage) UnclaimExperience(id EntryID, ctx context.Context) error {
+	collection := s.db.Collection("sync")
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"experiencePending": true}})
+	return apperror.FromMongo(err, "sync entry")
+}
+
+// Release forgets a client id whose record could not be created
+func (s *Storage) Release(id EntryID, ctx context.Context) error {
+	collection := s.db.Collection("sync")
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	return apperror.FromMongo(err, "sync entry")
+}
+
+// GetClientIDs maps the record ids synced since (unix seconds) to their client ids
+func (s *Storage) GetClientIDs(userId string, since int64, ctx context.Context) (map[string]string, error) {
+	collection := s.db.Collection("sync")
+
+	cursor, err := collection.Find(ctx, bson.M{"userId": userId, "completed": true, "createdAt": bson.M{"$gte": since}})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "sync entries")
+	}
+
+	var entries []EntryDB
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, apperror.FromMongo(err, "sync entries")
+	}
+
+	clientIDs := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		clientIDs[entry.EntityID] = entry.ClientID
+	}
+	return clientIDs, nil
+}
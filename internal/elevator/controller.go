@@ -1,10 +1,15 @@
 package elevator
 
 import (
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/calendar"
 	"cmd/http/main.go/internal/progress"
 	"cmd/http/main.go/internal/settings"
 	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	_ "go.mongodb.org/mongo-driver/bson/primitive"
@@ -28,6 +33,28 @@ type CreateElevatorRequest struct {
 	Stairs       bool  `json:"stairs" bson:"stairs"`
 	AmountStairs int   `json:"amountStairs" bson:"amountStairs"`
 	HeightGain   int64 `json:"heightGain" bson:"heightGain"`
+	// unix seconds on the client, defaults to now
+	Time int64 `json:"time" bson:"time"`
+}
+
+// upper bounds for a single entry, nobody climbs more in one go
+const (
+	maxAmountStairs = 10000
+	maxHeightGain   = 5000
+)
+
+func (r CreateElevatorRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(validation.InRange(int64(r.AmountStairs), 0, maxAmountStairs), "amountStairs", "must be between 0 and %d", maxAmountStairs)
+	errs.Check(r.AmountStairs == 0 || r.Stairs, "amountStairs", "can only be set if stairs is true")
+	errs.Check(validation.InRange(r.HeightGain, 0, maxHeightGain), "heightGain", "must be between 0 and %d meters", maxHeightGain)
+	errs.Check(r.Time == 0 || validation.IsClientTime(r.Time), "time", "must be a unix time of the last %d days", int(validation.MaxClientAge.Hours()/24))
+	return errs.Err()
+}
+
+// Experience is the progress an elevator entry earns, one point per ten stairs
+func (r CreateElevatorRequest) Experience() float64 {
+	return float64(r.AmountStairs / 10)
 }
 
 type createElevatorResponse struct {
@@ -44,41 +71,27 @@ type createElevatorResponse struct {
 // @Success 200 {object} createElevatorResponse
 // @Router /elevator [post]
 func (t *Controller) create(c *fiber.Ctx) error {
-	c.Request().Header.Set("Content-Type", "application/json")
-	var req CreateElevatorRequest
-
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request body",
-			"err":     err,
-		})
-	}
+	req := validation.Parsed[CreateElevatorRequest](c)
 
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
+		return apperror.Validation("Missing userId header")
 	}
 
 	//check if user exists
-	_, err := t.userStorage.Get(userId, c.Context())
-
+	_, err := t.userStorage.Get(userId, c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "User does not exist",
-			"err":     err,
-		})
+		return err
+	}
+	if err := t.storage.CheckLimit(req, userId, time.Now(), c.UserContext()); err != nil {
+		return err
 	}
 
-	id, err := t.storage.Create(req, userId, c.Context())
+	id, err := t.storage.Create(req, userId, c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "Failed to Create Elevator",
-			"err":     err.Error(),
-		})
+		return err
 	}
-	err = t.progressStorage.AddExperience(userId, c.Context(), settings.PluginNameElevator, float64(req.AmountStairs/10))
+	err = t.progressStorage.AddExperience(userId, c.UserContext(), settings.PluginNameElevator, req.Experience())
 	if err != nil {
 		return err
 	}
@@ -95,14 +108,21 @@ func (t *Controller) create(c *fiber.Ctx) error {
 // @Param endTime query int64 false "end time"
 // @Param durationStart query int64 false "duration start time"
 // @Param durationEnd query int64 false "duration end time"
+// @Param period query string false "day, week or month in the time zone of the user, replaces start and end time"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
 // @Param minGain query int64 false "Minimum amount of height gained"
 // @Param maxGain query int64 false "Maximum amount of height gained"
-// @Param userId header string false "User ID"
+// @Param userId header string true "User ID"
 // @Produce json
 // @Success 200 {object} []ElevatorDB
 // @Router /elevator [Get]
 func (t *Controller) get(c *fiber.Ctx) error {
 	c.Request().Header.Set("Content-Type", "application/json")
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
 	//parse Query values
 	elevatorId := c.Query("id")
 	//map for time parameters
@@ -118,12 +138,13 @@ func (t *Controller) get(c *fiber.Ctx) error {
 	}
 
 	if elevatorId != "" {
-		// Get particular elevator
-		elevator, err := t.storage.Get(elevatorId, c.Context())
+		// Get particular elevator, the entries of other users are private
+		elevator, err := t.storage.Get(elevatorId, c.UserContext())
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Failed to get elevator",
-			})
+			return err
+		}
+		if elevator.UserID != userId {
+			return apperror.NotFound("elevator does not exist")
 		}
 		// convert to array
 		return c.Status(fiber.StatusOK).JSON(
@@ -131,30 +152,122 @@ func (t *Controller) get(c *fiber.Ctx) error {
 		)
 	}
 
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	// a period of the user's calendar replaces start and end time
+	if period := c.Query("period"); period != "" {
+		times["startTime"], times["endTime"], err = profile.Calendar().Range(calendar.Period(period), c.Query("date"), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	// all elevators items for a user between a time range and duration
+	elevators, err := t.storage.GetAllOfOneUserBetweenTimeAndDuration(userId, times, gain, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(elevators)
+}
+
+type importResponse struct {
+	// entries created from floors climbed
+	Imported int `json:"imported"`
+	// samples overlapping another sample or an earlier import
+	Duplicates int `json:"duplicates"`
+	// samples in the future, without a value or beyond MaxStairsPerHour
+	Rejected   int   `json:"rejected"`
+	HeightGain int64 `json:"heightGain"`
+	// steps of the samples without duplicates, steps are not stored
+	Steps int64 `json:"steps"`
+}
+
+// @Summary Import elevator entries
+// @Description Converts the floors climbed of a health platform export into elevator entries, samples overlapping other samples or earlier imports are skipped. Imported history earns no experience. The body is limited to 4 MB, larger Apple Health exports go through /import/apple-health.
+// @Tags elevator
+// @Accept xml
+// @Accept json
+// @Produce json
+// @Param format query string true "healthKit (export.xml) or googleFit (Google Takeout json)"
+// @Param userId header string true "User ID"
+// @Success 201 {object} importResponse
+// @Router /elevator/import [post]
+func (t *Controller) importSamples(c *fiber.Ctx) error {
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
-	} else {
-		_, err := t.userStorage.Get(userId, c.Context())
+		return apperror.Validation("Missing userId header")
+	}
 
-		if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "User does not exist",
-				"err":     err,
-			})
+	//check if user exists
+	_, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	format := ImportFormat(c.Query("format"))
+	samples, err := ParseSamples(format, bytes.NewReader(c.Body()))
+	if err != nil {
+		return err
+	}
+
+	var response importResponse
+	now := time.Now()
+	valid := make([]Sample, 0, len(samples))
+	for _, sample := range samples {
+		if !sample.IsValid(now) {
+			response.Rejected++
+			continue
 		}
-		// all elevators items for a user between a time range and duration
-		elevators, err := t.storage.GetAllOfOneUserBetweenTimeAndDuration(userId, times, gain, c.Context())
+		valid = append(valid, sample)
+	}
+	samples, response.Duplicates = DedupeSamples(valid)
+
+	floors := make([]Sample, 0, len(samples))
+	var startTime, endTime int64
+	for _, sample := range samples {
+		if sample.Kind == SampleKindSteps {
+			response.Steps += int64(sample.Value)
+			continue
+		}
+		if len(floors) == 0 || sample.StartTime < startTime {
+			startTime = sample.StartTime
+		}
+		if sample.EndTime > endTime {
+			endTime = sample.EndTime
+		}
+		floors = append(floors, sample)
+	}
+
+	// floors of earlier imports of the same period
+	if len(floors) > 0 {
+		existing, err := t.storage.GetImportedBetween(userId, startTime, endTime, c.UserContext())
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Failed to get elevators in time range",
-				"err":     err,
-			})
+			return err
 		}
-		return c.Status(fiber.StatusOK).JSON(elevators)
+		var duplicates int
+		floors, duplicates = WithoutImported(floors, existing)
+		response.Duplicates += duplicates
+	}
+
+	// imports follow the anti-cheat limit of entries
+	floors, limited, err := t.storage.LimitSamples(floors, userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	response.Rejected += limited
+
+	elevators, err := t.storage.CreateImported(floors, format, userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	// imported history earns no experience, like the imports of healthimport
+	for _, elevator := range elevators {
+		response.HeightGain += elevator.HeightGain
 	}
+	response.Imported = len(elevators)
+	return c.Status(fiber.StatusCreated).JSON(response)
 }
 
 func convertToInt64(value string) int64 {
@@ -2,15 +2,20 @@ package elevator
 
 import (
 	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/idempotency"
 	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
 	"cmd/http/main.go/internal/storage"
 	"cmd/http/main.go/internal/user"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,16 +25,19 @@ import (
 
 type Suite struct {
 	suite.Suite
-	app        *fiber.App
-	store      *Storage
-	userStore  *user.Storage
-	testUserId string
-	elevatorId string
+	app           *fiber.App
+	store         *Storage
+	userStore     *user.Storage
+	progressStore *progress.Storage
+	testUserId    string
+	elevatorId    string
 }
 
 func (suite *Suite) SetupSuite() {
 	// Define Fiber app.
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
 	MONGODB_URI := "mongodb://localhost:27017"
 	MONGODB_NAME := "testing"
 
@@ -46,10 +54,11 @@ func (suite *Suite) SetupSuite() {
 	userStore := user.NewStorage(db)
 	suite.userStore = userStore
 	progressStore := progress.NewStorage(db)
+	suite.progressStore = progressStore
 
 	suite.store = NewStorage(db)
 	elevatorController := NewController(suite.store, userStore, progressStore)
-	Routes(app, elevatorController)
+	Routes(app, elevatorController, idempotency.New(idempotency.NewStorage(db)))
 
 	// // add health check
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -145,7 +154,27 @@ func (suite *Suite) TestPost() {
 		{
 			description:  "Wrongly setting amount of stairs",
 			body:         Body{false, 12, 12},
-			expectedCode: fiber.StatusNotFound,
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Negative height gain",
+			body:         Body{true, 12, -12},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Client time",
+			body:         CreateElevatorRequest{Stairs: true, AmountStairs: 12, Time: time.Now().Add(-time.Hour).Unix()},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "Client time in the future",
+			body:         CreateElevatorRequest{Stairs: true, AmountStairs: 12, Time: time.Now().Add(time.Hour).Unix()},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "More stairs than an hour allows",
+			body:         Body{true, 9950, 12},
+			expectedCode: fiber.StatusUnprocessableEntity,
 		},
 	}
 
@@ -217,7 +246,19 @@ func (suite *Suite) TestGet() {
 		{
 			description:  "id does not exist",
 			query:        map[string]string{"id": "nonexistingid"},
-			expectedCode: fiber.StatusInternalServerError,
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:  "id of another user",
+			userId:       "otherId",
+			query:        map[string]string{"id": suite.elevatorId},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "id without userId header",
+			missingHeader: true,
+			query:         map[string]string{"id": suite.elevatorId},
+			expectedCode:  fiber.StatusBadRequest,
 		},
 		{
 			description:  "User does not exist",
@@ -290,6 +331,122 @@ func (suite *Suite) TestGet() {
 	}
 }
 
+const healthKitExport = `<?xml version="1.0" encoding="UTF-8"?>
+<HealthData locale="en_US">
+ <Record type="HKQuantityTypeIdentifierFlightsClimbed" sourceName="iPhone" unit="count" startDate="%[1]s" endDate="%[2]s" value="2"/>
+ <Record type="HKQuantityTypeIdentifierFlightsClimbed" sourceName="Watch" unit="count" startDate="%[1]s" endDate="%[2]s" value="3"/>
+ <Record type="HKQuantityTypeIdentifierStepCount" sourceName="iPhone" unit="count" startDate="%[1]s" endDate="%[2]s" value="120"/>
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Watch" unit="count/min" startDate="%[1]s" endDate="%[2]s" value="80"/>
+</HealthData>`
+
+func (suite *Suite) TestImport() {
+	end := time.Now().Add(-time.Hour)
+	export := fmt.Sprintf(healthKitExport, end.Add(-5*time.Minute).Format(healthKitDateFormat), end.Format(healthKitDateFormat))
+
+	post := func(format string, body string) (int, importResponse) {
+		req := httptest.NewRequest("POST", "/elevator/import?format="+format, strings.NewReader(body))
+		req.Header.Set("userId", suite.testUserId)
+		resp, err := suite.app.Test(req, -1)
+		suite.NoError(err)
+
+		var imported importResponse
+		if resp.StatusCode == fiber.StatusCreated {
+			suite.NoError(json.NewDecoder(resp.Body).Decode(&imported))
+		}
+		return resp.StatusCode, imported
+	}
+
+	// the watch counted more floors than the phone for the same minutes
+	code, imported := post("healthKit", export)
+	suite.Equal(fiber.StatusCreated, code)
+	suite.Equal(1, imported.Imported)
+	suite.Equal(1, imported.Duplicates)
+	suite.Equal(int64(3*metersPerFloor), imported.HeightGain)
+	suite.Equal(int64(120), imported.Steps)
+
+	// imported history earns no experience
+	experience, err := suite.progressStore.GetExperience(suite.testUserId, context.Background())
+	suite.NoError(err)
+	suite.Zero(experience[settings.PluginNameElevator])
+
+	// importing the same export again creates nothing
+	code, imported = post("healthKit", export)
+	suite.Equal(fiber.StatusCreated, code)
+	suite.Equal(0, imported.Imported)
+	suite.Equal(2, imported.Duplicates)
+
+	code, _ = post("healthKit", "not xml <")
+	suite.Equal(fiber.StatusBadRequest, code)
+
+	code, _ = post("fitbit", export)
+	suite.Equal(fiber.StatusBadRequest, code)
+}
+
+func TestParseGoogleFit(t *testing.T) {
+	export := `{"Data Source": "derived:com.google.step_count.delta", "Data Points": [
+		{"dataTypeName": "com.google.step_count.delta", "originDataSourceId": "phone", "startTimeNanos": 1680000000000000000, "endTimeNanos": 1680000060000000000, "fitValue": [{"value": {"intVal": 90}}]},
+		{"dataTypeName": "com.google.floors_climbed.delta", "originDataSourceId": "phone", "startTimeNanos": 1680000000000000000, "endTimeNanos": 1680000060000000000, "fitValue": [{"value": {"fpVal": 1.5}}]},
+		{"dataTypeName": "com.google.heart_rate.bpm", "originDataSourceId": "watch", "startTimeNanos": 1680000000000000000, "endTimeNanos": 1680000000000000000, "fitValue": [{"value": {"fpVal": 70}}]}
+	]}`
+
+	samples, err := ParseSamples(FormatGoogleFit, strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("Could not parse export: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(samples))
+	}
+	if samples[0].Kind != SampleKindSteps || samples[0].Value != 90 || samples[0].EndTime != 1680000060 {
+		t.Errorf("unexpected step sample %+v", samples[0])
+	}
+	if entry := samples[1].Entry(); entry.AmountStairs != 24 || entry.HeightGain != 5 {
+		t.Errorf("unexpected entry %+v of floors sample", entry)
+	}
+}
+
+func TestDedupeSamples(t *testing.T) {
+	samples := []Sample{
+		{Kind: SampleKindFloors, StartTime: 100, EndTime: 200, Value: 2},
+		{Kind: SampleKindSteps, StartTime: 100, EndTime: 200, Value: 50},
+		{Kind: SampleKindFloors, StartTime: 150, EndTime: 250, Value: 4},
+		{Kind: SampleKindFloors, StartTime: 300, EndTime: 300, Value: 1},
+		{Kind: SampleKindFloors, StartTime: 300, EndTime: 300, Value: 1},
+	}
+
+	kept, duplicates := DedupeSamples(samples)
+	if duplicates != 2 || len(kept) != 3 {
+		t.Fatalf("expected 3 samples and 2 duplicates, got %d and %d", len(kept), duplicates)
+	}
+	if kept[0].Value != 4 {
+		t.Errorf("expected the overlapping sample with the most floors, got %+v", kept[0])
+	}
+
+	// an earlier import covered the last sample
+	kept, duplicates = WithoutImported(kept, []ElevatorDB{{StartTime: 300, Time: 300}})
+	if duplicates != 1 || len(kept) != 2 {
+		t.Errorf("expected 2 samples and 1 duplicate, got %d and %d", len(kept), duplicates)
+	}
+}
+
+func TestLimitStairs(t *testing.T) {
+	existing := []ElevatorDB{{Time: 1000, AmountStairs: 9000}}
+	samples := []Sample{
+		{Kind: SampleKindFloors, StartTime: 1400, EndTime: 1500, Value: 50},
+		// together with the hour before more than MaxStairsPerHour
+		{Kind: SampleKindFloors, StartTime: 1900, EndTime: 2000, Value: 20},
+		// the existing entry is more than an hour ago
+		{Kind: SampleKindFloors, StartTime: 4500, EndTime: 4600, Value: 20},
+	}
+
+	kept, limited := limitStairs(samples, existing)
+	if limited != 1 || len(kept) != 2 {
+		t.Fatalf("expected 2 samples and 1 limited, got %d and %d", len(kept), limited)
+	}
+	if kept[0].EndTime != 1500 || kept[1].EndTime != 4600 {
+		t.Errorf("expected the samples within the limit, got %+v", kept)
+	}
+}
+
 // In order for 'go test' to run this suite, we need to create
 // a normal test function and pass our suite to suite.Run
 func TestTripTestSuite(t *testing.T) {
@@ -0,0 +1,245 @@
+package elevator
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/validation"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ImportFormat is the health platform an export comes from
+type ImportFormat string
+
+const (
+	// export.xml of the Apple Health app
+	FormatHealthKit ImportFormat = "healthKit"
+	// json files of the Google Fit data in Google Takeout
+	FormatGoogleFit ImportFormat = "googleFit"
+)
+
+func (f ImportFormat) IsValid() bool {
+	return f == FormatHealthKit || f == FormatGoogleFit
+}
+
+type SampleKind string
+
+const (
+	SampleKindFloors SampleKind = "floors"
+	SampleKindSteps  SampleKind = "steps"
+)
+
+// Sample is one measurement of a health platform
+type Sample struct {
+	Kind SampleKind
+	// app or device that measured the sample
+	Source string
+	// unix seconds
+	StartTime int64
+	EndTime   int64
+	Value     float64
+}
+
+func (s Sample) overlaps(other Sample) bool {
+	return s.StartTime == other.StartTime || (s.StartTime < other.EndTime && other.StartTime < s.EndTime)
+}
+
+// a floor climbed in stairs and meters
+const (
+	stairsPerFloor = 16
+	metersPerFloor = 3
+)
+
+// Entry converts floors climbed into an elevator entry
+func (s Sample) Entry() CreateElevatorRequest {
+	return CreateElevatorRequest{
+		Stairs:       true,
+		AmountStairs: int(math.Round(s.Value * stairsPerFloor)),
+		HeightGain:   int64(math.Round(s.Value * metersPerFloor)),
+		Time:         s.EndTime,
+	}
+}
+
+// record types of HealthKit
+const (
+	healthKitFloors     = "HKQuantityTypeIdentifierFlightsClimbed"
+	healthKitSteps      = "HKQuantityTypeIdentifierStepCount"
+	healthKitDateFormat = "2006-01-02 15:04:05 -0700"
+)
+
+// data types of Google Fit
+const (
+	googleFitFloors = "com.google.floors_climbed.delta"
+	googleFitSteps  = "com.google.step_count.delta"
+)
+
+// ParseSamples reads the floor and step samples of an export, other samples are skipped
+func ParseSamples(format ImportFormat, r io.Reader) ([]Sample, error) {
+	switch format {
+	case FormatHealthKit:
+		return parseHealthKit(r)
+	case FormatGoogleFit:
+		return parseGoogleFit(r)
+	}
+	return nil, apperror.Validation("format must be one of %s, %s", FormatHealthKit, FormatGoogleFit)
+}
+
+// parseHealthKit reads the records of an export.xml one by one
+func parseHealthKit(r io.Reader) ([]Sample, error) {
+	decoder := xml.NewDecoder(r)
+	samples := make([]Sample, 0)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, apperror.Validation("body must be a HealthKit export: %v", err)
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok || element.Name.Local != "Record" {
+			continue
+		}
+		attributes := make(map[string]string, len(element.Attr))
+		for _, attribute := range element.Attr {
+			attributes[attribute.Name.Local] = attribute.Value
+		}
+
+		sample := Sample{Source: attributes["sourceName"]}
+		switch attributes["type"] {
+		case healthKitFloors:
+			sample.Kind = SampleKindFloors
+		case healthKitSteps:
+			sample.Kind = SampleKindSteps
+		default:
+			continue
+		}
+
+		start, startErr := time.Parse(healthKitDateFormat, attributes["startDate"])
+		end, endErr := time.Parse(healthKitDateFormat, attributes["endDate"])
+		value, valueErr := strconv.ParseFloat(attributes["value"], 64)
+		if startErr != nil || endErr != nil || valueErr != nil {
+			return nil, apperror.Validation("body must be a HealthKit export: invalid %s record", attributes["type"])
+		}
+		sample.StartTime = start.Unix()
+		sample.EndTime = end.Unix()
+		sample.Value = value
+		samples = append(samples, sample)
+	}
+}
+
+type googleFitExport struct {
+	DataPoints []struct {
+		DataTypeName       string `json:"dataTypeName"`
+		OriginDataSourceID string `json:"originDataSourceId"`
+		StartTimeNanos     int64  `json:"startTimeNanos"`
+		EndTimeNanos       int64  `json:"endTimeNanos"`
+		FitValue           []struct {
+			Value struct {
+				IntVal *int64   `json:"intVal"`
+				FpVal  *float64 `json:"fpVal"`
+			} `json:"value"`
+		} `json:"fitValue"`
+	} `json:"Data Points"`
+}
+
+func parseGoogleFit(r io.Reader) ([]Sample, error) {
+	var export googleFitExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, apperror.Validation("body must be a Google Fit export: %v", err)
+	}
+
+	samples := make([]Sample, 0, len(export.DataPoints))
+	for _, point := range export.DataPoints {
+		sample := Sample{
+			Source:    point.OriginDataSourceID,
+			StartTime: point.StartTimeNanos / int64(time.Second),
+			EndTime:   point.EndTimeNanos / int64(time.Second),
+		}
+		switch point.DataTypeName {
+		case googleFitFloors:
+			sample.Kind = SampleKindFloors
+		case googleFitSteps:
+			sample.Kind = SampleKindSteps
+		default:
+			continue
+		}
+		if len(point.FitValue) == 0 {
+			return nil, apperror.Validation("body must be a Google Fit export: %s point without value", point.DataTypeName)
+		}
+		switch value := point.FitValue[0].Value; {
+		case value.IntVal != nil:
+			sample.Value = float64(*value.IntVal)
+		case value.FpVal != nil:
+			sample.Value = *value.FpVal
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// IsValid rejects samples that can not be measured, exports may contain years
+// of history so only the future is limited
+func (s Sample) IsValid(now time.Time) bool {
+	if s.Kind == SampleKindFloors && s.Entry().AmountStairs > maxAmountStairs {
+		return false
+	}
+	return s.Value > 0 && s.StartTime > 0 && s.StartTime <= s.EndTime && s.EndTime <= now.Add(validation.MaxClockSkew).Unix()
+}
+
+// DedupeSamples drops samples overlapping another one of the same kind, the
+// phone and the watch often count the same stairs. Of overlapping samples the
+// one with the highest value is kept.
+func DedupeSamples(samples []Sample) (kept []Sample, duplicates int) {
+	sorted := append([]Sample(nil), samples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime < sorted[j].StartTime
+	})
+
+	kept = make([]Sample, 0, len(sorted))
+	last := make(map[SampleKind]int)
+	for _, sample := range sorted {
+		if i, ok := last[sample.Kind]; ok && kept[i].overlaps(sample) {
+			duplicates++
+			if sample.Value > kept[i].Value {
+				kept[i] = sample
+			}
+			continue
+		}
+		last[sample.Kind] = len(kept)
+		kept = append(kept, sample)
+	}
+	return kept, duplicates
+}
+
+// WithoutImported drops the samples overlapping entries of an earlier import,
+// existing has to be sorted by time and free of overlaps
+func WithoutImported(samples []Sample, existing []ElevatorDB) (kept []Sample, duplicates int) {
+	kept = make([]Sample, 0, len(samples))
+	for _, sample := range samples {
+		if overlapsImported(sample, existing) {
+			duplicates++
+			continue
+		}
+		kept = append(kept, sample)
+	}
+	return kept, duplicates
+}
+
+func overlapsImported(sample Sample, existing []ElevatorDB) bool {
+	// entries ending before the sample starts can not overlap
+	i := sort.Search(len(existing), func(i int) bool {
+		return existing[i].Time >= sample.StartTime
+	})
+	for ; i < len(existing) && existing[i].StartTime <= sample.EndTime; i++ {
+		if sample.overlaps(Sample{StartTime: existing[i].StartTime, EndTime: existing[i].Time}) {
+			return true
+		}
+	}
+	return false
+}
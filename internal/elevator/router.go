@@ -1,13 +1,19 @@
 package elevator
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"cmd/http/main.go/internal/validation"
 
-func Routes(app *fiber.App, controller *Controller) {
+	"github.com/gofiber/fiber/v2"
+)
+
+// idempotent guards the create route against duplicates from client retries
+func Routes(app fiber.Router, controller *Controller, idempotent fiber.Handler) {
 	meditation := app.Group("/elevator")
 
 	// add middlewares here
 
 	// add routes here
-	meditation.Post("/", controller.create)
+	meditation.Post("/", idempotent, validation.Body[CreateElevatorRequest](), controller.create)
 	meditation.Get("/", controller.get)
+	meditation.Post("/import", idempotent, controller.importSamples)
 }
@@ -1,14 +1,17 @@
 package elevator
 
 import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/storage"
 	"context"
-	"fmt"
 	"math"
+	"sort"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ElevatorDB struct {
@@ -18,6 +21,11 @@ type ElevatorDB struct {
 	Stairs       bool               `json:"stairs" bson:"stairs"`
 	AmountStairs int                `json:"amountStairs" bson:"amountStairs"`
 	HeightGain   int64              `json:"heightGain" bson:"heightGain"`
+	// unix seconds when the server stored the entry, time is the one of the client
+	ServerTime int64 `json:"serverTime" bson:"serverTime"`
+	// health platform of imported entries, their samples end at time
+	Source    ImportFormat `json:"source,omitempty" bson:"source,omitempty"`
+	StartTime int64        `json:"startTime,omitempty" bson:"startTime,omitempty"`
 }
 
 type Storage struct {
@@ -30,50 +38,134 @@ func NewStorage(db *mongo.Database) *Storage {
 	}
 }
 
+// the version of the records after Migrate
+const schemaVersion = 1
+
+// Migrate backfills entries of older versions and creates the index for range
+// queries. It is safe to run on every start.
+func (s *Storage) Migrate(ctx context.Context) error {
+	collection := s.db.Collection("elevator")
+
+	// older versions stored the server time as time
+	_, err := collection.UpdateMany(ctx, bson.M{"serverTime": bson.M{"$exists": false}}, bson.A{
+		bson.M{"$set": bson.M{"serverTime": "$time"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "time", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	return storage.SetSchemaVersion(s.db, "elevator", schemaVersion, ctx)
+}
+
+// Migrated returns an error if the records were not migrated to the version of this code
+func (s *Storage) Migrated(ctx context.Context) error {
+	return storage.CheckSchemaVersion(s.db, "elevator", schemaVersion, ctx)
+}
+
 func (s *Storage) Create(request CreateElevatorRequest, userId string, ctx context.Context) (string, error) {
 	collection := s.db.Collection("elevator")
 
 	createdAt := time.Now().Unix()
-	if request.AmountStairs != 0 && !request.Stairs {
-		return "", fmt.Errorf("amountStairs can only be set if stairs is true")
+	if err := request.Validate(); err != nil {
+		return "", err
+	}
+
+	clientTime := request.Time
+	if clientTime == 0 {
+		clientTime = createdAt
 	}
 
 	elevator := ElevatorDB{
 		ID:           primitive.NewObjectID(),
 		UserID:       userId,
-		Time:         createdAt,
+		Time:         clientTime,
+		ServerTime:   createdAt,
 		Stairs:       request.Stairs,
 		AmountStairs: request.AmountStairs,
 		HeightGain:   request.HeightGain,
 	}
 
 	result, err := collection.InsertOne(ctx, elevator)
-
 	if err != nil {
-		return "", err
+		return "", apperror.FromMongo(err, "elevator")
 	}
 
 	// convert the object id to a string
 	return result.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
+// CreateImported stores the floors climbed of samples of a health platform
+func (s *Storage) CreateImported(samples []Sample, source ImportFormat, userId string, ctx context.Context) ([]ElevatorDB, error) {
+	collection := s.db.Collection("elevator")
+
+	createdAt := time.Now().Unix()
+	elevators := make([]ElevatorDB, 0, len(samples))
+	documents := make([]interface{}, 0, len(samples))
+	for _, sample := range samples {
+		entry := sample.Entry()
+		elevator := ElevatorDB{
+			ID:           primitive.NewObjectID(),
+			UserID:       userId,
+			Time:         entry.Time,
+			ServerTime:   createdAt,
+			Stairs:       entry.Stairs,
+			AmountStairs: entry.AmountStairs,
+			HeightGain:   entry.HeightGain,
+			Source:       source,
+			StartTime:    sample.StartTime,
+		}
+		elevators = append(elevators, elevator)
+		documents = append(documents, elevator)
+	}
+	if len(documents) == 0 {
+		return elevators, nil
+	}
+
+	if _, err := collection.InsertMany(ctx, documents); err != nil {
+		return nil, apperror.FromMongo(err, "elevators")
+	}
+	return elevators, nil
+}
+
+// GetImportedBetween returns the imported entries of a user whose samples
+// overlap startTime to endTime, sorted by time
+func (s *Storage) GetImportedBetween(userId string, startTime int64, endTime int64, ctx context.Context) ([]ElevatorDB, error) {
+	collection := s.db.Collection("elevator")
+
+	cursor, err := collection.Find(ctx,
+		bson.M{"userId": userId, "source": bson.M{"$exists": true}, "time": bson.M{"$gte": startTime}, "startTime": bson.M{"$lte": endTime}},
+		options.Find().SetSort(bson.D{{Key: "time", Value: 1}}),
+	)
+	if err != nil {
+		return nil, apperror.FromMongo(err, "elevators")
+	}
+
+	elevators := make([]ElevatorDB, 0)
+	if err := cursor.All(ctx, &elevators); err != nil {
+		return nil, apperror.FromMongo(err, "elevators")
+	}
+	return elevators, nil
+}
+
 func (s *Storage) Get(elevatorID string, ctx context.Context) (ElevatorDB, error) {
 	collection := s.db.Collection("elevator")
 	elevatorRecord := ElevatorDB{}
 
+	// an id that is no object id cannot exist
 	objectID, err := primitive.ObjectIDFromHex(elevatorID)
 	if err != nil {
-		return elevatorRecord, err
+		return elevatorRecord, apperror.NotFound("elevator does not exist")
 	}
 
 	cursor := collection.FindOne(ctx, bson.M{"_id": objectID})
-
-	if err := cursor.Err(); err != nil {
-		return elevatorRecord, err
-	}
-
 	if err := cursor.Decode(&elevatorRecord); err != nil {
-		return elevatorRecord, err
+		return elevatorRecord, apperror.FromMongo(err, "elevator")
 	}
 	return elevatorRecord, nil
 }
@@ -96,20 +188,167 @@ func (s *Storage) GetAllOfOneUserBetweenTimeAndDuration(userId string, times map
 	elevators := make([]ElevatorDB, 0)
 	cursor, err = collection.Find(ctx, bson.M{"userId": userId, "time": bson.M{"$gte": times["startTime"], "$lte": times["endTime"]}, "amountStairs": bson.M{"$gte": times["durationStart"], "$lte": times["durationEnd"]}, "heightGain": bson.M{"$gte": gain["minGain"], "$lte": gain["maxGain"]}})
 	if err != nil {
-		return nil, err
+		return nil, apperror.FromMongo(err, "elevators")
 	}
 
 	for cursor.Next(ctx) {
 		var elevator ElevatorDB
 		if err := cursor.Decode(&elevator); err != nil {
-			return nil, err
+			return nil, apperror.FromMongo(err, "elevators")
 		}
 		elevators = append(elevators, elevator)
 	}
 	if err := cursor.Err(); err != nil {
-		return nil, err
+		return nil, apperror.FromMongo(err, "elevators")
 	}
 
 	// return the elevator list
 	return elevators, nil
 }
+
+// GetCreatedSince returns the elevators of a user created at or after since (unix seconds),
+// the creation time is part of the object id
+func (s *Storage) GetCreatedSince(userId string, since int64, ctx context.Context) ([]ElevatorDB, error) {
+	collection := s.db.Collection("elevator")
+	sinceID := primitive.NewObjectIDFromTimestamp(time.Unix(since, 0))
+
+	cursor, err := collection.Find(ctx, bson.M{"userId": userId, "_id": bson.M{"$gte": sinceID}})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "elevators")
+	}
+
+	elevators := make([]ElevatorDB, 0)
+	if err := cursor.All(ctx, &elevators); err != nil {
+		return nil, apperror.FromMongo(err, "elevators")
+	}
+	return elevators, nil
+}
+
+// GetStairsOfUsers returns the stairs climbed by each of userIds between
+// startTime and endTime, users without any are missing
+func (s *Storage) GetStairsOfUsers(userIds []string, startTime int64, endTime int64, ctx context.Context) (map[string]float64, error) {
+	return s.sumOfUsers("amountStairs", userIds, startTime, endTime, ctx)
+}
+
+// GetHeightGainOfUsers returns the meters climbed by stairs of each of userIds
+// between startTime and endTime, users without any are missing
+func (s *Storage) GetHeightGainOfUsers(userIds []string, startTime int64, endTime int64, ctx context.Context) (map[string]float64, error) {
+	return s.sumOfUsers("heightGain", userIds, startTime, endTime, ctx)
+}
+
+func (s *Storage) sumOfUsers(field string, userIds []string, startTime int64, endTime int64, ctx context.Context) (map[string]float64, error) {
+	collection := s.db.Collection("elevator")
+
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"userId": bson.M{"$in": userIds}, "stairs": true, "time": bson.M{"$gte": startTime, "$lte": endTime}}},
+		bson.M{"$group": bson.M{"_id": "$userId", "sum": bson.M{"$sum": "$" + field}}},
+		bson.M{"$match": bson.M{"sum": bson.M{"$gt": 0}}},
+	})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "elevators")
+	}
+
+	var groups []struct {
+		UserID string  `bson:"_id"`
+		Sum    float64 `bson:"sum"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, apperror.FromMongo(err, "elevators")
+	}
+
+	sums := make(map[string]float64, len(groups))
+	for _, group := range groups {
+		sums[group.UserID] = group.Sum
+	}
+	return sums, nil
+}
+
+// anti-cheat, an hour of climbing fits in a single entry at most
+const MaxStairsPerHour = maxAmountStairs
+
+// CheckLimit rejects an entry that exceeds MaxStairsPerHour together with the
+// entries of the hour before it
+func (s *Storage) CheckLimit(req CreateElevatorRequest, userId string, now time.Time, ctx context.Context) error {
+	if req.AmountStairs == 0 {
+		return nil
+	}
+	at := req.Time
+	if at == 0 {
+		at = now.Unix()
+	}
+	stairs, err := s.GetStairsOfUsers([]string{userId}, at-int64(time.Hour.Seconds())+1, at, ctx)
+	if err != nil {
+		return err
+	}
+	if stairs[userId]+float64(req.AmountStairs) > MaxStairsPerHour {
+		return apperror.Unprocessable("At most %d stairs per hour, %d are left", MaxStairsPerHour, MaxStairsPerHour-int(stairs[userId]))
+	}
+	return nil
+}
+
+// LimitSamples drops the floor samples that exceed MaxStairsPerHour together
+// with the entries and kept samples of the hour before them, like CheckLimit
+func (s *Storage) LimitSamples(samples []Sample, userId string, ctx context.Context) (kept []Sample, limited int, err error) {
+	if len(samples) == 0 {
+		return samples, 0, nil
+	}
+	sorted := append([]Sample(nil), samples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].EndTime < sorted[j].EndTime
+	})
+
+	hour := int64(time.Hour.Seconds())
+	collection := s.db.Collection("elevator")
+	cursor, err := collection.Find(ctx,
+		bson.M{"userId": userId, "time": bson.M{"$gt": sorted[0].EndTime - hour, "$lte": sorted[len(sorted)-1].EndTime}},
+		options.Find().SetSort(bson.D{{Key: "time", Value: 1}}),
+	)
+	if err != nil {
+		return nil, 0, apperror.FromMongo(err, "elevators")
+	}
+	var existing []ElevatorDB
+	if err := cursor.All(ctx, &existing); err != nil {
+		return nil, 0, apperror.FromMongo(err, "elevators")
+	}
+
+	kept, limited = limitStairs(sorted, existing)
+	return kept, limited, nil
+}
+
+// limitStairs keeps the samples, sorted by end time, whose hour before stays
+// within MaxStairsPerHour. existing has to be sorted by time.
+func limitStairs(samples []Sample, existing []ElevatorDB) (kept []Sample, limited int) {
+	hour := int64(time.Hour.Seconds())
+	type climb struct {
+		time   int64
+		stairs int
+	}
+	// the counted climbs of the last hour, in time order
+	window := make([]climb, 0)
+	var stairs, next int
+
+	kept = make([]Sample, 0, len(samples))
+	for _, sample := range samples {
+		at := sample.EndTime
+		for ; next < len(existing) && existing[next].Time <= at; next++ {
+			window = append(window, climb{time: existing[next].Time, stairs: existing[next].AmountStairs})
+			stairs += existing[next].AmountStairs
+		}
+		// entries added out of order are still counted at their time
+		sort.SliceStable(window, func(i, j int) bool { return window[i].time < window[j].time })
+		for len(window) > 0 && window[0].time <= at-hour {
+			stairs -= window[0].stairs
+			window = window[1:]
+		}
+
+		amount := sample.Entry().AmountStairs
+		if stairs+amount > MaxStairsPerHour {
+			limited++
+			continue
+		}
+		window = append(window, climb{time: at, stairs: amount})
+		stairs += amount
+		kept = append(kept, sample)
+	}
+	return kept, limited
+}
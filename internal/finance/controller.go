@@ -1,11 +1,14 @@
 package finance
 
 import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/calendar"
 	"cmd/http/main.go/internal/progress"
 	"cmd/http/main.go/internal/settings"
 	"cmd/http/main.go/internal/user"
-	"fmt"
+	"cmd/http/main.go/internal/validation"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -32,6 +35,22 @@ type CreateSpendingRequest struct {
 	Description  string  `json:"description" bson:"description"`
 }
 
+const maxDescriptionLength = 500
+
+func (r CreateSpendingRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(r.Amount > 0, "amount", "must be greater than 0")
+	errs.Check(r.Saving >= 0, "saving", "must not be negative")
+	errs.Check(r.SpendingTime >= 0, "spendingTime", "must not be negative")
+	errs.Check(len(r.Description) <= maxDescriptionLength, "description", "must be at most %d characters", maxDescriptionLength)
+	return errs.Err()
+}
+
+// Experience is the progress a spending earns, half a point per saved unit
+func (r CreateSpendingRequest) Experience() float64 {
+	return r.Saving / 2
+}
+
 type createSpendingResponse struct {
 	ID string `json:"id"`
 }
@@ -55,41 +74,20 @@ type getInvestmentResponse struct {
 // @Success 200 {object} createSpendingResponse
 // @Router /finance [post]
 func (t *Controller) create(c *fiber.Ctx) error {
-	c.Request().Header.Set("Content-Type", "application/json")
-	var req CreateSpendingRequest
+	req := validation.Parsed[CreateSpendingRequest](c)
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
-	}
-
-	if err := c.BodyParser(&req); err != nil {
-		fmt.Println(err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request body",
-			"err":     err,
-		})
-	}
-
-	//TODO correct error handling
-	id, err := t.storage.create(req, userId, c.Context())
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "Failed to create",
-			"err":     err,
-		})
+		return apperror.Validation("Missing userId header")
 	}
 
+	id, err := t.storage.Create(req, userId, c.UserContext())
 	if err != nil {
 		return err
 	}
-	err = t.progressStorage.AddExperience(userId, c.Context(), settings.PluginNameFinance, float64(req.Saving)/2)
+
+	err = t.progressStorage.AddExperience(userId, c.UserContext(), settings.PluginNameFinance, req.Experience())
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to add experience",
-			"err":     err,
-		})
+		return apperror.Internal("Failed to add experience", err)
 	}
 	return c.Status(fiber.StatusCreated).JSON(createSpendingResponse{
 		ID: id,
@@ -103,6 +101,8 @@ func (t *Controller) create(c *fiber.Ctx) error {
 // @Param id query string false "investment ID"
 // @Param startTime query int64 false "start time"
 // @Param endTime query int64 false "end time"
+// @Param period query string false "day, week or month in the time zone of the user, replaces start and end time"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
 // @Produce json
 // @Success 200 {object} getInvestmentResponse
 // @Router /finance [get]
@@ -118,30 +118,22 @@ func (t *Controller) get(c *fiber.Ctx) error {
 	if startTimeStr != "" {
 		startTime, err = strconv.ParseInt(startTimeStr, 10, 64)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"message": "Invalid startTime parameter",
-				"err":     err,
-			})
+			return apperror.Validation("Invalid startTime parameter")
 		}
 	}
 
 	if endTimeStr != "" {
 		endTime, err = strconv.ParseInt(endTimeStr, 10, 64)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"message": "Invalid endTime parameter",
-				"err":     err,
-			})
+			return apperror.Validation("Invalid endTime parameter")
 		}
 	}
 
 	if particularInvestment != "" {
 		// Get particular investment investment
-		investment, err := t.storage.get(particularInvestment, c.Context())
+		investment, err := t.storage.Get(particularInvestment, c.UserContext())
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Failed to get investment",
-			})
+			return err
 		}
 		// Convert FinanceDb to getInvestmentResponse
 		investmentResponse := getInvestmentResponse(investment)
@@ -150,45 +142,44 @@ func (t *Controller) get(c *fiber.Ctx) error {
 
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
+		return apperror.Validation("Missing userId header")
 	} else {
-		_, err := t.userStorage.Get(userId, c.Context())
-
+		profile, err := t.userStorage.Get(userId, c.UserContext())
 		if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "User does not exist",
-				"err":     err,
-			})
+			return err
 		}
-		if startTimeStr == "" && endTimeStr == "" {
-			// all investments for a user
-			investments, err := t.storage.getAllOfOneUser(userId, c.Context())
 
+		// a period of the user's calendar replaces start and end time
+		if period := c.Query("period"); period != "" {
+			startTime, endTime, err = profile.Calendar().Range(calendar.Period(period), c.Query("date"), time.Now())
 			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"message": "Failed to get investments",
-					"err":     err,
-				})
+				return err
+			}
+			// all investments for a user within the period
+			investments, err := t.storage.GetAllOfOneUserBetweenTime(userId, startTime, endTime, c.UserContext())
+			if err != nil {
+				return err
+			}
+			return c.Status(fiber.StatusOK).JSON(investments)
+		}
 
+		if startTimeStr == "" && endTimeStr == "" {
+			// all investments for a user
+			investments, err := t.storage.GetAllOfOneUser(userId, c.UserContext())
+			if err != nil {
+				return err
 			}
 			return c.Status(fiber.StatusOK).JSON(investments)
 		}
 		if startTimeStr != "" || endTimeStr != "" {
 			// all investments for a user between a time range
 			// Todo if startTime is given and endTime is not given, then return all investments after startTime
-			investments, err := t.storage.getAllOfOneUserBetweenTime(userId, startTime, endTime, c.Context())
+			investments, err := t.storage.GetAllOfOneUserBetweenTime(userId, startTime, endTime, c.UserContext())
 			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"message": "Failed to get investments in time range",
-					"err":     err,
-				})
+				return err
 			}
 			return c.Status(fiber.StatusOK).JSON(investments)
 		}
 	}
-	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-		"message": "Invalid request body",
-	})
+	return apperror.Validation("Invalid request body")
 }
@@ -2,6 +2,8 @@ package finance
 
 import (
 	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/idempotency"
 	"cmd/http/main.go/internal/progress"
 	"cmd/http/main.go/internal/storage"
 	"cmd/http/main.go/internal/user"
@@ -29,7 +31,9 @@ type Suite struct {
 
 func (suite *Suite) SetupSuite() {
 	// Define Fiber app.
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
 	MONGODB_URI := "mongodb://localhost:27017"
 	MONGODB_NAME := "testing-finance"
 
@@ -49,7 +53,7 @@ func (suite *Suite) SetupSuite() {
 
 	suite.store = NewStorage(db)
 	finCon := NewController(suite.store, userStore, progressStore)
-	Routes(app, finCon)
+	Routes(app, finCon, idempotency.New(idempotency.NewStorage(db)))
 
 	// // add health check
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -97,7 +101,7 @@ func (suite *Suite) BeforeTest(suiteName, testName string) {
 	log.Println("BEFORE TEST DONE", testId)
 
 	// create test evelevators
-	financeId, err := suite.store.create(CreateSpendingRequest{
+	financeId, err := suite.store.Create(CreateSpendingRequest{
 		Amount:       100,
 		Saving:       100,
 		SpendingTime: time.Now().Unix(),
@@ -115,6 +119,8 @@ func (suite *Suite) TestPost() {
 	route := "/finance"
 
 	type Body struct {
+		Amount float64 `json:"amount"`
+		Saving float64 `json:"saving"`
 	}
 
 	tests := []struct {
@@ -126,7 +132,7 @@ func (suite *Suite) TestPost() {
 	}{
 		{
 			description:  "Create successfully",
-			body:         Body{},
+			body:         Body{12.5, 0.5},
 			expectedCode: fiber.StatusCreated,
 		},
 		{
@@ -137,9 +143,14 @@ func (suite *Suite) TestPost() {
 		{
 			description:  "User does not exist",
 			userId:       "doesntexist",
-			body:         Body{},
+			body:         Body{12.5, 0.5},
 			expectedCode: fiber.StatusNotFound,
 		},
+		{
+			description:  "Negative saving",
+			body:         Body{12.5, -1},
+			expectedCode: fiber.StatusBadRequest,
+		},
 		{
 			description:   "Missing userId header",
 			missingHeader: true,
@@ -216,7 +227,7 @@ func (suite *Suite) TestGet() {
 		{
 			description:  "id does not exist",
 			query:        map[string]string{"id": "nonexistingid"},
-			expectedCode: fiber.StatusInternalServerError,
+			expectedCode: fiber.StatusNotFound,
 		},
 		{
 			description:  "User does not exist",
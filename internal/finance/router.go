@@ -1,13 +1,18 @@
 package finance
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"cmd/http/main.go/internal/validation"
 
-func Routes(app *fiber.App, controller *Controller) {
+	"github.com/gofiber/fiber/v2"
+)
+
+// idempotent guards the create route against duplicates from client retries
+func Routes(app fiber.Router, controller *Controller, idempotent fiber.Handler) {
 	finance := app.Group("/finance")
 
 	// add middlewares here
 
 	// add routes here
-	finance.Post("/", controller.create)
+	finance.Post("/", idempotent, validation.Body[CreateSpendingRequest](), controller.create)
 	finance.Get("/", controller.get)
 }
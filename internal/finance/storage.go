@@ -1,15 +1,16 @@
 package finance
 
 import (
+	"cmd/http/main.go/internal/apperror"
 	"context"
-	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-type financeDB struct {
+type FinanceDB struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id"`
 	UserID       string             `json:"userId" bson:"userId"`
 	SpendingTime int64              `json:"spendingTime" bson:"spendingTime"`
@@ -28,17 +29,16 @@ func NewStorage(db *mongo.Database) *Storage {
 	}
 }
 
-func (s *Storage) create(request CreateSpendingRequest, userId string, ctx context.Context) (string, error) {
+func (s *Storage) Create(request CreateSpendingRequest, userId string, ctx context.Context) (string, error) {
 	collection := s.db.Collection("investment")
 	userCollection := s.db.Collection("users")
 
 	//Check if user exists
 	userResult := userCollection.FindOne(ctx, bson.M{"_id": userId})
-
 	if err := userResult.Err(); err != nil {
-		return "", err
+		return "", apperror.FromMongo(err, "user")
 	}
-	statement := financeDB{
+	statement := FinanceDB{
 		ID:           primitive.NewObjectID(),
 		UserID:       userId,
 		SpendingTime: request.SpendingTime,
@@ -48,97 +48,168 @@ func (s *Storage) create(request CreateSpendingRequest, userId string, ctx conte
 	}
 
 	result, err := collection.InsertOne(ctx, statement)
-
 	if err != nil {
-		return "", err
+		return "", apperror.FromMongo(err, "investment")
 	}
 
 	// convert the object id to a string
 	return result.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
-func (s *Storage) get(investmentID string, ctx context.Context) (financeDB, error) {
+func (s *Storage) Get(investmentID string, ctx context.Context) (FinanceDB, error) {
 	collection := s.db.Collection("investment")
-	db := financeDB{}
+	db := FinanceDB{}
 
+	// an id that is no object id cannot exist
 	objectID, err := primitive.ObjectIDFromHex(investmentID)
 	if err != nil {
-		return db, err
+		return db, apperror.NotFound("investment does not exist")
 	}
 
 	cursor := collection.FindOne(ctx, bson.M{"_id": objectID})
-
-	if err := cursor.Err(); err != nil {
-		return db, err
-	}
-
 	if err := cursor.Decode(&db); err != nil {
-		return db, err
+		return db, apperror.FromMongo(err, "investment")
 	}
 	return db, nil
 }
 
-func (s *Storage) getAllOfOneUser(userID string, ctx context.Context) ([]financeDB, error) {
+func (s *Storage) GetAllOfOneUser(userID string, ctx context.Context) ([]FinanceDB, error) {
 	collection := s.db.Collection("investment")
 	userCollection := s.db.Collection("users")
 
 	//Check if user exists
 	userResult := userCollection.FindOne(ctx, bson.M{"_id": userID})
-
 	if err := userResult.Err(); err != nil {
-		fmt.Println("Error finding user:", err)
-		return nil, err
+		return nil, apperror.FromMongo(err, "user")
 	}
 
 	cursor, err := collection.Find(ctx, bson.M{"userId": userID})
 	if err != nil {
-		return nil, err
+		return nil, apperror.FromMongo(err, "investments")
 	}
 	defer cursor.Close(ctx)
 
-	investments := make([]financeDB, 0)
+	investments := make([]FinanceDB, 0)
 	for cursor.Next(ctx) {
-		var investment financeDB
+		var investment FinanceDB
 		if err := cursor.Decode(&investment); err != nil {
-			return nil, err
+			return nil, apperror.FromMongo(err, "investments")
 		}
 		investments = append(investments, investment)
 	}
 	if err := cursor.Err(); err != nil {
-		return nil, err
+		return nil, apperror.FromMongo(err, "investments")
 	}
 
 	// return the investment list
 	return investments, nil
 }
 
-func (s *Storage) getAllOfOneUserBetweenTime(id string, startTime int64, endTime int64, ctx context.Context) ([]financeDB, error) {
+func (s *Storage) GetAllOfOneUserBetweenTime(id string, startTime int64, endTime int64, ctx context.Context) ([]FinanceDB, error) {
 	// get all investments of one user between two times
 	collection := s.db.Collection("investment")
 	var cursor *mongo.Cursor
 	var err error
 	// different query if endtime is 0
 	if endTime == 0 {
-		cursor, err = collection.Find(ctx, bson.M{"userId": id, "investmentTime": bson.M{"$gte": startTime}})
+		cursor, err = collection.Find(ctx, bson.M{"userId": id, "spendingTime": bson.M{"$gte": startTime}})
 	} else {
-		cursor, err = collection.Find(ctx, bson.M{"userId": id, "investmentTime": bson.M{"$gte": startTime, "$lte": endTime}})
+		cursor, err = collection.Find(ctx, bson.M{"userId": id, "spendingTime": bson.M{"$gte": startTime, "$lte": endTime}})
 	}
 	if err != nil {
-		return nil, err
+		return nil, apperror.FromMongo(err, "investments")
 	}
 
-	investments := make([]financeDB, 0)
+	investments := make([]FinanceDB, 0)
 	for cursor.Next(ctx) {
-		var investment financeDB
+		var investment FinanceDB
 		if err := cursor.Decode(&investment); err != nil {
-			return nil, err
+			return nil, apperror.FromMongo(err, "investments")
 		}
 		investments = append(investments, investment)
 	}
 	if err := cursor.Err(); err != nil {
-		return nil, err
+		return nil, apperror.FromMongo(err, "investments")
 	}
 
 	// return the investment list
 	return investments, nil
 }
+
+// GetCreatedSince returns the investments of a user created at or after since (unix seconds),
+// the creation time is part of the object id
+func (s *Storage) GetCreatedSince(userId string, since int64, ctx context.Context) ([]FinanceDB, error) {
+	collection := s.db.Collection("investment")
+	sinceID := primitive.NewObjectIDFromTimestamp(time.Unix(since, 0))
+
+	cursor, err := collection.Find(ctx, bson.M{"userId": userId, "_id": bson.M{"$gte": sinceID}})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "investments")
+	}
+
+	investments := make([]FinanceDB, 0)
+	if err := cursor.All(ctx, &investments); err != nil {
+		return nil, apperror.FromMongo(err, "investments")
+	}
+	return investments, nil
+}
+
+// GetSavingsRateOfUsers returns the share of savings in spendings plus savings
+// (percent) of each of userIds between startTime and endTime, users without any are missing
+func (s *Storage) GetSavingsRateOfUsers(userIds []string, startTime int64, endTime int64, ctx context.Context) (map[string]float64, error) {
+	collection := s.db.Collection("investment")
+
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"userId": bson.M{"$in": userIds}, "spendingTime": bson.M{"$gte": startTime, "$lte": endTime}}},
+		bson.M{"$group": bson.M{"_id": "$userId", "amount": bson.M{"$sum": "$amount"}, "saving": bson.M{"$sum": "$saving"}}},
+	})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "investments")
+	}
+
+	var groups []struct {
+		UserID string  `bson:"_id"`
+		Amount float64 `bson:"amount"`
+		Saving float64 `bson:"saving"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, apperror.FromMongo(err, "investments")
+	}
+
+	rates := make(map[string]float64, len(groups))
+	for _, group := range groups {
+		if total := group.Amount + group.Saving; total > 0 {
+			rates[group.UserID] = group.Saving / total * 100
+		}
+	}
+	return rates, nil
+}
+
+// GetSavingsOfUsers returns the savings of each of userIds between startTime
+// and endTime, users without any are missing
+func (s *Storage) GetSavingsOfUsers(userIds []string, startTime int64, endTime int64, ctx context.Context) (map[string]float64, error) {
+	collection := s.db.Collection("investment")
+
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"userId": bson.M{"$in": userIds}, "spendingTime": bson.M{"$gte": startTime, "$lte": endTime}}},
+		bson.M{"$group": bson.M{"_id": "$userId", "saving": bson.M{"$sum": "$saving"}}},
+		bson.M{"$match": bson.M{"saving": bson.M{"$gt": 0}}},
+	})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "investments")
+	}
+
+	var groups []struct {
+		UserID string  `bson:"_id"`
+		Saving float64 `bson:"saving"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, apperror.FromMongo(err, "investments")
+	}
+
+	savings := make(map[string]float64, len(groups))
+	for _, group := range groups {
+		savings[group.UserID] = group.Saving
+	}
+	return savings, nil
+}
@@ -0,0 +1,122 @@
+// Package health answers the probes of the orchestrator. Liveness only tells
+// that the process serves requests, readiness runs the checks of the
+// dependencies and answers 503 if one of them fails.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFailed   = "failed"
+)
+
+// Check returns an error if a dependency is not usable
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	// empty if the check passed
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the answer of the readiness probe
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Checker runs the checks of the readiness probe
+type Checker struct {
+	timeout time.Duration
+	checks  []namedCheck
+}
+
+// New returns a checker that fails checks running longer than timeout
+func New(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+	}
+}
+
+// Add registers a check, it is reported with name
+func (h *Checker) Add(name string, check Check) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Run runs all checks at the same time, the report is degraded if one fails
+func (h *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(h.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check namedCheck) {
+			defer wg.Done()
+			result := run(check.check, ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusDegraded
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+// run runs a check until it returns or ctx is done, a check that ignores ctx
+// keeps running in the background
+func run(check Check, ctx context.Context) CheckResult {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{Status: StatusOK, Latency: time.Since(start).String()}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Live answers as long as the server handles requests
+func Live(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": StatusOK})
+}
+
+// Ready answers the report of the checks, 503 if it is degraded
+func (h *Checker) Ready(c *fiber.Ctx) error {
+	report := h.Run(c.UserContext())
+	if report.Status != StatusOK {
+		c.Status(fiber.StatusServiceUnavailable)
+	}
+	return c.JSON(report)
+}
@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func passing(ctx context.Context) error {
+	return nil
+}
+
+func failing(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func hanging(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks map[string]Check
+		code   int
+		status string
+		failed []string
+	}{
+		{"no checks", map[string]Check{}, fiber.StatusOK, StatusOK, nil},
+		{"all pass", map[string]Check{"mongo": passing, "worker": passing}, fiber.StatusOK, StatusOK, nil},
+		{"one fails", map[string]Check{"mongo": failing, "worker": passing}, fiber.StatusServiceUnavailable, StatusDegraded, []string{"mongo"}},
+		{"timeout", map[string]Check{"mongo": hanging, "worker": passing}, fiber.StatusServiceUnavailable, StatusDegraded, []string{"mongo"}},
+	}
+	for _, test := range tests {
+		checker := New(50 * time.Millisecond)
+		for name, check := range test.checks {
+			checker.Add(name, check)
+		}
+		app := fiber.New()
+		app.Get("/health/ready", checker.Ready)
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/health/ready", nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.code {
+			t.Errorf("%s: got status code %d, want %d", test.name, resp.StatusCode, test.code)
+		}
+		var report Report
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Status != test.status || len(report.Checks) != len(test.checks) {
+			t.Errorf("%s: got report %+v", test.name, report)
+		}
+		for _, name := range test.failed {
+			if result := report.Checks[name]; result.Status != StatusFailed || result.Error == "" {
+				t.Errorf("%s: got %s %+v, want failed", test.name, name, result)
+			}
+		}
+	}
+}
+
+func TestLive(t *testing.T) {
+	app := fiber.New()
+	app.Get("/health/live", Live)
+	resp, err := app.Test(httptest.NewRequest("GET", "/health/live", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("got status code %d", resp.StatusCode)
+	}
+}
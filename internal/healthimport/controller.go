@@ -0,0 +1,157 @@
+package healthimport
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/user"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Controller struct {
+	storage     *Storage
+	userStorage *user.Storage
+	importer    *Importer
+}
+
+func NewController(storage *Storage, userStorage *user.Storage, importer *Importer) *Controller {
+	return &Controller{
+		storage:     storage,
+		userStorage: userStorage,
+		importer:    importer,
+	}
+}
+
+// largest export.zip accepted, exports of many years of a watch are a few GB
+const maxExportSize = 4 << 30
+
+// job reads the job of the route for the user of the request
+func (t *Controller) job(c *fiber.Ctx) (JobDB, error) {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return JobDB{}, apperror.Validation("Missing userId header")
+	}
+	return t.storage.Get(c.Params("id"), userId, c.UserContext())
+}
+
+// @Summary Create an Apple Health import
+// @Description Creates an import job, the export.zip is then uploaded in chunks and the import started.
+// @Tags import
+// @Produce json
+// @Param userId header string true "User ID"
+// @Success 201 {object} JobDB
+// @Router /import/apple-health [post]
+func (t *Controller) create(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	//check if user exists
+	_, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	job, err := t.storage.Create(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(job)
+}
+
+// @Summary Upload a chunk of an export
+// @Description Appends the body to the export.zip of the import. Chunks are uploaded one after another, an interrupted upload continues at the size of the job.
+// @Tags import
+// @Accept application/octet-stream
+// @Produce json
+// @Param id path string true "Import ID"
+// @Param offset query int64 true "bytes uploaded before this chunk, the size of the job"
+// @Param userId header string true "User ID"
+// @Success 200 {object} JobDB
+// @Router /import/apple-health/{id} [put]
+func (t *Controller) upload(c *fiber.Ctx) error {
+	job, err := t.job(c)
+	if err != nil {
+		return err
+	}
+	if job.Status != StatusUploading {
+		return apperror.Conflict("import is %s", job.Status)
+	}
+
+	offset := int64(c.QueryInt("offset", -1))
+	if offset != job.Size {
+		return apperror.Conflict("chunk must start at offset %d", job.Size)
+	}
+	chunk := c.Body()
+	if len(chunk) == 0 {
+		return apperror.Validation("chunk must not be empty")
+	}
+	if job.Size+int64(len(chunk)) > maxExportSize {
+		return apperror.Validation("export must be at most %d GB", maxExportSize>>30)
+	}
+
+	file, err := os.OpenFile(t.importer.path(job), os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return apperror.Internal("could not store the chunk", err)
+	}
+	defer file.Close()
+	// drops the rest of a chunk that was written but not recorded
+	if err := file.Truncate(job.Size); err != nil {
+		return apperror.Internal("could not store the chunk", err)
+	}
+	if _, err := file.WriteAt(chunk, job.Size); err != nil {
+		return apperror.Internal("could not store the chunk", err)
+	}
+
+	job, err = t.storage.AddSize(job, int64(len(chunk)), c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(job)
+}
+
+// @Summary Start an import
+// @Description Imports the uploaded export in the background. Mindful sessions become meditations, flights climbed elevator entries and sleep analysis nights of sleep. Imported history earns no experience. Failed imports can be started again and continue after their last checkpoint.
+// @Tags import
+// @Produce json
+// @Param id path string true "Import ID"
+// @Param userId header string true "User ID"
+// @Success 202 {object} JobDB
+// @Router /import/apple-health/{id}/start [post]
+func (t *Controller) start(c *fiber.Ctx) error {
+	job, err := t.job(c)
+	if err != nil {
+		return err
+	}
+
+	// reject uploads that are no export before queueing them
+	export, err := openExport(t.importer.path(job))
+	if err != nil {
+		return err
+	}
+	export.Close()
+
+	job, err = t.storage.SetStatus(job, StatusPending, []Status{StatusUploading, StatusFailed}, "", c.UserContext())
+	if err != nil {
+		return err
+	}
+	t.importer.Start(job)
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// @Summary Get an import
+// @Description Status and counts of the imported, duplicate, skipped and ignored records.
+// @Tags import
+// @Produce json
+// @Param id path string true "Import ID"
+// @Param userId header string true "User ID"
+// @Success 200 {object} JobDB
+// @Router /import/apple-health/{id} [get]
+func (t *Controller) get(c *fiber.Ctx) error {
+	job, err := t.job(c)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(job)
+}
@@ -0,0 +1,258 @@
+package healthimport
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/idempotency"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/sleep"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type Suite struct {
+	suite.Suite
+	app        *fiber.App
+	store      *Storage
+	importer   *Importer
+	userStore  *user.Storage
+	testUserId string
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-import"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	userStore := user.NewStorage(db)
+	suite.userStore = userStore
+
+	suite.store = NewStorage(db)
+	suite.importer, err = NewImporter(suite.T().TempDir(), suite.store, meditation.NewStorage(db), elevator.NewStorage(db), sleep.NewStorage(db), settings.NewStorage(db))
+	if err != nil {
+		suite.T().Errorf("Could not create importer: %v", err)
+	}
+	Routes(app, NewController(suite.store, userStore, suite.importer), idempotency.New(idempotency.NewStorage(db)))
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) TearDownSuite() {
+	suite.importer.Stop()
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	for _, collection := range []string{"users", "imports", "meditation", "elevator", "sleep"} {
+		if err := suite.store.db.Collection(collection).Drop(context.Background()); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+
+	// create a test user (just for userId purposes)
+	testId := "testId"
+	_, err := suite.userStore.Create(user.CreateUserRequest{
+		ID:        testId,
+		FirstName: "test",
+		LastName:  "testId",
+	}, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test user: %v", err)
+	}
+
+	suite.testUserId = testId
+}
+
+func date(t time.Time) string {
+	return t.Format(dateFormat)
+}
+
+// exportXML returns an export.xml with a mindful session, flights climbed by
+// the phone and the watch, a night in two segments, a heart rate and a broken record
+func exportXML(day time.Time) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE HealthData>
+<HealthData locale="en_US">
+ <ExportDate value="%[1]s"/>
+ <Record type="HKCategoryTypeIdentifierMindfulSession" sourceName="Breathe" startDate="%[2]s" endDate="%[3]s" value="HKCategoryValueNotApplicable"/>
+ <Record type="HKQuantityTypeIdentifierFlightsClimbed" sourceName="iPhone" unit="count" startDate="%[2]s" endDate="%[3]s" value="2"/>
+ <Record type="HKQuantityTypeIdentifierFlightsClimbed" sourceName="Watch" unit="count" startDate="%[2]s" endDate="%[3]s" value="3"/>
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Watch" unit="count/min" startDate="%[2]s" endDate="%[2]s" value="62"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="%[4]s" endDate="%[5]s" value="HKCategoryValueSleepAnalysisAsleepCore"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="%[5]s" endDate="%[6]s" value="HKCategoryValueSleepAnalysisAsleepDeep"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="iPhone" startDate="%[4]s" endDate="%[6]s" value="HKCategoryValueSleepAnalysisInBed"/>
+ <Record type="HKCategoryTypeIdentifierMindfulSession" sourceName="Breathe" startDate="yesterday" endDate="%[3]s" value="HKCategoryValueNotApplicable"/>
+</HealthData>`,
+		date(day),
+		date(day.Add(-2*time.Hour)), date(day.Add(-2*time.Hour+10*time.Minute)),
+		date(day.Add(-20*time.Hour)), date(day.Add(-16*time.Hour)), date(day.Add(-13*time.Hour)),
+	)
+}
+
+func exportZip(t *testing.T, content string) []byte {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	file, err := archive.Create("apple_health_export/export.xml")
+	if err != nil {
+		t.Fatalf("Could not create export.xml: %v", err)
+	}
+	if _, err := file.Write([]byte(content)); err != nil {
+		t.Fatalf("Could not write export.xml: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Could not close export.zip: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func (suite *Suite) request(method string, route string, body []byte) (int, JobDB) {
+	req := httptest.NewRequest(method, route, bytes.NewReader(body))
+	req.Header.Set("userId", suite.testUserId)
+	resp, err := suite.app.Test(req, -1)
+	suite.NoError(err)
+
+	var job JobDB
+	if resp.StatusCode < 300 {
+		suite.NoError(json.NewDecoder(resp.Body).Decode(&job))
+	}
+	return resp.StatusCode, job
+}
+
+// importExport uploads an export in chunks of chunkSize bytes and waits for the import
+func (suite *Suite) importExport(export []byte, chunkSize int) JobDB {
+	code, job := suite.request("POST", "/import/apple-health", nil)
+	suite.Equal(fiber.StatusCreated, code)
+	route := "/import/apple-health/" + job.ID.Hex()
+
+	for offset := 0; offset < len(export); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(export) {
+			end = len(export)
+		}
+		code, job = suite.request("PUT", fmt.Sprintf("%s?offset=%d", route, offset), export[offset:end])
+		suite.Equal(fiber.StatusOK, code)
+	}
+	suite.Equal(int64(len(export)), job.Size)
+
+	code, _ = suite.request("POST", route+"/start", nil)
+	suite.Equal(fiber.StatusAccepted, code)
+
+	suite.Eventually(func() bool {
+		_, job = suite.request("GET", route, nil)
+		return job.Status == StatusDone || job.Status == StatusFailed
+	}, 10*time.Second, 50*time.Millisecond)
+	return job
+}
+
+func (suite *Suite) TestImport() {
+	export := exportZip(suite.T(), exportXML(time.Now()))
+
+	job := suite.importExport(export, 100)
+	suite.Equal(StatusDone, job.Status, job.Error)
+	suite.Equal(int64(8), job.Processed)
+	suite.Equal(Counts{Meditation: 1, Elevator: 1, Sleep: 1, Duplicates: 1, Skipped: 1, Ignored: 2}, job.Counts)
+
+	// the watch measured more floors than the phone, the night lasted seven hours
+	var elevators []elevator.ElevatorDB
+	cursor, err := suite.store.db.Collection("elevator").Find(context.Background(), map[string]string{"userId": suite.testUserId})
+	suite.NoError(err)
+	suite.NoError(cursor.All(context.Background(), &elevators))
+	suite.Len(elevators, 1)
+	suite.Equal(int64(9), elevators[0].HeightGain)
+
+	var night sleep.SleepDB
+	suite.NoError(suite.store.db.Collection("sleep").FindOne(context.Background(), map[string]string{"userId": suite.testUserId}).Decode(&night))
+	suite.Equal(7*60, night.Duration)
+
+	// a newer export of the same history adds nothing
+	job = suite.importExport(export, len(export))
+	suite.Equal(StatusDone, job.Status, job.Error)
+	suite.Equal(Counts{Duplicates: 4, Skipped: 1, Ignored: 2}, job.Counts)
+}
+
+func (suite *Suite) TestUpload() {
+	export := exportZip(suite.T(), exportXML(time.Now()))
+
+	code, job := suite.request("POST", "/import/apple-health", nil)
+	suite.Equal(fiber.StatusCreated, code)
+	route := "/import/apple-health/" + job.ID.Hex()
+
+	// a chunk after a lost one
+	code, _ = suite.request("PUT", route+"?offset=10", export)
+	suite.Equal(fiber.StatusConflict, code)
+
+	// nothing uploaded yet
+	code, _ = suite.request("POST", route+"/start", nil)
+	suite.Equal(fiber.StatusBadRequest, code)
+
+	code, _ = suite.request("PUT", route+"?offset=0", []byte("no zip"))
+	suite.Equal(fiber.StatusOK, code)
+	code, _ = suite.request("POST", route+"/start", nil)
+	suite.Equal(fiber.StatusBadRequest, code)
+
+	// imports of other users do not exist
+	req := httptest.NewRequest("GET", route, nil)
+	req.Header.Set("userId", "someoneelse")
+	resp, err := suite.app.Test(req, -1)
+	suite.NoError(err)
+	suite.Equal(fiber.StatusNotFound, resp.StatusCode)
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestImportTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
+
+func TestBatchResume(t *testing.T) {
+	now := time.Now()
+	decoder := xml.NewDecoder(strings.NewReader(exportXML(now)))
+
+	// a checkpoint after every record, only the open night is carried over in the job
+	job := &JobDB{}
+	current := batch{userId: "testId", sleepTimeGoal: 8 * 60, now: now}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if element, ok := token.(xml.StartElement); ok && element.Name.Local == "Record" {
+			current.add(job, parseRecord(element))
+			current.reset()
+		}
+	}
+	current.closeNight(job)
+
+	if len(current.nights) != 1 {
+		t.Fatalf("expected one night, got %d", len(current.nights))
+	}
+	if current.nights[0].Duration != 7*60 || current.nights[0].Debt != 60 {
+		t.Errorf("unexpected night %+v", current.nights[0])
+	}
+}
@@ -0,0 +1,298 @@
+package healthimport
+
+import (
+	"archive/zip"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/sleep"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// records of export.xml stored at once, the job is checkpointed after each batch
+const batchSize = 1000
+
+// jobs processed at the same time, the others wait
+const workers = 2
+
+// source of the imported records
+var source = string(elevator.FormatHealthKit)
+
+// Importer processes the uploaded exports in the background
+type Importer struct {
+	dir               string
+	storage           *Storage
+	meditationStorage *meditation.Storage
+	elevatorStorage   *elevator.Storage
+	sleepStorage      *sleep.Storage
+	settingsStorage   *settings.Storage
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewImporter(dir string, storage *Storage, meditationStorage *meditation.Storage, elevatorStorage *elevator.Storage, sleepStorage *sleep.Storage, settingsStorage *settings.Storage) (*Importer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("could not create the import directory: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Importer{
+		dir:               dir,
+		storage:           storage,
+		meditationStorage: meditationStorage,
+		elevatorStorage:   elevatorStorage,
+		sleepStorage:      sleepStorage,
+		settingsStorage:   settingsStorage,
+		ctx:               ctx,
+		cancel:            cancel,
+		workers:           make(chan struct{}, workers),
+	}, nil
+}
+
+// path of the uploaded export of a job
+func (i *Importer) path(job JobDB) string {
+	return filepath.Join(i.dir, job.ID.Hex()+".zip")
+}
+
+// Start processes a pending job in the background
+func (i *Importer) Start(job JobDB) {
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		select {
+		case i.workers <- struct{}{}:
+		case <-i.ctx.Done():
+			return
+		}
+		defer func() { <-i.workers }()
+		i.run(job)
+	}()
+}
+
+// Resume starts the jobs interrupted by a restart, they continue after their last checkpoint
+func (i *Importer) Resume(ctx context.Context) error {
+	jobs, err := i.storage.GetUnfinished(ctx)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		i.Start(job)
+	}
+	return nil
+}
+
+// Stop interrupts the running jobs at their next record and waits for them
+func (i *Importer) Stop() {
+	i.cancel()
+	i.wg.Wait()
+}
+
+// Check returns an error if the importer is stopped and takes no jobs
+func (i *Importer) Check(ctx context.Context) error {
+	if i.ctx.Err() != nil {
+		return errors.New("importer is stopped")
+	}
+	return nil
+}
+
+func (i *Importer) run(job JobDB) {
+	logger := slog.Default().With("jobId", job.ID.Hex())
+	job, err := i.storage.SetStatus(job, StatusRunning, []Status{StatusPending, StatusRunning}, "", i.ctx)
+	if err != nil {
+		logger.Error("could not finish import", "error", err)
+		return
+	}
+
+	err = i.process(&job)
+	// stopped jobs stay running and are resumed on the next start
+	if i.ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		logger.Error("import failed", "error", err)
+		if _, err := i.storage.SetStatus(job, StatusFailed, []Status{StatusRunning}, err.Error(), i.ctx); err != nil {
+			logger.Error("could not finish import", "error", err)
+		}
+		return
+	}
+
+	if _, err := i.storage.SetStatus(job, StatusDone, []Status{StatusRunning}, "", i.ctx); err != nil {
+		logger.Error("could not finish import", "error", err)
+		return
+	}
+	if err := os.Remove(i.path(job)); err != nil {
+		logger.Error("could not finish import", "error", err)
+	}
+}
+
+type zipFile struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (f zipFile) Close() error {
+	return errors.Join(f.ReadCloser.Close(), f.archive.Close())
+}
+
+// openExport opens the export.xml within an export.zip of Apple Health
+func openExport(name string) (io.ReadCloser, error) {
+	archive, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, apperror.Validation("export must be a zip file")
+	}
+	for _, file := range archive.File {
+		if path.Base(file.Name) != "export.xml" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			archive.Close()
+			return nil, apperror.Validation("export.xml can not be read: %v", err)
+		}
+		return zipFile{ReadCloser: reader, archive: archive}, nil
+	}
+	archive.Close()
+	return nil, apperror.Validation("export must contain an export.xml of Apple Health")
+}
+
+// process streams the records of the export, the records up to the last
+// checkpoint are skipped
+func (i *Importer) process(job *JobDB) error {
+	export, err := openExport(i.path(*job))
+	if err != nil {
+		return err
+	}
+	defer export.Close()
+
+	goal, err := i.sleepTimeGoal(job.UserID)
+	if err != nil {
+		return err
+	}
+
+	decoder := xml.NewDecoder(export)
+	current := batch{userId: job.UserID, sleepTimeGoal: goal, now: time.Now()}
+	var index int64
+	for {
+		if err := i.ctx.Err(); err != nil {
+			return err
+		}
+
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("export.xml is no valid xml: %w", err)
+		}
+		element, ok := token.(xml.StartElement)
+		if !ok || element.Name.Local != "Record" {
+			continue
+		}
+
+		index++
+		if index <= job.Processed {
+			continue
+		}
+		current.add(job, parseRecord(element))
+
+		if current.size() >= batchSize {
+			if err := i.flush(job, &current, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the last night ends with the export
+	if job.Night != nil {
+		current.closeNight(job)
+	}
+	return i.flush(job, &current, index)
+}
+
+// flush stores a batch and checkpoints the job after index records
+func (i *Importer) flush(job *JobDB, current *batch, index int64) error {
+	counts := current.counts
+
+	created, err := i.meditationStorage.CreateImported(current.meditations, i.ctx)
+	if err != nil {
+		return err
+	}
+	counts.Meditation += int64(created)
+	counts.Duplicates += int64(len(current.meditations) - created)
+
+	floors, duplicates := elevator.DedupeSamples(current.floors)
+	counts.Duplicates += int64(duplicates)
+	if len(floors) > 0 {
+		startTime, endTime := floors[0].StartTime, floors[0].EndTime
+		for _, sample := range floors {
+			if sample.StartTime < startTime {
+				startTime = sample.StartTime
+			}
+			if sample.EndTime > endTime {
+				endTime = sample.EndTime
+			}
+		}
+		existing, err := i.elevatorStorage.GetImportedBetween(job.UserID, startTime, endTime, i.ctx)
+		if err != nil {
+			return err
+		}
+		floors, duplicates = elevator.WithoutImported(floors, existing)
+		counts.Duplicates += int64(duplicates)
+
+		// imports follow the anti-cheat limit of entries
+		var limited int
+		floors, limited, err = i.elevatorStorage.LimitSamples(floors, job.UserID, i.ctx)
+		if err != nil {
+			return err
+		}
+		counts.Skipped += int64(limited)
+	}
+	elevators, err := i.elevatorStorage.CreateImported(floors, elevator.FormatHealthKit, job.UserID, i.ctx)
+	if err != nil {
+		return err
+	}
+	counts.Elevator += int64(len(elevators))
+
+	created, err = i.sleepStorage.CreateImported(current.nights, i.ctx)
+	if err != nil {
+		return err
+	}
+	counts.Sleep += int64(created)
+	counts.Duplicates += int64(len(current.nights) - created)
+
+	job.Counts.add(counts)
+	job.Processed = index
+	if err := i.storage.Checkpoint(*job, i.ctx); err != nil {
+		return err
+	}
+	current.reset()
+	return nil
+}
+
+// sleepTimeGoal returns the goal of the imported nights, users without sleep settings get the default
+func (i *Importer) sleepTimeGoal(userId string) (int, error) {
+	userSettings, err := i.settingsStorage.Get(userId, string(settings.PluginNameSleep), i.ctx)
+	if apperror.IsNotFound(err) {
+		return settings.DefaultSleepTimeGoal, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if userSettings.Sleep.SleepTimeGoal == 0 {
+		return settings.DefaultSleepTimeGoal, nil
+	}
+	return userSettings.Sleep.SleepTimeGoal, nil
+}
@@ -0,0 +1,208 @@
+package healthimport
+
+import (
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/sleep"
+	"encoding/xml"
+	"math"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// record types and values of export.xml
+const (
+	typeMindfulSession = "HKCategoryTypeIdentifierMindfulSession"
+	typeFlightsClimbed = "HKQuantityTypeIdentifierFlightsClimbed"
+	typeSleepAnalysis  = "HKCategoryTypeIdentifierSleepAnalysis"
+	dateFormat         = "2006-01-02 15:04:05 -0700"
+)
+
+// sleep analysis values of the phases asleep, in bed and awake are not counted
+var asleepValues = map[string]bool{
+	"HKCategoryValueSleepAnalysisAsleep":            true,
+	"HKCategoryValueSleepAnalysisAsleepUnspecified": true,
+	"HKCategoryValueSleepAnalysisAsleepCore":        true,
+	"HKCategoryValueSleepAnalysisAsleepDeep":        true,
+	"HKCategoryValueSleepAnalysisAsleepREM":         true,
+}
+
+// limits of the imported records
+const (
+	maxSession = 24 * time.Hour
+	maxNight   = 24 * time.Hour
+	// segments of sleep closer than this belong to the same night
+	maxNightGap = time.Hour
+)
+
+// record is a Record element of export.xml
+type record struct {
+	Type       string
+	SourceName string
+	Value      string
+	StartTime  int64
+	EndTime    int64
+	// the dates could not be parsed
+	Invalid bool
+}
+
+func parseRecord(element xml.StartElement) record {
+	var r record
+	var startDate, endDate string
+	for _, attribute := range element.Attr {
+		switch attribute.Name.Local {
+		case "type":
+			r.Type = attribute.Value
+		case "sourceName":
+			r.SourceName = attribute.Value
+		case "value":
+			r.Value = attribute.Value
+		case "startDate":
+			startDate = attribute.Value
+		case "endDate":
+			endDate = attribute.Value
+		}
+	}
+
+	start, startErr := time.Parse(dateFormat, startDate)
+	end, endErr := time.Parse(dateFormat, endDate)
+	r.Invalid = startErr != nil || endErr != nil || end.Before(start)
+	r.StartTime = start.Unix()
+	r.EndTime = end.Unix()
+	return r
+}
+
+// Night collects the asleep segments of one night
+type Night struct {
+	BedTime  int64 `bson:"bedTime"`
+	WakeTime int64 `bson:"wakeTime"`
+	// seconds asleep, overlapping segments of several sources count once
+	Asleep int64 `bson:"asleep"`
+}
+
+// batch collects the converted records until they are stored
+type batch struct {
+	userId        string
+	sleepTimeGoal int
+	now           time.Time
+
+	meditations []meditation.MeditationDB
+	floors      []elevator.Sample
+	nights      []sleep.SleepDB
+	counts      Counts
+}
+
+func (b *batch) size() int {
+	return len(b.meditations) + len(b.floors) + len(b.nights)
+}
+
+func (b *batch) reset() {
+	b.meditations = b.meditations[:0]
+	b.floors = b.floors[:0]
+	b.nights = b.nights[:0]
+	b.counts = Counts{}
+}
+
+// add converts a record, open nights are kept in the job so they survive a checkpoint
+func (b *batch) add(job *JobDB, r record) {
+	switch r.Type {
+	case typeMindfulSession:
+		b.addSession(r)
+	case typeFlightsClimbed:
+		b.addFloors(r)
+	case typeSleepAnalysis:
+		b.addSleep(job, r)
+	default:
+		b.counts.Ignored++
+	}
+}
+
+func (b *batch) addSession(r record) {
+	duration := time.Duration(r.EndTime-r.StartTime) * time.Second
+	minutes := int(math.Round(duration.Minutes()))
+	if r.Invalid || minutes < 1 || duration > maxSession || r.EndTime > b.now.Unix() {
+		b.counts.Skipped++
+		return
+	}
+	b.meditations = append(b.meditations, meditation.MeditationDB{
+		ID:             primitive.NewObjectID(),
+		UserID:         b.userId,
+		MeditationTime: minutes,
+		StartTime:      r.StartTime,
+		EndTime:        r.EndTime,
+		ServerTime:     b.now.Unix(),
+		Type:           meditation.MeditationTypeUnguided,
+		Source:         source,
+	})
+}
+
+func (b *batch) addFloors(r record) {
+	sample := elevator.Sample{
+		Kind:      elevator.SampleKindFloors,
+		Source:    r.SourceName,
+		StartTime: r.StartTime,
+		EndTime:   r.EndTime,
+	}
+	value, err := strconv.ParseFloat(r.Value, 64)
+	sample.Value = value
+	if r.Invalid || err != nil || !sample.IsValid(b.now) {
+		b.counts.Skipped++
+		return
+	}
+	b.floors = append(b.floors, sample)
+}
+
+func (b *batch) addSleep(job *JobDB, r record) {
+	if !asleepValues[r.Value] {
+		b.counts.Ignored++
+		return
+	}
+	if r.Invalid {
+		b.counts.Skipped++
+		return
+	}
+
+	night := job.Night
+	if night != nil && r.StartTime <= night.WakeTime+int64(maxNightGap.Seconds()) {
+		// only the part after the segments so far counts
+		if r.EndTime > night.WakeTime {
+			if r.StartTime > night.WakeTime {
+				night.Asleep += r.EndTime - r.StartTime
+			} else {
+				night.Asleep += r.EndTime - night.WakeTime
+			}
+			night.WakeTime = r.EndTime
+		}
+		return
+	}
+
+	if night != nil {
+		b.closeNight(job)
+	}
+	job.Night = &Night{BedTime: r.StartTime, WakeTime: r.EndTime, Asleep: r.EndTime - r.StartTime}
+}
+
+// closeNight converts the open night of a job
+func (b *batch) closeNight(job *JobDB) {
+	night := job.Night
+	job.Night = nil
+
+	duration := int(night.Asleep / 60)
+	if duration < 1 || night.WakeTime-night.BedTime > int64(maxNight.Seconds()) || night.WakeTime > b.now.Unix() {
+		b.counts.Skipped++
+		return
+	}
+	b.nights = append(b.nights, sleep.SleepDB{
+		ID:         primitive.NewObjectID(),
+		UserID:     b.userId,
+		BedTime:    night.BedTime,
+		WakeTime:   night.WakeTime,
+		Duration:   duration,
+		Goal:       b.sleepTimeGoal,
+		Debt:       b.sleepTimeGoal - duration,
+		ServerTime: b.now.Unix(),
+		Source:     source,
+	})
+}
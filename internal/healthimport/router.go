@@ -0,0 +1,18 @@
+package healthimport
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// idempotent guards the create route against duplicates from client retries
+func Routes(app fiber.Router, controller *Controller, idempotent fiber.Handler) {
+	imports := app.Group("/import/apple-health")
+
+	// add middlewares here
+
+	// add routes here
+	imports.Post("/", idempotent, controller.create)
+	imports.Get("/:id", controller.get)
+	imports.Put("/:id", controller.upload)
+	imports.Post("/:id/start", controller.start)
+}
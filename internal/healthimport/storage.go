@@ -0,0 +1,175 @@
+package healthimport
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Status string
+
+const (
+	// the export is being uploaded in chunks
+	StatusUploading Status = "uploading"
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusDone      Status = "done"
+	// failed jobs can be started again and continue after the last checkpoint
+	StatusFailed Status = "failed"
+)
+
+// Counts of the records of an export
+type Counts struct {
+	Meditation int64 `json:"meditation" bson:"meditation"`
+	Elevator   int64 `json:"elevator" bson:"elevator"`
+	Sleep      int64 `json:"sleep" bson:"sleep"`
+	// records of an earlier import
+	Duplicates int64 `json:"duplicates" bson:"duplicates"`
+	// records of a known type that could not be converted or exceed the anti-cheat limits
+	Skipped int64 `json:"skipped" bson:"skipped"`
+	// records of types without a plugin
+	Ignored int64 `json:"ignored" bson:"ignored"`
+}
+
+func (c *Counts) add(other Counts) {
+	c.Meditation += other.Meditation
+	c.Elevator += other.Elevator
+	c.Sleep += other.Sleep
+	c.Duplicates += other.Duplicates
+	c.Skipped += other.Skipped
+	c.Ignored += other.Ignored
+}
+
+type JobDB struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID string             `json:"userId" bson:"userId"`
+	Status Status             `json:"status" bson:"status"`
+	// bytes of the export uploaded so far
+	Size int64 `json:"size" bson:"size"`
+	// records of export.xml that are stored, a resumed job skips them
+	Processed int64  `json:"processed" bson:"processed"`
+	Counts    Counts `json:"counts" bson:"counts"`
+	// night of sleep that was still open at the last checkpoint
+	Night *Night `json:"-" bson:"night,omitempty"`
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	// unix seconds
+	CreatedAt int64 `json:"createdAt" bson:"createdAt"`
+	UpdatedAt int64 `json:"updatedAt" bson:"updatedAt"`
+}
+
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+func (s *Storage) Create(userId string, ctx context.Context) (JobDB, error) {
+	collection := s.db.Collection("imports")
+
+	now := time.Now().Unix()
+	job := JobDB{
+		ID:        primitive.NewObjectID(),
+		UserID:    userId,
+		Status:    StatusUploading,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := collection.InsertOne(ctx, job); err != nil {
+		return job, apperror.FromMongo(err, "import")
+	}
+	return job, nil
+}
+
+// Get returns the job of a user, jobs of other users do not exist for them
+func (s *Storage) Get(jobID string, userId string, ctx context.Context) (JobDB, error) {
+	collection := s.db.Collection("imports")
+	job := JobDB{}
+
+	// an id that is no object id cannot exist
+	objectID, err := primitive.ObjectIDFromHex(jobID)
+	if err != nil {
+		return job, apperror.NotFound("import does not exist")
+	}
+
+	cursor := collection.FindOne(ctx, bson.M{"_id": objectID, "userId": userId})
+	if err := cursor.Decode(&job); err != nil {
+		return job, apperror.FromMongo(err, "import")
+	}
+	return job, nil
+}
+
+// GetUnfinished returns the jobs to resume after a restart
+func (s *Storage) GetUnfinished(ctx context.Context) ([]JobDB, error) {
+	collection := s.db.Collection("imports")
+
+	cursor, err := collection.Find(ctx, bson.M{"status": bson.M{"$in": bson.A{StatusPending, StatusRunning}}})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "imports")
+	}
+
+	jobs := make([]JobDB, 0)
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, apperror.FromMongo(err, "imports")
+	}
+	return jobs, nil
+}
+
+// AddSize records an uploaded chunk, it fails if another chunk was stored since
+// the job was read
+func (s *Storage) AddSize(job JobDB, chunk int64, ctx context.Context) (JobDB, error) {
+	collection := s.db.Collection("imports")
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "status": StatusUploading, "size": job.Size},
+		bson.M{"$inc": bson.M{"size": chunk}, "$set": bson.M{"updatedAt": time.Now().Unix()}},
+	)
+	if err != nil {
+		return job, apperror.FromMongo(err, "import")
+	}
+	if result.MatchedCount == 0 {
+		return job, apperror.Conflict("import changed during the upload, retry with the current size")
+	}
+	job.Size += chunk
+	return job, nil
+}
+
+// SetStatus moves a job to status if it is in one of from
+func (s *Storage) SetStatus(job JobDB, status Status, from []Status, message string, ctx context.Context) (JobDB, error) {
+	collection := s.db.Collection("imports")
+
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": job.ID, "status": bson.M{"$in": from}},
+		bson.M{"$set": bson.M{"status": status, "error": message, "updatedAt": time.Now().Unix()}},
+	)
+	if err != nil {
+		return job, apperror.FromMongo(err, "import")
+	}
+	if result.MatchedCount == 0 {
+		return job, apperror.Conflict("import is %s", job.Status)
+	}
+	job.Status = status
+	job.Error = message
+	return job, nil
+}
+
+// Checkpoint stores the progress of a running job
+func (s *Storage) Checkpoint(job JobDB, ctx context.Context) error {
+	collection := s.db.Collection("imports")
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": job.ID},
+		bson.M{"$set": bson.M{"processed": job.Processed, "counts": job.Counts, "night": job.Night, "updatedAt": time.Now().Unix()}},
+	)
+	if err != nil {
+		return apperror.FromMongo(err, "import")
+	}
+	return nil
+}
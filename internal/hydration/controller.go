@@ -0,0 +1,296 @@
+package hydration
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/calendar"
+	"cmd/http/main.go/internal/logging"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Controller struct {
+	storage         *Storage
+	userStorage     *user.Storage
+	progressStorage *progress.Storage
+	settingsStorage *settings.Storage
+}
+
+func NewController(storage *Storage, userStorage *user.Storage, progressStorage *progress.Storage, settingsStorage *settings.Storage) *Controller {
+	return &Controller{
+		storage:         storage,
+		userStorage:     userStorage,
+		progressStorage: progressStorage,
+		settingsStorage: settingsStorage,
+	}
+}
+
+type CreateHydrationRequest struct {
+	// ml of water
+	Amount int `json:"amount" bson:"amount"`
+	// unix seconds on the client, defaults to now
+	Time int64 `json:"time" bson:"time"`
+}
+
+// most water of one entry in ml
+const maxAmount = 5000
+
+func (r CreateHydrationRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(validation.InRange(int64(r.Amount), 1, maxAmount), "amount", "must be between 1 and %d ml", maxAmount)
+	errs.Check(r.Time == 0 || validation.IsClientTime(r.Time), "time", "must be a unix time of the last %d days", int(validation.MaxClientAge.Hours()/24))
+	return errs.Err()
+}
+
+// dayResponse is the total of one day against the daily goal
+type dayResponse struct {
+	DayDB
+	Goal int `json:"goal"`
+	// amount in percent of the goal, above 100 when the goal was exceeded
+	PercentOfGoal float64 `json:"percentOfGoal"`
+}
+
+func newDayResponse(day DayDB, goal int) dayResponse {
+	return dayResponse{
+		DayDB:         day,
+		Goal:          goal,
+		PercentOfGoal: math.Round(float64(day.Amount)*1000/float64(goal)) / 10,
+	}
+}
+
+type createHydrationResponse struct {
+	ID string `json:"id"`
+	// total of the day of the entry
+	Day dayResponse `json:"day"`
+}
+
+type dailyResponse struct {
+	// first and last second of the period
+	StartTime int64         `json:"startTime"`
+	EndTime   int64         `json:"endTime"`
+	Days      []dayResponse `json:"days"`
+}
+
+// goal returns the daily water goal of a user, users without hydration settings get the default
+func (t *Controller) goal(userId string, ctx context.Context) (int, error) {
+	userSettings, err := t.settingsStorage.Get(userId, string(settings.PluginNameHydration), ctx)
+	if apperror.IsNotFound(err) {
+		return settings.DefaultHydrationGoal, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if userSettings.Hydration.DailyGoal == 0 {
+		return settings.DefaultHydrationGoal, nil
+	}
+	return userSettings.Hydration.DailyGoal, nil
+}
+
+// @Summary Create hydration.
+// @Description Logs water intake, reaching the daily goal earns experience.
+// @Tags hydration
+// @Accept */*
+// @Produce json
+// @Param hydration body CreateHydrationRequest true "Hydration to create"
+// @Param userId header string true "User ID"
+// @Success 201 {object} createHydrationResponse
+// @Router /hydration [post]
+func (t *Controller) create(c *fiber.Ctx) error {
+	req := validation.Parsed[CreateHydrationRequest](c)
+
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	//check if user exists
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	goal, err := t.goal(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	// the experience depends on the total of the day with this entry
+	at := time.Now()
+	if req.Time != 0 {
+		at = time.Unix(req.Time, 0)
+	}
+	userCalendar := profile.Calendar()
+	dayStart, dayEnd := userCalendar.Bounds(calendar.PeriodDay, at)
+	days, err := t.storage.GetDailyTotals(userId, dayStart.Unix(), dayEnd.Unix()-1, userCalendar.Location.String(), c.UserContext())
+	if err != nil {
+		return err
+	}
+	day := DayDB{Date: userCalendar.Date(at.Unix())}
+	if len(days) > 0 {
+		day = days[0]
+	}
+
+	id, err := t.storage.Create(req, userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	day.Amount += req.Amount
+	day.Entries++
+	if err := t.rewardGoal(userId, day, goal, c.UserContext()); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(createHydrationResponse{
+		ID:  id,
+		Day: newDayResponse(day, goal),
+	})
+}
+
+// rewardGoal grants the experience of a day that reached the goal. The day
+// is marked first, so concurrent drinks or a lowered goal earn it only once.
+func (t *Controller) rewardGoal(userId string, day DayDB, goal int, ctx context.Context) error {
+	experience := progress.HydrationExperience(day.Amount, goal)
+	if experience == 0 {
+		return nil
+	}
+	rewarded, err := t.storage.RewardGoal(userId, day.Date, ctx)
+	if err != nil || !rewarded {
+		return err
+	}
+	if err := t.progressStorage.AddExperience(userId, ctx, settings.PluginNameHydration, experience); err != nil {
+		if err := t.storage.UnrewardGoal(userId, day.Date, ctx); err != nil {
+			logging.FromContext(ctx).Error("could not forget hydration goal", "error", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// @Summary Get hydration
+// @Description Fetch one or multiple water intake entries.
+// @Tags hydration
+// @Param id query string false "Hydration ID"
+// @Param startTime query int64 false "start time"
+// @Param endTime query int64 false "end time"
+// @Param period query string false "day, week or month in the time zone of the user, replaces start and end time"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []HydrationDB
+// @Router /hydration [Get]
+func (t *Controller) get(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	hydrationId := c.Query("id")
+	if hydrationId != "" {
+		// Get particular entry, the entries of other users are private
+		entry, err := t.storage.Get(hydrationId, c.UserContext())
+		if err != nil {
+			return err
+		}
+		if entry.UserID != userId {
+			return apperror.NotFound("hydration does not exist")
+		}
+		// convert to array
+		return c.Status(fiber.StatusOK).JSON([]HydrationDB{entry})
+	}
+
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	startTime := convertToInt64(c.Query("startTime"))
+	endTime := convertToInt64(c.Query("endTime"))
+	// a period of the user's calendar replaces start and end time
+	if period := c.Query("period"); period != "" {
+		startTime, endTime, err = profile.Calendar().Range(calendar.Period(period), c.Query("date"), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := t.storage.GetAllOfOneUserBetweenTime(userId, startTime, endTime, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(entries)
+}
+
+// @Summary Get daily hydration
+// @Description Water intake per day of a period of the user's calendar against the daily goal.
+// @Tags hydration
+// @Param period query string false "day, week or month, defaults to week"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} dailyResponse
+// @Router /hydration/daily [Get]
+func (t *Controller) daily(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	userCalendar := profile.Calendar()
+	period := calendar.Period(c.Query("period", string(calendar.PeriodWeek)))
+	startTime, endTime, err := userCalendar.Range(period, c.Query("date"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	goal, err := t.goal(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	totals, err := t.storage.GetDailyTotals(userId, startTime, endTime, userCalendar.Location.String(), c.UserContext())
+	if err != nil {
+		return err
+	}
+	byDate := make(map[string]DayDB, len(totals))
+	for _, day := range totals {
+		byDate[day.Date] = day
+	}
+
+	// every day of the period, days without entries have an amount of 0
+	days := make([]dayResponse, 0)
+	for day := time.Unix(startTime, 0).In(userCalendar.Location); day.Unix() <= endTime; day = day.AddDate(0, 0, 1) {
+		date := userCalendar.Date(day.Unix())
+		total, ok := byDate[date]
+		if !ok {
+			total = DayDB{Date: date}
+		}
+		days = append(days, newDayResponse(total, goal))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dailyResponse{
+		StartTime: startTime,
+		EndTime:   endTime,
+		Days:      days,
+	})
+}
+
+func convertToInt64(value string) int64 {
+	intValue, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return intValue
+}
@@ -0,0 +1,337 @@
+package hydration
+
+import (
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/idempotency"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Suite struct {
+	suite.Suite
+	app           *fiber.App
+	store         *Storage
+	userStore     *user.Storage
+	settingsStore *settings.Storage
+	testUserId    string
+	hydrationId   string
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-hydration"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	userStore := user.NewStorage(db)
+	suite.userStore = userStore
+	suite.settingsStore = settings.NewStorage(db)
+
+	suite.store = NewStorage(db)
+	hydrationCont := NewController(suite.store, userStore, progress.NewStorage(db), suite.settingsStore)
+	Routes(app, hydrationCont, idempotency.New(idempotency.NewStorage(db)))
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	for _, collection := range []string{"users", "hydration", "hydrationGoals", "settings", "progress"} {
+		if err := suite.store.db.Collection(collection).Drop(context.Background()); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+	if err := suite.store.EnsureIndexes(context.Background()); err != nil {
+		log.Println("Error: ", err)
+	}
+
+	// create a test user (just for userId purposes)
+	testId := "testId"
+	_, err := suite.userStore.Create(user.CreateUserRequest{
+		ID:        testId,
+		FirstName: "test",
+		LastName:  "testId",
+	}, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test user: %v", err)
+	}
+
+	suite.testUserId = testId
+
+	// create a test glass of water of now
+	hydrationId, err := suite.store.Create(CreateHydrationRequest{
+		Amount: 500,
+	}, testId, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test hydration: %v", err)
+	}
+
+	suite.hydrationId = hydrationId
+}
+
+func (suite *Suite) TestPost() {
+	route := "/hydration"
+
+	tests := []struct {
+		missingHeader bool
+		userId        string
+		description   string
+		expectedCode  int
+		body          interface{}
+	}{
+		{
+			description:  "Create successfully",
+			body:         CreateHydrationRequest{Amount: 250},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "Create with client time",
+			body:         CreateHydrationRequest{Amount: 250, Time: time.Now().Add(-time.Minute).Unix()},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "User does not exist",
+			userId:       "doesntexist",
+			body:         CreateHydrationRequest{Amount: 250},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "Missing userId header",
+			missingHeader: true,
+			body:          CreateHydrationRequest{Amount: 250},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+		{
+			description:  "Missing amount",
+			body:         CreateHydrationRequest{},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Too much at once",
+			body:         CreateHydrationRequest{Amount: maxAmount + 1},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Time in the future",
+			body:         CreateHydrationRequest{Amount: 250, Time: time.Now().Add(time.Hour).Unix()},
+			expectedCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		bodyJson, err := json.Marshal(test.body)
+		if err != nil {
+			suite.T().Errorf("Could not marshal hydration: %v", err)
+		}
+
+		req := httptest.NewRequest("POST", route, bytes.NewReader(bodyJson))
+
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		} else {
+			req.Header.Set("userId", suite.testUserId)
+		}
+
+		if test.missingHeader {
+			req.Header.Del("userId")
+		}
+
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+func (suite *Suite) TestGoalAndExperience() {
+	// a goal of one liter from the settings
+	err := suite.settingsStore.CreatePluginSettings(settings.HydrationSettings{
+		PeriodNotifications: settings.NotificationTypeDay,
+		DailyGoal:           1000,
+	}, suite.testUserId, context.Background())
+	suite.NoError(err)
+
+	post := func(amount int) createHydrationResponse {
+		bodyJson, _ := json.Marshal(CreateHydrationRequest{Amount: amount})
+		req := httptest.NewRequest("POST", "/hydration", bytes.NewReader(bodyJson))
+		req.Header.Set("userId", suite.testUserId)
+		resp, err := suite.app.Test(req, -1)
+		suite.NoError(err)
+		suite.Equal(fiber.StatusCreated, resp.StatusCode)
+
+		var created createHydrationResponse
+		suite.NoError(json.NewDecoder(resp.Body).Decode(&created))
+		return created
+	}
+
+	// the glass of BeforeTest and this one reach the goal, the next one earns nothing more
+	created := post(600)
+	suite.Equal(1100, created.Day.Amount)
+	suite.Equal(2, created.Day.Entries)
+	suite.Equal(110.0, created.Day.PercentOfGoal)
+	post(200)
+
+	// a raised goal is reached as well, but the day was rewarded already
+	_, err = suite.settingsStore.UpdatePluginSettings(settings.HydrationSettings{
+		PeriodNotifications: settings.NotificationTypeDay,
+		DailyGoal:           1500,
+	}, suite.testUserId, context.Background())
+	suite.NoError(err)
+	post(300)
+
+	var progressDB progress.Db
+	err = suite.store.db.Collection("progress").FindOne(context.Background(), bson.M{"_id": suite.testUserId}).Decode(&progressDB)
+	suite.NoError(err)
+	suite.Equal(float64(10), progressDB.Experience[settings.PluginNameHydration])
+
+	req := httptest.NewRequest("GET", "/hydration/daily?period=week", nil)
+	req.Header.Set("userId", suite.testUserId)
+	resp, err := suite.app.Test(req, -1)
+	suite.NoError(err)
+	suite.Equal(fiber.StatusOK, resp.StatusCode)
+
+	var daily dailyResponse
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&daily))
+	suite.Len(daily.Days, 7)
+
+	total := 0
+	for _, day := range daily.Days {
+		suite.Equal(1500, day.Goal)
+		total += day.Amount
+	}
+	suite.Equal(1600, total)
+}
+
+func (suite *Suite) TestGet() {
+	route := "/hydration"
+
+	tests := []struct {
+		missingHeader bool
+		userId        string
+		description   string
+		expectedCode  int
+		query         map[string]string
+	}{
+		{
+			description:  "simple test one",
+			query:        map[string]string{"id": suite.hydrationId},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "this week",
+			query:        map[string]string{"period": "week"},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "invalid period",
+			query:        map[string]string{"period": "year"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "id does not exist",
+			query:        map[string]string{"id": "nonexistingid"},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:  "id of another user",
+			userId:       "otherId",
+			query:        map[string]string{"id": suite.hydrationId},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "id without userId header",
+			missingHeader: true,
+			query:         map[string]string{"id": suite.hydrationId},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+		{
+			description:  "User does not exist",
+			userId:       "doesntexist",
+			query:        map[string]string{},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "Missing userId header",
+			missingHeader: true,
+			query:         map[string]string{},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		url := url.URL{
+			Path: route,
+		}
+
+		// Add query
+		q := url.Query()
+		for key, value := range test.query {
+			q.Add(key, value)
+		}
+		url.RawQuery = q.Encode()
+
+		req := httptest.NewRequest("GET", url.String(), nil)
+
+		// Add header
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		} else {
+			req.Header.Set("userId", suite.testUserId)
+		}
+
+		if test.missingHeader {
+			req.Header.Del("userId")
+		}
+
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestHydrationTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
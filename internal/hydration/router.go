@@ -0,0 +1,19 @@
+package hydration
+
+import (
+	"cmd/http/main.go/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// idempotent guards the create route against duplicates from client retries
+func Routes(app fiber.Router, controller *Controller, idempotent fiber.Handler) {
+	hydration := app.Group("/hydration")
+
+	// add middlewares here
+
+	// add routes here
+	hydration.Post("/", idempotent, validation.Body[CreateHydrationRequest](), controller.create)
+	hydration.Get("/", controller.get)
+	hydration.Get("/daily", controller.daily)
+}
@@ -0,0 +1,179 @@
+package hydration
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type HydrationDB struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID string             `json:"userId" bson:"userId"`
+	// ml of water
+	Amount int `json:"amount" bson:"amount"`
+	// unix seconds of the client
+	Time int64 `json:"time" bson:"time"`
+	// unix seconds when the server stored the entry
+	ServerTime int64 `json:"serverTime" bson:"serverTime"`
+}
+
+// DayDB sums up the entries of one day
+type DayDB struct {
+	// day in the time zone of the user (validation.DateLayout)
+	Date    string `json:"date" bson:"_id"`
+	Amount  int    `json:"amount" bson:"amount"`
+	Entries int    `json:"entries" bson:"entries"`
+}
+
+// GoalDB marks a day whose goal was rewarded, it is rewarded once per day
+type GoalDB struct {
+	UserID string `json:"userId" bson:"userId"`
+	// day in the time zone of the user (validation.DateLayout)
+	Date string `json:"date" bson:"date"`
+	// unix seconds when the goal was rewarded
+	Time int64 `json:"time" bson:"time"`
+}
+
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+// EnsureIndexes creates the index for range queries and the one that rewards
+// a goal once per day
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	collection := s.db.Collection("hydration")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "time", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Collection("hydrationGoals").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// RewardGoal marks the goal of a day as rewarded, rewarded is false if it
+// was rewarded before
+func (s *Storage) RewardGoal(userId string, date string, ctx context.Context) (bool, error) {
+	collection := s.db.Collection("hydrationGoals")
+	_, err := collection.InsertOne(ctx, GoalDB{UserID: userId, Date: date, Time: time.Now().Unix()})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, apperror.FromMongo(err, "hydration goal")
+	}
+	return true, nil
+}
+
+// UnrewardGoal forgets the reward of a day after granting it failed
+func (s *Storage) UnrewardGoal(userId string, date string, ctx context.Context) error {
+	collection := s.db.Collection("hydrationGoals")
+	_, err := collection.DeleteOne(ctx, bson.M{"userId": userId, "date": date})
+	return apperror.FromMongo(err, "hydration goal")
+}
+
+func (s *Storage) Create(request CreateHydrationRequest, userId string, ctx context.Context) (string, error) {
+	collection := s.db.Collection("hydration")
+
+	now := time.Now().Unix()
+	entry := HydrationDB{
+		ID:         primitive.NewObjectID(),
+		UserID:     userId,
+		Amount:     request.Amount,
+		Time:       request.Time,
+		ServerTime: now,
+	}
+	if entry.Time == 0 {
+		entry.Time = now
+	}
+
+	result, err := collection.InsertOne(ctx, entry)
+	if err != nil {
+		return "", apperror.FromMongo(err, "hydration")
+	}
+
+	// convert the object id to a string
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func (s *Storage) Get(hydrationID string, ctx context.Context) (HydrationDB, error) {
+	collection := s.db.Collection("hydration")
+	entry := HydrationDB{}
+
+	// an id that is no object id cannot exist
+	objectID, err := primitive.ObjectIDFromHex(hydrationID)
+	if err != nil {
+		return entry, apperror.NotFound("hydration does not exist")
+	}
+
+	cursor := collection.FindOne(ctx, bson.M{"_id": objectID})
+	if err := cursor.Decode(&entry); err != nil {
+		return entry, apperror.FromMongo(err, "hydration")
+	}
+	return entry, nil
+}
+
+// GetAllOfOneUserBetweenTime returns the entries of a user between startTime
+// and endTime, an endTime of 0 is now
+func (s *Storage) GetAllOfOneUserBetweenTime(userId string, startTime int64, endTime int64, ctx context.Context) ([]HydrationDB, error) {
+	collection := s.db.Collection("hydration")
+	if endTime == 0 {
+		endTime = time.Now().Unix()
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"userId": userId, "time": bson.M{"$gte": startTime, "$lte": endTime}})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "hydration")
+	}
+
+	entries := make([]HydrationDB, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, apperror.FromMongo(err, "hydration")
+	}
+	return entries, nil
+}
+
+// GetDailyTotals sums up the entries of a user between startTime and endTime
+// per day of timeZone, days without entries are missing
+func (s *Storage) GetDailyTotals(userId string, startTime int64, endTime int64, timeZone string, ctx context.Context) ([]DayDB, error) {
+	collection := s.db.Collection("hydration")
+
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"userId": userId, "time": bson.M{"$gte": startTime, "$lte": endTime}}},
+		bson.M{"$group": bson.M{
+			"_id": bson.M{"$dateToString": bson.M{
+				// same as validation.DateLayout
+				"format":   "%Y-%m-%d",
+				"date":     bson.M{"$toDate": bson.M{"$multiply": bson.A{"$time", 1000}}},
+				"timezone": timeZone,
+			}},
+			"amount":  bson.M{"$sum": "$amount"},
+			"entries": bson.M{"$sum": 1},
+		}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "hydration")
+	}
+
+	days := make([]DayDB, 0)
+	if err := cursor.All(ctx, &days); err != nil {
+		return nil, apperror.FromMongo(err, "hydration")
+	}
+	return days, nil
+}
@@ -0,0 +1,51 @@
+package idempotency
+
+import (
+	"cmd/http/main.go/internal/apiversion"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHashRequest(t *testing.T) {
+	// mounted like main does, the hash is the response
+	app := fiber.New()
+	mount := func(router fiber.Router) {
+		hashed := func(c *fiber.Ctx) error {
+			return c.SendString(hashRequest(c))
+		}
+		router.Post("/sleep", hashed)
+		router.Post("/challenges/:id/join", hashed)
+	}
+	mount(app.Group("/"+apiversion.V1, apiversion.Negotiate(apiversion.V1)))
+	mount(app.Group("/", apiversion.Legacy(apiversion.V1, time.Time{})))
+
+	hash := func(path string, payload string) string {
+		resp, err := app.Test(httptest.NewRequest("POST", path, strings.NewReader(payload)), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	if hash("/sleep", `{"quality":3}`) != hash("/v1/sleep", `{"quality":3}`) {
+		t.Errorf("got different hashes for the legacy alias and the /v1 path")
+	}
+	if hash("/challenges/a/join", "") != hash("/v1/challenges/a/join", "") {
+		t.Errorf("got different hashes for the params of the legacy alias and the /v1 path")
+	}
+	if hash("/v1/sleep", `{"quality":3}`) == hash("/v1/sleep", `{"quality":4}`) {
+		t.Errorf("got the same hash for different bodies")
+	}
+	if hash("/v1/challenges/a/join", "") == hash("/v1/challenges/b/join", "") {
+		t.Errorf("got the same hash for different params")
+	}
+}
@@ -0,0 +1,96 @@
+package idempotency
+
+import (
+	"cmd/http/main.go/internal/apiversion"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/logging"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// set on responses that are replayed from a stored key
+	HeaderReplayed = "Idempotent-Replayed"
+)
+
+const maxKeyLength = 255
+
+// New returns a middleware that makes a route safe to retry. Requests with an
+// Idempotency-Key header run once per user and key, retries get the stored
+// response. Reusing a key for a different body is rejected with 422, the key
+// of a rejected or failed request can be used again.
+func New(storage *Storage) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(HeaderIdempotencyKey)
+		userId := string(c.Request().Header.Peek("userId"))
+
+		// the handler rejects requests without user
+		if key == "" || userId == "" {
+			return c.Next()
+		}
+		if len(key) > maxKeyLength {
+			return apperror.Validation("%s must be at most %d characters", HeaderIdempotencyKey, maxKeyLength)
+		}
+
+		requestHash := hashRequest(c)
+		record, started, err := storage.Start(userId, key, requestHash, c.UserContext())
+		if err != nil {
+			return err
+		}
+
+		if !started {
+			if record.RequestHash != requestHash {
+				return apperror.Unprocessable("%s was already used for a different request", HeaderIdempotencyKey)
+			}
+			if !record.Completed {
+				return apperror.Conflict("A request with this %s is still in progress", HeaderIdempotencyKey)
+			}
+
+			c.Set(HeaderReplayed, "true")
+			c.Set(fiber.HeaderContentType, record.ContentType)
+			return c.Status(record.Status).Send(record.Body)
+		}
+
+		// render errors now, so the final response can be stored
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				return err
+			}
+		}
+
+		// errors are not final, the client may fix the request or retry with the same key
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusBadRequest {
+			if err := storage.Release(record.ID, c.UserContext()); err != nil {
+				logging.FromContext(c.UserContext()).Error("could not release idempotency key", "error", err)
+			}
+			return nil
+		}
+
+		contentType := string(c.Response().Header.ContentType())
+		body := append([]byte(nil), c.Response().Body()...)
+		if err := storage.Complete(record.ID, status, contentType, body, c.UserContext()); err != nil {
+			logging.FromContext(c.UserContext()).Error("could not store idempotent response", "error", err)
+		}
+		return nil
+	}
+}
+
+// hashRequest identifies a request by method, route, params and body. The
+// route has no version, so a retry on the legacy alias matches the /v1 path.
+func hashRequest(c *fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method()))
+	hash.Write([]byte(apiversion.Unversioned(c.Route().Path)))
+	for _, param := range c.Route().Params {
+		// separated, so params cannot run into each other
+		hash.Write([]byte{0})
+		hash.Write([]byte(c.Params(param)))
+	}
+	hash.Write([]byte{0})
+	hash.Write(c.Body())
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,113 @@
+package idempotency
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultTTL is how long a key can be replayed
+const DefaultTTL = 24 * time.Hour
+
+// RecordID is one key of one user, as separate fields of the _id, so keys of
+// different users never collide
+type RecordID struct {
+	UserID string `json:"userId" bson:"userId"`
+	Key    string `json:"key" bson:"key"`
+}
+
+// RecordDB is one idempotency key of one user
+type RecordDB struct {
+	ID          RecordID  `json:"id" bson:"_id"`
+	RequestHash string    `json:"requestHash" bson:"requestHash"`
+	Completed   bool      `json:"completed" bson:"completed"`
+	Status      int       `json:"status" bson:"status"`
+	ContentType string    `json:"contentType" bson:"contentType"`
+	Body        []byte    `json:"body" bson:"body"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+type Storage struct {
+	db  *mongo.Database
+	ttl time.Duration
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db:  db,
+		ttl: DefaultTTL,
+	}
+}
+
+// EnsureIndexes lets mongo expire old keys
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	collection := s.db.Collection("idempotency")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"createdAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(int32(s.ttl.Seconds())),
+	})
+	return err
+}
+
+// Start reserves the key for a request. If the key is already known the
+// existing record is returned and started is false.
+func (s *Storage) Start(userId string, key string, requestHash string, ctx context.Context) (RecordDB, bool, error) {
+	collection := s.db.Collection("idempotency")
+
+	record := RecordDB{
+		ID:          RecordID{UserID: userId, Key: key},
+		RequestHash: requestHash,
+		CreatedAt:   time.Now(),
+	}
+
+	_, err := collection.InsertOne(ctx, record)
+	if err == nil {
+		return record, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return record, false, apperror.FromMongo(err, "idempotency key")
+	}
+
+	var existing RecordDB
+	if err := collection.FindOne(ctx, bson.M{"_id": record.ID}).Decode(&existing); err != nil {
+		return record, false, apperror.FromMongo(err, "idempotency key")
+	}
+
+	// mongo removes expired keys only periodically, an expired key starts over
+	if time.Since(existing.CreatedAt) > s.ttl {
+		result, err := collection.ReplaceOne(ctx, bson.M{"_id": record.ID, "createdAt": existing.CreatedAt}, record)
+		if err != nil {
+			return record, false, apperror.FromMongo(err, "idempotency key")
+		}
+		if result.MatchedCount == 1 {
+			return record, true, nil
+		}
+		// another retry took over the expired key in the meantime
+		return record, false, nil
+	}
+
+	return existing, false, nil
+}
+
+// Complete stores the response that is replayed for retries
+func (s *Storage) Complete(id RecordID, status int, contentType string, body []byte, ctx context.Context) error {
+	collection := s.db.Collection("idempotency")
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"completed":   true,
+		"status":      status,
+		"contentType": contentType,
+		"body":        body,
+	}})
+	return apperror.FromMongo(err, "idempotency key")
+}
+
+// Release forgets the key, so the request can be retried
+func (s *Storage) Release(id RecordID, ctx context.Context) error {
+	collection := s.db.Collection("idempotency")
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	return apperror.FromMongo(err, "idempotency key")
+}
@@ -0,0 +1,198 @@
+package journal
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/calendar"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Controller struct {
+	storage         *Storage
+	userStorage     *user.Storage
+	progressStorage *progress.Storage
+}
+
+func NewController(storage *Storage, userStorage *user.Storage, progressStorage *progress.Storage) *Controller {
+	return &Controller{
+		storage:         storage,
+		userStorage:     userStorage,
+		progressStorage: progressStorage,
+	}
+}
+
+type CreateJournalRequest struct {
+	// from 1 (bad) to 5 (great)
+	Mood int      `json:"mood" bson:"mood"`
+	Tags []string `json:"tags" bson:"tags"`
+	Text string   `json:"text" bson:"text"`
+	// unix seconds on the client, defaults to now
+	Time int64 `json:"time" bson:"time"`
+}
+
+// limits of one entry
+const (
+	maxMood      = 5
+	maxTags      = 20
+	maxTagLength = 50
+	maxText      = 10000
+)
+
+func (r CreateJournalRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(validation.InRange(int64(r.Mood), 1, maxMood), "mood", "must be between 1 and %d", maxMood)
+	errs.Check(len(r.Tags) <= maxTags, "tags", "must be at most %d tags", maxTags)
+	for _, tag := range r.Tags {
+		tag = normalizeTag(tag)
+		errs.Check(tag != "" && len(tag) <= maxTagLength, "tags", "must be between 1 and %d characters", maxTagLength)
+	}
+	errs.Check(len(r.Text) <= maxText, "text", "must be at most %d characters", maxText)
+	errs.Check(r.Time == 0 || validation.IsClientTime(r.Time), "time", "must be a unix time of the last %d days", int(validation.MaxClientAge.Hours()/24))
+	return errs.Err()
+}
+
+// tags are matched case insensitive
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+type createJournalResponse struct {
+	ID string `json:"id"`
+}
+
+// @Summary Create journal entry.
+// @Description Creates a new journal entry.
+// @Tags journal
+// @Accept */*
+// @Produce json
+// @Param journal body CreateJournalRequest true "Entry to create"
+// @Param userId header string true "User ID"
+// @Success 200 {object} createJournalResponse
+// @Router /journal [post]
+func (t *Controller) create(c *fiber.Ctx) error {
+	req := validation.Parsed[CreateJournalRequest](c)
+
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	//check if user exists
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	// the experience depends on the earlier entries of the same day
+	at := time.Now()
+	if req.Time != 0 {
+		at = time.Unix(req.Time, 0)
+	}
+	dayStart, dayEnd := profile.Calendar().Bounds(calendar.PeriodDay, at)
+	entriesToday, err := t.storage.CountBetween(userId, dayStart.Unix(), dayEnd.Unix()-1, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	id, err := t.storage.Create(req, userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	err = t.progressStorage.AddExperience(userId, c.UserContext(), settings.PluginNameJournal, progress.JournalExperience(len(req.Text), entriesToday))
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(createJournalResponse{
+		ID: id,
+	})
+}
+
+// @Summary Get journal entries
+// @Description Fetch one or multiple journal entries, newest first or best match first when searching.
+// @Tags journal
+// @Param id query string false "Entry ID"
+// @Param startTime query int64 false "start time"
+// @Param endTime query int64 false "end time"
+// @Param period query string false "day, week or month in the time zone of the user, replaces start and end time"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
+// @Param tag query string false "only entries with this tag"
+// @Param q query string false "full text search in text and tags"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []JournalDB
+// @Router /journal [Get]
+func (t *Controller) get(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	if entryId := c.Query("id"); entryId != "" {
+		// Get particular entry, the entries of other users are private
+		entry, err := t.storage.Get(entryId, c.UserContext())
+		if err != nil {
+			return err
+		}
+		if entry.UserID != userId {
+			return apperror.NotFound("journal entry does not exist")
+		}
+		// convert to array
+		return c.Status(fiber.StatusOK).JSON([]JournalDB{entry})
+	}
+
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	filter := Filter{
+		Tag:    c.Query("tag"),
+		Search: c.Query("q"),
+	}
+
+	var errs validation.Errors
+	for field, target := range map[string]*int64{"startTime": &filter.StartTime, "endTime": &filter.EndTime} {
+		if value := c.Query(field); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			errs.Check(err == nil, field, "must be a unix time")
+			*target = parsed
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	// a period of the user's calendar replaces start and end time
+	if period := c.Query("period"); period != "" {
+		filter.StartTime, filter.EndTime, err = profile.Calendar().Range(calendar.Period(period), c.Query("date"), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := t.storage.GetAllOfOneUser(userId, filter, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(entries)
+}
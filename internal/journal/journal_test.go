@@ -0,0 +1,329 @@
+package journal
+
+import (
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/idempotency"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Suite struct {
+	suite.Suite
+	app        *fiber.App
+	store      *Storage
+	userStore  *user.Storage
+	testUserId string
+	entryId    string
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-journal"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	userStore := user.NewStorage(db)
+	suite.userStore = userStore
+	progressStore := progress.NewStorage(db)
+
+	suite.store = NewStorage(db)
+	journalCont := NewController(suite.store, userStore, progressStore)
+	Routes(app, journalCont, idempotency.New(idempotency.NewStorage(db)))
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	for _, collection := range []string{"users", "journal", "progress"} {
+		if err := suite.store.db.Collection(collection).Drop(context.Background()); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+
+	// the search needs the text index
+	if err := suite.store.EnsureIndexes(context.Background()); err != nil {
+		suite.T().Errorf("Could not create indexes: %v", err)
+	}
+
+	// create a test user (just for userId purposes)
+	testId := "testId"
+	_, err := suite.userStore.Create(user.CreateUserRequest{
+		ID:        testId,
+		FirstName: "test",
+		LastName:  "testId",
+	}, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test user: %v", err)
+	}
+
+	suite.testUserId = testId
+
+	// create a test entry
+	entryId, err := suite.store.Create(CreateJournalRequest{
+		Mood: 4,
+		Tags: []string{"Gratitude"},
+		Text: "A calm morning walk by the lake",
+	}, testId, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test entry: %v", err)
+	}
+
+	suite.entryId = entryId
+}
+
+func (suite *Suite) TestPost() {
+	route := "/journal"
+
+	tests := []struct {
+		missingHeader bool
+		userId        string
+		description   string
+		expectedCode  int
+		body          interface{}
+	}{
+		{
+			description:  "Create successfully",
+			body:         CreateJournalRequest{Mood: 3, Tags: []string{"work"}, Text: "Busy day"},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "Client time",
+			body:         CreateJournalRequest{Mood: 5, Time: time.Now().Add(-time.Hour).Unix()},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "User does not exist",
+			userId:       "doesntexist",
+			body:         CreateJournalRequest{Mood: 3},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "Missing userId header",
+			missingHeader: true,
+			body:          CreateJournalRequest{Mood: 3},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+		{
+			description:  "Missing mood",
+			body:         CreateJournalRequest{Text: "no mood"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Empty tag and too long text",
+			body:         CreateJournalRequest{Mood: 3, Tags: []string{" "}, Text: strings.Repeat("a", maxText+1)},
+			expectedCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		bodyJson, err := json.Marshal(test.body)
+		if err != nil {
+			suite.T().Errorf("Could not marshal entry: %v", err)
+		}
+
+		req := httptest.NewRequest("POST", route, bytes.NewReader(bodyJson))
+
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		} else {
+			req.Header.Set("userId", suite.testUserId)
+		}
+
+		if test.missingHeader {
+			req.Header.Del("userId")
+		}
+
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+func (suite *Suite) TestExperience() {
+	// only the first entries of a day earn experience
+	for i := 0; i < 5; i++ {
+		bodyJson, _ := json.Marshal(CreateJournalRequest{Mood: 3})
+		req := httptest.NewRequest("POST", "/journal", bytes.NewReader(bodyJson))
+		req.Header.Set("userId", suite.testUserId)
+
+		resp, err := suite.app.Test(req, -1)
+		suite.NoError(err)
+		suite.Equal(fiber.StatusCreated, resp.StatusCode)
+	}
+
+	var progressDB progress.Db
+	err := suite.store.db.Collection("progress").FindOne(context.Background(), bson.M{"_id": suite.testUserId}).Decode(&progressDB)
+	suite.NoError(err)
+
+	// the entry of BeforeTest is the first of the day
+	suite.Equal(float64(2*5), progressDB.Experience[settings.PluginNameJournal])
+}
+
+func (suite *Suite) TestGet() {
+	route := "/journal"
+
+	tests := []struct {
+		missingHeader bool
+		userId        string
+		description   string
+		expectedCode  int
+		expectedCount int
+		query         map[string]string
+	}{
+		{
+			description:   "by id",
+			query:         map[string]string{"id": suite.entryId},
+			expectedCode:  fiber.StatusOK,
+			expectedCount: 1,
+		},
+		{
+			description:   "all entries",
+			query:         map[string]string{},
+			expectedCode:  fiber.StatusOK,
+			expectedCount: 1,
+		},
+		{
+			description:   "by tag",
+			query:         map[string]string{"tag": "gratitude"},
+			expectedCode:  fiber.StatusOK,
+			expectedCount: 1,
+		},
+		{
+			description:   "search text",
+			query:         map[string]string{"q": "lake"},
+			expectedCode:  fiber.StatusOK,
+			expectedCount: 1,
+		},
+		{
+			description:   "search without match",
+			query:         map[string]string{"q": "mountains"},
+			expectedCode:  fiber.StatusOK,
+			expectedCount: 0,
+		},
+		{
+			description:   "today",
+			query:         map[string]string{"period": "day"},
+			expectedCode:  fiber.StatusOK,
+			expectedCount: 1,
+		},
+		{
+			description:  "invalid start time",
+			query:        map[string]string{"startTime": "yesterday"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "id does not exist",
+			query:        map[string]string{"id": "nonexistingid"},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:  "id of another user",
+			userId:       "otherId",
+			query:        map[string]string{"id": suite.entryId},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "id without userId header",
+			missingHeader: true,
+			query:         map[string]string{"id": suite.entryId},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+		{
+			description:  "User does not exist",
+			userId:       "doesntexist",
+			query:        map[string]string{},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "Missing userId header",
+			missingHeader: true,
+			query:         map[string]string{},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		url := url.URL{
+			Path: route,
+		}
+
+		// Add query
+		q := url.Query()
+		for key, value := range test.query {
+			q.Add(key, value)
+		}
+		url.RawQuery = q.Encode()
+
+		req := httptest.NewRequest("GET", url.String(), nil)
+
+		// Add header
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		} else {
+			req.Header.Set("userId", suite.testUserId)
+		}
+
+		if test.missingHeader {
+			req.Header.Del("userId")
+		}
+
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, "Error for (%v): %v ", test.description, string(body[:]))
+		if resp.StatusCode == fiber.StatusOK {
+			var entries []JournalDB
+			suite.NoError(json.Unmarshal(body, &entries))
+			suite.Len(entries, test.expectedCount, test.description)
+		}
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestJournalTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
@@ -0,0 +1,18 @@
+package journal
+
+import (
+	"cmd/http/main.go/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// idempotent guards the create route against duplicates from client retries
+func Routes(app fiber.Router, controller *Controller, idempotent fiber.Handler) {
+	journal := app.Group("/journal")
+
+	// add middlewares here
+
+	// add routes here
+	journal.Post("/", idempotent, validation.Body[CreateJournalRequest](), controller.create)
+	journal.Get("/", controller.get)
+}
@@ -0,0 +1,147 @@
+package journal
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type JournalDB struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID string             `json:"userId" bson:"userId"`
+	// from 1 (bad) to 5 (great)
+	Mood int      `json:"mood" bson:"mood"`
+	Tags []string `json:"tags" bson:"tags"`
+	Text string   `json:"text" bson:"text"`
+	// unix seconds of the client
+	Time int64 `json:"time" bson:"time"`
+	// unix seconds when the server stored the entry
+	ServerTime int64 `json:"serverTime" bson:"serverTime"`
+}
+
+// Filter narrows the entries of a user, empty fields match all
+type Filter struct {
+	// unix seconds, an end time of 0 is now
+	StartTime int64
+	EndTime   int64
+	Tag       string
+	// words of the text or tags, the best matches come first
+	Search string
+}
+
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+// EnsureIndexes creates the indexes for range queries and the full text search
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	collection := s.db.Collection("journal")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "userId", Value: 1}, {Key: "time", Value: 1}},
+		},
+		{
+			// searches are always within the entries of one user. Users write in
+			// different languages, so words are not stemmed.
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "text", Value: "text"}, {Key: "tags", Value: "text"}},
+			Options: options.Index().SetDefaultLanguage("none"),
+		},
+	})
+	return err
+}
+
+func (s *Storage) Create(request CreateJournalRequest, userId string, ctx context.Context) (string, error) {
+	collection := s.db.Collection("journal")
+
+	createdAt := time.Now().Unix()
+	clientTime := request.Time
+	if clientTime == 0 {
+		clientTime = createdAt
+	}
+
+	entry := JournalDB{
+		ID:         primitive.NewObjectID(),
+		UserID:     userId,
+		Mood:       request.Mood,
+		Tags:       normalizeTags(request.Tags),
+		Text:       request.Text,
+		Time:       clientTime,
+		ServerTime: createdAt,
+	}
+
+	result, err := collection.InsertOne(ctx, entry)
+	if err != nil {
+		return "", apperror.FromMongo(err, "journal entry")
+	}
+
+	// convert the object id to a string
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func (s *Storage) Get(entryID string, ctx context.Context) (JournalDB, error) {
+	collection := s.db.Collection("journal")
+	entry := JournalDB{}
+
+	// an id that is no object id cannot exist
+	objectID, err := primitive.ObjectIDFromHex(entryID)
+	if err != nil {
+		return entry, apperror.NotFound("journal entry does not exist")
+	}
+
+	cursor := collection.FindOne(ctx, bson.M{"_id": objectID})
+	if err := cursor.Decode(&entry); err != nil {
+		return entry, apperror.FromMongo(err, "journal entry")
+	}
+	return entry, nil
+}
+
+func (s *Storage) GetAllOfOneUser(userId string, filter Filter, ctx context.Context) ([]JournalDB, error) {
+	collection := s.db.Collection("journal")
+
+	if filter.EndTime == 0 {
+		filter.EndTime = time.Now().Unix()
+	}
+	query := bson.M{"userId": userId, "time": bson.M{"$gte": filter.StartTime, "$lte": filter.EndTime}}
+	if filter.Tag != "" {
+		query["tags"] = normalizeTag(filter.Tag)
+	}
+
+	// newest first, or best match first when searching
+	opts := options.Find().SetSort(bson.M{"time": -1})
+	if filter.Search != "" {
+		query["$text"] = bson.M{"$search": filter.Search}
+		opts.SetSort(bson.M{"score": bson.M{"$meta": "textScore"}})
+	}
+
+	cursor, err := collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, apperror.FromMongo(err, "journal entries")
+	}
+
+	entries := make([]JournalDB, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, apperror.FromMongo(err, "journal entries")
+	}
+	return entries, nil
+}
+
+// CountBetween counts the entries of a user between two unix times
+func (s *Storage) CountBetween(userId string, startTime int64, endTime int64, ctx context.Context) (int64, error) {
+	collection := s.db.Collection("journal")
+	count, err := collection.CountDocuments(ctx, bson.M{"userId": userId, "time": bson.M{"$gte": startTime, "$lte": endTime}})
+	if err != nil {
+		return 0, apperror.FromMongo(err, "journal entries")
+	}
+	return count, nil
+}
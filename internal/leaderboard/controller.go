@@ -0,0 +1,181 @@
+package leaderboard
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/social"
+	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Controller struct {
+	storage       *Storage
+	userStorage   *user.Storage
+	socialStorage *social.Storage
+}
+
+func NewController(storage *Storage, userStorage *user.Storage, socialStorage *social.Storage) *Controller {
+	return &Controller{
+		storage:       storage,
+		userStorage:   userStorage,
+		socialStorage: socialStorage,
+	}
+}
+
+// entries of a leaderboard page
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+type entryResponse struct {
+	EntryDB
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+type leaderboardResponse struct {
+	BoardDB
+	Scope   Scope           `json:"scope"`
+	Entries []entryResponse `json:"entries"`
+	// the caller even outside the top, nil if not opted in or without activity
+	Me *entryResponse `json:"me"`
+}
+
+// optedIn keeps the entries of users that are still opted in, the snapshot
+// may be older than an opt-out
+func (t *Controller) optedIn(entries []EntryDB, ctx context.Context) ([]EntryDB, error) {
+	userIds := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		userIds = append(userIds, entry.UserID)
+	}
+	privacy, err := t.socialStorage.GetPrivacyOfUsers(userIds, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]EntryDB, 0, len(entries))
+	for _, entry := range entries {
+		if privacy[entry.UserID].Leaderboards {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, nil
+}
+
+// @Summary Get a leaderboard
+// @Description The users with the most minutes meditated, stairs climbed or the highest savings rate that opted in, recomputed on a schedule. The caller's own rank is always included.
+// @Tags leaderboard
+// @Param plugin path string true "meditation, elevator or finance"
+// @Param period query string false "week, month or allTime, defaults to week"
+// @Param scope query string false "global or friends, defaults to global"
+// @Param limit query int false "entries, defaults to 10, at most 100"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} leaderboardResponse
+// @Router /leaderboard/{plugin} [get]
+func (t *Controller) get(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	plugin := settings.PluginName(c.Params("plugin"))
+	period := Period(c.Query("period", string(PeriodWeek)))
+	scope := Scope(c.Query("scope", string(ScopeGlobal)))
+	limit := c.QueryInt("limit", defaultLimit)
+
+	var errs validation.Errors
+	errs.Check(isPlugin(plugin), "plugin", "must be one of %s, %s, %s", settings.PluginNameMeditation, settings.PluginNameElevator, settings.PluginNameFinance)
+	errs.Check(period.IsValid(), "period", "must be one of %s, %s, %s", PeriodWeek, PeriodMonth, PeriodAllTime)
+	errs.Check(scope.IsValid(), "scope", "must be one of %s, %s", ScopeGlobal, ScopeFriends)
+	errs.Check(validation.InRange(int64(limit), 1, maxLimit), "limit", "must be between 1 and %d", maxLimit)
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	//check if user exists
+	if _, err := t.userStorage.Get(userId, c.UserContext()); err != nil {
+		return err
+	}
+
+	response := leaderboardResponse{
+		BoardDB: BoardDB{Plugin: plugin, Period: period},
+		Scope:   scope,
+		Entries: make([]entryResponse, 0),
+	}
+	// boards are empty until the first snapshot
+	board, err := t.storage.GetBoard(plugin, period, c.UserContext())
+	if apperror.IsNotFound(err) {
+		return c.Status(fiber.StatusOK).JSON(response)
+	}
+	if err != nil {
+		return err
+	}
+	response.BoardDB = board
+
+	var entries []EntryDB
+	var me *EntryDB
+	switch scope {
+	case ScopeFriends:
+		// ranks among the friends and the caller
+		friendships, err := t.socialStorage.GetAllOfOneUser(userId, social.FriendshipStatusAccepted, c.UserContext())
+		if err != nil {
+			return err
+		}
+		userIds := []string{userId}
+		for _, friendship := range friendships {
+			userIds = append(userIds, friendship.Other(userId))
+		}
+		if entries, err = t.storage.GetEntries(board, userIds, c.UserContext()); err != nil {
+			return err
+		}
+		if entries, err = t.optedIn(entries, c.UserContext()); err != nil {
+			return err
+		}
+		Rank(entries)
+		for i := range entries {
+			if entries[i].UserID == userId {
+				me = &entries[i]
+			}
+		}
+	default:
+		if entries, err = t.storage.GetTop(board, int64(limit), c.UserContext()); err != nil {
+			return err
+		}
+		own, err := t.storage.GetEntries(board, []string{userId}, c.UserContext())
+		if err != nil {
+			return err
+		}
+		entries = append(entries, own...)
+		if entries, err = t.optedIn(entries, c.UserContext()); err != nil {
+			return err
+		}
+		if len(own) > 0 && len(entries) > 0 && entries[len(entries)-1].UserID == userId {
+			me = &entries[len(entries)-1]
+			entries = entries[:len(entries)-1]
+		}
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	userIds := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		userIds = append(userIds, entry.UserID)
+	}
+	users, err := t.userStorage.GetMany(append(userIds, userId), c.UserContext())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		response.Entries = append(response.Entries, entryResponse{EntryDB: entry, FirstName: users[entry.UserID].FirstName, LastName: users[entry.UserID].LastName})
+	}
+	if me != nil {
+		response.Me = &entryResponse{EntryDB: *me, FirstName: users[userId].FirstName, LastName: users[userId].LastName}
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
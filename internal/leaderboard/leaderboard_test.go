@@ -0,0 +1,216 @@
+package leaderboard
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/finance"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/social"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Suite struct {
+	suite.Suite
+	app         *fiber.App
+	store       *Storage
+	userStore   *user.Storage
+	socialStore *social.Storage
+	worker      *Worker
+	testUserId  string
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-leaderboard"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	userStore := user.NewStorage(db)
+	suite.userStore = userStore
+	suite.socialStore = social.NewStorage(db)
+
+	suite.store = NewStorage(db)
+	suite.worker = NewWorker(suite.store, suite.socialStore, meditation.NewStorage(db), elevator.NewStorage(db), finance.NewStorage(db), time.Minute)
+	leaderboardCont := NewController(suite.store, userStore, suite.socialStore)
+	Routes(app, leaderboardCont)
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	ctx := context.Background()
+	for _, collection := range []string{"users", "meditation", "friendships", "privacy", "leaderboards", "leaderboardEntries"} {
+		if err := suite.store.db.Collection(collection).Drop(ctx); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+
+	// the test user, a friend and two strangers meditated today, all but the private one opted in
+	suite.testUserId = "testId"
+	now := time.Now().Unix()
+	minutes := map[string]int{suite.testUserId: 20, "friendId": 30, "strangerId": 60, "privateId": 90}
+	for id, amount := range minutes {
+		_, err := suite.userStore.Create(user.CreateUserRequest{
+			ID:        id,
+			FirstName: "test",
+			LastName:  id,
+		}, ctx)
+		if err != nil {
+			suite.T().Errorf("Could not create test user: %v", err)
+		}
+
+		_, err = suite.store.db.Collection("meditation").InsertOne(ctx, meditation.MeditationDB{
+			ID:             primitive.NewObjectID(),
+			UserID:         id,
+			MeditationTime: amount,
+			StartTime:      now - int64(amount*60),
+			EndTime:        now,
+			ServerTime:     now,
+		})
+		if err != nil {
+			suite.T().Errorf("Could not create test meditation: %v", err)
+		}
+
+		optIn := id != "privateId"
+		if _, err := suite.socialStore.UpdatePrivacy(id, social.UpdatePrivacyRequest{Leaderboards: &optIn}, ctx); err != nil {
+			suite.T().Errorf("Could not opt in: %v", err)
+		}
+	}
+
+	if _, err := suite.socialStore.CreateRequest(suite.testUserId, "friendId", ctx); err != nil {
+		suite.T().Errorf("Could not create test friend request: %v", err)
+	}
+	if _, err := suite.socialStore.Accept("friendId", suite.testUserId, ctx); err != nil {
+		suite.T().Errorf("Could not accept test friend request: %v", err)
+	}
+
+	if err := suite.worker.Recompute(ctx); err != nil {
+		suite.T().Errorf("Could not compute the leaderboards: %v", err)
+	}
+}
+
+func (suite *Suite) get(query string) (int, leaderboardResponse) {
+	req := httptest.NewRequest("GET", "/leaderboard/"+query, nil)
+	req.Header.Set("userId", suite.testUserId)
+	resp, err := suite.app.Test(req, -1)
+	if err != nil {
+		suite.T().Errorf("Could not make request: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var response leaderboardResponse
+	if resp.StatusCode == fiber.StatusOK {
+		suite.NoError(json.Unmarshal(body, &response), string(body))
+	}
+	return resp.StatusCode, response
+}
+
+func (suite *Suite) TestGet() {
+	tests := []struct {
+		description  string
+		query        string
+		expectedCode int
+	}{
+		{description: "Get successfully", query: "meditation", expectedCode: fiber.StatusOK},
+		{description: "Friends of the month", query: "meditation?period=month&scope=friends", expectedCode: fiber.StatusOK},
+		{description: "Without activity is empty", query: "finance?period=allTime", expectedCode: fiber.StatusOK},
+		{description: "Plugin without leaderboard", query: "journal", expectedCode: fiber.StatusBadRequest},
+		{description: "Invalid period", query: "meditation?period=year", expectedCode: fiber.StatusBadRequest},
+		{description: "Invalid scope", query: "meditation?scope=everyone", expectedCode: fiber.StatusBadRequest},
+		{description: "Limit too high", query: "meditation?limit=1000", expectedCode: fiber.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		code, _ := suite.get(test.query)
+		suite.Equal(test.expectedCode, code, "Error for (%v)", test.description)
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+func (suite *Suite) TestGlobal() {
+	// the private user is missing and the caller is ranked below the top
+	code, response := suite.get("meditation?limit=2")
+	suite.Equal(fiber.StatusOK, code)
+	suite.Len(response.Entries, 2)
+	suite.Equal("strangerId", response.Entries[0].UserID)
+	suite.Equal(1, response.Entries[0].Rank)
+	suite.Equal(60.0, response.Entries[0].Value)
+	suite.Equal("friendId", response.Entries[1].UserID)
+	suite.Require().NotNil(response.Me)
+	suite.Equal(3, response.Me.Rank)
+	suite.Equal(20.0, response.Me.Value)
+
+	// an opt-out hides the user before the next snapshot
+	optIn := false
+	_, err := suite.socialStore.UpdatePrivacy("strangerId", social.UpdatePrivacyRequest{Leaderboards: &optIn}, context.Background())
+	suite.NoError(err)
+	_, response = suite.get("meditation")
+	for _, entry := range response.Entries {
+		suite.NotEqual("strangerId", entry.UserID)
+	}
+}
+
+func (suite *Suite) TestFriends() {
+	code, response := suite.get("meditation?scope=friends")
+	suite.Equal(fiber.StatusOK, code)
+	suite.Len(response.Entries, 2)
+	suite.Equal("friendId", response.Entries[0].UserID)
+	suite.Equal(1, response.Entries[0].Rank)
+	suite.Require().NotNil(response.Me)
+	suite.Equal(2, response.Me.Rank)
+}
+
+func (suite *Suite) TestOptedOut() {
+	optIn := false
+	_, err := suite.socialStore.UpdatePrivacy(suite.testUserId, social.UpdatePrivacyRequest{Leaderboards: &optIn}, context.Background())
+	suite.NoError(err)
+
+	_, response := suite.get("meditation")
+	suite.Nil(response.Me)
+}
+
+func TestRank(t *testing.T) {
+	entries := []EntryDB{{UserID: "a", Value: 10}, {UserID: "b", Value: 30}, {UserID: "c", Value: 10}, {UserID: "d", Value: 5}}
+	Rank(entries)
+
+	expected := []struct {
+		userId string
+		rank   int
+	}{{"b", 1}, {"a", 2}, {"c", 2}, {"d", 4}}
+	for i, entry := range entries {
+		if entry.UserID != expected[i].userId || entry.Rank != expected[i].rank {
+			t.Errorf("entry %d: got %s at rank %d, want %s at rank %d", i, entry.UserID, entry.Rank, expected[i].userId, expected[i].rank)
+		}
+	}
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestLeaderboardTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
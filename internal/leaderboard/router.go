@@ -0,0 +1,14 @@
+package leaderboard
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+func Routes(app fiber.Router, controller *Controller) {
+	leaderboard := app.Group("/leaderboard")
+
+	// add middlewares here
+
+	// add routes here
+	leaderboard.Get("/:plugin", controller.get)
+}
@@ -0,0 +1,186 @@
+package leaderboard
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/settings"
+	"context"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// plugins with a leaderboard
+var plugins = []settings.PluginName{settings.PluginNameMeditation, settings.PluginNameElevator, settings.PluginNameFinance}
+
+func isPlugin(plugin settings.PluginName) bool {
+	for _, p := range plugins {
+		if p == plugin {
+			return true
+		}
+	}
+	return false
+}
+
+type Period string
+
+const (
+	PeriodWeek    Period = "week"
+	PeriodMonth   Period = "month"
+	PeriodAllTime Period = "allTime"
+)
+
+func (p Period) IsValid() bool {
+	return p == PeriodWeek || p == PeriodMonth || p == PeriodAllTime
+}
+
+var periods = []Period{PeriodWeek, PeriodMonth, PeriodAllTime}
+
+type Scope string
+
+const (
+	ScopeGlobal  Scope = "global"
+	ScopeFriends Scope = "friends"
+)
+
+func (s Scope) IsValid() bool {
+	return s == ScopeGlobal || s == ScopeFriends
+}
+
+// BoardDB is the latest snapshot of a leaderboard, its entries belong to the generation
+type BoardDB struct {
+	// plugin:period
+	ID     string              `json:"-" bson:"_id"`
+	Plugin settings.PluginName `json:"plugin" bson:"plugin"`
+	Period Period              `json:"period" bson:"period"`
+	// unix seconds of the period, all time starts at 0
+	StartTime  int64              `json:"startTime" bson:"startTime"`
+	EndTime    int64              `json:"endTime" bson:"endTime"`
+	ComputedAt int64              `json:"computedAt" bson:"computedAt"`
+	Generation primitive.ObjectID `json:"-" bson:"generation"`
+}
+
+func boardID(plugin settings.PluginName, period Period) string {
+	return string(plugin) + ":" + string(period)
+}
+
+type EntryDB struct {
+	ID         primitive.ObjectID `json:"-" bson:"_id"`
+	Board      string             `json:"-" bson:"board"`
+	Generation primitive.ObjectID `json:"-" bson:"generation"`
+	UserID     string             `json:"userId" bson:"userId"`
+	Value      float64            `json:"value" bson:"value"`
+	// users with the same value share the rank, the next rank is skipped
+	Rank int `json:"rank" bson:"rank"`
+}
+
+// Rank sorts entries by value, highest first, and sets their ranks
+func Rank(entries []EntryDB) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+	for i := range entries {
+		if i > 0 && entries[i].Value == entries[i-1].Value {
+			entries[i].Rank = entries[i-1].Rank
+		} else {
+			entries[i].Rank = i + 1
+		}
+	}
+}
+
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+// EnsureIndexes creates the indexes for the top of a board and the rank of a user
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	collection := s.db.Collection("leaderboardEntries")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "board", Value: 1}, {Key: "generation", Value: 1}, {Key: "rank", Value: 1}}},
+		{Keys: bson.D{{Key: "board", Value: 1}, {Key: "generation", Value: 1}, {Key: "userId", Value: 1}}},
+	})
+	return err
+}
+
+// Replace stores a new snapshot of a board. Readers see the old snapshot until
+// the board points to the new generation, the old entries are removed after.
+func (s *Storage) Replace(board BoardDB, entries []EntryDB, ctx context.Context) error {
+	collection := s.db.Collection("leaderboards")
+	entriesCollection := s.db.Collection("leaderboardEntries")
+
+	board.ID = boardID(board.Plugin, board.Period)
+	board.Generation = primitive.NewObjectID()
+	if len(entries) > 0 {
+		documents := make([]interface{}, 0, len(entries))
+		for _, entry := range entries {
+			entry.ID = primitive.NewObjectID()
+			entry.Board = board.ID
+			entry.Generation = board.Generation
+			documents = append(documents, entry)
+		}
+		if _, err := entriesCollection.InsertMany(ctx, documents); err != nil {
+			return apperror.FromMongo(err, "leaderboard entries")
+		}
+	}
+
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": board.ID}, board, options.Replace().SetUpsert(true))
+	if err != nil {
+		return apperror.FromMongo(err, "leaderboard")
+	}
+
+	_, err = entriesCollection.DeleteMany(ctx, bson.M{"board": board.ID, "generation": bson.M{"$ne": board.Generation}})
+	if err != nil {
+		return apperror.FromMongo(err, "leaderboard entries")
+	}
+	return nil
+}
+
+// GetBoard returns the latest snapshot of a board
+func (s *Storage) GetBoard(plugin settings.PluginName, period Period, ctx context.Context) (BoardDB, error) {
+	collection := s.db.Collection("leaderboards")
+	board := BoardDB{}
+
+	err := collection.FindOne(ctx, bson.M{"_id": boardID(plugin, period)}).Decode(&board)
+	if err != nil {
+		return board, apperror.FromMongo(err, "leaderboard")
+	}
+	return board, nil
+}
+
+// GetTop returns the best entries of a snapshot, sorted by rank
+func (s *Storage) GetTop(board BoardDB, limit int64, ctx context.Context) ([]EntryDB, error) {
+	return s.find(bson.M{"board": board.ID, "generation": board.Generation},
+		options.Find().SetSort(bson.D{{Key: "rank", Value: 1}, {Key: "userId", Value: 1}}).SetLimit(limit), ctx)
+}
+
+// GetEntries returns the entries of userIds in a snapshot, users without activity are missing
+func (s *Storage) GetEntries(board BoardDB, userIds []string, ctx context.Context) ([]EntryDB, error) {
+	return s.find(bson.M{"board": board.ID, "generation": board.Generation, "userId": bson.M{"$in": userIds}},
+		options.Find().SetSort(bson.D{{Key: "rank", Value: 1}, {Key: "userId", Value: 1}}), ctx)
+}
+
+func (s *Storage) find(filter bson.M, opts *options.FindOptions, ctx context.Context) ([]EntryDB, error) {
+	collection := s.db.Collection("leaderboardEntries")
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, apperror.FromMongo(err, "leaderboard entries")
+	}
+
+	entries := make([]EntryDB, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, apperror.FromMongo(err, "leaderboard entries")
+	}
+	return entries, nil
+}
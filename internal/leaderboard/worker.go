@@ -0,0 +1,133 @@
+package leaderboard
+
+import (
+	"cmd/http/main.go/internal/calendar"
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/finance"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/social"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// totals returns the value of each of userIds with activity between startTime and endTime
+type totals func(userIds []string, startTime int64, endTime int64, ctx context.Context) (map[string]float64, error)
+
+// Worker recomputes the snapshots of all leaderboards on a schedule
+type Worker struct {
+	storage       *Storage
+	socialStorage *social.Storage
+	totals        map[settings.PluginName]totals
+	interval      time.Duration
+	running       atomic.Bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewWorker(storage *Storage, socialStorage *social.Storage, meditationStorage *meditation.Storage, elevatorStorage *elevator.Storage, financeStorage *finance.Storage, interval time.Duration) *Worker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Worker{
+		storage:       storage,
+		socialStorage: socialStorage,
+		totals: map[settings.PluginName]totals{
+			// minutes meditated
+			settings.PluginNameMeditation: meditationStorage.GetMinutesOfUsers,
+			// stairs climbed
+			settings.PluginNameElevator: elevatorStorage.GetStairsOfUsers,
+			// savings rate in percent
+			settings.PluginNameFinance: financeStorage.GetSavingsRateOfUsers,
+		},
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start recomputes the leaderboards now and then every interval in the background
+func (w *Worker) Start() {
+	w.running.Store(true)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer w.running.Store(false)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			if err := w.Recompute(w.ctx); err != nil && w.ctx.Err() == nil {
+				slog.Error("could not recompute leaderboards", "error", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-w.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop interrupts a running recompute and waits for it
+func (w *Worker) Stop() {
+	w.cancel()
+	w.wg.Wait()
+}
+
+// Check returns an error if the worker is not started or stopped
+func (w *Worker) Check(ctx context.Context) error {
+	if !w.running.Load() {
+		return errors.New("leaderboard worker is not running")
+	}
+	return nil
+}
+
+// Recompute stores new snapshots of all leaderboards, a failing board does not stop the others
+func (w *Worker) Recompute(ctx context.Context) error {
+	userIds, err := w.socialStorage.GetLeaderboardUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the periods of the global leaderboards are the ones of the default calendar
+	cal, err := calendar.New("", "")
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	var errs []error
+	for _, plugin := range plugins {
+		for _, period := range periods {
+			if err := w.recompute(plugin, period, userIds, cal, now, ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", boardID(plugin, period), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *Worker) recompute(plugin settings.PluginName, period Period, userIds []string, cal calendar.Calendar, now time.Time, ctx context.Context) error {
+	board := BoardDB{Plugin: plugin, Period: period, EndTime: now.Unix(), ComputedAt: now.Unix()}
+	if period != PeriodAllTime {
+		start, end := cal.Bounds(calendar.Period(period), now)
+		board.StartTime, board.EndTime = start.Unix(), end.Unix()-1
+	}
+
+	values, err := w.totals[plugin](userIds, board.StartTime, board.EndTime, ctx)
+	if err != nil {
+		return err
+	}
+	entries := make([]EntryDB, 0, len(values))
+	for userId, value := range values {
+		entries = append(entries, EntryDB{UserID: userId, Value: value})
+	}
+	Rank(entries)
+
+	return w.storage.Replace(board, entries, ctx)
+}
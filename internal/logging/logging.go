@@ -0,0 +1,102 @@
+// Package logging configures the structured logger. Requests get a logger
+// with their request and trace id in the context, storages log with the
+// logger of their context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// keys of attributes that hold personal data, compared in lower case
+var piiKeys = map[string]bool{
+	"email":       true,
+	"dateofbirth": true,
+	"birthdate":   true,
+	"firstname":   true,
+	"lastname":    true,
+	"password":    true,
+	"reason":      true,
+}
+
+// emails within messages and errors, like of duplicate key errors
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// Redacted replaces personal data
+const Redacted = "[redacted]"
+
+// Redact removes the emails of a text
+func Redact(text string) string {
+	return emailPattern.ReplaceAllString(text, Redacted)
+}
+
+// Personal reports if key names personal data, like the email of a profile
+func Personal(key string) bool {
+	return piiKeys[strings.ToLower(key)]
+}
+
+// redact replaces the values of personal attributes and the emails within
+// strings and errors
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if Personal(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(Redact(attr.Value.String()))
+	case slog.KindAny:
+		switch value := attr.Value.Any().(type) {
+		case error:
+			attr.Value = slog.StringValue(Redact(value.Error()))
+		case fmt.Stringer:
+			attr.Value = slog.StringValue(Redact(value.String()))
+		}
+	}
+	return attr
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	err := parsed.UnmarshalText([]byte(level))
+	return parsed, err
+}
+
+// New returns a logger of level that writes json or text lines to w
+func New(level string, format string, w io.Writer) (*slog.Logger, error) {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{Level: parsed, ReplaceAttr: redact}
+	if format == FormatText {
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	}
+	return slog.New(slog.NewJSONHandler(w, options)), nil
+}
+
+type loggerKey struct{}
+
+// WithContext returns ctx with the logger
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of ctx, the default logger outside of requests
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRedact(t *testing.T) {
+	var output bytes.Buffer
+	logger, err := New("debug", FormatJSON, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("user created",
+		"email", "jane@example.com",
+		"dateOfBirth", "1990-01-31",
+		"error", errors.New(`duplicate key { email: "jane@example.com" }`),
+		"note", "mail jane.doe+test@mail.example.org soon",
+		"userId", "testId",
+	)
+
+	line := output.String()
+	if strings.Contains(line, "example") || strings.Contains(line, "1990-01-31") {
+		t.Errorf("got personal data in %s", line)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["email"] != Redacted || entry["dateOfBirth"] != Redacted || entry["userId"] != "testId" {
+		t.Errorf("got entry %v", entry)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []string{"debug", "INFO", "warn", "error"} {
+		if _, err := ParseLevel(level); err != nil {
+			t.Errorf("%s: %v", level, err)
+		}
+	}
+	if _, err := New("verbose", FormatText, &bytes.Buffer{}); err == nil {
+		t.Errorf("got no error for an unknown level")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var output bytes.Buffer
+	logger, err := New("info", FormatJSON, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(Middleware(logger))
+	app.Get("/users/:id", func(c *fiber.Ctx) error {
+		// the storages log with the logger of the request context
+		FromContext(c.Context()).Info("storage")
+		return fiber.ErrNotFound
+	})
+
+	tests := []struct {
+		header    string
+		requestId string
+	}{
+		{"client-id.1", "client-id.1"},
+		{"", ""},
+		{"no spaces allowed", ""},
+	}
+	for _, test := range tests {
+		output.Reset()
+		req := httptest.NewRequest("GET", "/users/testId", nil)
+		if test.header != "" {
+			req.Header.Set(HeaderRequestID, test.header)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requestId := resp.Header.Get(HeaderRequestID)
+		if test.requestId != "" && requestId != test.requestId {
+			t.Errorf("%q: got request id %s, want %s", test.header, requestId, test.requestId)
+		}
+		if test.requestId == "" && (len(requestId) != 32 || requestId == test.header) {
+			t.Errorf("%q: got request id %q, want a new one", test.header, requestId)
+		}
+
+		decoder := json.NewDecoder(&output)
+		var lines []map[string]interface{}
+		for decoder.More() {
+			var line map[string]interface{}
+			if err := decoder.Decode(&line); err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) != 2 {
+			t.Fatalf("%q: got %d lines, want 2", test.header, len(lines))
+		}
+		for _, line := range lines {
+			if line["requestId"] != requestId {
+				t.Errorf("%q: got line %v without the request id", test.header, line)
+			}
+		}
+		if request := lines[1]; request["route"] != "/users/:id" || request["status"] != float64(fiber.StatusNotFound) {
+			t.Errorf("%q: got request line %v", test.header, request)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"cmd/http/main.go/internal/tracing"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const HeaderRequestID = "X-Request-Id"
+
+// request ids of clients are kept if they are short and plain
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// Middleware gives each request an id and a logger with it in the context,
+// the id of an X-Request-Id header is kept. Each request is logged when it is
+// done, errors are rendered first to log their status.
+func Middleware(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		requestId := c.Get(HeaderRequestID)
+		if !requestIDPattern.MatchString(requestId) {
+			requestId = newRequestID()
+		}
+		c.Set(HeaderRequestID, requestId)
+
+		requestLogger := logger.With("requestId", requestId)
+		if span := tracing.FromContext(c.Context()); span != nil {
+			requestLogger = requestLogger.With("traceId", span.TraceID)
+		}
+		c.Context().SetUserValue(loggerKey{}, requestLogger)
+		c.SetUserContext(WithContext(c.UserContext(), requestLogger))
+
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		requestLogger.Log(c.Context(), level, "request",
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"latency", time.Since(start),
+			"userId", string(c.Request().Header.Peek("userId")),
+		)
+		return nil
+	}
+}
@@ -1,10 +1,14 @@
 package meditation
 
 import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/calendar"
 	"cmd/http/main.go/internal/progress"
 	"cmd/http/main.go/internal/settings"
 	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -23,9 +27,84 @@ func NewController(storage *Storage, userStorage *user.Storage, progressStorage
 	}
 }
 
+type MeditationType string
+
+const (
+	MeditationTypeGuided    MeditationType = "guided"
+	MeditationTypeBreathing MeditationType = "breathing"
+	MeditationTypeBodyScan  MeditationType = "bodyScan"
+	MeditationTypeUnguided  MeditationType = "unguided"
+)
+
+func (t MeditationType) IsValid() bool {
+	return t == MeditationTypeGuided || t == MeditationTypeBreathing || t == MeditationTypeBodyScan || t == MeditationTypeUnguided
+}
+
 type CreateMeditationRequest struct {
-	MeditationTime int   `json:"meditationTime" bson:"meditationTime"`
-	EndTime        int64 `json:"endTime" bson:"endTime"`
+	// duration in minutes
+	MeditationTime int `json:"meditationTime" bson:"meditationTime"`
+	// unix seconds on the client, both are optional
+	StartTime int64 `json:"startTime" bson:"startTime"`
+	EndTime   int64 `json:"endTime" bson:"endTime"`
+	// defaults to unguided
+	Type MeditationType `json:"type" bson:"type"`
+	// guide or track of a guided session
+	GuideRef string `json:"guideRef" bson:"guideRef"`
+	// from 1 (bad) to 5 (great), 0 if not given
+	MoodBefore    int    `json:"moodBefore" bson:"moodBefore"`
+	MoodAfter     int    `json:"moodAfter" bson:"moodAfter"`
+	Interruptions int    `json:"interruptions" bson:"interruptions"`
+	Notes         string `json:"notes" bson:"notes"`
+}
+
+// at most one day of meditation per session
+const maxMeditationTime = 24 * 60
+
+// limits of the session details
+const (
+	MoodScale        = 5
+	maxGuideRef      = 200
+	maxInterruptions = 1000
+	maxNotes         = 2000
+)
+
+func (r CreateMeditationRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(validation.InRange(int64(r.MeditationTime), 1, maxMeditationTime), "meditationTime", "must be between 1 and %d minutes", maxMeditationTime)
+	errs.Check(r.StartTime == 0 || validation.IsClientTime(r.StartTime), "startTime", "must be a unix time of the last %d days", int(validation.MaxClientAge.Hours()/24))
+	errs.Check(r.EndTime == 0 || validation.IsClientTime(r.EndTime), "endTime", "must be a unix time of the last %d days", int(validation.MaxClientAge.Hours()/24))
+	if r.StartTime != 0 && r.EndTime != 0 {
+		// the duration is rounded to minutes and may exclude pauses
+		errs.Check(r.EndTime-r.StartTime+60 >= int64(r.MeditationTime)*60, "meditationTime", "must fit between startTime and endTime")
+	}
+	errs.Check(r.Type == "" || r.Type.IsValid(), "type", "must be one of %s, %s, %s, %s", MeditationTypeGuided, MeditationTypeBreathing, MeditationTypeBodyScan, MeditationTypeUnguided)
+	errs.Check(len(r.GuideRef) <= maxGuideRef, "guideRef", "must be at most %d characters", maxGuideRef)
+	errs.Check(r.GuideRef == "" || (r.Type != "" && r.Type != MeditationTypeUnguided), "guideRef", "can not be set for unguided sessions")
+	errs.Check(validation.InRange(int64(r.MoodBefore), 0, MoodScale), "moodBefore", "must be between 1 and %d, or 0 if not set", MoodScale)
+	errs.Check(validation.InRange(int64(r.MoodAfter), 0, MoodScale), "moodAfter", "must be between 1 and %d, or 0 if not set", MoodScale)
+	errs.Check(validation.InRange(int64(r.Interruptions), 0, maxInterruptions), "interruptions", "must be between 0 and %d", maxInterruptions)
+	errs.Check(len(r.Notes) <= maxNotes, "notes", "must be at most %d characters", maxNotes)
+	return errs.Err()
+}
+
+// Times returns the start and end of the session, missing times are derived
+// from the duration and the end defaults to now
+func (r CreateMeditationRequest) Times(now time.Time) (int64, int64) {
+	duration := int64(r.MeditationTime) * 60
+	switch {
+	case r.StartTime != 0 && r.EndTime != 0:
+		return r.StartTime, r.EndTime
+	case r.StartTime != 0:
+		return r.StartTime, r.StartTime + duration
+	case r.EndTime != 0:
+		return r.EndTime - duration, r.EndTime
+	}
+	return now.Unix() - duration, now.Unix()
+}
+
+// Experience is the progress a meditation earns, one point per minute
+func (r CreateMeditationRequest) Experience() float64 {
+	return float64(r.MeditationTime)
 }
 
 type createMeditationResponse struct {
@@ -52,43 +131,28 @@ type getAllMeditationResponse []struct {
 // @Success 200 {object} createMeditationResponse
 // @Router /meditation [post]
 func (t *Controller) create(c *fiber.Ctx) error {
-	c.Request().Header.Set("Content-Type", "application/json")
-	var req CreateMeditationRequest
-
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request body",
-			"err":     err,
-		})
-	}
+	req := validation.Parsed[CreateMeditationRequest](c)
 
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
+		return apperror.Validation("Missing userId header")
 	}
 
 	//check if user exists
-	_, err := t.userStorage.Get(userId, c.Context())
-
+	profile, err := t.userStorage.Get(userId, c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "User does not exist",
-			"err":     err,
-		})
+		return err
+	}
+	if err := t.storage.CheckLimit(req, userId, profile.Calendar(), time.Now(), c.UserContext()); err != nil {
+		return err
 	}
 
-	//TODO correct error handling
 	// Create meditation record
-	id, err := t.storage.Create(req, userId, c.Context())
+	id, err := t.storage.Create(req, userId, c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "Failed to Create Meditation",
-			"err":     err,
-		})
+		return err
 	}
-	err = t.progressStorage.AddExperience(userId, c.Context(), settings.PluginNameMeditation, float64(req.MeditationTime))
+	err = t.progressStorage.AddExperience(userId, c.UserContext(), settings.PluginNameMeditation, req.Experience())
 	if err != nil {
 		return err
 	}
@@ -105,12 +169,22 @@ func (t *Controller) create(c *fiber.Ctx) error {
 // @Param endTime query int64 false "end time"
 // @Param durationStart query int64 false "duration start time"
 // @Param durationEnd query int64 false "duration end time"
-// @Param userId header string false "User ID"
+// @Param period query string false "day, week or month in the time zone of the user, replaces start and end time"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
+// @Param type query string false "guided, breathing, bodyScan or unguided"
+// @Param minMoodChange query int false "minimum of moodAfter minus moodBefore"
+// @Param maxMoodChange query int false "maximum of moodAfter minus moodBefore"
+// @Param userId header string true "User ID"
 // @Produce json
 // @Success 200 {object} []MeditationDB
 // @Router /meditation [Get]
 func (t *Controller) get(c *fiber.Ctx) error {
 	c.Request().Header.Set("Content-Type", "application/json")
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
 	//parse Query values
 	meditationId := c.Query("id")
 	//map for time parameters
@@ -121,12 +195,13 @@ func (t *Controller) get(c *fiber.Ctx) error {
 		"durationEnd":   convertToInt64(c.Query("durationEnd")),
 	}
 	if meditationId != "" {
-		// Get particular meditation
-		meditation, err := t.storage.Get(meditationId, c.Context())
+		// Get particular meditation, the entries of other users are private
+		meditation, err := t.storage.Get(meditationId, c.UserContext())
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Failed to get meditation",
-			})
+			return err
+		}
+		if meditation.UserID != userId {
+			return apperror.NotFound("meditation does not exist")
 		}
 		// convert to array
 		return c.Status(fiber.StatusOK).JSON(
@@ -134,32 +209,104 @@ func (t *Controller) get(c *fiber.Ctx) error {
 		)
 	}
 
-	userId := string(c.Request().Header.Peek("userId"))
-	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
-	} else {
-		_, err := t.userStorage.Get(userId, c.Context())
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
 
+	// a period of the user's calendar replaces start and end time
+	if period := c.Query("period"); period != "" {
+		times["startTime"], times["endTime"], err = profile.Calendar().Range(calendar.Period(period), c.Query("date"), time.Now())
 		if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "User does not exist",
-				"err":     err,
-			})
+			return err
 		}
+	}
 
-		// all meditations for a user between a time range and duration
-		meditations, err := t.storage.GetAllOfOneUserBetweenTimeAndDuration(userId, times, c.Context())
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"message": "Failed to get meditations in time range",
-				"err":     err,
-			})
-		}
+	filter, err := parseFilter(c)
+	if err != nil {
+		return err
+	}
 
-		return c.Status(fiber.StatusOK).JSON(meditations)
+	// all meditations for a user between a time range and duration
+	meditations, err := t.storage.GetAllOfOneUserBetweenTimeAndDuration(userId, times, filter, c.UserContext())
+	if err != nil {
+		return err
 	}
+
+	return c.Status(fiber.StatusOK).JSON(meditations)
+}
+
+// parseFilter reads the type and mood change filters of a query
+func parseFilter(c *fiber.Ctx) (Filter, error) {
+	var errs validation.Errors
+	filter := Filter{Type: MeditationType(c.Query("type"))}
+	errs.Check(filter.Type == "" || filter.Type.IsValid(), "type", "must be one of %s, %s, %s, %s", MeditationTypeGuided, MeditationTypeBreathing, MeditationTypeBodyScan, MeditationTypeUnguided)
+	filter.MinMoodChange = optionalInt(&errs, c, "minMoodChange")
+	filter.MaxMoodChange = optionalInt(&errs, c, "maxMoodChange")
+	return filter, errs.Err()
+}
+
+// optionalInt parses a number query parameter, nil if it is not given
+func optionalInt(errs *validation.Errors, c *fiber.Ctx, field string) *int {
+	value := c.Query(field)
+	if value == "" {
+		return nil
+	}
+	number, err := strconv.Atoi(value)
+	errs.Check(err == nil, field, "must be a number")
+	return &number
+}
+
+// @Summary Get meditation stats
+// @Description Totals per meditation type within a period of the user's calendar.
+// @Tags meditation
+// @Param period query string false "day, week or month, defaults to week"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} statsResponse
+// @Router /meditation/stats [Get]
+func (t *Controller) stats(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	period := calendar.Period(c.Query("period", string(calendar.PeriodWeek)))
+	startTime, endTime, err := profile.Calendar().Range(period, c.Query("date"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	byType, err := t.storage.GetStats(userId, startTime, endTime, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	response := statsResponse{
+		StartTime: startTime,
+		EndTime:   endTime,
+		ByType:    byType,
+	}
+	for _, stats := range byType {
+		response.Sessions += stats.Sessions
+		response.Minutes += stats.Minutes
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+type statsResponse struct {
+	// first and last second of the period
+	StartTime int64                        `json:"startTime"`
+	EndTime   int64                        `json:"endTime"`
+	Sessions  int                          `json:"sessions"`
+	Minutes   int                          `json:"minutes"`
+	ByType    map[MeditationType]TypeStats `json:"byType"`
 }
 
 func convertToInt64(value string) int64 {
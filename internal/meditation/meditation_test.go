@@ -2,6 +2,8 @@ package meditation
 
 import (
 	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/idempotency"
 	"cmd/http/main.go/internal/progress"
 	"cmd/http/main.go/internal/storage"
 	"cmd/http/main.go/internal/user"
@@ -29,7 +31,9 @@ type Suite struct {
 
 func (suite *Suite) SetupSuite() {
 	// Define Fiber app.
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
 	MONGODB_URI := "mongodb://localhost:27017"
 	MONGODB_NAME := "testing-meditation"
 
@@ -49,7 +53,7 @@ func (suite *Suite) SetupSuite() {
 
 	suite.store = NewStorage(db)
 	mediCont := NewController(suite.store, userStore, progressStore)
-	Routes(app, mediCont)
+	Routes(app, mediCont, idempotency.New(idempotency.NewStorage(db)))
 
 	// // add health check
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -75,6 +79,10 @@ func (suite *Suite) BeforeTest(suiteName, testName string) {
 		log.Println("Error: ", err)
 	}
 
+	if err := suite.store.db.Collection("idempotency").Drop(context.Background()); err != nil {
+		log.Println("Error: ", err)
+	}
+
 	// create a test user (just for userId purposes)
 	testId := "testId"
 	_, err = suite.userStore.Get(testId, context.Background())
@@ -111,6 +119,7 @@ func (suite *Suite) TestPost() {
 	route := "/meditation"
 
 	type Body struct {
+		MeditationTime int `json:"meditationTime"`
 	}
 
 	tests := []struct {
@@ -122,7 +131,7 @@ func (suite *Suite) TestPost() {
 	}{
 		{
 			description:  "Create successfully",
-			body:         Body{},
+			body:         Body{10},
 			expectedCode: fiber.StatusCreated,
 		},
 		{
@@ -133,15 +142,65 @@ func (suite *Suite) TestPost() {
 		{
 			description:  "User does not exist",
 			userId:       "doesntexist",
-			body:         Body{},
+			body:         Body{10},
 			expectedCode: fiber.StatusNotFound,
 		},
+		{
+			description:  "Negative minutes",
+			body:         Body{-5},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Missing minutes",
+			body:         Body{},
+			expectedCode: fiber.StatusBadRequest,
+		},
 		{
 			description:   "Missing userId header",
 			missingHeader: true,
 			body:          Body{},
 			expectedCode:  fiber.StatusBadRequest,
 		},
+		{
+			description:  "Client start time",
+			body:         CreateMeditationRequest{MeditationTime: 20, StartTime: time.Now().Add(-time.Hour).Unix()},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "End time in the future",
+			body:         CreateMeditationRequest{MeditationTime: 20, EndTime: time.Now().Add(time.Hour).Unix()},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Duration does not fit between start and end",
+			body:         CreateMeditationRequest{MeditationTime: 30, StartTime: time.Now().Add(-10 * time.Minute).Unix(), EndTime: time.Now().Add(-5 * time.Minute).Unix()},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Guided session with moods",
+			body:         CreateMeditationRequest{MeditationTime: 10, Type: MeditationTypeGuided, GuideRef: "track-1", MoodBefore: 2, MoodAfter: 4, Interruptions: 1, Notes: "calm"},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "Unknown type",
+			body:         CreateMeditationRequest{MeditationTime: 10, Type: "yoga"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Guide of an unguided session",
+			body:         CreateMeditationRequest{MeditationTime: 10, GuideRef: "track-1"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Mood out of scale",
+			body:         CreateMeditationRequest{MeditationTime: 10, MoodBefore: 6, Interruptions: -1},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "More minutes than a day allows",
+			body:         Body{715},
+			expectedCode: fiber.StatusUnprocessableEntity,
+		},
 	}
 
 	for _, test := range tests {
@@ -212,7 +271,19 @@ func (suite *Suite) TestGet() {
 		{
 			description:  "id does not exist",
 			query:        map[string]string{"id": "nonexistingid"},
-			expectedCode: fiber.StatusInternalServerError,
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:  "id of another user",
+			userId:       "otherId",
+			query:        map[string]string{"id": suite.meditationId},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "id without userId header",
+			missingHeader: true,
+			query:         map[string]string{"id": suite.meditationId},
+			expectedCode:  fiber.StatusBadRequest,
 		},
 		{
 			description:  "User does not exist",
@@ -240,6 +311,31 @@ func (suite *Suite) TestGet() {
 			},
 			expectedCode: fiber.StatusOK,
 		},
+		{
+			description:  "today",
+			query:        map[string]string{"period": "day"},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "week of a date",
+			query:        map[string]string{"period": "week", "date": "2023-05-11"},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "invalid period",
+			query:        map[string]string{"period": "year", "date": "11.05.2023"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "type and mood change",
+			query:        map[string]string{"type": "guided", "minMoodChange": "1", "maxMoodChange": "3"},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "invalid type and mood change",
+			query:        map[string]string{"type": "yoga", "minMoodChange": "better"},
+			expectedCode: fiber.StatusBadRequest,
+		},
 	}
 
 	for _, test := range tests {
@@ -285,6 +381,115 @@ func (suite *Suite) TestGet() {
 	}
 }
 
+func (suite *Suite) TestIdempotentPost() {
+	route := "/meditation"
+
+	tests := []struct {
+		description      string
+		key              string
+		body             CreateMeditationRequest
+		expectedCode     int
+		expectedReplayed bool
+	}{
+		{
+			description:  "First request is created",
+			body:         CreateMeditationRequest{MeditationTime: 15},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:      "Retry is replayed",
+			body:             CreateMeditationRequest{MeditationTime: 15},
+			expectedCode:     fiber.StatusCreated,
+			expectedReplayed: true,
+		},
+		{
+			description:  "Same key with another body",
+			body:         CreateMeditationRequest{MeditationTime: 20},
+			expectedCode: fiber.StatusUnprocessableEntity,
+		},
+		{
+			description:  "Rejected request",
+			key:          "rejected-key",
+			body:         CreateMeditationRequest{MeditationTime: 0},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Key of a rejected request is free again",
+			key:          "rejected-key",
+			body:         CreateMeditationRequest{MeditationTime: 20},
+			expectedCode: fiber.StatusCreated,
+		},
+	}
+
+	var firstBody string
+	for _, test := range tests {
+		bodyJson, err := json.Marshal(test.body)
+		if err != nil {
+			suite.T().Errorf("Could not marshal meditation: %v", err)
+		}
+
+		req := httptest.NewRequest("POST", route, bytes.NewReader(bodyJson))
+		req.Header.Set("userId", suite.testUserId)
+		key := test.key
+		if key == "" {
+			key = "retry-key"
+		}
+		req.Header.Set(idempotency.HeaderIdempotencyKey, key)
+
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.Equal(test.expectedReplayed, resp.Header.Get(idempotency.HeaderReplayed) == "true", test.description)
+		if firstBody == "" {
+			firstBody = string(body)
+		} else if test.expectedReplayed {
+			suite.Equal(firstBody, string(body), test.description)
+		}
+	}
+
+	// only the first request of each key created a meditation (next to the one of BeforeTest)
+	count, err := suite.store.db.Collection("meditation").CountDocuments(context.Background(), map[string]string{"userId": suite.testUserId})
+	suite.NoError(err)
+	suite.Equal(int64(3), count)
+}
+
+func (suite *Suite) TestStats() {
+	for _, request := range []CreateMeditationRequest{
+		{MeditationTime: 10, Type: MeditationTypeGuided, MoodBefore: 2, MoodAfter: 4},
+		{MeditationTime: 20, Type: MeditationTypeGuided},
+		{MeditationTime: 5, Type: MeditationTypeBreathing, MoodBefore: 3, MoodAfter: 2},
+	} {
+		_, err := suite.store.Create(request, suite.testUserId, context.Background())
+		suite.NoError(err)
+	}
+
+	req := httptest.NewRequest("GET", "/meditation/stats?period=day", nil)
+	req.Header.Set("userId", suite.testUserId)
+
+	resp, err := suite.app.Test(req, -1)
+	suite.NoError(err)
+	suite.Equal(fiber.StatusOK, resp.StatusCode)
+
+	var stats statsResponse
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&stats))
+
+	// the meditation of BeforeTest is unguided
+	suite.Equal(4, stats.Sessions)
+	suite.Equal(45, stats.Minutes)
+	suite.Equal(2, stats.ByType[MeditationTypeGuided].Sessions)
+	suite.Equal(30, stats.ByType[MeditationTypeGuided].Minutes)
+	suite.Equal(2.0, *stats.ByType[MeditationTypeGuided].AverageMoodChange)
+	suite.Equal(-1.0, *stats.ByType[MeditationTypeBreathing].AverageMoodChange)
+	suite.Nil(stats.ByType[MeditationTypeUnguided].AverageMoodChange)
+}
+
 // In order for 'go test' to run this suite, we need to create
 // a normal test function and pass our suite to suite.Run
 func TestTripTestSuite(t *testing.T) {
@@ -1,13 +1,19 @@
 package meditation
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"cmd/http/main.go/internal/validation"
 
-func Routes(app *fiber.App, controller *Controller) {
+	"github.com/gofiber/fiber/v2"
+)
+
+// idempotent guards the create route against duplicates from client retries
+func Routes(app fiber.Router, controller *Controller, idempotent fiber.Handler) {
 	meditation := app.Group("/meditation")
 
 	// add middlewares here
 
 	// add routes here
-	meditation.Post("/", controller.create)
+	meditation.Post("/", idempotent, validation.Body[CreateMeditationRequest](), controller.create)
 	meditation.Get("/", controller.get)
+	meditation.Get("/stats", controller.stats)
 }
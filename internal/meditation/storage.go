@@ -1,6 +1,9 @@
 package meditation
 
 import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/calendar"
+	"cmd/http/main.go/internal/storage"
 	"context"
 	"math"
 	"time"
@@ -14,7 +17,35 @@ type MeditationDB struct {
 	ID             primitive.ObjectID `json:"id" bson:"_id"`
 	UserID         string             `json:"userId" bson:"userId"`
 	MeditationTime int                `json:"meditationTime" bson:"meditationTime"`
-	EndTime        int64              `json:"endTime" bson:"endTime"`
+	// unix seconds of the client
+	StartTime int64 `json:"startTime" bson:"startTime"`
+	EndTime   int64 `json:"endTime" bson:"endTime"`
+	// unix seconds when the server stored the meditation
+	ServerTime    int64          `json:"serverTime" bson:"serverTime"`
+	Type          MeditationType `json:"type" bson:"type"`
+	GuideRef      string         `json:"guideRef,omitempty" bson:"guideRef,omitempty"`
+	MoodBefore    int            `json:"moodBefore,omitempty" bson:"moodBefore,omitempty"`
+	MoodAfter     int            `json:"moodAfter,omitempty" bson:"moodAfter,omitempty"`
+	Interruptions int            `json:"interruptions" bson:"interruptions"`
+	Notes         string         `json:"notes,omitempty" bson:"notes,omitempty"`
+	// health platform of imported sessions
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+}
+
+// Filter narrows the meditations of a user, empty fields match all
+type Filter struct {
+	Type MeditationType
+	// moodAfter minus moodBefore, only sessions with both moods match
+	MinMoodChange *int
+	MaxMoodChange *int
+}
+
+// TypeStats are the totals of one meditation type
+type TypeStats struct {
+	Sessions int `json:"sessions" bson:"sessions"`
+	Minutes  int `json:"minutes" bson:"minutes"`
+	// of the sessions with both moods, nil if there are none
+	AverageMoodChange *float64 `json:"averageMoodChange" bson:"averageMoodChange"`
 }
 
 type Storage struct {
@@ -27,50 +58,138 @@ func NewStorage(db *mongo.Database) *Storage {
 	}
 }
 
+// the version of the records after Migrate
+const schemaVersion = 2
+
+// Migrate backfills meditations of older versions and creates the index for
+// range queries. It is safe to run on every start.
+func (s *Storage) Migrate(ctx context.Context) error {
+	collection := s.db.Collection("meditation")
+
+	// older versions stored the server time as end time
+	_, err := collection.UpdateMany(ctx, bson.M{"serverTime": bson.M{"$exists": false}}, bson.A{
+		bson.M{"$set": bson.M{
+			"serverTime": "$endTime",
+			"startTime":  bson.M{"$subtract": bson.A{"$endTime", bson.M{"$multiply": bson.A{"$meditationTime", 60}}}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// sessions of older versions have no type
+	_, err = collection.UpdateMany(ctx, bson.M{"type": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"type": MeditationTypeUnguided}})
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "endTime", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	return storage.SetSchemaVersion(s.db, "meditation", schemaVersion, ctx)
+}
+
+// Migrated returns an error if the records were not migrated to the version of this code
+func (s *Storage) Migrated(ctx context.Context) error {
+	return storage.CheckSchemaVersion(s.db, "meditation", schemaVersion, ctx)
+}
+
 func (s *Storage) Create(request CreateMeditationRequest, userId string, ctx context.Context) (string, error) {
 	collection := s.db.Collection("meditation")
 
-	createdAt := time.Now().Unix()
+	now := time.Now()
+	startTime, endTime := request.Times(now)
 
 	meditation := MeditationDB{
 		ID:             primitive.NewObjectID(),
 		UserID:         userId,
 		MeditationTime: request.MeditationTime,
-		EndTime:        createdAt,
+		StartTime:      startTime,
+		EndTime:        endTime,
+		ServerTime:     now.Unix(),
+		Type:           request.Type,
+		GuideRef:       request.GuideRef,
+		MoodBefore:     request.MoodBefore,
+		MoodAfter:      request.MoodAfter,
+		Interruptions:  request.Interruptions,
+		Notes:          request.Notes,
+	}
+	if meditation.Type == "" {
+		meditation.Type = MeditationTypeUnguided
 	}
 
 	result, err := collection.InsertOne(ctx, meditation)
-
 	if err != nil {
-		return "", err
+		return "", apperror.FromMongo(err, "meditation")
 	}
 
 	// convert the object id to a string
 	return result.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
+// CreateImported stores sessions of a health platform, sessions of the same
+// user, source and start time as an earlier import are skipped
+func (s *Storage) CreateImported(meditations []MeditationDB, ctx context.Context) (int, error) {
+	collection := s.db.Collection("meditation")
+	if len(meditations) == 0 {
+		return 0, nil
+	}
+
+	first := meditations[0]
+	startTimes := make(bson.A, 0, len(meditations))
+	for _, meditation := range meditations {
+		startTimes = append(startTimes, meditation.StartTime)
+	}
+	existing, err := collection.Distinct(ctx, "startTime", bson.M{"userId": first.UserID, "source": first.Source, "startTime": bson.M{"$in": startTimes}})
+	if err != nil {
+		return 0, apperror.FromMongo(err, "meditations")
+	}
+	imported := make(map[int64]bool, len(existing))
+	for _, startTime := range existing {
+		if value, ok := startTime.(int64); ok {
+			imported[value] = true
+		}
+	}
+
+	documents := make([]interface{}, 0, len(meditations))
+	for _, meditation := range meditations {
+		if imported[meditation.StartTime] {
+			continue
+		}
+		imported[meditation.StartTime] = true
+		documents = append(documents, meditation)
+	}
+	if len(documents) == 0 {
+		return 0, nil
+	}
+
+	if _, err := collection.InsertMany(ctx, documents); err != nil {
+		return 0, apperror.FromMongo(err, "meditations")
+	}
+	return len(documents), nil
+}
+
 func (s *Storage) Get(meditationID string, ctx context.Context) (MeditationDB, error) {
 	collection := s.db.Collection("meditation")
 	meditationRecord := MeditationDB{}
 
+	// an id that is no object id cannot exist
 	objectID, err := primitive.ObjectIDFromHex(meditationID)
 	if err != nil {
-		return meditationRecord, err
+		return meditationRecord, apperror.NotFound("meditation does not exist")
 	}
 
 	cursor := collection.FindOne(ctx, bson.M{"_id": objectID})
-
-	if err := cursor.Err(); err != nil {
-		return meditationRecord, err
-	}
-
 	if err := cursor.Decode(&meditationRecord); err != nil {
-		return meditationRecord, err
+		return meditationRecord, apperror.FromMongo(err, "meditation")
 	}
 	return meditationRecord, nil
 }
 
-func (s *Storage) GetAllOfOneUserBetweenTimeAndDuration(userId string, times map[string]int64, ctx context.Context) ([]MeditationDB, error) {
+func (s *Storage) GetAllOfOneUserBetweenTimeAndDuration(userId string, times map[string]int64, filter Filter, ctx context.Context) ([]MeditationDB, error) {
 	// get all meditations of one user between two times
 	collection := s.db.Collection("meditation")
 	var cursor *mongo.Cursor
@@ -82,22 +201,142 @@ func (s *Storage) GetAllOfOneUserBetweenTimeAndDuration(userId string, times map
 		times["durationEnd"] = math.MaxInt64
 	}
 	meditations := make([]MeditationDB, 0)
-	cursor, err = collection.Find(ctx, bson.M{"userId": userId, "endTime": bson.M{"$gte": times["startTime"], "$lte": times["endTime"]}, "meditationTime": bson.M{"$gte": times["startDuration"], "$lte": times["durationEnd"]}})
+	query := bson.M{"userId": userId, "endTime": bson.M{"$gte": times["startTime"], "$lte": times["endTime"]}, "meditationTime": bson.M{"$gte": times["startDuration"], "$lte": times["durationEnd"]}}
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+	if filter.MinMoodChange != nil || filter.MaxMoodChange != nil {
+		moodChange := bson.M{"$subtract": bson.A{"$moodAfter", "$moodBefore"}}
+		conditions := bson.A{}
+		if filter.MinMoodChange != nil {
+			conditions = append(conditions, bson.M{"$gte": bson.A{moodChange, *filter.MinMoodChange}})
+		}
+		if filter.MaxMoodChange != nil {
+			conditions = append(conditions, bson.M{"$lte": bson.A{moodChange, *filter.MaxMoodChange}})
+		}
+		query["moodBefore"] = bson.M{"$gt": 0}
+		query["moodAfter"] = bson.M{"$gt": 0}
+		query["$expr"] = bson.M{"$and": conditions}
+	}
+	cursor, err = collection.Find(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, apperror.FromMongo(err, "meditations")
 	}
 
 	for cursor.Next(ctx) {
 		var meditation MeditationDB
 		if err := cursor.Decode(&meditation); err != nil {
-			return nil, err
+			return nil, apperror.FromMongo(err, "meditations")
 		}
 		meditations = append(meditations, meditation)
 	}
 	if err := cursor.Err(); err != nil {
-		return nil, err
+		return nil, apperror.FromMongo(err, "meditations")
 	}
 
 	// return the meditation list
 	return meditations, nil
 }
+
+// GetCreatedSince returns the meditations of a user created at or after since (unix seconds),
+// the creation time is part of the object id
+func (s *Storage) GetCreatedSince(userId string, since int64, ctx context.Context) ([]MeditationDB, error) {
+	collection := s.db.Collection("meditation")
+	sinceID := primitive.NewObjectIDFromTimestamp(time.Unix(since, 0))
+
+	cursor, err := collection.Find(ctx, bson.M{"userId": userId, "_id": bson.M{"$gte": sinceID}})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "meditations")
+	}
+
+	meditations := make([]MeditationDB, 0)
+	if err := cursor.All(ctx, &meditations); err != nil {
+		return nil, apperror.FromMongo(err, "meditations")
+	}
+	return meditations, nil
+}
+
+// GetStats returns the totals per type of the meditations of a user that
+// ended between startTime and endTime (unix seconds)
+func (s *Storage) GetStats(userId string, startTime int64, endTime int64, ctx context.Context) (map[MeditationType]TypeStats, error) {
+	collection := s.db.Collection("meditation")
+
+	// the average ignores the nulls of sessions without both moods
+	moodChange := bson.M{"$cond": bson.A{
+		bson.M{"$and": bson.A{bson.M{"$gt": bson.A{"$moodBefore", 0}}, bson.M{"$gt": bson.A{"$moodAfter", 0}}}},
+		bson.M{"$subtract": bson.A{"$moodAfter", "$moodBefore"}},
+		nil,
+	}}
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"userId": userId, "endTime": bson.M{"$gte": startTime, "$lte": endTime}}},
+		bson.M{"$group": bson.M{
+			"_id":               "$type",
+			"sessions":          bson.M{"$sum": 1},
+			"minutes":           bson.M{"$sum": "$meditationTime"},
+			"averageMoodChange": bson.M{"$avg": moodChange},
+		}},
+	})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "meditations")
+	}
+
+	var groups []struct {
+		Type      MeditationType `bson:"_id"`
+		TypeStats `bson:",inline"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, apperror.FromMongo(err, "meditations")
+	}
+
+	stats := make(map[MeditationType]TypeStats, len(groups))
+	for _, group := range groups {
+		stats[group.Type] = group.TypeStats
+	}
+	return stats, nil
+}
+
+// GetMinutesOfUsers returns the minutes meditated by each of userIds in
+// meditations that ended between startTime and endTime, users without any are missing
+func (s *Storage) GetMinutesOfUsers(userIds []string, startTime int64, endTime int64, ctx context.Context) (map[string]float64, error) {
+	collection := s.db.Collection("meditation")
+
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"userId": bson.M{"$in": userIds}, "endTime": bson.M{"$gte": startTime, "$lte": endTime}}},
+		bson.M{"$group": bson.M{"_id": "$userId", "minutes": bson.M{"$sum": "$meditationTime"}}},
+	})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "meditations")
+	}
+
+	var groups []struct {
+		UserID  string  `bson:"_id"`
+		Minutes float64 `bson:"minutes"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, apperror.FromMongo(err, "meditations")
+	}
+
+	minutes := make(map[string]float64, len(groups))
+	for _, group := range groups {
+		minutes[group.UserID] = group.Minutes
+	}
+	return minutes, nil
+}
+
+// anti-cheat, nobody meditates longer on a single day
+const MaxMinutesPerDay = 12 * 60
+
+// CheckLimit rejects a meditation that exceeds MaxMinutesPerDay together with
+// the meditations that ended on its day in the calendar of the user
+func (s *Storage) CheckLimit(req CreateMeditationRequest, userId string, cal calendar.Calendar, now time.Time, ctx context.Context) error {
+	_, endTime := req.Times(now)
+	start, next := cal.Bounds(calendar.PeriodDay, time.Unix(endTime, 0))
+	minutes, err := s.GetMinutesOfUsers([]string{userId}, start.Unix(), next.Unix()-1, ctx)
+	if err != nil {
+		return err
+	}
+	if minutes[userId]+float64(req.MeditationTime) > MaxMinutesPerDay {
+		return apperror.Unprocessable("At most %d minutes of meditation per day, %d are left on %s", MaxMinutesPerDay, MaxMinutesPerDay-int(minutes[userId]), cal.Date(endTime))
+	}
+	return nil
+}
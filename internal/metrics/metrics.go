@@ -0,0 +1,225 @@
+// Package metrics keeps counters, gauges and histograms and writes them in
+// the text format of Prometheus.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of latency histograms in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric is a family of series with the same name
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds the metrics written at /metrics
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// Default is the registry of the package level constructors
+var Default = &Registry{}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, registered := range r.metrics {
+		if registered.name() == m.name() {
+			panic("metrics: " + m.name() + " is registered twice")
+		}
+	}
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes all metrics sorted by name
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name() < metrics[j].name()
+	})
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// family is what counters and histograms share, series are kept per label values
+type family struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (f family) name() string {
+	return f.metricName
+}
+
+func (f family) header(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, f.help, f.metricName, kind)
+}
+
+// key joins label values, it cannot appear within a value
+func (f family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has labels %v, got %d values", f.metricName, f.labels, len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series formats the labels of a key with extra labels like le
+func (f family) series(key string, extra ...string) string {
+	pairs := make([]string, 0, len(f.labels)+len(extra)/2)
+	if len(f.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, f.labels[i]+"="+strconv.Quote(value))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return f.metricName
+	}
+	return f.metricName + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Counter only goes up, like requests served
+type Counter struct {
+	family
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{family: family{metricName: name, help: help, labels: labels}, values: make(map[string]float64)}
+	Default.register(c)
+	return c
+}
+
+// Add adds a positive value to the series of the label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += value
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, "counter")
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s %s\n", c.series(key), formatFloat(c.values[key]))
+	}
+}
+
+// Histogram counts observations like latencies in buckets
+type Histogram struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	// per bucket, not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{family: family{metricName: name, help: help, labels: labels}, buckets: buckets, values: make(map[string]*histogramValue)}
+	Default.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	current, ok := h.values[key]
+	if !ok {
+		current = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = current
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			current.counts[i]++
+			break
+		}
+	}
+	current.count++
+	current.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		current := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += current.counts[i]
+			fmt.Fprintf(w, "%s %d\n", h.series(key, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s %d\n", h.series(key, "le", "+Inf"), current.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, strings.TrimPrefix(h.series(key), h.metricName), formatFloat(current.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, strings.TrimPrefix(h.series(key), h.metricName), current.count)
+	}
+}
+
+// GaugeFunc reads its values when the metrics are written, by label values
+type GaugeFunc struct {
+	family
+	read func() map[string]float64
+}
+
+// NewGaugeFunc registers a gauge with one label, read returns the value of each label value
+func NewGaugeFunc(name string, help string, label string, read func() map[string]float64) *GaugeFunc {
+	g := &GaugeFunc{family: family{metricName: name, help: help, labels: []string{label}}, read: read}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	values := g.read()
+	g.header(w, "gauge")
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s %s\n", g.series(key), formatFloat(values[key]))
+	}
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWrite(t *testing.T) {
+	registry := &Registry{}
+	counter := &Counter{family: family{metricName: "test_total", help: "Test.", labels: []string{"plugin"}}, values: make(map[string]float64)}
+	histogram := &Histogram{family: family{metricName: "test_seconds", help: "Test."}, buckets: []float64{0.1, 1}, values: make(map[string]*histogramValue)}
+	registry.register(counter)
+	registry.register(histogram)
+
+	counter.Add(2.5, "meditation")
+	counter.Inc(`el"evator`)
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	var buffer bytes.Buffer
+	registry.Write(&buffer)
+	expected := `# HELP test_seconds Test.
+# TYPE test_seconds histogram
+test_seconds{le="0.1"} 1
+test_seconds{le="1"} 2
+test_seconds{le="+Inf"} 3
+test_seconds_sum 5.55
+test_seconds_count 3
+# HELP test_total Test.
+# TYPE test_total counter
+test_total{plugin="el\"evator"} 1
+test_total{plugin="meditation"} 2.5
+`
+	if buffer.String() != expected {
+		t.Errorf("got\n%s\nwant\n%s", buffer.String(), expected)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/users/:id", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusNotFound, "user does not exist")
+	})
+	app.Get("/metrics", Handler)
+
+	req := httptest.NewRequest("GET", "/users/testId", nil)
+	req.Header.Set("userId", "testId")
+	if _, err := app.Test(req, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, line := range []string{
+		`http_requests_total{method="GET",route="/users/:id",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/users/:id"} 1`,
+		`wholesome_active_users{window="5m"} 1`,
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("missing %s in\n%s", line, body)
+		}
+	}
+}
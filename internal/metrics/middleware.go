@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	requests = NewCounter("http_requests_total", "Requests served by route and status.", "method", "route", "status")
+	latency  = NewHistogram("http_request_duration_seconds", "Latency of requests by route.", DefaultBuckets, "method", "route")
+)
+
+// windows of the active users, users seen within the window are active
+var activeWindows = map[string]time.Duration{
+	"5m":  5 * time.Minute,
+	"24h": 24 * time.Hour,
+}
+
+// users that are tracked at most, the ids of the header are not checked
+const maxSeen = 100000
+
+// seen holds when each user sent the last request to this instance
+var seen = struct {
+	sync.Mutex
+	users map[string]time.Time
+}{users: make(map[string]time.Time)}
+
+var _ = NewGaugeFunc("wholesome_active_users", "Users with a request to this instance within the window.", "window", activeUsers)
+
+func activeUsers() map[string]float64 {
+	seen.Lock()
+	defer seen.Unlock()
+
+	now := time.Now()
+	counts := make(map[string]float64, len(activeWindows))
+	for window := range activeWindows {
+		counts[window] = 0
+	}
+	for userId, last := range seen.users {
+		age := now.Sub(last)
+		// users of the longest window are forgotten after it
+		if age > 24*time.Hour {
+			delete(seen.users, userId)
+			continue
+		}
+		for window, duration := range activeWindows {
+			if age <= duration {
+				counts[window]++
+			}
+		}
+	}
+	return counts
+}
+
+// Middleware counts the requests and their latency by the route that served
+// them, failed requests are counted with the status of their error
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if fiberErr, ok := err.(*fiber.Error); ok {
+				status = fiberErr.Code
+			}
+			// the error handler sets the status of domain errors
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr == nil {
+				status = c.Response().StatusCode()
+				err = nil
+			}
+		}
+
+		route := c.Route().Path
+		requests.Inc(c.Method(), route, strconv.Itoa(status))
+		latency.Observe(time.Since(start).Seconds(), c.Method(), route)
+
+		if userId := c.Request().Header.Peek("userId"); len(userId) > 0 {
+			seen.Lock()
+			if _, ok := seen.users[string(userId)]; ok || len(seen.users) < maxSeen {
+				seen.users[string(userId)] = time.Now()
+			}
+			seen.Unlock()
+		}
+		return err
+	}
+}
+
+// Handler writes the metrics of the default registry
+func Handler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	Default.Write(c)
+	return nil
+}
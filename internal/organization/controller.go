@@ -0,0 +1,624 @@
+package organization
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/audit"
+	"cmd/http/main.go/internal/calendar"
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Controller struct {
+	storage           *Storage
+	userStorage       *user.Storage
+	meditationStorage *meditation.Storage
+	elevatorStorage   *elevator.Storage
+}
+
+func NewController(storage *Storage, userStorage *user.Storage, meditationStorage *meditation.Storage, elevatorStorage *elevator.Storage) *Controller {
+	return &Controller{
+		storage:           storage,
+		userStorage:       userStorage,
+		meditationStorage: meditationStorage,
+		elevatorStorage:   elevatorStorage,
+	}
+}
+
+// reports need this many members and the figures of a plugin this many
+// participants, so individuals cannot be identified
+const minCohortSize = 5
+
+// limits of an organization
+const (
+	maxNameLength = 100
+	maxDomains    = 20
+)
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name"`
+	// email domains like example.com, the one of the creator is required
+	Domains []string `json:"domains"`
+}
+
+func (r *CreateOrganizationRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+
+	var errs validation.Errors
+	errs.Check(r.Name != "" && len(r.Name) <= maxNameLength, "name", "must be between 1 and %d characters", maxNameLength)
+	errs.Check(len(r.Domains) > 0 && len(r.Domains) <= maxDomains, "domains", "must have between 1 and %d domains", maxDomains)
+	seen := make(map[string]bool, len(r.Domains))
+	for i, domain := range r.Domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		r.Domains[i] = domain
+		errs.Check(domainPattern.MatchString(domain), "domains", "%q is no domain", domain)
+		errs.Check(!seen[domain], "domains", "%q is listed twice", domain)
+		seen[domain] = true
+	}
+	return errs.Err()
+}
+
+type UpdateMemberRequest struct {
+	Role Role `json:"role"`
+}
+
+func (r UpdateMemberRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(r.Role.IsValid(), "role", "must be one of %s, %s", RoleAdmin, RoleMember)
+	return errs.Err()
+}
+
+type JoinOrganizationRequest struct {
+	// token of an invitation of an admin
+	Token string `json:"token"`
+}
+
+func (r *JoinOrganizationRequest) Validate() error {
+	r.Token = strings.ToLower(strings.TrimSpace(r.Token))
+
+	var errs validation.Errors
+	errs.Check(len(r.Token) == 2*tokenBytes, "token", "must have %d characters", 2*tokenBytes)
+	return errs.Err()
+}
+
+type invitationResponse struct {
+	// shown once, the invited user joins with it
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+type organizationResponse struct {
+	OrganizationDB
+	// of the caller
+	Role Role `json:"role,omitempty"`
+}
+
+type memberResponse struct {
+	MemberDB
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+}
+
+// pluginReport is the activity of the members in a plugin, all figures are
+// nil if there are fewer participants than the minimum cohort
+type pluginReport struct {
+	// members with records in the period
+	Participants *int `json:"participants"`
+	// percent of the members
+	ParticipationRate *float64 `json:"participationRate"`
+	// per participant
+	Average *float64 `json:"average"`
+}
+
+type reportResponse struct {
+	StartTime int64 `json:"startTime"`
+	EndTime   int64 `json:"endTime"`
+	Members   int   `json:"members"`
+	// the average is in minutes
+	Meditation pluginReport `json:"meditation"`
+	// the average is in stairs
+	Elevator pluginReport `json:"elevator"`
+}
+
+func newPluginReport(values map[string]float64, members int) pluginReport {
+	participants := len(values)
+	if participants < minCohortSize || members == 0 {
+		return pluginReport{}
+	}
+
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	rate := float64(participants) / float64(members) * 100
+	average := sum / float64(participants)
+	return pluginReport{Participants: &participants, ParticipationRate: &rate, Average: &average}
+}
+
+func userID(c *fiber.Ctx) (string, error) {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return "", apperror.Validation("Missing userId header")
+	}
+	return userId, nil
+}
+
+// member returns the organization of the id param and the membership of the
+// caller, the organization does not exist for non members
+func (t *Controller) member(c *fiber.Ctx) (OrganizationDB, MemberDB, error) {
+	userId, err := userID(c)
+	if err != nil {
+		return OrganizationDB{}, MemberDB{}, err
+	}
+
+	organization, err := t.storage.Get(c.Params("id"), c.UserContext())
+	if err != nil {
+		return organization, MemberDB{}, err
+	}
+	member, err := t.storage.GetMember(organization.ID, userId, c.UserContext())
+	if apperror.IsNotFound(err) {
+		return organization, member, apperror.NotFound("organization does not exist")
+	}
+	return organization, member, err
+}
+
+// admin is member for the routes of admins
+func (t *Controller) admin(c *fiber.Ctx) (OrganizationDB, MemberDB, error) {
+	organization, member, err := t.member(c)
+	if err != nil {
+		return organization, member, err
+	}
+	if member.Role != RoleAdmin {
+		return organization, member, apperror.Forbidden("only admins of the organization can do this")
+	}
+	return organization, member, nil
+}
+
+// keepAdmin fails if member is the last admin of an organization
+func (t *Controller) keepAdmin(member MemberDB, ctx context.Context) error {
+	if member.Role != RoleAdmin {
+		return nil
+	}
+	admins, err := t.storage.CountAdmins(member.OrganizationID, ctx)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return apperror.Conflict("an organization needs an admin")
+	}
+	return nil
+}
+
+// @Summary Create an organization
+// @Description Creates an organization with the user as admin, the email domain of the user must be one of its domains.
+// @Tags organizations
+// @Accept json
+// @Param organization body CreateOrganizationRequest true "organization to create"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 201 {object} organizationResponse
+// @Router /organizations [post]
+func (t *Controller) create(c *fiber.Ctx) error {
+	req := validation.Parsed[CreateOrganizationRequest](c)
+
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	// a domain can only be claimed by its own users
+	domain := EmailDomain(profile.Email)
+	claimed := false
+	for _, d := range req.Domains {
+		claimed = claimed || d == domain
+	}
+	if !claimed {
+		return apperror.Forbidden("the domain of your email must be one of the domains")
+	}
+
+	organization, err := t.storage.Create(req, userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(organizationResponse{OrganizationDB: organization, Role: RoleAdmin})
+}
+
+// @Summary Get the organizations of a user
+// @Tags organizations
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []organizationResponse
+// @Router /organizations [get]
+func (t *Controller) getAll(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	memberships, err := t.storage.GetMemberships(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	ids := make([]primitive.ObjectID, 0, len(memberships))
+	for _, membership := range memberships {
+		ids = append(ids, membership.OrganizationID)
+	}
+	organizations, err := t.storage.GetMany(ids, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	response := make([]organizationResponse, 0, len(memberships))
+	for _, membership := range memberships {
+		if organization, ok := organizations[membership.OrganizationID]; ok {
+			response = append(response, organizationResponse{OrganizationDB: organization, Role: membership.Role})
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// @Summary Get the invitation of a user
+// @Description The organization of the email domain of the user, if the user is no member yet. Joining it needs an invitation token of its admins.
+// @Tags organizations
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []OrganizationDB
+// @Router /organizations/invitations [get]
+func (t *Controller) getInvitations(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	invitations := make([]OrganizationDB, 0, 1)
+	organization, err := t.storage.GetByDomain(EmailDomain(profile.Email), c.UserContext())
+	if apperror.IsNotFound(err) {
+		return c.Status(fiber.StatusOK).JSON(invitations)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = t.storage.GetMember(organization.ID, userId, c.UserContext())
+	if apperror.IsNotFound(err) {
+		invitations = append(invitations, organization)
+	} else if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(invitations)
+}
+
+// @Summary Get an organization
+// @Description Only members see the organization.
+// @Tags organizations
+// @Param id path string true "Organization ID"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} organizationResponse
+// @Router /organizations/{id} [get]
+func (t *Controller) get(c *fiber.Ctx) error {
+	organization, member, err := t.member(c)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(organizationResponse{OrganizationDB: organization, Role: member.Role})
+}
+
+// @Summary Update an organization
+// @Description Admins change the name and the domains that are invited.
+// @Tags organizations
+// @Accept json
+// @Param id path string true "Organization ID"
+// @Param organization body CreateOrganizationRequest true "name and domains"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} organizationResponse
+// @Router /organizations/{id} [put]
+func (t *Controller) update(c *fiber.Ctx) error {
+	req := validation.Parsed[CreateOrganizationRequest](c)
+
+	organization, member, err := t.admin(c)
+	if err != nil {
+		return err
+	}
+
+	before := organization
+	organization.Name = req.Name
+	organization.Domains = req.Domains
+	organization, err = t.storage.Update(organization, c.UserContext())
+	if err != nil {
+		return err
+	}
+	audit.Log(c, audit.EntryDB{
+		Action:     "organizations.update",
+		EntityType: "organization",
+		EntityID:   organization.ID.Hex(),
+		Changes:    audit.Diff(before, organization),
+	})
+	return c.Status(fiber.StatusOK).JSON(organizationResponse{OrganizationDB: organization, Role: member.Role})
+}
+
+// @Summary Invite a user to an organization
+// @Description Admins create an invitation token for one user, it can be used once within 7 days.
+// @Tags organizations
+// @Param id path string true "Organization ID"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 201 {object} invitationResponse
+// @Router /organizations/{id}/invitations [post]
+func (t *Controller) createInvitation(c *fiber.Ctx) error {
+	organization, admin, err := t.admin(c)
+	if err != nil {
+		return err
+	}
+
+	token, invitation, err := t.storage.CreateInvitation(organization.ID, admin.UserID, c.UserContext())
+	if err != nil {
+		return err
+	}
+	audit.Log(c, audit.EntryDB{
+		Action:     "organizationInvitations.create",
+		EntityType: "organizationInvitation",
+		EntityID:   invitation.ID,
+	})
+	return c.Status(fiber.StatusCreated).JSON(invitationResponse{Token: token, ExpiresAt: invitation.ExpiresAt.Unix()})
+}
+
+// @Summary Join an organization
+// @Description Users join an organization as members with the invitation token of an admin, the email is not verified and does not count.
+// @Tags organizations
+// @Accept json
+// @Param id path string true "Organization ID"
+// @Param invitation body JoinOrganizationRequest true "invitation token"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 201 {object} MemberDB
+// @Router /organizations/{id}/join [post]
+func (t *Controller) join(c *fiber.Ctx) error {
+	req := validation.Parsed[JoinOrganizationRequest](c)
+
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+	if _, err := t.userStorage.Get(userId, c.UserContext()); err != nil {
+		return err
+	}
+
+	// users that are not invited cannot tell the organization exists
+	organization, err := t.storage.Get(c.Params("id"), c.UserContext())
+	if err != nil {
+		return err
+	}
+	if _, err := t.storage.GetMember(organization.ID, userId, c.UserContext()); err == nil {
+		return apperror.Conflict("already a member")
+	} else if !apperror.IsNotFound(err) {
+		return err
+	}
+	if _, err := t.storage.UseInvitation(organization.ID, req.Token, c.UserContext()); err != nil {
+		if apperror.IsNotFound(err) {
+			return apperror.NotFound("organization does not exist")
+		}
+		return err
+	}
+
+	member, err := t.storage.AddMember(organization.ID, userId, RoleMember, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(member)
+}
+
+// @Summary Leave an organization
+// @Description The last admin cannot leave.
+// @Tags organizations
+// @Param id path string true "Organization ID"
+// @Param userId header string true "User ID"
+// @Success 204
+// @Router /organizations/{id}/leave [post]
+func (t *Controller) leave(c *fiber.Ctx) error {
+	_, member, err := t.member(c)
+	if err != nil {
+		return err
+	}
+	if err := t.keepAdmin(member, c.UserContext()); err != nil {
+		return err
+	}
+
+	if err := t.storage.RemoveMember(member, c.UserContext()); err != nil {
+		return err
+	}
+	logMember(c, "organizationMembers.leave", member, nil)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// logMember adds a change of a membership to the audit log, the member is the target
+func logMember(c *fiber.Ctx, action string, member MemberDB, changes []audit.Change) {
+	audit.Log(c, audit.EntryDB{
+		TargetID:   member.UserID,
+		Action:     action,
+		EntityType: "organizationMember",
+		EntityID:   member.ID,
+		Changes:    changes,
+	})
+}
+
+// @Summary Get the members of an organization
+// @Description Only admins see the members.
+// @Tags organizations
+// @Param id path string true "Organization ID"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []memberResponse
+// @Router /organizations/{id}/members [get]
+func (t *Controller) getMembers(c *fiber.Ctx) error {
+	organization, _, err := t.admin(c)
+	if err != nil {
+		return err
+	}
+
+	members, err := t.storage.GetMembers(organization.ID, c.UserContext())
+	if err != nil {
+		return err
+	}
+	userIds := make([]string, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserID)
+	}
+	users, err := t.userStorage.GetMany(userIds, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	response := make([]memberResponse, 0, len(members))
+	for _, member := range members {
+		profile := users[member.UserID]
+		response = append(response, memberResponse{MemberDB: member, FirstName: profile.FirstName, LastName: profile.LastName, Email: profile.Email})
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// @Summary Change the role of a member
+// @Description Admins make members admins or the other way around, the last admin stays.
+// @Tags organizations
+// @Accept json
+// @Param id path string true "Organization ID"
+// @Param memberId path string true "User ID of the member"
+// @Param role body UpdateMemberRequest true "new role"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} MemberDB
+// @Router /organizations/{id}/members/{memberId} [put]
+func (t *Controller) updateMember(c *fiber.Ctx) error {
+	req := validation.Parsed[UpdateMemberRequest](c)
+
+	organization, _, err := t.admin(c)
+	if err != nil {
+		return err
+	}
+	member, err := t.storage.GetMember(organization.ID, c.Params("memberId"), c.UserContext())
+	if err != nil {
+		return err
+	}
+	if req.Role == RoleMember {
+		if err := t.keepAdmin(member, c.UserContext()); err != nil {
+			return err
+		}
+	}
+
+	before := member
+	member, err = t.storage.UpdateRole(member, req.Role, c.UserContext())
+	if err != nil {
+		return err
+	}
+	logMember(c, "organizationMembers.update", member, audit.Diff(before, member))
+	return c.Status(fiber.StatusOK).JSON(member)
+}
+
+// @Summary Remove a member
+// @Description Admins remove members, the last admin stays.
+// @Tags organizations
+// @Param id path string true "Organization ID"
+// @Param memberId path string true "User ID of the member"
+// @Param userId header string true "User ID"
+// @Success 204
+// @Router /organizations/{id}/members/{memberId} [delete]
+func (t *Controller) removeMember(c *fiber.Ctx) error {
+	organization, _, err := t.admin(c)
+	if err != nil {
+		return err
+	}
+	member, err := t.storage.GetMember(organization.ID, c.Params("memberId"), c.UserContext())
+	if err != nil {
+		return err
+	}
+	if err := t.keepAdmin(member, c.UserContext()); err != nil {
+		return err
+	}
+
+	if err := t.storage.RemoveMember(member, c.UserContext()); err != nil {
+		return err
+	}
+	logMember(c, "organizationMembers.remove", member, nil)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @Summary Get the report of an organization
+// @Description Anonymized activity of the members for admins. Organizations need at least 5 members, the figures of a plugin at least 5 participants.
+// @Tags organizations
+// @Param id path string true "Organization ID"
+// @Param period query string false "week or month in the calendar of the admin, defaults to month"
+// @Param date query string false "a day of the period (YYYY-MM-DD), defaults to today"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} reportResponse
+// @Router /organizations/{id}/report [get]
+func (t *Controller) getReport(c *fiber.Ctx) error {
+	organization, admin, err := t.admin(c)
+	if err != nil {
+		return err
+	}
+	profile, err := t.userStorage.Get(admin.UserID, c.UserContext())
+	if err != nil {
+		return err
+	}
+	// a day has too few participants to hide one of them
+	period := calendar.Period(c.Query("period", string(calendar.PeriodMonth)))
+	var errs validation.Errors
+	errs.Check(period == calendar.PeriodWeek || period == calendar.PeriodMonth, "period", "must be one of %s, %s", calendar.PeriodWeek, calendar.PeriodMonth)
+	if err := errs.Err(); err != nil {
+		return err
+	}
+	startTime, endTime, err := profile.Calendar().Range(period, c.Query("date"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	members, err := t.storage.GetMembers(organization.ID, c.UserContext())
+	if err != nil {
+		return err
+	}
+	if len(members) < minCohortSize {
+		return apperror.Unprocessable("reports need at least %d members", minCohortSize)
+	}
+	userIds := make([]string, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserID)
+	}
+
+	minutes, err := t.meditationStorage.GetMinutesOfUsers(userIds, startTime, endTime, c.UserContext())
+	if err != nil {
+		return err
+	}
+	stairs, err := t.elevatorStorage.GetStairsOfUsers(userIds, startTime, endTime, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(reportResponse{
+		StartTime:  startTime,
+		EndTime:    endTime,
+		Members:    len(members),
+		Meditation: newPluginReport(minutes, len(members)),
+		Elevator:   newPluginReport(stairs, len(members)),
+	})
+}
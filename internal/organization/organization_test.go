@@ -0,0 +1,298 @@
+package organization
+
+import (
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/elevator"
+	"cmd/http/main.go/internal/meditation"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Suite struct {
+	suite.Suite
+	app            *fiber.App
+	store          *Storage
+	userStore      *user.Storage
+	testUserId     string
+	organizationId string
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-organizations"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	userStore := user.NewStorage(db)
+	suite.userStore = userStore
+
+	suite.store = NewStorage(db)
+	if err := suite.store.EnsureIndexes(context.Background()); err != nil {
+		suite.T().Errorf("Could not create indexes: %v", err)
+	}
+	organizationCont := NewController(suite.store, userStore, meditation.NewStorage(db), elevator.NewStorage(db))
+	Routes(app, organizationCont)
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) createUser(id string, email string) {
+	_, err := suite.userStore.Create(user.CreateUserRequest{
+		ID:        id,
+		FirstName: "test",
+		LastName:  id,
+		Email:     email,
+	}, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test user: %v", err)
+	}
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	ctx := context.Background()
+	for _, collection := range []string{"users", "meditation", "organizations", "organizationMembers", "organizationInvitations"} {
+		if _, err := suite.store.db.Collection(collection).DeleteMany(ctx, bson.M{}); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+
+	// the test user is the admin of an organization of example.com
+	suite.testUserId = "testId"
+	suite.createUser(suite.testUserId, "admin@example.com")
+	suite.createUser("colleagueId", "colleague@Example.com")
+	suite.createUser("outsiderId", "outsider@other.org")
+
+	organization, err := suite.store.Create(CreateOrganizationRequest{Name: "Example", Domains: []string{"example.com"}}, suite.testUserId, ctx)
+	if err != nil {
+		suite.T().Errorf("Could not create test organization: %v", err)
+	}
+	suite.organizationId = organization.ID.Hex()
+}
+
+func (suite *Suite) request(method string, route string, userId string, body interface{}) (int, []byte) {
+	var reader io.Reader
+	if body != nil {
+		bodyJson, err := json.Marshal(body)
+		if err != nil {
+			suite.T().Errorf("Could not marshal body: %v", err)
+		}
+		reader = bytes.NewReader(bodyJson)
+	}
+
+	req := httptest.NewRequest(method, route, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if userId != "" {
+		req.Header.Set("userId", userId)
+	}
+
+	resp, err := suite.app.Test(req, -1)
+	if err != nil {
+		suite.T().Errorf("Could not make request: %v", err)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return resp.StatusCode, respBody
+}
+
+func (suite *Suite) TestPost() {
+	tests := []struct {
+		description  string
+		userId       string
+		body         CreateOrganizationRequest
+		expectedCode int
+	}{
+		{
+			description:  "Create successfully",
+			userId:       "outsiderId",
+			body:         CreateOrganizationRequest{Name: "Other", Domains: []string{"Other.org"}},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "Domain of another organization",
+			userId:       "colleagueId",
+			body:         CreateOrganizationRequest{Name: "Example 2", Domains: []string{"example.com"}},
+			expectedCode: fiber.StatusConflict,
+		},
+		{
+			description:  "Domain of someone else",
+			userId:       "colleagueId",
+			body:         CreateOrganizationRequest{Name: "Example 2", Domains: []string{"example.net"}},
+			expectedCode: fiber.StatusForbidden,
+		},
+		{
+			description:  "No domain",
+			userId:       "colleagueId",
+			body:         CreateOrganizationRequest{Name: "Example 2"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Invalid domain",
+			userId:       "colleagueId",
+			body:         CreateOrganizationRequest{Name: "Example 2", Domains: []string{"not a domain"}},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Missing name",
+			userId:       "colleagueId",
+			body:         CreateOrganizationRequest{Domains: []string{"example.com"}},
+			expectedCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		code, body := suite.request("POST", "/organizations", test.userId, test.body)
+		suite.Equal(test.expectedCode, code, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+func (suite *Suite) TestMembership() {
+	route := "/organizations/" + suite.organizationId
+
+	// the colleague is invited by the domain, the outsider not
+	code, body := suite.request("GET", "/organizations/invitations", "colleagueId", nil)
+	suite.Equal(fiber.StatusOK, code)
+	var invitations []OrganizationDB
+	suite.NoError(json.Unmarshal(body, &invitations))
+	suite.Len(invitations, 1)
+
+	// the email is not verified, joining needs the token of an admin
+	code, _ = suite.request("POST", route+"/join", "colleagueId", nil)
+	suite.Equal(fiber.StatusBadRequest, code)
+	code, _ = suite.request("POST", route+"/join", "colleagueId", JoinOrganizationRequest{Token: "00000000000000000000000000000000"})
+	suite.Equal(fiber.StatusNotFound, code)
+	code, _ = suite.request("GET", route, "outsiderId", nil)
+	suite.Equal(fiber.StatusNotFound, code)
+	code, _ = suite.request("POST", route+"/invitations", "outsiderId", nil)
+	suite.Equal(fiber.StatusNotFound, code)
+
+	code, body = suite.request("POST", route+"/invitations", suite.testUserId, nil)
+	suite.Equal(fiber.StatusCreated, code, string(body))
+	var invitation invitationResponse
+	suite.NoError(json.Unmarshal(body, &invitation))
+	join := JoinOrganizationRequest{Token: invitation.Token}
+
+	code, body = suite.request("POST", route+"/join", "colleagueId", join)
+	suite.Equal(fiber.StatusCreated, code, string(body))
+	code, _ = suite.request("POST", route+"/join", "colleagueId", join)
+	suite.Equal(fiber.StatusConflict, code)
+	// a token is used once
+	code, _ = suite.request("POST", route+"/join", "outsiderId", join)
+	suite.Equal(fiber.StatusNotFound, code)
+
+	// members cannot manage the organization
+	code, _ = suite.request("GET", route+"/members", "colleagueId", nil)
+	suite.Equal(fiber.StatusForbidden, code)
+	code, _ = suite.request("POST", route+"/invitations", "colleagueId", nil)
+	suite.Equal(fiber.StatusForbidden, code)
+	code, _ = suite.request("PUT", route+"/members/"+suite.testUserId, "colleagueId", UpdateMemberRequest{Role: RoleMember})
+	suite.Equal(fiber.StatusForbidden, code)
+
+	// the last admin stays
+	code, _ = suite.request("POST", route+"/leave", suite.testUserId, nil)
+	suite.Equal(fiber.StatusConflict, code)
+	code, _ = suite.request("PUT", route+"/members/"+suite.testUserId, suite.testUserId, UpdateMemberRequest{Role: RoleMember})
+	suite.Equal(fiber.StatusConflict, code)
+
+	code, body = suite.request("PUT", route+"/members/colleagueId", suite.testUserId, UpdateMemberRequest{Role: RoleAdmin})
+	suite.Equal(fiber.StatusOK, code, string(body))
+	code, _ = suite.request("POST", route+"/leave", suite.testUserId, nil)
+	suite.Equal(fiber.StatusNoContent, code)
+
+	code, body = suite.request("GET", route+"/members", "colleagueId", nil)
+	suite.Equal(fiber.StatusOK, code, string(body))
+	var members []memberResponse
+	suite.NoError(json.Unmarshal(body, &members))
+	suite.Len(members, 1)
+	suite.Equal(RoleAdmin, members[0].Role)
+}
+
+func (suite *Suite) TestReport() {
+	ctx := context.Background()
+	route := "/organizations/" + suite.organizationId + "/report?period=week"
+
+	// too few members to stay anonymous
+	code, _ := suite.request("GET", route, suite.testUserId, nil)
+	suite.Equal(fiber.StatusUnprocessableEntity, code)
+
+	// five more members, four of them meditated now
+	organization, err := suite.store.Get(suite.organizationId, ctx)
+	suite.NoError(err)
+	now := time.Now().Unix()
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("memberId%d", i)
+		suite.createUser(id, id+"@example.com")
+		_, err := suite.store.AddMember(organization.ID, id, RoleMember, ctx)
+		suite.NoError(err)
+		if i < 4 {
+			_, err = suite.store.db.Collection("meditation").InsertOne(ctx, meditation.MeditationDB{
+				ID: primitive.NewObjectID(), UserID: id, MeditationTime: 10, StartTime: now - 600, EndTime: now, ServerTime: now,
+			})
+			suite.NoError(err)
+		}
+	}
+
+	code, body := suite.request("GET", route, suite.testUserId, nil)
+	suite.Equal(fiber.StatusOK, code, string(body))
+	var report reportResponse
+	suite.NoError(json.Unmarshal(body, &report))
+	suite.Equal(6, report.Members)
+	// four participants could be identified
+	suite.Nil(report.Meditation.Participants)
+	suite.Nil(report.Meditation.ParticipationRate)
+	suite.Nil(report.Meditation.Average)
+
+	code, _ = suite.request("GET", route, "memberId0", nil)
+	suite.Equal(fiber.StatusForbidden, code)
+
+	// a day has too few participants
+	code, _ = suite.request("GET", "/organizations/"+suite.organizationId+"/report?period=day", suite.testUserId, nil)
+	suite.Equal(fiber.StatusBadRequest, code)
+}
+
+func TestPluginReport(t *testing.T) {
+	values := map[string]float64{"a": 10, "b": 20, "c": 30, "d": 40, "e": 50}
+
+	report := newPluginReport(values, 10)
+	if report.Participants == nil || *report.Participants != 5 || report.ParticipationRate == nil || *report.ParticipationRate != 50 || report.Average == nil || *report.Average != 30 {
+		t.Errorf("got %+v, want 5 participants, a rate of 50 and an average of 30", report)
+	}
+
+	delete(values, "e")
+	if report := newPluginReport(values, 10); report.Participants != nil || report.ParticipationRate != nil || report.Average != nil {
+		t.Errorf("got %+v for fewer than %d participants", report, minCohortSize)
+	}
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestOrganizationTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
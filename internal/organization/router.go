@@ -0,0 +1,27 @@
+package organization
+
+import (
+	"cmd/http/main.go/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func Routes(app fiber.Router, controller *Controller) {
+	organizations := app.Group("/organizations")
+
+	// add middlewares here
+
+	// add routes here
+	organizations.Post("/", validation.Body[CreateOrganizationRequest](), controller.create)
+	organizations.Get("/", controller.getAll)
+	organizations.Get("/invitations", controller.getInvitations)
+	organizations.Get("/:id", controller.get)
+	organizations.Put("/:id", validation.Body[CreateOrganizationRequest](), controller.update)
+	organizations.Post("/:id/invitations", controller.createInvitation)
+	organizations.Post("/:id/join", validation.Body[JoinOrganizationRequest](), controller.join)
+	organizations.Post("/:id/leave", controller.leave)
+	organizations.Get("/:id/members", controller.getMembers)
+	organizations.Put("/:id/members/:memberId", validation.Body[UpdateMemberRequest](), controller.updateMember)
+	organizations.Delete("/:id/members/:memberId", controller.removeMember)
+	organizations.Get("/:id/report", controller.getReport)
+}
@@ -0,0 +1,335 @@
+package organization
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Role string
+
+const (
+	// manages the members and reads the reports
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+)
+
+func (r Role) IsValid() bool {
+	return r == RoleAdmin || r == RoleMember
+}
+
+type OrganizationDB struct {
+	ID   primitive.ObjectID `json:"id" bson:"_id"`
+	Name string             `json:"name" bson:"name"`
+	// users with an email of these domains are invited, a domain belongs to one organization
+	Domains   []string `json:"domains" bson:"domains"`
+	CreatedAt int64    `json:"createdAt" bson:"createdAt"`
+}
+
+type MemberDB struct {
+	// organization id:user id
+	ID             string             `json:"-" bson:"_id"`
+	OrganizationID primitive.ObjectID `json:"organizationId" bson:"organizationId"`
+	UserID         string             `json:"userId" bson:"userId"`
+	Role           Role               `json:"role" bson:"role"`
+	JoinedAt       int64              `json:"joinedAt" bson:"joinedAt"`
+}
+
+// InvitationDB lets one user join an organization, only the hash of its
+// token is stored
+type InvitationDB struct {
+	// sha256 of the token
+	ID             string             `json:"-" bson:"_id"`
+	OrganizationID primitive.ObjectID `json:"organizationId" bson:"organizationId"`
+	// admin that created the invitation
+	CreatedBy string    `json:"createdBy" bson:"createdBy"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// how long an invitation can be used
+const InvitationTTL = 7 * 24 * time.Hour
+
+// random bytes of a token, it is sent as hex
+const tokenBytes = 16
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func memberID(organizationID primitive.ObjectID, userId string) string {
+	return organizationID.Hex() + ":" + userId
+}
+
+// EmailDomain returns the lowercase domain of an email address, empty if it has none
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+// EnsureIndexes makes the domains unique and creates the index for the organizations of a user
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	_, err := s.db.Collection("organizations").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "domains", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Collection("organizationMembers").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "organizationId", Value: 1}, {Key: "role", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	// mongo removes expired invitations
+	_, err = s.db.Collection("organizationInvitations").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Create stores an organization with userId as its first admin
+func (s *Storage) Create(request CreateOrganizationRequest, userId string, ctx context.Context) (OrganizationDB, error) {
+	collection := s.db.Collection("organizations")
+
+	now := time.Now().Unix()
+	organization := OrganizationDB{
+		ID:        primitive.NewObjectID(),
+		Name:      request.Name,
+		Domains:   request.Domains,
+		CreatedAt: now,
+	}
+	if _, err := collection.InsertOne(ctx, organization); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return organization, apperror.Conflict("a domain belongs to another organization")
+		}
+		return organization, apperror.FromMongo(err, "organization")
+	}
+
+	if _, err := s.AddMember(organization.ID, userId, RoleAdmin, ctx); err != nil {
+		return organization, err
+	}
+	return organization, nil
+}
+
+func (s *Storage) Get(organizationID string, ctx context.Context) (OrganizationDB, error) {
+	collection := s.db.Collection("organizations")
+	organization := OrganizationDB{}
+
+	// an id that is no object id cannot exist
+	objectID, err := primitive.ObjectIDFromHex(organizationID)
+	if err != nil {
+		return organization, apperror.NotFound("organization does not exist")
+	}
+
+	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&organization)
+	if err != nil {
+		return organization, apperror.FromMongo(err, "organization")
+	}
+	return organization, nil
+}
+
+// GetByDomain returns the organization that invites the users of an email domain
+func (s *Storage) GetByDomain(domain string, ctx context.Context) (OrganizationDB, error) {
+	collection := s.db.Collection("organizations")
+	organization := OrganizationDB{}
+
+	err := collection.FindOne(ctx, bson.M{"domains": domain}).Decode(&organization)
+	if err != nil {
+		return organization, apperror.FromMongo(err, "organization")
+	}
+	return organization, nil
+}
+
+// GetMany returns the organizations of ids by id
+func (s *Storage) GetMany(ids []primitive.ObjectID, ctx context.Context) (map[primitive.ObjectID]OrganizationDB, error) {
+	collection := s.db.Collection("organizations")
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "organizations")
+	}
+
+	var organizations []OrganizationDB
+	if err := cursor.All(ctx, &organizations); err != nil {
+		return nil, apperror.FromMongo(err, "organizations")
+	}
+	byId := make(map[primitive.ObjectID]OrganizationDB, len(organizations))
+	for _, organization := range organizations {
+		byId[organization.ID] = organization
+	}
+	return byId, nil
+}
+
+func (s *Storage) Update(organization OrganizationDB, ctx context.Context) (OrganizationDB, error) {
+	collection := s.db.Collection("organizations")
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": organization.ID},
+		bson.M{"$set": bson.M{"name": organization.Name, "domains": organization.Domains}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return organization, apperror.Conflict("a domain belongs to another organization")
+	}
+	if err != nil {
+		return organization, apperror.FromMongo(err, "organization")
+	}
+	return organization, nil
+}
+
+func (s *Storage) AddMember(organizationID primitive.ObjectID, userId string, role Role, ctx context.Context) (MemberDB, error) {
+	collection := s.db.Collection("organizationMembers")
+
+	member := MemberDB{
+		ID:             memberID(organizationID, userId),
+		OrganizationID: organizationID,
+		UserID:         userId,
+		Role:           role,
+		JoinedAt:       time.Now().Unix(),
+	}
+	if _, err := collection.InsertOne(ctx, member); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return member, apperror.Conflict("already a member")
+		}
+		return member, apperror.FromMongo(err, "member")
+	}
+	return member, nil
+}
+
+// GetMember returns the membership of userId, non members get a not found
+func (s *Storage) GetMember(organizationID primitive.ObjectID, userId string, ctx context.Context) (MemberDB, error) {
+	collection := s.db.Collection("organizationMembers")
+	member := MemberDB{}
+
+	err := collection.FindOne(ctx, bson.M{"_id": memberID(organizationID, userId)}).Decode(&member)
+	if err != nil {
+		return member, apperror.FromMongo(err, "member")
+	}
+	return member, nil
+}
+
+// GetMembers returns the members of an organization, the earliest first
+func (s *Storage) GetMembers(organizationID primitive.ObjectID, ctx context.Context) ([]MemberDB, error) {
+	return s.findMembers(bson.M{"organizationId": organizationID}, ctx)
+}
+
+// GetMemberships returns the memberships of a user
+func (s *Storage) GetMemberships(userId string, ctx context.Context) ([]MemberDB, error) {
+	return s.findMembers(bson.M{"userId": userId}, ctx)
+}
+
+func (s *Storage) findMembers(filter bson.M, ctx context.Context) ([]MemberDB, error) {
+	collection := s.db.Collection("organizationMembers")
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "joinedAt", Value: 1}}))
+	if err != nil {
+		return nil, apperror.FromMongo(err, "members")
+	}
+
+	members := make([]MemberDB, 0)
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, apperror.FromMongo(err, "members")
+	}
+	return members, nil
+}
+
+// CountAdmins returns the number of admins of an organization
+func (s *Storage) CountAdmins(organizationID primitive.ObjectID, ctx context.Context) (int64, error) {
+	collection := s.db.Collection("organizationMembers")
+
+	count, err := collection.CountDocuments(ctx, bson.M{"organizationId": organizationID, "role": RoleAdmin})
+	if err != nil {
+		return 0, apperror.FromMongo(err, "members")
+	}
+	return count, nil
+}
+
+func (s *Storage) UpdateRole(member MemberDB, role Role, ctx context.Context) (MemberDB, error) {
+	collection := s.db.Collection("organizationMembers")
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": member.ID}, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return member, apperror.FromMongo(err, "member")
+	}
+	member.Role = role
+	return member, nil
+}
+
+func (s *Storage) RemoveMember(member MemberDB, ctx context.Context) error {
+	collection := s.db.Collection("organizationMembers")
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": member.ID})
+	if err != nil {
+		return apperror.FromMongo(err, "member")
+	}
+	if result.DeletedCount == 0 {
+		return apperror.NotFound("member does not exist")
+	}
+	return nil
+}
+
+// CreateInvitation stores an invitation of an admin and returns its token,
+// the token cannot be read again
+func (s *Storage) CreateInvitation(organizationID primitive.ObjectID, userId string, ctx context.Context) (string, InvitationDB, error) {
+	collection := s.db.Collection("organizationInvitations")
+
+	random := make([]byte, tokenBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", InvitationDB{}, apperror.Internal("could not create an invitation token", err)
+	}
+	token := hex.EncodeToString(random)
+
+	invitation := InvitationDB{
+		ID:             hashToken(token),
+		OrganizationID: organizationID,
+		CreatedBy:      userId,
+		ExpiresAt:      time.Now().Add(InvitationTTL),
+	}
+	if _, err := collection.InsertOne(ctx, invitation); err != nil {
+		return "", invitation, apperror.FromMongo(err, "invitation")
+	}
+	return token, invitation, nil
+}
+
+// UseInvitation removes the invitation of token, an unknown, expired or used
+// token is not found
+func (s *Storage) UseInvitation(organizationID primitive.ObjectID, token string, ctx context.Context) (InvitationDB, error) {
+	collection := s.db.Collection("organizationInvitations")
+	invitation := InvitationDB{}
+
+	// mongo removes expired invitations only periodically
+	err := collection.FindOneAndDelete(ctx, bson.M{
+		"_id":            hashToken(token),
+		"organizationId": organizationID,
+		"expiresAt":      bson.M{"$gt": time.Now()},
+	}).Decode(&invitation)
+	if err != nil {
+		return invitation, apperror.FromMongo(err, "invitation")
+	}
+	return invitation, nil
+}
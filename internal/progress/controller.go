@@ -1,7 +1,9 @@
 package progress
 
 import (
+	"cmd/http/main.go/internal/apperror"
 	"cmd/http/main.go/internal/user"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -27,17 +29,12 @@ func NewController(storage *Storage, userStorage *user.Storage) *Controller {
 func (t *Controller) get(c *fiber.Ctx) error {
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
+		return apperror.Validation("Missing userId header")
 	}
-	// Get plugin from query
 
-	settings, err := t.storage.Get(userId, c.Context())
+	settings, err := t.storage.Get(userId, c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "Could not get settings, because: " + err.Error(),
-		})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(settings)
@@ -0,0 +1,124 @@
+package progress
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/settings"
+	"context"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EventType is a change of the progress worth sharing
+type EventType string
+
+const (
+	// the first experience in a plugin
+	EventTypeFirstSteps EventType = "firstSteps"
+	EventTypeLevelUp    EventType = "levelUp"
+	// the highest level of a plugin, it replaces the level up
+	EventTypeMaxLevel EventType = "maxLevel"
+)
+
+type EventDB struct {
+	ID     primitive.ObjectID  `json:"id" bson:"_id"`
+	UserID string              `json:"userId" bson:"userId"`
+	Plugin settings.PluginName `json:"plugin" bson:"plugin"`
+	Type   EventType           `json:"type" bson:"type"`
+	// level after the event
+	Level int `json:"level" bson:"level"`
+	// unix seconds
+	Time int64 `json:"time" bson:"time"`
+}
+
+// Level is the level of a plugin with experience
+func Level(experience float64) int {
+	level := int(math.Floor(experience / experienceToNewLevel))
+	if level > maxLevel {
+		return maxLevel
+	}
+	return level
+}
+
+// Events returns the events of a plugin whose experience grew from before to after
+func Events(before float64, after float64) []EventType {
+	events := make([]EventType, 0)
+	if before <= 0 && after > 0 {
+		events = append(events, EventTypeFirstSteps)
+	}
+	switch level := Level(after); {
+	case level == Level(before):
+	case level == maxLevel:
+		events = append(events, EventTypeMaxLevel)
+	default:
+		events = append(events, EventTypeLevelUp)
+	}
+	return events
+}
+
+// EnsureIndexes creates the index for the feeds
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	collection := s.db.Collection("progressEvents")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "time", Value: -1}},
+	})
+	return err
+}
+
+func (s *Storage) createEvents(userId string, plugin settings.PluginName, before float64, after float64, ctx context.Context) error {
+	collection := s.db.Collection("progressEvents")
+
+	now := time.Now().Unix()
+	documents := make([]interface{}, 0)
+	for _, eventType := range Events(before, after) {
+		documents = append(documents, EventDB{
+			ID:     primitive.NewObjectID(),
+			UserID: userId,
+			Plugin: plugin,
+			Type:   eventType,
+			Level:  Level(after),
+			Time:   now,
+		})
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+
+	if _, err := collection.InsertMany(ctx, documents); err != nil {
+		return apperror.FromMongo(err, "progress event")
+	}
+	return nil
+}
+
+// GetEvents returns the latest events before the unix time before, of each
+// user only the events of the given plugins
+func (s *Storage) GetEvents(plugins map[string][]settings.PluginName, before int64, limit int64, ctx context.Context) ([]EventDB, error) {
+	collection := s.db.Collection("progressEvents")
+
+	events := make([]EventDB, 0)
+	visible := make(bson.A, 0, len(plugins))
+	for userId, userPlugins := range plugins {
+		if len(userPlugins) > 0 {
+			visible = append(visible, bson.M{"userId": userId, "plugin": bson.M{"$in": userPlugins}})
+		}
+	}
+	if len(visible) == 0 {
+		return events, nil
+	}
+
+	cursor, err := collection.Find(ctx,
+		bson.M{"$or": visible, "time": bson.M{"$lt": before}},
+		options.Find().SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, apperror.FromMongo(err, "progress events")
+	}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, apperror.FromMongo(err, "progress events")
+	}
+	return events, nil
+}
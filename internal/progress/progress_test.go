@@ -1,6 +1,7 @@
 package progress
 
 import (
+	"cmd/http/main.go/internal/apperror"
 	"cmd/http/main.go/internal/storage"
 	"cmd/http/main.go/internal/user"
 	"context"
@@ -25,7 +26,9 @@ type Suite struct {
 
 func (suite *Suite) SetupSuite() {
 	// Define Fiber app.
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
 	MONGODB_URI := "mongodb://localhost:27017"
 	MONGODB_NAME := "testing-progress"
 
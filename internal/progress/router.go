@@ -2,7 +2,7 @@ package progress
 
 import "github.com/gofiber/fiber/v2"
 
-func Routes(app *fiber.App, controller *Controller) {
+func Routes(app fiber.Router, controller *Controller) {
 	progress := app.Group("/progress")
 
 	// add middlewares here
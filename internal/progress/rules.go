@@ -0,0 +1,80 @@
+package progress
+
+// experience of journal entries, reflecting every day is rewarded but writing
+// many entries on one day is not
+const (
+	journalEntryExperience = 5
+	// bonus for entries with at least journalLongEntry characters
+	journalLongEntryBonus = 5
+	journalLongEntry      = 280
+	// later entries of the same day earn nothing
+	journalEntriesPerDay = 3
+)
+
+// JournalExperience is the experience of a journal entry with textLength
+// characters, entriesToday counts the earlier entries of the same day
+func JournalExperience(textLength int, entriesToday int64) float64 {
+	if entriesToday >= journalEntriesPerDay {
+		return 0
+	}
+	if textLength >= journalLongEntry {
+		return journalEntryExperience + journalLongEntryBonus
+	}
+	return journalEntryExperience
+}
+
+// experience of a night of sleep, reaching the sleep time goal is rewarded and
+// coming close still earns a part
+const (
+	sleepGoalExperience  = 10
+	sleepCloseExperience = 5
+	// minutes below the goal that still count as close
+	sleepCloseMargin = 30
+)
+
+// SleepExperience is the experience of a night of duration minutes against
+// the sleep time goal of the user
+func SleepExperience(duration int, goal int) float64 {
+	switch {
+	case duration >= goal:
+		return sleepGoalExperience
+	case duration >= goal-sleepCloseMargin:
+		return sleepCloseExperience
+	}
+	return 0
+}
+
+// experience for reaching the daily water goal, more water earns nothing more
+const hydrationGoalExperience = 10
+
+// HydrationExperience is the experience of a day with a total of ml, the
+// caller grants it once per day
+func HydrationExperience(total int, goal int) float64 {
+	if total >= goal {
+		return hydrationGoalExperience
+	}
+	return 0
+}
+
+// experience of a workout, one point per minute at a moderate exertion and a
+// bonus for every personal record
+const (
+	workoutModerateExertion = 5
+	// longer workouts earn no more
+	workoutMaxMinutes       = 180
+	workoutRecordExperience = 10
+	// records beyond this earn no more
+	workoutMaxRecords = 3
+)
+
+// WorkoutExperience is the experience of a workout of duration minutes with a
+// perceived exertion from 1 to 10 that set records new personal records
+func WorkoutExperience(duration int, exertion int, records int) float64 {
+	if duration > workoutMaxMinutes {
+		duration = workoutMaxMinutes
+	}
+	if records > workoutMaxRecords {
+		records = workoutMaxRecords
+	}
+	return float64(duration*exertion)/workoutModerateExertion + float64(records*workoutRecordExperience)
+}
@@ -1,9 +1,10 @@
 package progress
 
 import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/metrics"
 	"cmd/http/main.go/internal/settings"
 	"context"
-	"errors"
 	"math"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,6 +18,8 @@ type ExperienceToNewLevel map[settings.PluginName]float64
 
 const maxLevel = 6
 
+var experienceGranted = metrics.NewCounter("wholesome_experience_granted_total", "Experience granted by plugin.", "plugin")
+
 const experienceToNewLevel = 50
 
 type Db struct {
@@ -47,14 +50,14 @@ func (s *Storage) Get(userId string, ctx context.Context) (Response, error) {
 	// Check if user exists
 	userResult := userCollection.FindOne(ctx, bson.M{"_id": userId})
 	if err := userResult.Err(); err != nil {
-		return Response{}, errors.New("User not found!")
+		return Response{}, apperror.FromMongo(err, "user")
 	}
 
 	var db Db
 
 	err := collection.FindOne(ctx, bson.M{"_id": userId}).Decode(&db)
 	if err != nil {
-		return Response{}, err
+		return Response{}, apperror.FromMongo(err, "progress")
 	}
 
 	// Calculate level
@@ -73,6 +76,21 @@ func (s *Storage) Get(userId string, ctx context.Context) (Response, error) {
 		ExperienceToNewLevel: toNewLevel}, nil
 }
 
+// GetExperience returns the experience of a user per plugin, empty if the user has none
+func (s *Storage) GetExperience(userId string, ctx context.Context) (Experience, error) {
+	collection := s.db.Collection("progress")
+
+	db := Db{Experience: make(Experience)}
+	err := collection.FindOne(ctx, bson.M{"_id": userId}).Decode(&db)
+	if err == mongo.ErrNoDocuments {
+		return make(Experience), nil
+	}
+	if err != nil {
+		return nil, apperror.FromMongo(err, "progress")
+	}
+	return db.Experience, nil
+}
+
 func (s *Storage) AddExperience(userId string, ctx context.Context, plugin settings.PluginName, experienceToAdd float64) error {
 	collection := s.db.Collection("progress")
 	userCollection := s.db.Collection("users")
@@ -101,7 +119,7 @@ func (s *Storage) AddExperience(userId string, ctx context.Context, plugin setti
 		}
 	}
 	// Add experience to the plugin
-
+	before := db.Experience[plugin]
 	db.Experience[plugin] += experienceToAdd
 
 	// Update the user settings in the database
@@ -109,6 +127,8 @@ func (s *Storage) AddExperience(userId string, ctx context.Context, plugin setti
 	if err != nil {
 		return err
 	}
+	experienceGranted.Add(experienceToAdd, string(plugin))
 
-	return nil
+	// level ups and achievements for the feeds of friends
+	return s.createEvents(userId, plugin, before, db.Experience[plugin], ctx)
 }
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// buckets kept before the full ones are dropped
+const maxBuckets = 10000
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// when the bucket is full again
+	full time.Time
+}
+
+// MemoryStore keeps the buckets of a single instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]bucket),
+	}
+}
+
+func (s *MemoryStore) Take(key string, policy Policy, now time.Time, ctx context.Context) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := float64(policy.Limit)
+	if current, ok := s.buckets[key]; ok {
+		tokens = policy.refill(current.tokens, current.updated, now)
+	}
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	result := policy.result(tokens, allowed)
+
+	if len(s.buckets) >= maxBuckets {
+		s.prune(now)
+	}
+	s.buckets[key] = bucket{tokens: tokens, updated: now, full: now.Add(result.Reset)}
+	return result, nil
+}
+
+// prune drops the full buckets, they are the same as new ones. If too many
+// buckets are still in use, the ones closest to full are dropped too.
+func (s *MemoryStore) prune(now time.Time) {
+	for key, current := range s.buckets {
+		if !current.full.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+	if len(s.buckets) < maxBuckets {
+		return
+	}
+
+	keys := make([]string, 0, len(s.buckets))
+	for key := range s.buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return s.buckets[keys[i]].full.Before(s.buckets[keys[j]].full)
+	})
+	// room for new buckets, so the next take does not prune again
+	for _, key := range keys[:len(keys)-maxBuckets*9/10] {
+		delete(s.buckets, key)
+	}
+}
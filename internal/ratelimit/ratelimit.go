@@ -0,0 +1,127 @@
+// Package ratelimit limits the requests of a caller with token buckets. The
+// caller is the user of the userId header once auth.Active confirmed it, or
+// else the client IP.
+package ratelimit
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/auth"
+	"cmd/http/main.go/internal/logging"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	HeaderLimit     = "RateLimit-Limit"
+	HeaderRemaining = "RateLimit-Remaining"
+	// seconds until the bucket is full again
+	HeaderReset  = "RateLimit-Reset"
+	HeaderPolicy = "RateLimit-Policy"
+)
+
+// Policy allows Limit requests per Period, a bucket holds up to Limit
+// requests and refills continuously
+type Policy struct {
+	// the bucket of each caller is kept per name
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// rate is the tokens added per second
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// refill returns the tokens of a bucket that had tokens at updated
+func (p Policy) refill(tokens float64, updated time.Time, now time.Time) float64 {
+	elapsed := now.Sub(updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(p.Limit), tokens+elapsed*p.rate())
+}
+
+// result describes a bucket that has tokens left after a request
+func (p Policy) result(tokens float64, allowed bool) Result {
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(p.Limit) - tokens) / p.rate() * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / p.rate() * float64(time.Second))
+	}
+	return result
+}
+
+// Result of taking a token of a bucket
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// until the bucket is full
+	Reset time.Duration
+	// until the next request is allowed, only if it was not
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets, a new bucket is full
+type Store interface {
+	Take(key string, policy Policy, now time.Time, ctx context.Context) (Result, error)
+}
+
+type Limiter struct {
+	store Store
+}
+
+func New(store Store) *Limiter {
+	return &Limiter{
+		store: store,
+	}
+}
+
+// key identifies the caller of a request, unknown user ids share the bucket
+// of their IP so made up ids get no fresh buckets
+func key(c *fiber.Ctx, policy Policy) string {
+	if auth.Known(c) {
+		return policy.Name + ":user:" + string(c.Request().Header.Peek("userId"))
+	}
+	return policy.Name + ":ip:" + c.IP()
+}
+
+// Limit returns a middleware that allows the requests of policy per caller.
+// With several policies on a route the headers show the one with the fewest
+// requests left. The requests are allowed if the store fails.
+func (l *Limiter) Limit(policy Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		result, err := l.store.Take(key(c, policy), policy, time.Now(), c.UserContext())
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("could not take rate limit", "policy", policy.Name, "error", err)
+			return c.Next()
+		}
+
+		previous, err := strconv.Atoi(c.GetRespHeader(HeaderRemaining))
+		if err != nil || result.Remaining <= previous {
+			c.Set(HeaderLimit, strconv.Itoa(policy.Limit))
+			c.Set(HeaderRemaining, strconv.Itoa(result.Remaining))
+			c.Set(HeaderReset, strconv.Itoa(seconds(result.Reset)))
+			c.Set(HeaderPolicy, fmt.Sprintf("%d;w=%d", policy.Limit, seconds(policy.Period)))
+		}
+
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds(result.RetryAfter)))
+			return apperror.RateLimited("Too many requests, retry in %d seconds", seconds(result.RetryAfter))
+		}
+		return c.Next()
+	}
+}
+
+// seconds rounds up, so clients do not retry too early
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
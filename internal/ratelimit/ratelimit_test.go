@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/auth"
+	"cmd/http/main.go/internal/storage"
+	"context"
+	"log"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+// accounts is an in memory auth.Accounts
+type accounts map[string]auth.Account
+
+func (a accounts) Account(userId string, ctx context.Context) (auth.Account, error) {
+	account, ok := a[userId]
+	if !ok {
+		return account, apperror.NotFound("user does not exist")
+	}
+	return account, nil
+}
+
+type Suite struct {
+	suite.Suite
+	app   *fiber.App
+	store *Storage
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-ratelimit"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	suite.store = NewStorage(db)
+	limiter := New(suite.store)
+	app.Use(auth.Active(accounts{"testId": {Role: auth.RoleUser}, "otherId": {Role: auth.RoleUser}}))
+	app.Use(limiter.Limit(Policy{Name: "default", Limit: 10, Period: time.Minute}))
+	app.Post("/elevator", limiter.Limit(Policy{Name: "create", Limit: 2, Period: time.Minute}))
+	app.Post("/elevator", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusCreated) })
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	if err := suite.store.db.Collection("rateLimits").Drop(context.Background()); err != nil {
+		log.Println("Error: ", err)
+	}
+}
+
+func (suite *Suite) request(userId string) (int, map[string]string) {
+	req := httptest.NewRequest("POST", "/elevator", nil)
+	if userId != "" {
+		req.Header.Set("userId", userId)
+	}
+	resp, err := suite.app.Test(req, -1)
+	if err != nil {
+		suite.T().Errorf("Could not make request: %v", err)
+	}
+	headers := make(map[string]string)
+	for _, header := range []string{HeaderLimit, HeaderRemaining, HeaderReset, HeaderPolicy, fiber.HeaderRetryAfter} {
+		headers[header] = resp.Header.Get(header)
+	}
+	return resp.StatusCode, headers
+}
+
+func (suite *Suite) TestLimit() {
+	// the stricter policy of the route is shown
+	code, headers := suite.request("testId")
+	suite.Equal(fiber.StatusCreated, code)
+	suite.Equal("2", headers[HeaderLimit])
+	suite.Equal("1", headers[HeaderRemaining])
+	suite.Equal("2;w=60", headers[HeaderPolicy])
+
+	code, _ = suite.request("testId")
+	suite.Equal(fiber.StatusCreated, code)
+	code, headers = suite.request("testId")
+	suite.Equal(fiber.StatusTooManyRequests, code)
+	suite.Equal("0", headers[HeaderRemaining])
+	suite.Equal("30", headers[fiber.HeaderRetryAfter])
+
+	// other users and callers without user have their own buckets
+	code, _ = suite.request("otherId")
+	suite.Equal(fiber.StatusCreated, code)
+	code, _ = suite.request("")
+	suite.Equal(fiber.StatusCreated, code)
+
+	// made up user ids share the bucket of the IP
+	code, _ = suite.request("unknown1")
+	suite.Equal(fiber.StatusCreated, code)
+	code, _ = suite.request("unknown2")
+	suite.Equal(fiber.StatusTooManyRequests, code)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	policy := Policy{Name: "test", Limit: 3, Period: 3 * time.Second}
+	now := time.Unix(1700000000, 0)
+
+	for i, remaining := range []int{2, 1, 0} {
+		result, _ := store.Take("key", policy, now, context.Background())
+		if !result.Allowed || result.Remaining != remaining {
+			t.Errorf("request %d: got %+v, want %d remaining", i, result, remaining)
+		}
+	}
+	result, _ := store.Take("key", policy, now, context.Background())
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Errorf("got %+v, want a retry after a second", result)
+	}
+
+	// a token is refilled each second, the bucket is never fuller than the limit
+	result, _ = store.Take("key", policy, now.Add(time.Second), context.Background())
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("got %+v after a second, want the refilled token", result)
+	}
+	result, _ = store.Take("key", policy, now.Add(time.Hour), context.Background())
+	if !result.Allowed || result.Remaining != 2 || result.Reset != time.Second {
+		t.Errorf("got %+v after an hour, want a full bucket", result)
+	}
+}
+
+func TestMemoryStorePrune(t *testing.T) {
+	store := NewMemoryStore()
+	policy := Policy{Name: "test", Limit: 3, Period: time.Hour}
+	now := time.Unix(1700000000, 0)
+
+	// every key is a bucket in use, they are dropped anyway beyond the cap
+	for i := 0; i < 2*maxBuckets; i++ {
+		store.Take(strconv.Itoa(i), policy, now.Add(time.Duration(i)*time.Millisecond), context.Background())
+	}
+	if len(store.buckets) > maxBuckets {
+		t.Errorf("got %d buckets, want at most %d", len(store.buckets), maxBuckets)
+	}
+	if _, ok := store.buckets[strconv.Itoa(2*maxBuckets-1)]; !ok {
+		t.Errorf("got the newest bucket dropped")
+	}
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestRateLimitTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BucketDB is the bucket of a caller and policy, shared by all instances
+type BucketDB struct {
+	ID      string    `bson:"_id"`
+	Tokens  float64   `bson:"tokens"`
+	Updated time.Time `bson:"updated"`
+	Allowed bool      `bson:"allowed"`
+	// a bucket is full again after the period at the latest, then it is removed
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// Storage keeps the buckets in mongo, for several instances
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+// EnsureIndexes removes the buckets that are full again
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	collection := s.db.Collection("rateLimits")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Take refills the bucket and takes a token in one update, so concurrent
+// requests of a caller cannot take the same token
+func (s *Storage) Take(key string, policy Policy, now time.Time, ctx context.Context) (Result, error) {
+	collection := s.db.Collection("rateLimits")
+
+	// mongo has millisecond dates
+	now = now.Truncate(time.Millisecond)
+	limit := float64(policy.Limit)
+	update := bson.A{
+		bson.M{"$set": bson.M{"tokens": bson.M{"$min": bson.A{limit, bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$tokens", limit}},
+			bson.M{"$multiply": bson.A{
+				bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated", now}}}}}},
+				policy.rate() / 1000,
+			}},
+		}}}}}},
+		bson.M{"$set": bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}, "updated": now, "expiresAt": now.Add(policy.Period)}},
+		bson.M{"$set": bson.M{"tokens": bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var bucket BucketDB
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&bucket)
+	// two first requests of a caller both insert, the second one is retried
+	if mongo.IsDuplicateKeyError(err) {
+		err = collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&bucket)
+	}
+	if err != nil {
+		return Result{}, apperror.FromMongo(err, "rate limit")
+	}
+	return policy.result(bucket.Tokens, bucket.Allowed), nil
+}
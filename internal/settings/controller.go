@@ -1,6 +1,8 @@
 package settings
 
 import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/audit"
 	"cmd/http/main.go/internal/user"
 	"reflect"
 
@@ -21,6 +23,10 @@ type CreateSettingsRequest struct {
 	Meditation     MeditationSettings `json:"meditation" bson:"meditation"`
 	Finance        FinanceSettings    `json:"finance" bson:"finance"`
 	Elevator       ElevatorSettings   `json:"elevator" bson:"elevator"`
+	Journal        JournalSettings    `json:"journal" bson:"journal"`
+	Sleep          SleepSettings      `json:"sleep" bson:"sleep"`
+	Hydration      HydrationSettings  `json:"hydration" bson:"hydration"`
+	Workout        WorkoutSettings    `json:"workout" bson:"workout"`
 }
 
 func NewController(storage *Storage, userStorage *user.Storage) *Controller {
@@ -36,6 +42,10 @@ type CreateOnboardingSettingResponse struct {
 	Meditation     MeditationSettings `json:"meditation" bson:"meditation"`
 	Finance        FinanceSettings    `json:"finance" bson:"finance"`
 	Elevator       ElevatorSettings   `json:"elevator" bson:"elevator"`
+	Journal        JournalSettings    `json:"journal" bson:"journal"`
+	Sleep          SleepSettings      `json:"sleep" bson:"sleep"`
+	Hydration      HydrationSettings  `json:"hydration" bson:"hydration"`
+	Workout        WorkoutSettings    `json:"workout" bson:"workout"`
 }
 
 // TODO for each Plugin a creat endpoint
@@ -68,22 +78,16 @@ func (t *Controller) createOnboarding(c *fiber.Ctx) error {
 
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
+		return apperror.Validation("Missing userId header")
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request body",
-		})
+		return apperror.Validation("Invalid request body")
 	}
 
-	http, err := t.storage.CreateOnboarding(req, userId, c.Context())
+	http, err := t.storage.CreateOnboarding(req, userId, c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Could not create onboarding, because: " + err.Error(),
-		})
+		return err
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(http)
@@ -100,18 +104,14 @@ func (t *Controller) createOnboarding(c *fiber.Ctx) error {
 func (t *Controller) get(c *fiber.Ctx) error {
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
+		return apperror.Validation("Missing userId header")
 	}
 	// Get plugin from query
 	plugin := c.Query("plugin")
 
-	settings, err := t.storage.Get(userId, plugin, c.Context())
+	settings, err := t.storage.Get(userId, plugin, c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Could not get settings, because: " + err.Error(),
-		})
+		return err
 	}
 
 	if plugin != "" {
@@ -121,9 +121,7 @@ func (t *Controller) get(c *fiber.Ctx) error {
 		if f.IsValid() {
 			return c.Status(fiber.StatusOK).JSON(f.Interface())
 		} else {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"message": "Plugin does not exist",
-			})
+			return apperror.Validation("Plugin does not exist")
 		}
 	}
 
@@ -169,27 +167,73 @@ func (t *Controller) createMeditationSettings(c *fiber.Ctx) error {
 	return t.createPluginSettings(&MeditationSettings{}, c)
 }
 
+// @Summary Create settings for the journal Plugin.
+// @Description Creates settings for the journal plugin
+// @Tags settings
+// @Accept */*
+// @Produce json
+// @param userId header string true "User ID"
+// @Param settings body JournalSettings true "onboarding to create"
+// @Success 201
+// @Router /settings/journal [post]
+func (t *Controller) createJournalSettings(c *fiber.Ctx) error {
+	return t.createPluginSettings(&JournalSettings{}, c)
+}
+
+// @Summary Create settings for the sleep Plugin.
+// @Description Creates settings for the sleep plugin
+// @Tags settings
+// @Accept */*
+// @Produce json
+// @param userId header string true "User ID"
+// @Param settings body SleepSettings true "onboarding to create"
+// @Success 201
+// @Router /settings/sleep [post]
+func (t *Controller) createSleepSettings(c *fiber.Ctx) error {
+	return t.createPluginSettings(&SleepSettings{}, c)
+}
+
+// @Summary Create settings for the hydration Plugin.
+// @Description Creates settings for the hydration plugin
+// @Tags settings
+// @Accept */*
+// @Produce json
+// @param userId header string true "User ID"
+// @Param settings body HydrationSettings true "onboarding to create"
+// @Success 201
+// @Router /settings/hydration [post]
+func (t *Controller) createHydrationSettings(c *fiber.Ctx) error {
+	return t.createPluginSettings(&HydrationSettings{}, c)
+}
+
+// @Summary Create settings for the workout Plugin.
+// @Description Creates settings for the workout plugin
+// @Tags settings
+// @Accept */*
+// @Produce json
+// @param userId header string true "User ID"
+// @Param settings body WorkoutSettings true "onboarding to create"
+// @Success 201
+// @Router /settings/workout [post]
+func (t *Controller) createWorkoutSettings(c *fiber.Ctx) error {
+	return t.createPluginSettings(&WorkoutSettings{}, c)
+}
+
 func (t *Controller) createPluginSettings(settingType SingleSetting, c *fiber.Ctx) error {
 	c.Request().Header.Set("Content-Type", "application/json")
 
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
+		return apperror.Validation("Missing userId header")
 	}
 
 	if err := c.BodyParser(settingType); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request body" + err.Error(),
-		})
+		return apperror.Validation("Invalid request body")
 	}
 
-	err := t.storage.CreatePluginSettings(settingType, userId, c.Context())
+	err := t.storage.CreatePluginSettings(settingType, userId, c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Could not create " + settingType.getName() + " settings: " + err.Error(),
-		})
+		return err
 	}
 	return c.Status(fiber.StatusCreated).JSON("Created")
 }
@@ -234,32 +278,81 @@ func (t *Controller) updateElevatorSettings(c *fiber.Ctx) error {
 	return t.updatePluginSettings(&ElevatorSettings{}, c)
 }
 
+// @Summary Update settings for the journal Plugin.
+// @Description Update settings for the journal Plugin.
+// @Tags settings
+// @Accept */*
+// @Produce json
+// @param userId header string true "User ID"
+// @Param settings body JournalSettings true "onboarding to create"
+// @Success 200
+// @Router /settings/journal [put]
+func (t *Controller) updateJournalSettings(c *fiber.Ctx) error {
+	return t.updatePluginSettings(&JournalSettings{}, c)
+}
+
+// @Summary Update settings for the sleep Plugin.
+// @Description Update settings for the sleep Plugin.
+// @Tags settings
+// @Accept */*
+// @Produce json
+// @param userId header string true "User ID"
+// @Param settings body SleepSettings true "onboarding to create"
+// @Success 200
+// @Router /settings/sleep [put]
+func (t *Controller) updateSleepSettings(c *fiber.Ctx) error {
+	return t.updatePluginSettings(&SleepSettings{}, c)
+}
+
+// @Summary Update settings for the hydration Plugin.
+// @Description Update settings for the hydration Plugin.
+// @Tags settings
+// @Accept */*
+// @Produce json
+// @param userId header string true "User ID"
+// @Param settings body HydrationSettings true "onboarding to create"
+// @Success 200
+// @Router /settings/hydration [put]
+func (t *Controller) updateHydrationSettings(c *fiber.Ctx) error {
+	return t.updatePluginSettings(&HydrationSettings{}, c)
+}
+
+// @Summary Update settings for the workout Plugin.
+// @Description Update settings for the workout Plugin.
+// @Tags settings
+// @Accept */*
+// @Produce json
+// @param userId header string true "User ID"
+// @Param settings body WorkoutSettings true "onboarding to create"
+// @Success 200
+// @Router /settings/workout [put]
+func (t *Controller) updateWorkoutSettings(c *fiber.Ctx) error {
+	return t.updatePluginSettings(&WorkoutSettings{}, c)
+}
+
 func (t *Controller) updatePluginSettings(settingType SingleSetting, c *fiber.Ctx) error {
 	c.Request().Header.Set("Content-Type", "application/json")
 
 	// Check if the user is logged in
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
+		return apperror.Validation("Missing userId header")
 	}
 
 	if err := c.BodyParser(settingType); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request body",
-		})
+		return apperror.Validation("Invalid request body")
 	}
 
-	http, err := t.storage.UpdatePluginSettings(settingType, userId, c.Context())
+	before, err := t.current(userId, c)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(
-			fiber.Map{
-				"message": "Could not update" +
-					settingType.getName() +
-					" settings: " + err.Error(),
-			},
-		)
+		return err
+	}
+	http, err := t.storage.UpdatePluginSettings(settingType, userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	if err := t.logChange(c, "settings.update", userId, before); err != nil {
+		return err
 	}
 	return c.Status(fiber.StatusOK).JSON(http)
 }
@@ -276,21 +369,47 @@ func (t *Controller) updatePluginSettings(settingType SingleSetting, c *fiber.Ct
 func (t *Controller) delete(c *fiber.Ctx) error {
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
+		return apperror.Validation("Missing userId header")
 	}
 	plugin := c.Query("plugin")
-	err := t.storage.Delete(userId, plugin, c.Context())
+	before, err := t.current(userId, c)
 	if err != nil {
-		if err.Error() == "User not found" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"message": "User not found" + err.Error(),
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Could not delete settings, because: " + err.Error(),
-		})
+		return err
+	}
+	err = t.storage.Delete(userId, plugin, c.UserContext())
+	if err != nil {
+		return err
+	}
+	if err := t.logChange(c, "settings.delete", userId, before); err != nil {
+		return err
 	}
 	return c.SendStatus(fiber.StatusOK)
 }
+
+// current returns the settings of a user, nil if there are none
+func (t *Controller) current(userId string, c *fiber.Ctx) (*SettingsDB, error) {
+	settings, err := t.storage.Get(userId, "", c.UserContext())
+	if apperror.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// logChange adds the changed fields of the settings of a user to the audit log
+func (t *Controller) logChange(c *fiber.Ctx, action string, userId string, before *SettingsDB) error {
+	after, err := t.current(userId, c)
+	if err != nil {
+		return err
+	}
+	audit.Log(c, audit.EntryDB{
+		TargetID:   userId,
+		Action:     action,
+		EntityType: "settings",
+		EntityID:   userId,
+		Changes:    audit.Diff(before, after),
+	})
+	return nil
+}
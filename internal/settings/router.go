@@ -2,7 +2,7 @@ package settings
 
 import "github.com/gofiber/fiber/v2"
 
-func Routes(app *fiber.App, controller *Controller) {
+func Routes(app fiber.Router, controller *Controller) {
 	settings := app.Group("/settings")
 
 	// add middlewares here
@@ -14,11 +14,19 @@ func Routes(app *fiber.App, controller *Controller) {
 	settings.Post("/finance", controller.createFinanceSettings)
 	settings.Post("/meditation", controller.createMeditationSettings)
 	settings.Post("/elevator", controller.createElevatorSettings)
+	settings.Post("/journal", controller.createJournalSettings)
+	settings.Post("/sleep", controller.createSleepSettings)
+	settings.Post("/hydration", controller.createHydrationSettings)
+	settings.Post("/workout", controller.createWorkoutSettings)
 
 	// Put for each plugin
 	settings.Put("/finance", controller.updateFinanceSettings)
 	settings.Put("/meditation", controller.updateMeditationSettings)
 	settings.Put("/elevator", controller.updateElevatorSettings)
+	settings.Put("/journal", controller.updateJournalSettings)
+	settings.Put("/sleep", controller.updateSleepSettings)
+	settings.Put("/hydration", controller.updateHydrationSettings)
+	settings.Put("/workout", controller.updateWorkoutSettings)
 
 	settings.Delete("/", controller.delete)
 }
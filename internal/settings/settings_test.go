@@ -2,6 +2,7 @@ package settings
 
 import (
 	"bytes"
+	"cmd/http/main.go/internal/apperror"
 	"cmd/http/main.go/internal/storage"
 	"cmd/http/main.go/internal/user"
 	"context"
@@ -25,7 +26,9 @@ type SettingsSuite struct {
 }
 
 func (suite *SettingsSuite) SetupSuite() {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
 	MONGODB_URI := "mongodb://localhost:27017"
 	MONGODB_NAME := "testing-setting"
 
@@ -150,7 +153,7 @@ func (suite *SettingsSuite) TestCreateFinanceSettingsAndDelete() {
 		log.Fatalln(err)
 	}
 
-	suite.Equal(500, resp.StatusCode, "Message: %v", string(body))
+	suite.Equal(201, resp.StatusCode, "Message: %v", string(body))
 
 	//test put
 	req2 := httptest.NewRequest("PUT", "/settings/finance", bytes.NewReader(reqBodyBytes))
@@ -175,7 +178,7 @@ func (suite *SettingsSuite) TestGetInvalidPlugin() {
 
 	resp, _ := suite.app.Test(req)
 
-	suite.Equal(500, resp.StatusCode, "\nStatus::"+resp.Status+"\n", "Should return HTTP 400")
+	suite.Equal(404, resp.StatusCode, "\nStatus::"+resp.Status+"\n", "Should return HTTP 404")
 
 }
 
@@ -258,7 +261,7 @@ func (suite *SettingsSuite) TestCreatePluginSettingsTwiceAndDeleteOneSetting() {
 	req3.Header.Set("userId", suite.testUserId)
 
 	resp3, _ := suite.app.Test(req3)
-	suite.Equal(500, resp3.StatusCode, "\nStatus::"+resp3.Status+"\n", "Should return HTTP 500")
+	suite.Equal(400, resp3.StatusCode, "\nStatus::"+resp3.Status+"\n", "Should return HTTP 400")
 
 	// Delete settings
 	req5 := httptest.NewRequest("DELETE", "/settings?plugin=meditation", nil)
@@ -311,7 +314,7 @@ func (suite *SettingsSuite) TestUpdateMeditationAndElevator() {
 		panic(err)
 	}
 
-	suite.Equal(500, resp6.StatusCode, "Message: %v", string(body))
+	suite.Equal(404, resp6.StatusCode, "Message: %v", string(body))
 
 	reqBody := CreateSettingsRequest{
 		EnabledPlugins: []PluginName{"elevator", "meditation"},
@@ -431,8 +434,92 @@ func (suite *SettingsSuite) TestGetSpecificPlugin() {
 	req5 := httptest.NewRequest("GET", "/settings?plugin=invalidPlugin", nil)
 	req5.Header.Set("userId", suite.testUserId)
 	resp5, _ := suite.app.Test(req5)
-	suite.Equal(500, resp5.StatusCode, "\nStatus::"+resp5.Status+"\n", "Should return HTTP 400")
+	suite.Equal(400, resp5.StatusCode, "\nStatus::"+resp5.Status+"\n", "Should return HTTP 400")
+
+}
+
+func (suite *SettingsSuite) TestCreateSettingsOutOfRange() {
+	reqBody := CreateSettingsRequest{
+		EnabledPlugins: []PluginName{"meditation"},
+		Meditation: MeditationSettings{
+			MeditationTimeGoal:  -10,
+			Notifications:       true,
+			AmountNotifications: 3,
+			PeriodNotifications: "Day",
+		}}
+	reqBodyBytes, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/settings", bytes.NewReader(reqBodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("userId", suite.testUserId)
+	resp, _ := suite.app.Test(req)
+	suite.Equal(400, resp.StatusCode, "\nStatus::"+resp.Status+"\n", "Should return HTTP 400")
+
+	reqBody2 := FinanceSettings{
+		PeriodNotifications: "Week",
+		Strategy:            "Percent",
+		StrategyAmount:      150,
+	}
+	reqBodyBytes2, _ := json.Marshal(reqBody2)
+	req2 := httptest.NewRequest("POST", "/settings/finance", bytes.NewReader(reqBodyBytes2))
+	req2.Header.Set("Content-Type", "application/json")
+	req2.Header.Set("userId", suite.testUserId)
+	resp2, _ := suite.app.Test(req2)
+	suite.Equal(400, resp2.StatusCode, "\nStatus::"+resp2.Status+"\n", "Should return HTTP 400")
+}
+
+func (suite *SettingsSuite) TestJournalSettings() {
+	// the journal is also part of the onboarding, the prompt time is checked there too
+	onboarding := CreateSettingsRequest{
+		EnabledPlugins: []PluginName{PluginNameJournal},
+		Journal:        JournalSettings{PeriodNotifications: "Day", DailyPrompt: true, PromptTime: "seven"},
+	}
+	reqBodyBytes, _ := json.Marshal(onboarding)
+	req := httptest.NewRequest("POST", "/settings", bytes.NewReader(reqBodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("userId", suite.testUserId)
+	resp, _ := suite.app.Test(req)
+	suite.Equal(fiber.StatusBadRequest, resp.StatusCode)
 
+	tests := []struct {
+		description  string
+		method       string
+		body         JournalSettings
+		expectedCode int
+	}{
+		{
+			description:  "Prompt without time",
+			method:       "POST",
+			body:         JournalSettings{PeriodNotifications: "Day", DailyPrompt: true},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Create daily prompt",
+			method:       "POST",
+			body:         JournalSettings{PeriodNotifications: "Day", DailyPrompt: true, PromptTime: "20:30"},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "Update with invalid time",
+			method:       "PUT",
+			body:         JournalSettings{PeriodNotifications: "Day", DailyPrompt: true, PromptTime: "25:00"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Disable daily prompt",
+			method:       "PUT",
+			body:         JournalSettings{PeriodNotifications: "Week"},
+			expectedCode: fiber.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		reqBodyBytes, _ := json.Marshal(test.body)
+		req := httptest.NewRequest(test.method, "/settings/journal", bytes.NewReader(reqBodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("userId", suite.testUserId)
+		resp, _ := suite.app.Test(req)
+		suite.Equal(test.expectedCode, resp.StatusCode, test.description)
+	}
 }
 
 func (suite *SettingsSuite) TestPutSettingsMissingUserId() {
@@ -448,7 +535,7 @@ func (suite *SettingsSuite) TestDeleteSettingsUnavailableUserId() {
 	req.Header.Set("userId", "someUserId")
 
 	resp, _ := suite.app.Test(req)
-	suite.Equal(fiber.StatusInternalServerError, resp.StatusCode)
+	suite.Equal(fiber.StatusNotFound, resp.StatusCode)
 }
 
 // tear down the database after all tests are done
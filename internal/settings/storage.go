@@ -1,10 +1,13 @@
 package settings
 
 import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/logging"
+	"cmd/http/main.go/internal/validation"
 	"context"
 	"errors"
-	"log"
 	"reflect"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -17,6 +20,10 @@ const (
 	PluginNameFinance    PluginName = "finance"
 	PluginNameMeditation PluginName = "meditation"
 	PluginNameElevator   PluginName = "elevator"
+	PluginNameJournal    PluginName = "journal"
+	PluginNameSleep      PluginName = "sleep"
+	PluginNameHydration  PluginName = "hydration"
+	PluginNameWorkout    PluginName = "workout"
 )
 
 // AND ADD ALSO HERE
@@ -25,12 +32,24 @@ var pluginNameToCap = map[PluginName]string{
 	PluginNameFinance:    "Finance",
 	PluginNameMeditation: "Meditation",
 	PluginNameElevator:   "Elevator",
+	PluginNameJournal:    "Journal",
+	PluginNameSleep:      "Sleep",
+	PluginNameHydration:  "Hydration",
+	PluginNameWorkout:    "Workout",
 }
 
 var validPlugins = map[PluginName]bool{
 	PluginNameFinance:    true,
 	PluginNameMeditation: true,
 	PluginNameElevator:   true,
+	PluginNameJournal:    true,
+	PluginNameSleep:      true,
+	PluginNameHydration:  true,
+	PluginNameWorkout:    true,
+}
+
+func (p PluginName) IsValid() bool {
+	return validPlugins[p]
 }
 
 type NotificationType string
@@ -49,6 +68,18 @@ const (
 	StrategyTypePercent StrategyType = "Percent"
 )
 
+// bounds shared by the settings of all plugins
+const (
+	maxAmountNotifications = 50
+	maxMeditationTimeGoal  = 24 * 60
+	maxElevatorGoal        = 100000
+	maxPercent             = 100
+	maxSleepTimeGoal       = 16 * 60
+	maxHydrationGoal       = 10000
+	maxWorkoutWeeklyGoal   = 21
+	promptTimeLayout       = "15:04"
+)
+
 type SingleSetting interface {
 	getPeriodNotifications() NotificationType
 	getName() string
@@ -74,12 +105,14 @@ func (f FinanceSettings) getName() string {
 	return "finance"
 }
 
-// TODO check if enough
 func (f FinanceSettings) validate() error {
-	if !isValidNotificationType(f) || !isValidStrategy(f.Strategy) {
-		return errors.New("invalid finance strategy")
-	}
-	return nil
+	errs := checkNotifications(f, f.AmountNotifications)
+	errs.Check(isValidStrategy(f.Strategy), "strategy", "must be one of %s, %s, %s", StrategyTypeRound, StrategyTypePlus, StrategyTypePercent)
+	errs.Check(f.StrategyAmount >= 0, "strategyAmount", "must not be negative")
+	errs.Check(f.Strategy != StrategyTypePercent || f.StrategyAmount <= maxPercent, "strategyAmount", "must be at most %d percent", maxPercent)
+	errs.Check(f.InvestmentGoal >= 0, "investmentGoal", "must not be negative")
+	errs.Check(f.InvestmentTimeGoal >= 0, "investmentTimeGoal", "must not be negative")
+	return errs.Err()
 }
 
 type MeditationSettings struct {
@@ -97,12 +130,10 @@ func (m MeditationSettings) getName() string {
 	return "meditation"
 }
 
-// TODO check if enough
 func (m MeditationSettings) validate() error {
-	if !isValidNotificationType(m) {
-		return errors.New("Invalid notification type")
-	}
-	return nil
+	errs := checkNotifications(m, m.AmountNotifications)
+	errs.Check(validation.InRange(int64(m.MeditationTimeGoal), 0, maxMeditationTimeGoal), "meditationTimeGoal", "must be between 0 and %d minutes", maxMeditationTimeGoal)
+	return errs.Err()
 }
 
 type ElevatorSettings struct {
@@ -120,12 +151,106 @@ func (e ElevatorSettings) getName() string {
 	return "elevator"
 }
 
-// TODO check if enough
 func (e ElevatorSettings) validate() error {
-	if !isValidNotificationType(e) {
-		return errors.New("Invalid notification type")
-	}
-	return nil
+	errs := checkNotifications(e, e.AmountNotifications)
+	errs.Check(validation.InRange(int64(e.Goal), 0, maxElevatorGoal), "goal", "must be between 0 and %d", maxElevatorGoal)
+	return errs.Err()
+}
+
+type JournalSettings struct {
+	Notifications       bool             `json:"notifications" bson:"notifications"`
+	AmountNotifications int              `json:"amountNotifications" bson:"amountNotifications"`
+	PeriodNotifications NotificationType `json:"periodNotifications" bson:"periodNotifications"`
+	// daily reminder with a writing prompt at PromptTime (HH:MM in the time zone of the user)
+	DailyPrompt bool   `json:"dailyPrompt" bson:"dailyPrompt"`
+	PromptTime  string `json:"promptTime" bson:"promptTime"`
+}
+
+func (j JournalSettings) getPeriodNotifications() NotificationType {
+	return j.PeriodNotifications
+}
+
+func (j JournalSettings) getName() string {
+	return "journal"
+}
+
+func (j JournalSettings) validate() error {
+	errs := checkNotifications(j, j.AmountNotifications)
+	_, err := time.Parse(promptTimeLayout, j.PromptTime)
+	errs.Check(!j.DailyPrompt || err == nil, "promptTime", "must be a time of day like 20:30")
+	return errs.Err()
+}
+
+// DefaultSleepTimeGoal is the sleep time goal of users without one
+const DefaultSleepTimeGoal = 8 * 60
+
+type SleepSettings struct {
+	Notifications       bool             `json:"notifications" bson:"notifications"`
+	AmountNotifications int              `json:"amountNotifications" bson:"amountNotifications"`
+	PeriodNotifications NotificationType `json:"periodNotifications" bson:"periodNotifications"`
+	// minutes of sleep per night, the sleep debt is measured against it
+	SleepTimeGoal int `json:"sleepTimeGoal" bson:"sleepTimeGoal"`
+}
+
+func (s SleepSettings) getPeriodNotifications() NotificationType {
+	return s.PeriodNotifications
+}
+
+func (s SleepSettings) getName() string {
+	return "sleep"
+}
+
+func (s SleepSettings) validate() error {
+	errs := checkNotifications(s, s.AmountNotifications)
+	errs.Check(validation.InRange(int64(s.SleepTimeGoal), 0, maxSleepTimeGoal), "sleepTimeGoal", "must be between 0 and %d minutes", maxSleepTimeGoal)
+	return errs.Err()
+}
+
+// DefaultHydrationGoal is the daily water goal in ml of users without one
+const DefaultHydrationGoal = 2000
+
+type HydrationSettings struct {
+	Notifications       bool             `json:"notifications" bson:"notifications"`
+	AmountNotifications int              `json:"amountNotifications" bson:"amountNotifications"`
+	PeriodNotifications NotificationType `json:"periodNotifications" bson:"periodNotifications"`
+	// ml of water per day
+	DailyGoal int `json:"dailyGoal" bson:"dailyGoal"`
+}
+
+func (h HydrationSettings) getPeriodNotifications() NotificationType {
+	return h.PeriodNotifications
+}
+
+func (h HydrationSettings) getName() string {
+	return "hydration"
+}
+
+func (h HydrationSettings) validate() error {
+	errs := checkNotifications(h, h.AmountNotifications)
+	errs.Check(validation.InRange(int64(h.DailyGoal), 0, maxHydrationGoal), "dailyGoal", "must be between 0 and %d ml", maxHydrationGoal)
+	return errs.Err()
+}
+
+type WorkoutSettings struct {
+	Notifications       bool             `json:"notifications" bson:"notifications"`
+	AmountNotifications int              `json:"amountNotifications" bson:"amountNotifications"`
+	PeriodNotifications NotificationType `json:"periodNotifications" bson:"periodNotifications"`
+	// workouts per week, 0 if the user has no goal
+	WeeklyGoal int `json:"weeklyGoal" bson:"weeklyGoal"`
+}
+
+func (w WorkoutSettings) getPeriodNotifications() NotificationType {
+	return w.PeriodNotifications
+}
+
+func (w WorkoutSettings) getName() string {
+	return "workout"
+}
+
+func (w WorkoutSettings) validate() error {
+	errs := checkNotifications(w, w.AmountNotifications)
+	errs.Check(validation.InRange(int64(w.WeeklyGoal), 0, maxWorkoutWeeklyGoal), "weeklyGoal", "must be between 0 and %d workouts", maxWorkoutWeeklyGoal)
+	return errs.Err()
 }
 
 // SettingsDB is the struct that is stored in the database
@@ -137,6 +262,10 @@ type SettingsDB struct {
 	Meditation     MeditationSettings `json:"meditation" bson:"meditation,omitempty" `
 	Finance        FinanceSettings    `json:"finance" bson:"finance,omitempty"`
 	Elevator       ElevatorSettings   `json:"elevator" bson:"elevator,omitempty"`
+	Journal        JournalSettings    `json:"journal" bson:"journal,omitempty"`
+	Sleep          SleepSettings      `json:"sleep" bson:"sleep,omitempty"`
+	Hydration      HydrationSettings  `json:"hydration" bson:"hydration,omitempty"`
+	Workout        WorkoutSettings    `json:"workout" bson:"workout,omitempty"`
 }
 
 type Storage struct {
@@ -157,19 +286,16 @@ func (s *Storage) Get(userId string, plugin string, ctx context.Context) (Settin
 	// Check if user exists
 	user := userCollection.FindOne(ctx, bson.M{"_id": userId})
 	if err := user.Err(); err != nil {
-		return settingsRecord, errors.New("User not found!")
+		return settingsRecord, apperror.FromMongo(err, "user")
 	}
 
 	// No plugin - Get all plugins
 	if plugin == "" {
 		cursor := collection.FindOne(ctx, bson.M{"_id": userId})
-		if err := cursor.Err(); err != nil {
-			return settingsRecord, err
-		}
 
 		// Decode the record
 		if err := cursor.Decode(&settingsRecord); err != nil {
-			return settingsRecord, err
+			return settingsRecord, apperror.FromMongo(err, "settings")
 		}
 
 		return settingsRecord, nil
@@ -178,18 +304,15 @@ func (s *Storage) Get(userId string, plugin string, ctx context.Context) (Settin
 	// Check if plugin exists
 	pluginName := PluginName(plugin)
 	if _, ok := validPlugins[pluginName]; !ok {
-		return settingsRecord, errors.New("Plugin not found!")
+		return settingsRecord, apperror.Validation("Plugin not found!")
 	}
 
 	// Get certain plugin info
 	cursor := collection.FindOne(ctx, bson.M{"_id": userId, "enabledPlugins": pluginName})
-	if err := cursor.Err(); err != nil {
-		return settingsRecord, err
-	}
 
 	// Decode the record
 	if err := cursor.Decode(&settingsRecord); err != nil {
-		return settingsRecord, err
+		return settingsRecord, apperror.FromMongo(err, plugin+" settings")
 	}
 
 	return settingsRecord, nil
@@ -203,33 +326,32 @@ func (s *Storage) CreateOnboarding(request CreateSettingsRequest, userId string,
 	// Check if user exists
 	user := userCollection.FindOne(ctx, bson.M{"_id": userId})
 	if err := user.Err(); err != nil {
-		return "User not found", err
+		return "User not found", apperror.FromMongo(err, "user")
 	}
 
 	// Check if user already has onboarding settings
 	userSettings := collection.FindOne(ctx, bson.M{"_id": userId})
 	if userSettings.Err() == nil {
-		return "", errors.New("User already has onboarding settings")
+		return "", apperror.Conflict("User already has onboarding settings")
 	}
 
 	// Validate request
-	if err := validateSettingsRequest(request); err != nil {
+	if err := validateSettingsRequest(request, ctx); err != nil {
 		return "Invalid settings", err
 	}
 
 	// Create settings
-	settings, err := createEnabledSettings(request, userId)
+	settings, err := createEnabledSettings(request, userId, ctx)
 	if err != nil {
 		return "", err
 	}
 
 	// Insert settings
-	result, err := collection.InsertOne(ctx, settings)
-	if err != nil {
-		return result.InsertedID.(string), err
+	if _, err := collection.InsertOne(ctx, settings); err != nil {
+		return "", apperror.FromMongo(err, "settings")
 	}
 
-	return "Created", err
+	return "Created", nil
 }
 
 func (s *Storage) CreatePluginSettings(request SingleSetting, userId string, ctx context.Context) error {
@@ -240,7 +362,7 @@ func (s *Storage) CreatePluginSettings(request SingleSetting, userId string, ctx
 	// Check if user exists
 	user := userCollection.FindOne(ctx, bson.M{"_id": userId})
 	if err := user.Err(); err != nil {
-		return errors.New("User not found!")
+		return apperror.FromMongo(err, "user")
 	}
 
 	// Check if plugin exists
@@ -251,15 +373,16 @@ func (s *Storage) CreatePluginSettings(request SingleSetting, userId string, ctx
 	// Check if user already has onboarding settings
 	settings := collection.FindOne(ctx, bson.M{"_id": userId})
 	if settings.Err() != nil {
-		// Create new settings since the user has no settings yet
+		// Create new settings since the user has no settings yet,
+		// the plugin itself is enabled below
 		sett := SettingsDB{
 			ID:             userId,
-			EnabledPlugins: []PluginName{PluginName(pluginName)},
+			EnabledPlugins: []PluginName{},
 		}
 
 		// Insert the settings
 		if _, err := collection.InsertOne(ctx, sett); err != nil {
-			return err
+			return apperror.FromMongo(err, "settings")
 		}
 	}
 
@@ -269,13 +392,13 @@ func (s *Storage) CreatePluginSettings(request SingleSetting, userId string, ctx
 	// Create plugin settings and keep the other settings
 	var settingsRecord SettingsDB
 	if err := settings.Decode(&settingsRecord); err != nil {
-		return err
+		return apperror.FromMongo(err, "settings")
 	}
 
 	// Check if user already has the specified plugin settings
 	for _, plugin := range settingsRecord.EnabledPlugins {
 		if plugin == PluginName(pluginName) {
-			return errors.New("User already has " + pluginName + " settings")
+			return apperror.Conflict("User already has %s settings", pluginName)
 		}
 	}
 
@@ -291,7 +414,7 @@ func (s *Storage) CreatePluginSettings(request SingleSetting, userId string, ctx
 		})
 
 	if result.Err() != nil {
-		return result.Err()
+		return apperror.FromMongo(result.Err(), "settings")
 	}
 
 	return nil
@@ -304,13 +427,13 @@ func (s *Storage) UpdatePluginSettings(request SingleSetting, userId string, ctx
 	// Check if user already has the specified plugin settings
 	oldSettings := collection.FindOne(ctx, bson.M{"_id": userId, "enabledPlugins": pluginName})
 	if oldSettings.Err() != nil {
-		return "", errors.New("User does not have " + pluginName + " settings")
+		return "", apperror.NotFound("User does not have %s settings", pluginName)
 	}
 
 	// Update plugin settings
 	var settingsRecord SettingsDB
 	if err := oldSettings.Decode(&settingsRecord); err != nil {
-		return "", err
+		return "", apperror.FromMongo(err, "settings")
 	}
 
 	// Validate the request updates
@@ -320,7 +443,7 @@ func (s *Storage) UpdatePluginSettings(request SingleSetting, userId string, ctx
 	// Update the OnboardingSettings with the new settings
 	cursor := collection.FindOneAndUpdate(ctx, bson.M{"_id": userId}, bson.M{"$set": bson.M{pluginName: request}})
 	if cursor.Err() != nil {
-		return "", cursor.Err()
+		return "", apperror.FromMongo(cursor.Err(), "settings")
 	}
 
 	return "Updated", nil
@@ -332,29 +455,28 @@ func (s *Storage) Delete(userId string, plugin string, ctx context.Context) erro
 	// Check if user exists
 	userResult := collection.FindOne(ctx, bson.M{"_id": userId})
 	if userResult.Err() != nil {
-		log.Println(userResult.Err())
-		return errors.New("No plugin-settings found for user")
+		return apperror.NotFound("No plugin-settings found for user")
 	}
 
 	// Delete all settings, if no plugin is specified
 	if plugin == "" {
 		_, err := collection.DeleteOne(ctx, bson.M{"_id": userId})
 		if err != nil {
-			return err
+			return apperror.FromMongo(err, "settings")
 		}
 		return nil
 	}
 
 	// Validate plugin name
 	if !isValidPlugins(plugin) {
-		return errors.New("Invalid plugin name")
+		return apperror.Validation("Invalid plugin name")
 	}
 
 	// Load settings
 	var sdb SettingsDB
 	err := userResult.Decode(&sdb)
 	if err != nil {
-		return err
+		return apperror.FromMongo(err, "settings")
 	}
 
 	// Check if plugin is enabled
@@ -381,7 +503,7 @@ func (s *Storage) Delete(userId string, plugin string, ctx context.Context) erro
 	// Update the settings
 	_, err = collection.UpdateOne(ctx, bson.M{"_id": userId}, update)
 	if err != nil {
-		return err
+		return apperror.FromMongo(err, "settings")
 	}
 
 	// If no plugins are left, delete the entire user settings
@@ -389,35 +511,35 @@ func (s *Storage) Delete(userId string, plugin string, ctx context.Context) erro
 	if len(sdb.EnabledPlugins)-1 == 0 {
 		_, err := collection.DeleteOne(ctx, bson.M{"_id": userId})
 		if err != nil {
-			return err
+			return apperror.FromMongo(err, "settings")
 		}
 	}
 
 	return nil
 }
 
-func validateSettingsRequest(request CreateSettingsRequest) error {
+func validateSettingsRequest(request CreateSettingsRequest, ctx context.Context) error {
 	if !isValidPlugins(request.EnabledPlugins) {
-		return errors.New("Invalid enabled plugin ")
+		return apperror.Validation("Invalid enabled plugin ")
 	}
 
 	for _, v := range request.EnabledPlugins {
 		pluginCap, ok := pluginNameToCap[PluginName(v)]
 		if !ok {
-			return errors.New("Invalid plugin name: " + string(v))
+			return apperror.Validation("Invalid plugin name: %s", v)
 		}
 
 		// Validate field if present
 		field := reflect.ValueOf(request).FieldByName(string(pluginCap))
 		if field.CanInterface() {
-			log.Println("Validating field: ", field.Type())
+			logging.FromContext(ctx).Debug("validating field", "type", field.Type().String())
 			singset, ok := field.Interface().(SingleSetting)
 			if !ok {
-				return errors.New("Invalid field type: " + string(pluginCap) + " is not a SingleSetting")
+				return apperror.Internal("Invalid field type: "+pluginCap+" is not a SingleSetting", nil)
 			}
 
 			if err := singset.validate(); err != nil {
-				return err
+				return prefixFields(err, string(v))
 			}
 		}
 
@@ -425,17 +547,31 @@ func validateSettingsRequest(request CreateSettingsRequest) error {
 	return nil
 }
 
-func createEnabledSettings(request CreateSettingsRequest, userId string) (SettingsDB, error) {
+// prefixes the field errors of one plugin in an onboarding request, e.g. meditation.goal
+func prefixFields(err error, plugin string) error {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) || len(appErr.Fields) == 0 {
+		return err
+	}
+
+	fields := make([]apperror.FieldError, len(appErr.Fields))
+	for i, field := range appErr.Fields {
+		fields[i] = apperror.FieldError{Field: plugin + "." + field.Field, Message: field.Message}
+	}
+	return apperror.InvalidFields(fields)
+}
+
+func createEnabledSettings(request CreateSettingsRequest, userId string, ctx context.Context) (SettingsDB, error) {
 	settingsDB := SettingsDB{ID: userId, EnabledPlugins: request.EnabledPlugins}
 
 	for _, v := range request.EnabledPlugins {
 		pluginCap, ok := pluginNameToCap[PluginName(v)]
 		if !ok {
-			return settingsDB, errors.New("Invalid plugin name: " + string(v))
+			return settingsDB, apperror.Validation("Invalid plugin name: %s", v)
 		}
 
 		if srcField := reflect.ValueOf(request).FieldByName(string(pluginCap)); srcField.CanInterface() {
-			log.Println("Validating src-field: ", srcField.Type())
+			logging.FromContext(ctx).Debug("copying field", "type", srcField.Type().String())
 			dstField := reflect.ValueOf(&settingsDB).Elem().FieldByName(string(pluginCap))
 			dstField.Set(srcField)
 		}
@@ -470,6 +606,14 @@ func isValidPlugins(plugin interface{}) bool {
 	}
 }
 
+// checks the notification fields every plugin setting has
+func checkNotifications(setting SingleSetting, amount int) validation.Errors {
+	var errs validation.Errors
+	errs.Check(isValidNotificationType(setting), "periodNotifications", "must be one of %s, %s, %s", NotificationTypeDay, NotificationTypeWeek, NotificationTypeMonth)
+	errs.Check(validation.InRange(int64(amount), 0, maxAmountNotifications), "amountNotifications", "must be between 0 and %d", maxAmountNotifications)
+	return errs
+}
+
 func isValidNotificationType(setting SingleSetting) bool {
 	notifications := setting.getPeriodNotifications()
 	switch notifications {
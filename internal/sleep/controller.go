@@ -0,0 +1,244 @@
+package sleep
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/calendar"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Controller struct {
+	storage         *Storage
+	userStorage     *user.Storage
+	progressStorage *progress.Storage
+	settingsStorage *settings.Storage
+}
+
+func NewController(storage *Storage, userStorage *user.Storage, progressStorage *progress.Storage, settingsStorage *settings.Storage) *Controller {
+	return &Controller{
+		storage:         storage,
+		userStorage:     userStorage,
+		progressStorage: progressStorage,
+		settingsStorage: settingsStorage,
+	}
+}
+
+type CreateSleepRequest struct {
+	// unix seconds on the client
+	BedTime  int64 `json:"bedTime" bson:"bedTime"`
+	WakeTime int64 `json:"wakeTime" bson:"wakeTime"`
+	// from 1 (bad) to 5 (great)
+	Quality int `json:"quality" bson:"quality"`
+}
+
+// limits of one night
+const (
+	maxQuality = 5
+	maxSleep   = 24 * time.Hour
+)
+
+func (r CreateSleepRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(validation.IsClientTime(r.BedTime), "bedTime", "must be a unix time of the last %d days", int(validation.MaxClientAge.Hours()/24))
+	errs.Check(validation.IsClientTime(r.WakeTime), "wakeTime", "must be a unix time of the last %d days", int(validation.MaxClientAge.Hours()/24))
+	errs.Check(validation.InRange(r.WakeTime-r.BedTime, 1, int64(maxSleep.Seconds())), "wakeTime", "must be after bedTime and at most %d hours later", int(maxSleep.Hours()))
+	errs.Check(validation.InRange(int64(r.Quality), 1, maxQuality), "quality", "must be between 1 and %d", maxQuality)
+	return errs.Err()
+}
+
+// Duration is the time slept in minutes
+func (r CreateSleepRequest) Duration() int {
+	return int((r.WakeTime - r.BedTime) / 60)
+}
+
+type createSleepResponse struct {
+	ID string `json:"id"`
+}
+
+type debtResponse struct {
+	// first and last second of the period
+	StartTime int64 `json:"startTime"`
+	EndTime   int64 `json:"endTime"`
+	// current sleep time goal of the user
+	Goal int `json:"goal"`
+	DebtDB
+}
+
+// goal returns the sleep time goal of a user, users without sleep settings get the default
+func (t *Controller) goal(userId string, ctx context.Context) (int, error) {
+	userSettings, err := t.settingsStorage.Get(userId, string(settings.PluginNameSleep), ctx)
+	if apperror.IsNotFound(err) {
+		return settings.DefaultSleepTimeGoal, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if userSettings.Sleep.SleepTimeGoal == 0 {
+		return settings.DefaultSleepTimeGoal, nil
+	}
+	return userSettings.Sleep.SleepTimeGoal, nil
+}
+
+// @Summary Create sleep.
+// @Description Creates a new night of sleep, it must not overlap another night of the user.
+// @Tags sleep
+// @Accept */*
+// @Produce json
+// @Param sleep body CreateSleepRequest true "Sleep to create"
+// @Param userId header string true "User ID"
+// @Success 200 {object} createSleepResponse
+// @Router /sleep [post]
+func (t *Controller) create(c *fiber.Ctx) error {
+	req := validation.Parsed[CreateSleepRequest](c)
+
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	//check if user exists
+	_, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	goal, err := t.goal(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	// Create sleep record
+	id, err := t.storage.Create(req, goal, userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	err = t.progressStorage.AddExperience(userId, c.UserContext(), settings.PluginNameSleep, progress.SleepExperience(req.Duration(), goal))
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(createSleepResponse{
+		ID: id,
+	})
+}
+
+// @Summary Get sleep
+// @Description Fetch one or multiple nights of sleep.
+// @Tags sleep
+// @Param id query string false "Sleep ID"
+// @Param startTime query int64 false "start time"
+// @Param endTime query int64 false "end time"
+// @Param durationStart query int64 false "minimum duration in minutes"
+// @Param durationEnd query int64 false "maximum duration in minutes"
+// @Param period query string false "day, week or month in the time zone of the user, replaces start and end time"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []SleepDB
+// @Router /sleep [Get]
+func (t *Controller) get(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	//parse Query values
+	sleepId := c.Query("id")
+	//map for time parameters
+	times := map[string]int64{
+		"startTime":     convertToInt64(c.Query("startTime")),
+		"endTime":       convertToInt64(c.Query("endTime")),
+		"durationStart": convertToInt64(c.Query("durationStart")),
+		"durationEnd":   convertToInt64(c.Query("durationEnd")),
+	}
+	if sleepId != "" {
+		// Get particular night, the nights of other users are private
+		night, err := t.storage.Get(sleepId, c.UserContext())
+		if err != nil {
+			return err
+		}
+		if night.UserID != userId {
+			return apperror.NotFound("sleep does not exist")
+		}
+		// convert to array
+		return c.Status(fiber.StatusOK).JSON([]SleepDB{night})
+	}
+
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	// a period of the user's calendar replaces start and end time
+	if period := c.Query("period"); period != "" {
+		times["startTime"], times["endTime"], err = profile.Calendar().Range(calendar.Period(period), c.Query("date"), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	// all nights of a user between a time range and duration
+	nights, err := t.storage.GetAllOfOneUserBetweenTimeAndDuration(userId, times, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(nights)
+}
+
+// @Summary Get sleep debt
+// @Description Sum of the sleep missing to the sleep time goal within a period of the user's calendar.
+// @Tags sleep
+// @Param period query string false "day, week or month, defaults to week"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} debtResponse
+// @Router /sleep/debt [Get]
+func (t *Controller) debt(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	period := calendar.Period(c.Query("period", string(calendar.PeriodWeek)))
+	startTime, endTime, err := profile.Calendar().Range(period, c.Query("date"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	goal, err := t.goal(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	debt, err := t.storage.GetDebt(userId, startTime, endTime, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(debtResponse{
+		StartTime: startTime,
+		EndTime:   endTime,
+		Goal:      goal,
+		DebtDB:    debt,
+	})
+}
+
+func convertToInt64(value string) int64 {
+	intValue, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return intValue
+}
@@ -0,0 +1,19 @@
+package sleep
+
+import (
+	"cmd/http/main.go/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// idempotent guards the create route against duplicates from client retries
+func Routes(app fiber.Router, controller *Controller, idempotent fiber.Handler) {
+	sleep := app.Group("/sleep")
+
+	// add middlewares here
+
+	// add routes here
+	sleep.Post("/", idempotent, validation.Body[CreateSleepRequest](), controller.create)
+	sleep.Get("/", controller.get)
+	sleep.Get("/debt", controller.debt)
+}
@@ -0,0 +1,340 @@
+package sleep
+
+import (
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/idempotency"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Suite struct {
+	suite.Suite
+	app           *fiber.App
+	store         *Storage
+	userStore     *user.Storage
+	settingsStore *settings.Storage
+	testUserId    string
+	sleepId       string
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-sleep"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	userStore := user.NewStorage(db)
+	suite.userStore = userStore
+	suite.settingsStore = settings.NewStorage(db)
+
+	suite.store = NewStorage(db)
+	sleepCont := NewController(suite.store, userStore, progress.NewStorage(db), suite.settingsStore)
+	Routes(app, sleepCont, idempotency.New(idempotency.NewStorage(db)))
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	for _, collection := range []string{"users", "sleep", "settings", "progress"} {
+		if err := suite.store.db.Collection(collection).Drop(context.Background()); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+
+	// create a test user (just for userId purposes)
+	testId := "testId"
+	_, err := suite.userStore.Create(user.CreateUserRequest{
+		ID:        testId,
+		FirstName: "test",
+		LastName:  "testId",
+	}, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test user: %v", err)
+	}
+
+	suite.testUserId = testId
+
+	// create a test night of seven hours
+	wakeTime := time.Now().Add(-time.Hour)
+	sleepId, err := suite.store.Create(CreateSleepRequest{
+		BedTime:  wakeTime.Add(-7 * time.Hour).Unix(),
+		WakeTime: wakeTime.Unix(),
+		Quality:  3,
+	}, settings.DefaultSleepTimeGoal, testId, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test sleep: %v", err)
+	}
+
+	suite.sleepId = sleepId
+}
+
+// night is the night before the test night of BeforeTest
+func night(hours time.Duration, quality int) CreateSleepRequest {
+	return nightUntil(time.Now().Add(-9*time.Hour), hours, quality)
+}
+
+func nightUntil(wakeTime time.Time, hours time.Duration, quality int) CreateSleepRequest {
+	return CreateSleepRequest{
+		BedTime:  wakeTime.Add(-hours * time.Hour).Unix(),
+		WakeTime: wakeTime.Unix(),
+		Quality:  quality,
+	}
+}
+
+func (suite *Suite) TestPost() {
+	route := "/sleep"
+
+	tests := []struct {
+		missingHeader bool
+		userId        string
+		description   string
+		expectedCode  int
+		body          interface{}
+	}{
+		{
+			description:  "Create successfully",
+			body:         night(8, 4),
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "User does not exist",
+			userId:       "doesntexist",
+			body:         night(8, 4),
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "Missing userId header",
+			missingHeader: true,
+			body:          night(8, 4),
+			expectedCode:  fiber.StatusBadRequest,
+		},
+		{
+			description:  "Wake time before bed time",
+			body:         night(-2, 4),
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Missing times",
+			body:         CreateSleepRequest{Quality: 4},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Quality out of scale",
+			body:         night(8, 6),
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Overlaps the test night",
+			body:         nightUntil(time.Now().Add(-3*time.Hour), 4, 4),
+			expectedCode: fiber.StatusConflict,
+		},
+	}
+
+	for _, test := range tests {
+		bodyJson, err := json.Marshal(test.body)
+		if err != nil {
+			suite.T().Errorf("Could not marshal sleep: %v", err)
+		}
+
+		req := httptest.NewRequest("POST", route, bytes.NewReader(bodyJson))
+
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		} else {
+			req.Header.Set("userId", suite.testUserId)
+		}
+
+		if test.missingHeader {
+			req.Header.Del("userId")
+		}
+
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+func (suite *Suite) TestGoalAndExperience() {
+	// a goal of six hours from the settings
+	err := suite.settingsStore.CreatePluginSettings(settings.SleepSettings{
+		PeriodNotifications: settings.NotificationTypeDay,
+		SleepTimeGoal:       6 * 60,
+	}, suite.testUserId, context.Background())
+	suite.NoError(err)
+
+	// two nights of a past day, apart from the night of BeforeTest
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+	for i, request := range []CreateSleepRequest{
+		nightUntil(day.Add(8*time.Hour), 7, 4),
+		nightUntil(day.Add(18*time.Hour), 5, 2),
+	} {
+		bodyJson, _ := json.Marshal(request)
+		req := httptest.NewRequest("POST", "/sleep", bytes.NewReader(bodyJson))
+		req.Header.Set("userId", suite.testUserId)
+		resp, err := suite.app.Test(req, -1)
+		suite.NoError(err)
+		suite.Equal(fiber.StatusCreated, resp.StatusCode)
+
+		if i == 0 {
+			var progressDB progress.Db
+			err = suite.store.db.Collection("progress").FindOne(context.Background(), bson.M{"_id": suite.testUserId}).Decode(&progressDB)
+			suite.NoError(err)
+			suite.Equal(float64(10), progressDB.Experience[settings.PluginNameSleep])
+		}
+	}
+
+	// the first night beat the goal by one hour, the second one missed it by one hour
+	req := httptest.NewRequest("GET", "/sleep/debt?period=day&date="+day.Format("2006-01-02"), nil)
+	req.Header.Set("userId", suite.testUserId)
+	resp, err := suite.app.Test(req, -1)
+	suite.NoError(err)
+	suite.Equal(fiber.StatusOK, resp.StatusCode)
+
+	var debt debtResponse
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&debt))
+	suite.Equal(6*60, debt.Goal)
+	suite.Equal(2, debt.Nights)
+	suite.Equal(12*60, debt.Duration)
+	suite.Equal(0, debt.Debt)
+}
+
+func (suite *Suite) TestGet() {
+	route := "/sleep"
+
+	tests := []struct {
+		missingHeader bool
+		userId        string
+		description   string
+		expectedCode  int
+		query         map[string]string
+	}{
+		{
+			description:  "simple test one",
+			query:        map[string]string{"id": suite.sleepId},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "nights of at least six hours",
+			query:        map[string]string{"durationStart": "360"},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "this week",
+			query:        map[string]string{"period": "week"},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "invalid period",
+			query:        map[string]string{"period": "night"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "id does not exist",
+			query:        map[string]string{"id": "nonexistingid"},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:  "id of another user",
+			userId:       "otherId",
+			query:        map[string]string{"id": suite.sleepId},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "id without userId header",
+			missingHeader: true,
+			query:         map[string]string{"id": suite.sleepId},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+		{
+			description:  "User does not exist",
+			userId:       "doesntexist",
+			query:        map[string]string{},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "Missing userId header",
+			missingHeader: true,
+			query:         map[string]string{},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		url := url.URL{
+			Path: route,
+		}
+
+		// Add query
+		q := url.Query()
+		for key, value := range test.query {
+			q.Add(key, value)
+		}
+		url.RawQuery = q.Encode()
+
+		req := httptest.NewRequest("GET", url.String(), nil)
+
+		// Add header
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		} else {
+			req.Header.Set("userId", suite.testUserId)
+		}
+
+		if test.missingHeader {
+			req.Header.Del("userId")
+		}
+
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestSleepTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
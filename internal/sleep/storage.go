@@ -0,0 +1,203 @@
+package sleep
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SleepDB struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID string             `json:"userId" bson:"userId"`
+	// unix seconds of the client
+	BedTime  int64 `json:"bedTime" bson:"bedTime"`
+	WakeTime int64 `json:"wakeTime" bson:"wakeTime"`
+	// minutes between bed and wake time
+	Duration int `json:"duration" bson:"duration"`
+	// from 1 (bad) to 5 (great)
+	Quality int `json:"quality" bson:"quality"`
+	// sleep time goal of the user for this night, debt is goal minus duration
+	Goal int `json:"goal" bson:"goal"`
+	Debt int `json:"debt" bson:"debt"`
+	// unix seconds when the server stored the night
+	ServerTime int64 `json:"serverTime" bson:"serverTime"`
+	// health platform of imported nights, their quality is 0
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+}
+
+// DebtDB sums up the nights of a period
+type DebtDB struct {
+	Nights   int `json:"nights" bson:"nights"`
+	Duration int `json:"duration" bson:"duration"`
+	// positive if the user slept less than the goals
+	Debt int `json:"debt" bson:"debt"`
+}
+
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+// EnsureIndexes creates the index for range queries
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	collection := s.db.Collection("sleep")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "wakeTime", Value: 1}},
+	})
+	return err
+}
+
+func (s *Storage) Create(request CreateSleepRequest, goal int, userId string, ctx context.Context) (string, error) {
+	collection := s.db.Collection("sleep")
+
+	duration := request.Duration()
+	night := SleepDB{
+		ID:         primitive.NewObjectID(),
+		UserID:     userId,
+		BedTime:    request.BedTime,
+		WakeTime:   request.WakeTime,
+		Duration:   duration,
+		Quality:    request.Quality,
+		Goal:       goal,
+		Debt:       goal - duration,
+		ServerTime: time.Now().Unix(),
+	}
+
+	// nights of the same user cannot overlap, else the sleep would be counted twice
+	overlapping, err := collection.CountDocuments(ctx, bson.M{"userId": userId, "bedTime": bson.M{"$lt": night.WakeTime}, "wakeTime": bson.M{"$gt": night.BedTime}})
+	if err != nil {
+		return "", apperror.FromMongo(err, "sleep")
+	}
+	if overlapping > 0 {
+		return "", apperror.Conflict("sleep overlaps another night")
+	}
+
+	result, err := collection.InsertOne(ctx, night)
+	if err != nil {
+		return "", apperror.FromMongo(err, "sleep")
+	}
+
+	// convert the object id to a string
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// CreateImported stores nights of a health platform, nights of the same user,
+// source and bed time as an earlier import are skipped
+func (s *Storage) CreateImported(nights []SleepDB, ctx context.Context) (int, error) {
+	collection := s.db.Collection("sleep")
+	if len(nights) == 0 {
+		return 0, nil
+	}
+
+	first := nights[0]
+	bedTimes := make(bson.A, 0, len(nights))
+	for _, night := range nights {
+		bedTimes = append(bedTimes, night.BedTime)
+	}
+	existing, err := collection.Distinct(ctx, "bedTime", bson.M{"userId": first.UserID, "source": first.Source, "bedTime": bson.M{"$in": bedTimes}})
+	if err != nil {
+		return 0, apperror.FromMongo(err, "sleep")
+	}
+	imported := make(map[int64]bool, len(existing))
+	for _, bedTime := range existing {
+		if value, ok := bedTime.(int64); ok {
+			imported[value] = true
+		}
+	}
+
+	documents := make([]interface{}, 0, len(nights))
+	for _, night := range nights {
+		if imported[night.BedTime] {
+			continue
+		}
+		imported[night.BedTime] = true
+		documents = append(documents, night)
+	}
+	if len(documents) == 0 {
+		return 0, nil
+	}
+
+	if _, err := collection.InsertMany(ctx, documents); err != nil {
+		return 0, apperror.FromMongo(err, "sleep")
+	}
+	return len(documents), nil
+}
+
+func (s *Storage) Get(sleepID string, ctx context.Context) (SleepDB, error) {
+	collection := s.db.Collection("sleep")
+	sleepRecord := SleepDB{}
+
+	// an id that is no object id cannot exist
+	objectID, err := primitive.ObjectIDFromHex(sleepID)
+	if err != nil {
+		return sleepRecord, apperror.NotFound("sleep does not exist")
+	}
+
+	cursor := collection.FindOne(ctx, bson.M{"_id": objectID})
+	if err := cursor.Decode(&sleepRecord); err != nil {
+		return sleepRecord, apperror.FromMongo(err, "sleep")
+	}
+	return sleepRecord, nil
+}
+
+// GetAllOfOneUserBetweenTimeAndDuration returns the nights of a user that
+// ended between startTime and endTime with a duration in minutes between
+// durationStart and durationEnd
+func (s *Storage) GetAllOfOneUserBetweenTimeAndDuration(userId string, times map[string]int64, ctx context.Context) ([]SleepDB, error) {
+	collection := s.db.Collection("sleep")
+	if times["endTime"] == 0 {
+		times["endTime"] = time.Now().Unix()
+	}
+	if times["durationEnd"] == 0 {
+		times["durationEnd"] = math.MaxInt64
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"userId": userId, "wakeTime": bson.M{"$gte": times["startTime"], "$lte": times["endTime"]}, "duration": bson.M{"$gte": times["durationStart"], "$lte": times["durationEnd"]}})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "sleep")
+	}
+
+	nights := make([]SleepDB, 0)
+	if err := cursor.All(ctx, &nights); err != nil {
+		return nil, apperror.FromMongo(err, "sleep")
+	}
+	return nights, nil
+}
+
+// GetDebt sums up the nights of a user that ended between startTime and endTime
+func (s *Storage) GetDebt(userId string, startTime int64, endTime int64, ctx context.Context) (DebtDB, error) {
+	collection := s.db.Collection("sleep")
+
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"userId": userId, "wakeTime": bson.M{"$gte": startTime, "$lte": endTime}}},
+		bson.M{"$group": bson.M{
+			"_id":      nil,
+			"nights":   bson.M{"$sum": 1},
+			"duration": bson.M{"$sum": "$duration"},
+			"debt":     bson.M{"$sum": "$debt"},
+		}},
+	})
+	if err != nil {
+		return DebtDB{}, apperror.FromMongo(err, "sleep")
+	}
+
+	var debts []DebtDB
+	if err := cursor.All(ctx, &debts); err != nil {
+		return DebtDB{}, apperror.FromMongo(err, "sleep")
+	}
+	// no nights in the period
+	if len(debts) == 0 {
+		return DebtDB{}, nil
+	}
+	return debts[0], nil
+}
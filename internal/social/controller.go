@@ -0,0 +1,489 @@
+package social
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/audit"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Controller struct {
+	storage         *Storage
+	userStorage     *user.Storage
+	progressStorage *progress.Storage
+}
+
+func NewController(storage *Storage, userStorage *user.Storage, progressStorage *progress.Storage) *Controller {
+	return &Controller{
+		storage:         storage,
+		userStorage:     userStorage,
+		progressStorage: progressStorage,
+	}
+}
+
+type CreateFriendRequest struct {
+	FriendID string `json:"friendId"`
+}
+
+func (r CreateFriendRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(r.FriendID != "", "friendId", "must not be empty")
+	return errs.Err()
+}
+
+type UpdatePrivacyRequest struct {
+	Plugins map[settings.PluginName]Sharing `json:"plugins"`
+	// nil keeps the opt-in of the leaderboards
+	Leaderboards *bool `json:"leaderboards"`
+}
+
+func (r UpdatePrivacyRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(len(r.Plugins) > 0 || r.Leaderboards != nil, "plugins", "must not be empty")
+	for plugin, sharing := range r.Plugins {
+		errs.Check(plugin.IsValid(), "plugins."+string(plugin), "is no plugin")
+		errs.Check(sharing.IsValid(), "plugins."+string(plugin), "must be one of %s, %s, %s", SharingNone, SharingLevel, SharingExperience)
+	}
+	return errs.Err()
+}
+
+// friendResponse is the part of a user that friends see
+type friendResponse struct {
+	ID        string `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	// unix seconds when the request was sent or accepted
+	Since int64 `json:"since"`
+}
+
+type requestsResponse struct {
+	Incoming []friendResponse `json:"incoming"`
+	Outgoing []friendResponse `json:"outgoing"`
+}
+
+type sharedProgress struct {
+	Level int `json:"level"`
+	// only if the friend shares the experience
+	Experience *float64 `json:"experience,omitempty"`
+}
+
+type feedItem struct {
+	progress.EventDB
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+// events of a feed page
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+)
+
+func userID(c *fiber.Ctx) (string, error) {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return "", apperror.Validation("Missing userId header")
+	}
+	return userId, nil
+}
+
+// friendsOf returns the friendships of a user as friends, newest first
+func (t *Controller) friendsOf(userId string, friendships []FriendshipDB, since func(FriendshipDB) int64, ctx context.Context) ([]friendResponse, error) {
+	ids := make([]string, 0, len(friendships))
+	for _, friendship := range friendships {
+		ids = append(ids, friendship.Other(userId))
+	}
+	users, err := t.userStorage.GetMany(ids, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	friends := make([]friendResponse, 0, len(friendships))
+	for _, friendship := range friendships {
+		friend, ok := users[friendship.Other(userId)]
+		if !ok {
+			continue
+		}
+		friends = append(friends, friendResponse{
+			ID:        friend.ID,
+			FirstName: friend.FirstName,
+			LastName:  friend.LastName,
+			Since:     since(friendship),
+		})
+	}
+	return friends, nil
+}
+
+// @Summary Get friends
+// @Description Fetch the accepted friends of a user.
+// @Tags social
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []friendResponse
+// @Router /social/friends [get]
+func (t *Controller) getFriends(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	friendships, err := t.storage.GetAllOfOneUser(userId, FriendshipStatusAccepted, c.UserContext())
+	if err != nil {
+		return err
+	}
+	friends, err := t.friendsOf(userId, friendships, func(f FriendshipDB) int64 { return f.AcceptedAt }, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(friends)
+}
+
+// @Summary Get friend requests
+// @Description Fetch the pending friend requests a user received and sent.
+// @Tags social
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} requestsResponse
+// @Router /social/requests [get]
+func (t *Controller) getRequests(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	friendships, err := t.storage.GetAllOfOneUser(userId, FriendshipStatusPending, c.UserContext())
+	if err != nil {
+		return err
+	}
+	var incoming, outgoing []FriendshipDB
+	for _, friendship := range friendships {
+		if friendship.Addressee == userId {
+			incoming = append(incoming, friendship)
+		} else {
+			outgoing = append(outgoing, friendship)
+		}
+	}
+
+	createdAt := func(f FriendshipDB) int64 { return f.CreatedAt }
+	response := requestsResponse{}
+	if response.Incoming, err = t.friendsOf(userId, incoming, createdAt, c.UserContext()); err != nil {
+		return err
+	}
+	if response.Outgoing, err = t.friendsOf(userId, outgoing, createdAt, c.UserContext()); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// @Summary Send a friend request
+// @Description Sends a friend request, a pending request of the other user is accepted instead.
+// @Tags social
+// @Accept json
+// @Param request body CreateFriendRequest true "friend to request"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 201 {object} FriendshipDB
+// @Router /social/requests [post]
+func (t *Controller) createRequest(c *fiber.Ctx) error {
+	req := validation.Parsed[CreateFriendRequest](c)
+
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+	if req.FriendID == userId {
+		return apperror.Validation("friendId must not be the user")
+	}
+
+	//check if both users exist
+	if _, err := t.userStorage.Get(userId, c.UserContext()); err != nil {
+		return err
+	}
+	if _, err := t.userStorage.Get(req.FriendID, c.UserContext()); err != nil {
+		return err
+	}
+
+	existing, err := t.storage.Get(userId, req.FriendID, c.UserContext())
+	switch {
+	case apperror.IsNotFound(err):
+	case err != nil:
+		return err
+	case existing.Status == FriendshipStatusPending && existing.Addressee == userId:
+		friendship, err := t.storage.Accept(userId, req.FriendID, c.UserContext())
+		if err != nil {
+			return err
+		}
+		return c.Status(fiber.StatusOK).JSON(friendship)
+	case existing.Status == FriendshipStatusPending:
+		return apperror.Conflict("friend request already sent")
+	default:
+		return apperror.Conflict("already friends")
+	}
+
+	friendship, err := t.storage.CreateRequest(userId, req.FriendID, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(friendship)
+}
+
+// @Summary Accept a friend request
+// @Tags social
+// @Param friendId path string true "User ID of the requester"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} FriendshipDB
+// @Router /social/requests/{friendId}/accept [post]
+func (t *Controller) acceptRequest(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	friendship, err := t.storage.Accept(userId, c.Params("friendId"), c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(friendship)
+}
+
+// @Summary Decline a friend request
+// @Tags social
+// @Param friendId path string true "User ID of the requester"
+// @Param userId header string true "User ID"
+// @Success 204
+// @Router /social/requests/{friendId}/decline [post]
+func (t *Controller) declineRequest(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	err = t.storage.Delete(userId, c.Params("friendId"), bson.M{"addressee": userId, "status": FriendshipStatusPending}, c.UserContext())
+	if err != nil {
+		return err
+	}
+	logDelete(c, "friendRequests.decline", userId, c.Params("friendId"))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// logDelete adds a deleted friendship to the audit log, the friend is the target
+func logDelete(c *fiber.Ctx, action string, userId string, friendId string) {
+	audit.Log(c, audit.EntryDB{
+		TargetID:   friendId,
+		Action:     action,
+		EntityType: "friendship",
+		EntityID:   friendshipID(userId, friendId),
+	})
+}
+
+// @Summary Cancel a friend request
+// @Tags social
+// @Param friendId path string true "User ID of the addressee"
+// @Param userId header string true "User ID"
+// @Success 204
+// @Router /social/requests/{friendId} [delete]
+func (t *Controller) cancelRequest(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	err = t.storage.Delete(userId, c.Params("friendId"), bson.M{"requester": userId, "status": FriendshipStatusPending}, c.UserContext())
+	if err != nil {
+		return err
+	}
+	logDelete(c, "friendRequests.cancel", userId, c.Params("friendId"))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @Summary Remove a friend
+// @Tags social
+// @Param friendId path string true "User ID of the friend"
+// @Param userId header string true "User ID"
+// @Success 204
+// @Router /social/friends/{friendId} [delete]
+func (t *Controller) removeFriend(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	err = t.storage.Delete(userId, c.Params("friendId"), bson.M{"status": FriendshipStatusAccepted}, c.UserContext())
+	if err != nil {
+		return err
+	}
+	logDelete(c, "friends.remove", userId, c.Params("friendId"))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @Summary Get the progress of a friend
+// @Description The level of the plugins a friend shares, and the experience if shared. Only accepted friends can read it.
+// @Tags social
+// @Param friendId path string true "User ID of the friend"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} map[string]sharedProgress
+// @Router /social/friends/{friendId}/progress [get]
+func (t *Controller) getFriendProgress(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+	friendId := c.Params("friendId")
+
+	// users that are no friends do not exist for each other
+	friends, err := t.storage.AreFriends(userId, friendId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	if !friends {
+		return apperror.NotFound("friend does not exist")
+	}
+
+	privacy, err := t.storage.GetPrivacy(friendId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	experience, err := t.progressStorage.GetExperience(friendId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	shared := make(map[settings.PluginName]sharedProgress)
+	for _, plugin := range privacy.Visible() {
+		points := experience[plugin]
+		progress := sharedProgress{Level: progress.Level(points)}
+		if privacy.Sharing(plugin) == SharingExperience {
+			progress.Experience = &points
+		}
+		shared[plugin] = progress
+	}
+	return c.Status(fiber.StatusOK).JSON(shared)
+}
+
+// @Summary Get the feed
+// @Description Level ups and achievements of friends in the plugins they share, newest first.
+// @Tags social
+// @Param before query int64 false "unix time, only older events, defaults to now"
+// @Param limit query int false "events per page, defaults to 20, at most 100"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []feedItem
+// @Router /social/feed [get]
+func (t *Controller) getFeed(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	var errs validation.Errors
+	before := int64(c.QueryInt("before", int(time.Now().Unix()+1)))
+	limit := c.QueryInt("limit", defaultFeedLimit)
+	errs.Check(before > 0, "before", "must be a unix time")
+	errs.Check(validation.InRange(int64(limit), 1, maxFeedLimit), "limit", "must be between 1 and %d", maxFeedLimit)
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	friendships, err := t.storage.GetAllOfOneUser(userId, FriendshipStatusAccepted, c.UserContext())
+	if err != nil {
+		return err
+	}
+	friendIds := make([]string, 0, len(friendships))
+	for _, friendship := range friendships {
+		friendIds = append(friendIds, friendship.Other(userId))
+	}
+
+	privacy, err := t.storage.GetPrivacyOfUsers(friendIds, c.UserContext())
+	if err != nil {
+		return err
+	}
+	visible := make(map[string][]settings.PluginName, len(privacy))
+	for friendId, friendPrivacy := range privacy {
+		visible[friendId] = friendPrivacy.Visible()
+	}
+
+	events, err := t.progressStorage.GetEvents(visible, before, int64(limit), c.UserContext())
+	if err != nil {
+		return err
+	}
+	users, err := t.userStorage.GetMany(friendIds, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	feed := make([]feedItem, 0, len(events))
+	for _, event := range events {
+		friend := users[event.UserID]
+		feed = append(feed, feedItem{EventDB: event, FirstName: friend.FirstName, LastName: friend.LastName})
+	}
+	return c.Status(fiber.StatusOK).JSON(feed)
+}
+
+// @Summary Get the privacy settings
+// @Description What friends see of each plugin, plugins without a setting are not shared, and the opt-in to the leaderboards.
+// @Tags social
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} PrivacyDB
+// @Router /social/privacy [get]
+func (t *Controller) getPrivacy(c *fiber.Ctx) error {
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	privacy, err := t.storage.GetPrivacy(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(privacy)
+}
+
+// @Summary Update the privacy settings
+// @Description Sets what friends see of the given plugins (none, level or experience), other plugins keep their setting, and the opt-in to the leaderboards.
+// @Tags social
+// @Accept json
+// @Param privacy body UpdatePrivacyRequest true "sharing per plugin"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} PrivacyDB
+// @Router /social/privacy [put]
+func (t *Controller) updatePrivacy(c *fiber.Ctx) error {
+	req := validation.Parsed[UpdatePrivacyRequest](c)
+
+	userId, err := userID(c)
+	if err != nil {
+		return err
+	}
+
+	//check if user exists
+	if _, err := t.userStorage.Get(userId, c.UserContext()); err != nil {
+		return err
+	}
+
+	before, err := t.storage.GetPrivacy(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	privacy, err := t.storage.UpdatePrivacy(userId, req, c.UserContext())
+	if err != nil {
+		return err
+	}
+	audit.Log(c, audit.EntryDB{
+		TargetID:   userId,
+		Action:     "privacy.update",
+		EntityType: "privacy",
+		EntityID:   userId,
+		Changes:    audit.Diff(before, privacy),
+	})
+	return c.Status(fiber.StatusOK).JSON(privacy)
+}
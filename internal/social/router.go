@@ -0,0 +1,26 @@
+package social
+
+import (
+	"cmd/http/main.go/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func Routes(app fiber.Router, controller *Controller) {
+	social := app.Group("/social")
+
+	// add middlewares here
+
+	// add routes here
+	social.Get("/friends", controller.getFriends)
+	social.Delete("/friends/:friendId", controller.removeFriend)
+	social.Get("/friends/:friendId/progress", controller.getFriendProgress)
+	social.Get("/requests", controller.getRequests)
+	social.Post("/requests", validation.Body[CreateFriendRequest](), controller.createRequest)
+	social.Post("/requests/:friendId/accept", controller.acceptRequest)
+	social.Post("/requests/:friendId/decline", controller.declineRequest)
+	social.Delete("/requests/:friendId", controller.cancelRequest)
+	social.Get("/feed", controller.getFeed)
+	social.Get("/privacy", controller.getPrivacy)
+	social.Put("/privacy", validation.Body[UpdatePrivacyRequest](), controller.updatePrivacy)
+}
@@ -0,0 +1,302 @@
+package social
+
+import (
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+)
+
+type Suite struct {
+	suite.Suite
+	app           *fiber.App
+	store         *Storage
+	userStore     *user.Storage
+	progressStore *progress.Storage
+	testUserId    string
+	friendId      string
+	strangerId    string
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-social"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	userStore := user.NewStorage(db)
+	suite.userStore = userStore
+	suite.progressStore = progress.NewStorage(db)
+
+	suite.store = NewStorage(db)
+	socialCont := NewController(suite.store, userStore, suite.progressStore)
+	Routes(app, socialCont)
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	for _, collection := range []string{"users", "friendships", "privacy", "progress", "progressEvents"} {
+		if err := suite.store.db.Collection(collection).Drop(context.Background()); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+
+	// create test users, the friend has accepted the request of the test user
+	suite.testUserId = "testId"
+	suite.friendId = "friendId"
+	suite.strangerId = "strangerId"
+	for _, id := range []string{suite.testUserId, suite.friendId, suite.strangerId} {
+		_, err := suite.userStore.Create(user.CreateUserRequest{
+			ID:        id,
+			FirstName: "test",
+			LastName:  id,
+		}, context.Background())
+
+		if err != nil {
+			suite.T().Errorf("Could not create test user: %v", err)
+		}
+	}
+
+	if _, err := suite.store.CreateRequest(suite.testUserId, suite.friendId, context.Background()); err != nil {
+		suite.T().Errorf("Could not create test friend request: %v", err)
+	}
+	if _, err := suite.store.Accept(suite.friendId, suite.testUserId, context.Background()); err != nil {
+		suite.T().Errorf("Could not accept test friend request: %v", err)
+	}
+}
+
+func (suite *Suite) request(method string, route string, userId string, body interface{}) (int, []byte) {
+	var reader io.Reader
+	if body != nil {
+		bodyJson, err := json.Marshal(body)
+		if err != nil {
+			suite.T().Errorf("Could not marshal body: %v", err)
+		}
+		reader = bytes.NewReader(bodyJson)
+	}
+
+	req := httptest.NewRequest(method, route, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if userId != "" {
+		req.Header.Set("userId", userId)
+	}
+
+	resp, err := suite.app.Test(req, -1)
+	if err != nil {
+		suite.T().Errorf("Could not make request: %v", err)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return resp.StatusCode, respBody
+}
+
+func (suite *Suite) TestRequests() {
+	tests := []struct {
+		description  string
+		method       string
+		route        string
+		userId       string
+		body         interface{}
+		expectedCode int
+	}{
+		{
+			description:  "Missing userId header",
+			method:       "POST",
+			route:        "/social/requests",
+			body:         CreateFriendRequest{FriendID: suite.strangerId},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Request to oneself",
+			method:       "POST",
+			route:        "/social/requests",
+			userId:       suite.testUserId,
+			body:         CreateFriendRequest{FriendID: suite.testUserId},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Friend does not exist",
+			method:       "POST",
+			route:        "/social/requests",
+			userId:       suite.testUserId,
+			body:         CreateFriendRequest{FriendID: "doesntexist"},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:  "Already friends",
+			method:       "POST",
+			route:        "/social/requests",
+			userId:       suite.friendId,
+			body:         CreateFriendRequest{FriendID: suite.testUserId},
+			expectedCode: fiber.StatusConflict,
+		},
+		{
+			description:  "Send successfully",
+			method:       "POST",
+			route:        "/social/requests",
+			userId:       suite.testUserId,
+			body:         CreateFriendRequest{FriendID: suite.strangerId},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "Send twice",
+			method:       "POST",
+			route:        "/social/requests",
+			userId:       suite.testUserId,
+			body:         CreateFriendRequest{FriendID: suite.strangerId},
+			expectedCode: fiber.StatusConflict,
+		},
+		{
+			description:  "Requester cannot accept",
+			method:       "POST",
+			route:        "/social/requests/" + suite.strangerId + "/accept",
+			userId:       suite.testUserId,
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:  "Decline successfully",
+			method:       "POST",
+			route:        "/social/requests/" + suite.testUserId + "/decline",
+			userId:       suite.strangerId,
+			expectedCode: fiber.StatusNoContent,
+		},
+		{
+			description:  "Send again after decline",
+			method:       "POST",
+			route:        "/social/requests",
+			userId:       suite.testUserId,
+			body:         CreateFriendRequest{FriendID: suite.strangerId},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "Request back accepts",
+			method:       "POST",
+			route:        "/social/requests",
+			userId:       suite.strangerId,
+			body:         CreateFriendRequest{FriendID: suite.testUserId},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "Remove successfully",
+			method:       "DELETE",
+			route:        "/social/friends/" + suite.strangerId,
+			userId:       suite.testUserId,
+			expectedCode: fiber.StatusNoContent,
+		},
+		{
+			description:  "Remove twice",
+			method:       "DELETE",
+			route:        "/social/friends/" + suite.strangerId,
+			userId:       suite.testUserId,
+			expectedCode: fiber.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		code, body := suite.request(test.method, test.route, test.userId, test.body)
+		suite.Equal(test.expectedCode, code, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+
+	code, body := suite.request("GET", "/social/friends", suite.testUserId, nil)
+	suite.Equal(fiber.StatusOK, code)
+	var friends []friendResponse
+	suite.NoError(json.Unmarshal(body, &friends))
+	suite.Len(friends, 1)
+	suite.Equal(suite.friendId, friends[0].ID)
+}
+
+func (suite *Suite) TestSharedProgress() {
+	ctx := context.Background()
+	suite.NoError(suite.progressStore.AddExperience(suite.friendId, ctx, settings.PluginNameMeditation, 120))
+	suite.NoError(suite.progressStore.AddExperience(suite.friendId, ctx, settings.PluginNameFinance, 60))
+
+	// nothing is shared by default
+	code, body := suite.request("GET", "/social/friends/"+suite.friendId+"/progress", suite.testUserId, nil)
+	suite.Equal(fiber.StatusOK, code, string(body))
+	suite.JSONEq(`{}`, string(body))
+
+	code, body = suite.request("PUT", "/social/privacy", suite.friendId, UpdatePrivacyRequest{
+		Plugins: map[settings.PluginName]Sharing{settings.PluginNameMeditation: SharingExperience, settings.PluginNameFinance: SharingLevel},
+	})
+	suite.Equal(fiber.StatusOK, code, string(body))
+
+	code, body = suite.request("GET", "/social/friends/"+suite.friendId+"/progress", suite.testUserId, nil)
+	suite.Equal(fiber.StatusOK, code, string(body))
+	suite.JSONEq(`{"meditation":{"level":2,"experience":120},"finance":{"level":1}}`, string(body))
+
+	// strangers cannot tell the user exists
+	code, _ = suite.request("GET", "/social/friends/"+suite.friendId+"/progress", suite.strangerId, nil)
+	suite.Equal(fiber.StatusNotFound, code)
+
+	code, body = suite.request("PUT", "/social/privacy", suite.friendId, UpdatePrivacyRequest{
+		Plugins: map[settings.PluginName]Sharing{"unknown": SharingLevel},
+	})
+	suite.Equal(fiber.StatusBadRequest, code, string(body))
+}
+
+func (suite *Suite) TestFeed() {
+	ctx := context.Background()
+	_, err := suite.store.UpdatePrivacy(suite.friendId, UpdatePrivacyRequest{
+		Plugins: map[settings.PluginName]Sharing{settings.PluginNameMeditation: SharingLevel},
+	}, ctx)
+	suite.NoError(err)
+
+	// first steps and a level up in a shared plugin, the finance one stays private
+	suite.NoError(suite.progressStore.AddExperience(suite.friendId, ctx, settings.PluginNameMeditation, 10))
+	suite.NoError(suite.progressStore.AddExperience(suite.friendId, ctx, settings.PluginNameMeditation, 50))
+	suite.NoError(suite.progressStore.AddExperience(suite.friendId, ctx, settings.PluginNameFinance, 60))
+	suite.NoError(suite.progressStore.AddExperience(suite.strangerId, ctx, settings.PluginNameMeditation, 60))
+
+	code, body := suite.request("GET", "/social/feed", suite.testUserId, nil)
+	suite.Equal(fiber.StatusOK, code, string(body))
+	var feed []feedItem
+	suite.NoError(json.Unmarshal(body, &feed))
+	suite.Len(feed, 2)
+	suite.Equal(progress.EventTypeLevelUp, feed[0].Type)
+	suite.Equal(1, feed[0].Level)
+	suite.Equal(progress.EventTypeFirstSteps, feed[1].Type)
+	for _, item := range feed {
+		suite.Equal(suite.friendId, item.UserID)
+		suite.Equal(settings.PluginNameMeditation, item.Plugin)
+	}
+
+	// the stranger sees nothing of the friend
+	code, body = suite.request("GET", "/social/feed", suite.strangerId, nil)
+	suite.Equal(fiber.StatusOK, code, string(body))
+	suite.JSONEq(`[]`, string(body))
+
+	code, _ = suite.request("GET", "/social/feed?limit=1000", suite.testUserId, nil)
+	suite.Equal(fiber.StatusBadRequest, code)
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestSocialTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
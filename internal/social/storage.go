@@ -0,0 +1,274 @@
+package social
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/settings"
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type FriendshipStatus string
+
+const (
+	FriendshipStatusPending  FriendshipStatus = "pending"
+	FriendshipStatusAccepted FriendshipStatus = "accepted"
+)
+
+// FriendshipDB connects two users, a declined or removed friendship is deleted
+type FriendshipDB struct {
+	// ids of both users in order, so a pair has one friendship
+	ID    string   `json:"-" bson:"_id"`
+	Users []string `json:"users" bson:"users"`
+	// the user that sent the request
+	Requester string           `json:"requester" bson:"requester"`
+	Addressee string           `json:"addressee" bson:"addressee"`
+	Status    FriendshipStatus `json:"status" bson:"status"`
+	// unix seconds
+	CreatedAt  int64 `json:"createdAt" bson:"createdAt"`
+	AcceptedAt int64 `json:"acceptedAt,omitempty" bson:"acceptedAt,omitempty"`
+}
+
+// Other returns the friend of userId
+func (f FriendshipDB) Other(userId string) string {
+	if f.Requester == userId {
+		return f.Addressee
+	}
+	return f.Requester
+}
+
+func friendshipID(userId string, friendId string) string {
+	users := []string{userId, friendId}
+	sort.Strings(users)
+	return users[0] + ":" + users[1]
+}
+
+// Sharing is what friends see of a plugin
+type Sharing string
+
+const (
+	SharingNone Sharing = "none"
+	// the level and the level ups in the feed
+	SharingLevel Sharing = "level"
+	// also the experience
+	SharingExperience Sharing = "experience"
+)
+
+func (s Sharing) IsValid() bool {
+	return s == SharingNone || s == SharingLevel || s == SharingExperience
+}
+
+// PrivacyDB holds the sharing of each plugin of a user, plugins that are
+// missing are not shared
+type PrivacyDB struct {
+	ID      string                          `json:"-" bson:"_id"`
+	Plugins map[settings.PluginName]Sharing `json:"plugins" bson:"plugins"`
+	// opted in to the leaderboards, they show the name to all users
+	Leaderboards bool `json:"leaderboards" bson:"leaderboards"`
+}
+
+// Sharing returns what friends see of plugin
+func (p PrivacyDB) Sharing(plugin settings.PluginName) Sharing {
+	if sharing, ok := p.Plugins[plugin]; ok {
+		return sharing
+	}
+	return SharingNone
+}
+
+// Visible returns the plugins friends see
+func (p PrivacyDB) Visible() []settings.PluginName {
+	plugins := make([]settings.PluginName, 0, len(p.Plugins))
+	for plugin, sharing := range p.Plugins {
+		if sharing != SharingNone {
+			plugins = append(plugins, plugin)
+		}
+	}
+	return plugins
+}
+
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+// EnsureIndexes creates the index for the friends of a user
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	collection := s.db.Collection("friendships")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "users", Value: 1}, {Key: "status", Value: 1}},
+	})
+	return err
+}
+
+func (s *Storage) CreateRequest(userId string, friendId string, ctx context.Context) (FriendshipDB, error) {
+	collection := s.db.Collection("friendships")
+
+	friendship := FriendshipDB{
+		ID:        friendshipID(userId, friendId),
+		Users:     []string{userId, friendId},
+		Requester: userId,
+		Addressee: friendId,
+		Status:    FriendshipStatusPending,
+		CreatedAt: time.Now().Unix(),
+	}
+	sort.Strings(friendship.Users)
+
+	if _, err := collection.InsertOne(ctx, friendship); err != nil {
+		return friendship, apperror.FromMongo(err, "friendship")
+	}
+	return friendship, nil
+}
+
+// Get returns the friendship of two users in any status
+func (s *Storage) Get(userId string, friendId string, ctx context.Context) (FriendshipDB, error) {
+	collection := s.db.Collection("friendships")
+	friendship := FriendshipDB{}
+
+	cursor := collection.FindOne(ctx, bson.M{"_id": friendshipID(userId, friendId)})
+	if err := cursor.Decode(&friendship); err != nil {
+		return friendship, apperror.FromMongo(err, "friendship")
+	}
+	return friendship, nil
+}
+
+// Accept accepts the request friendId sent to userId
+func (s *Storage) Accept(userId string, friendId string, ctx context.Context) (FriendshipDB, error) {
+	collection := s.db.Collection("friendships")
+	friendship := FriendshipDB{}
+
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": friendshipID(userId, friendId), "addressee": userId, "status": FriendshipStatusPending},
+		bson.M{"$set": bson.M{"status": FriendshipStatusAccepted, "acceptedAt": time.Now().Unix()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&friendship)
+	if err != nil {
+		return friendship, apperror.FromMongo(err, "friend request")
+	}
+	return friendship, nil
+}
+
+// Delete removes the friendship of two users if it matches filter
+func (s *Storage) Delete(userId string, friendId string, filter bson.M, ctx context.Context) error {
+	collection := s.db.Collection("friendships")
+
+	filter["_id"] = friendshipID(userId, friendId)
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return apperror.FromMongo(err, "friendship")
+	}
+	if result.DeletedCount == 0 {
+		return apperror.NotFound("friendship does not exist")
+	}
+	return nil
+}
+
+// GetAllOfOneUser returns the friendships of a user in status
+func (s *Storage) GetAllOfOneUser(userId string, status FriendshipStatus, ctx context.Context) ([]FriendshipDB, error) {
+	collection := s.db.Collection("friendships")
+
+	cursor, err := collection.Find(ctx, bson.M{"users": userId, "status": status}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, apperror.FromMongo(err, "friendships")
+	}
+
+	friendships := make([]FriendshipDB, 0)
+	if err := cursor.All(ctx, &friendships); err != nil {
+		return nil, apperror.FromMongo(err, "friendships")
+	}
+	return friendships, nil
+}
+
+// AreFriends checks for an accepted friendship of two users
+func (s *Storage) AreFriends(userId string, friendId string, ctx context.Context) (bool, error) {
+	collection := s.db.Collection("friendships")
+
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": friendshipID(userId, friendId), "status": FriendshipStatusAccepted})
+	if err != nil {
+		return false, apperror.FromMongo(err, "friendship")
+	}
+	return count > 0, nil
+}
+
+// GetPrivacy returns the sharing of a user, users without privacy settings share nothing
+func (s *Storage) GetPrivacy(userId string, ctx context.Context) (PrivacyDB, error) {
+	collection := s.db.Collection("privacy")
+	privacy := PrivacyDB{ID: userId, Plugins: make(map[settings.PluginName]Sharing)}
+
+	err := collection.FindOne(ctx, bson.M{"_id": userId}).Decode(&privacy)
+	if err == mongo.ErrNoDocuments {
+		return privacy, nil
+	}
+	if err != nil {
+		return privacy, apperror.FromMongo(err, "privacy")
+	}
+	return privacy, nil
+}
+
+// GetPrivacyOfUsers returns the sharing of several users by user id
+func (s *Storage) GetPrivacyOfUsers(userIds []string, ctx context.Context) (map[string]PrivacyDB, error) {
+	collection := s.db.Collection("privacy")
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": userIds}})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "privacy")
+	}
+
+	var documents []PrivacyDB
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, apperror.FromMongo(err, "privacy")
+	}
+	privacy := make(map[string]PrivacyDB, len(documents))
+	for _, document := range documents {
+		privacy[document.ID] = document
+	}
+	return privacy, nil
+}
+
+// GetLeaderboardUsers returns the ids of the users that opted in to the leaderboards
+func (s *Storage) GetLeaderboardUsers(ctx context.Context) ([]string, error) {
+	collection := s.db.Collection("privacy")
+
+	ids, err := collection.Distinct(ctx, "_id", bson.M{"leaderboards": true})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "privacy")
+	}
+	userIds := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if userId, ok := id.(string); ok {
+			userIds = append(userIds, userId)
+		}
+	}
+	return userIds, nil
+}
+
+// UpdatePrivacy sets the sharing of the plugins of request, other plugins keep theirs
+func (s *Storage) UpdatePrivacy(userId string, request UpdatePrivacyRequest, ctx context.Context) (PrivacyDB, error) {
+	collection := s.db.Collection("privacy")
+
+	update := bson.M{}
+	for plugin, sharing := range request.Plugins {
+		update["plugins."+string(plugin)] = sharing
+	}
+	if request.Leaderboards != nil {
+		update["leaderboards"] = *request.Leaderboards
+	}
+	privacy := PrivacyDB{}
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userId},
+		bson.M{"$set": update},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&privacy)
+	if err != nil {
+		return privacy, apperror.FromMongo(err, "privacy")
+	}
+	return privacy, nil
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// the schema version of each migrated collection, by collection name
+const migrationsCollection = "migrations"
+
+type migrationDB struct {
+	Collection string `bson:"_id"`
+	Version    int    `bson:"version"`
+}
+
+// SetSchemaVersion records that the records of collection were migrated to version
+func SetSchemaVersion(db *mongo.Database, collection string, version int, ctx context.Context) error {
+	_, err := db.Collection(migrationsCollection).UpdateOne(ctx,
+		bson.M{"_id": collection},
+		// a newer instance may already have migrated further
+		bson.M{"$max": bson.M{"version": version}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// CheckSchemaVersion returns an error if collection was not migrated to version yet
+func CheckSchemaVersion(db *mongo.Database, collection string, version int, ctx context.Context) error {
+	var migration migrationDB
+	err := db.Collection(migrationsCollection).FindOne(ctx, bson.M{"_id": collection}).Decode(&migration)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("%s is not migrated", collection)
+	}
+	if err != nil {
+		return err
+	}
+	if migration.Version < version {
+		return fmt.Errorf("%s is at version %d, want %d", collection, migration.Version, version)
+	}
+	return nil
+}
@@ -2,27 +2,43 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
 import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 func BootstrapMongo(uri, dbName string, timeout time.Duration) (*mongo.Database, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	clientOpts := options.Client().ApplyURI(uri)
+	// every command is measured and traced
+	clientOpts := options.Client().ApplyURI(uri).SetMonitor(newMonitor())
 	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
 		return nil, err
 	}
 
-	return client.Database(dbName), nil
+	// connect does not reach the server, fail fast if it is down
+	db := client.Database(dbName)
+	if err := Ping(db, ctx); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("could not reach mongo: %w", err)
+	}
+
+	return db, nil
+}
+
+// Ping checks that the primary answers
+func Ping(db *mongo.Database, ctx context.Context) error {
+	return db.Client().Ping(ctx, readpref.Primary())
 }
 
-func CloseMongo(db *mongo.Database) error {
-	return db.Client().Disconnect(context.Background())
+// CloseMongo waits for the running commands until ctx is done, then closes the connections
+func CloseMongo(db *mongo.Database, ctx context.Context) error {
+	return db.Client().Disconnect(ctx)
 }
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"cmd/http/main.go/internal/metrics"
+	"cmd/http/main.go/internal/tracing"
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var commandLatency = metrics.NewHistogram("mongo_command_duration_seconds", "Latency of mongo commands by collection.", metrics.DefaultBuckets, "collection", "command")
+
+type startedCommand struct {
+	collection string
+	// nil for commands outside of a trace, like of the background workers
+	span *tracing.Span
+}
+
+// newMonitor measures every command and traces the ones of requests
+func newMonitor() *event.CommandMonitor {
+	var started sync.Map
+
+	finish := func(requestId int64, command string, duration time.Duration, failure string) {
+		value, ok := started.LoadAndDelete(requestId)
+		if !ok {
+			return
+		}
+		current := value.(startedCommand)
+		commandLatency.Observe(duration.Seconds(), current.collection, command)
+		if current.span != nil {
+			current.span.Error = failure
+			current.span.Finish()
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			current := startedCommand{collection: collectionOf(e.Command)}
+			if tracing.FromContext(ctx) != nil {
+				_, current.span = tracing.Start(ctx, "mongo."+e.CommandName, tracing.KindClient)
+				current.span.SetAttribute("db.system", "mongodb")
+				current.span.SetAttribute("db.name", e.DatabaseName)
+				current.span.SetAttribute("db.operation", e.CommandName)
+				current.span.SetAttribute("db.mongodb.collection", current.collection)
+			}
+			started.Store(e.RequestID, current)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finish(e.RequestID, e.CommandName, time.Duration(e.DurationNanos), "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finish(e.RequestID, e.CommandName, time.Duration(e.DurationNanos), e.Failure)
+		},
+	}
+}
+
+// collectionOf returns the collection of a command like {find: "users"},
+// commands of cursors name it in the collection field
+func collectionOf(command bson.Raw) string {
+	if collection, ok := command.Lookup("collection").StringValueOK(); ok {
+		return collection
+	}
+	elements, err := command.Elements()
+	if err != nil || len(elements) == 0 {
+		return ""
+	}
+	if collection, ok := elements[0].Value().StringValueOK(); ok {
+		return collection
+	}
+	return ""
+}
@@ -0,0 +1,246 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// spans exported at once, and how long an ended span waits at most
+const (
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+	// spans waiting for the exporter, more are dropped
+	queueSize = 4096
+)
+
+// Exporter sends ended spans to a backend
+type Exporter interface {
+	Export(spans []*Span, ctx context.Context) error
+}
+
+// the processor spans are handed to, nil if none is started
+var current atomic.Pointer[Processor]
+
+// Processor exports the ended spans in batches in the background
+type Processor struct {
+	exporter Exporter
+	spans    chan *Span
+	dropped  atomic.Int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewProcessor(exporter Exporter) *Processor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Processor{
+		exporter: exporter,
+		spans:    make(chan *Span, queueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start makes the processor receive all ended spans
+func (p *Processor) Start() {
+	current.Store(p)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.run()
+	}()
+}
+
+// Stop exports the spans that ended until now and waits for it
+func (p *Processor) Stop() {
+	current.CompareAndSwap(p, nil)
+	p.cancel()
+	p.wg.Wait()
+}
+
+// enqueue never blocks a request, spans are dropped if the exporter is behind
+func (p *Processor) enqueue(span *Span) {
+	select {
+	case p.spans <- span:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+func (p *Processor) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	for {
+		select {
+		case span := <-p.spans:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				batch = p.export(batch)
+			}
+		case <-ticker.C:
+			batch = p.export(batch)
+		case <-p.ctx.Done():
+			for {
+				select {
+				case span := <-p.spans:
+					batch = append(batch, span)
+				default:
+					p.export(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// export sends a batch and returns the emptied batch
+func (p *Processor) export(batch []*Span) []*Span {
+	if dropped := p.dropped.Swap(0); dropped > 0 {
+		slog.Warn("tracing dropped spans", "count", dropped)
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushInterval)
+	defer cancel()
+	if err := p.exporter.Export(batch, ctx); err != nil {
+		slog.Error("tracing could not export spans", "count", len(batch), "error", err)
+	}
+	return batch[:0]
+}
+
+// WriterExporter writes each span as a json line, like to stdout
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{
+		w: w,
+	}
+}
+
+func (e *WriterExporter) Export(spans []*Span, ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	encoder := json.NewEncoder(e.w)
+	for _, span := range spans {
+		if err := encoder.Encode(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OTLPExporter sends the spans to an OTLP collector with the json encoding
+// of OTLP/HTTP, like to http://localhost:4318/v1/traces
+type OTLPExporter struct {
+	endpoint string
+	service  string
+	client   *http.Client
+}
+
+func NewOTLPExporter(endpoint string, service string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		service:  service,
+		client:   &http.Client{Timeout: flushInterval},
+	}
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	// 1 ok, 2 error
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+func attributes(values map[string]string) []otlpAttribute {
+	list := make([]otlpAttribute, 0, len(values))
+	for key, value := range values {
+		list = append(list, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+	}
+	return list
+}
+
+func (e *OTLPExporter) Export(spans []*Span, ctx context.Context) error {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		status := otlpStatus{Code: 1}
+		if span.Error != "" {
+			status = otlpStatus{Code: 2, Message: span.Error}
+		}
+		converted = append(converted, otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentID,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        attributes(span.Attributes),
+			Status:            status,
+		})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": attributes(map[string]string{"service.name": e.service})},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "cmd/http/main.go/internal/tracing"},
+				"spans": converted,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Package tracing records spans of requests and the mongo commands they run.
+// Trace ids follow W3C trace context, so callers can continue their traces
+// with a traceparent header. Ended spans go to the exporter of the started
+// Processor, without one they only carry the ids.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	HeaderTraceParent = "traceparent"
+	// the trace id of a request, to find it in the logs
+	HeaderTraceID = "X-Trace-Id"
+	// the trace id in the locals of a request, for the logger
+	LocalsTraceID = "traceId"
+)
+
+type Kind int
+
+// the values of OTLP
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Span is a timed operation of a trace, ids are hex
+type Span struct {
+	TraceID    string            `json:"traceId"`
+	SpanID     string            `json:"spanId"`
+	ParentID   string            `json:"parentSpanId,omitempty"`
+	Name       string            `json:"name"`
+	Kind       Kind              `json:"kind"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// empty if the operation succeeded
+	Error string `json:"error,omitempty"`
+}
+
+func (s *Span) SetAttribute(key string, value string) {
+	s.Attributes[key] = value
+}
+
+// Finish ends the span and hands it to the exporter
+func (s *Span) Finish() {
+	s.End = time.Now()
+	if p := current.Load(); p != nil {
+		p.enqueue(s)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns ctx with span as the parent of new spans
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// FromContext returns the current span of ctx, nil outside of a trace
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start begins a span, a child of the span of ctx or else a new trace
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	span := newSpan(name, kind)
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func newSpan(name string, kind Kind) *Span {
+	return &Span{
+		TraceID:    randomHex(16),
+		SpanID:     randomHex(8),
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]string),
+	}
+}
+
+func randomHex(size int) string {
+	id := make([]byte, size)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// parseTraceParent returns the trace and parent span of a traceparent header,
+// empty if the header is missing or invalid
+func parseTraceParent(header string) (string, string) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", ""
+	}
+	traceId, parentId := strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	if !isHexID(traceId, 32) || !isHexID(parentId, 16) {
+		return "", ""
+	}
+	return traceId, parentId
+}
+
+// isHexID checks for a hex id of length that is not all zeros
+func isHexID(id string, length int) bool {
+	if len(id) != length || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// Middleware starts the span of a request, it continues the trace of a
+// traceparent header. Handlers pass c.UserContext() to the storages, it
+// carries the span to the mongo commands like c.Context() does.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		span := newSpan(c.Method()+" "+c.Path(), KindServer)
+		if traceId, parentId := parseTraceParent(c.Get(HeaderTraceParent)); traceId != "" {
+			span.TraceID = traceId
+			span.ParentID = parentId
+		}
+		c.Context().SetUserValue(spanKey{}, span)
+		c.SetUserContext(ContextWithSpan(c.UserContext(), span))
+		c.Locals(LocalsTraceID, span.TraceID)
+		c.Set(HeaderTraceID, span.TraceID)
+
+		err := c.Next()
+
+		route := c.Route().Path
+		span.Name = c.Method() + " " + route
+		span.SetAttribute("http.method", c.Method())
+		span.SetAttribute("http.route", route)
+		if err != nil {
+			span.Error = err.Error()
+		} else {
+			status := c.Response().StatusCode()
+			span.SetAttribute("http.status_code", strconv.Itoa(status))
+			if status >= fiber.StatusInternalServerError {
+				span.Error = http.StatusText(status)
+			}
+		}
+		span.Finish()
+		return err
+	}
+}
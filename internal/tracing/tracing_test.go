@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		header   string
+		traceId  string
+		parentId string
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-00", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", ""},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", ""},
+		{"00-4bf92f3577b34da6-00f067aa0ba902b7-01", "", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		traceId, parentId := parseTraceParent(test.header)
+		if traceId != test.traceId || parentId != test.parentId {
+			t.Errorf("%q: got %s %s, want %s %s", test.header, traceId, parentId, test.traceId, test.parentId)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var output bytes.Buffer
+	processor := NewProcessor(NewWriterExporter(&output))
+	processor.Start()
+
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/users/:id", func(c *fiber.Ctx) error {
+		// the storages get the span with the context of the request
+		_, span := Start(c.Context(), "storage", KindInternal)
+		span.Finish()
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/users/testId", nil)
+	req.Header.Set(HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if traceId := resp.Header.Get(HeaderTraceID); traceId != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("got trace id %s, want the one of traceparent", traceId)
+	}
+	processor.Stop()
+
+	var spans []Span
+	decoder := json.NewDecoder(&output)
+	for decoder.More() {
+		var span Span
+		if err := decoder.Decode(&span); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	storage, request := spans[0], spans[1]
+	if request.Name != "GET /users/:id" || request.ParentID != "00f067aa0ba902b7" || request.Attributes["http.status_code"] != "200" {
+		t.Errorf("got request span %+v", request)
+	}
+	if storage.TraceID != request.TraceID || storage.ParentID != request.SpanID {
+		t.Errorf("storage span %+v is no child of the request span", storage)
+	}
+	if FromContext(context.Background()) != nil {
+		t.Errorf("got a span without trace")
+	}
+}
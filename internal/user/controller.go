@@ -1,8 +1,11 @@
 package user
 
 import (
-	"fmt"
-	"log"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/audit"
+	"cmd/http/main.go/internal/calendar"
+	"cmd/http/main.go/internal/validation"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -29,7 +32,35 @@ type CreateUserRequest struct {
 	LastName    string `json:"lastName" bson:"lastName"`
 	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth"`
 	Email       string `json:"email" bson:"email"`
-	ID          string `json:"id" bson:"_id"`
+	// optional, default to UTC, en and monday
+	TimeZone  string `json:"timeZone" bson:"timeZone"`
+	Locale    string `json:"locale" bson:"locale"`
+	WeekStart string `json:"weekStart" bson:"weekStart"`
+	ID        string `json:"id" bson:"_id"`
+}
+
+const maxNameLength = 100
+
+// DefaultLocale is the locale of users that did not choose one
+const DefaultLocale = "en"
+
+// checkRegional checks the optional time zone, locale and week start of a profile
+func checkRegional(errs *validation.Errors, timeZone string, locale string, weekStart string) {
+	errs.Check(timeZone == "" || calendar.IsTimeZone(timeZone), "timeZone", "must be an IANA time zone like Europe/Berlin")
+	errs.Check(locale == "" || validation.IsLocale(locale), "locale", "must be a language tag like de-CH")
+	_, ok := calendar.ParseWeekday(weekStart)
+	errs.Check(weekStart == "" || ok, "weekStart", "must be a weekday like monday")
+}
+
+func (r CreateUserRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(r.ID != "", "id", "is required")
+	errs.Check(validation.IsEmail(r.Email), "email", "must be a valid email address")
+	errs.Check(r.DateOfBirth == "" || validation.IsPastDate(r.DateOfBirth), "dateOfBirth", "must be a past date in the format %s", validation.DateLayout)
+	errs.Check(len(r.FirstName) <= maxNameLength, "firstName", "must be at most %d characters", maxNameLength)
+	errs.Check(len(r.LastName) <= maxNameLength, "lastName", "must be at most %d characters", maxNameLength)
+	checkRegional(&errs, r.TimeZone, r.Locale, r.WeekStart)
+	return errs.Err()
 }
 
 type createUserResponse struct {
@@ -48,6 +79,20 @@ type updateUserRequest struct {
 	LastName    string `json:"lastName" bson:"lastName"`
 	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth"`
 	Email       string `json:"email" bson:"email"`
+	TimeZone    string `json:"timeZone" bson:"timeZone"`
+	Locale      string `json:"locale" bson:"locale"`
+	WeekStart   string `json:"weekStart" bson:"weekStart"`
+}
+
+// empty fields are not updated, so only given fields are checked
+func (r updateUserRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(r.Email == "" || validation.IsEmail(r.Email), "email", "must be a valid email address")
+	errs.Check(r.DateOfBirth == "" || validation.IsPastDate(r.DateOfBirth), "dateOfBirth", "must be a past date in the format %s", validation.DateLayout)
+	errs.Check(len(r.FirstName) <= maxNameLength, "firstName", "must be at most %d characters", maxNameLength)
+	errs.Check(len(r.LastName) <= maxNameLength, "lastName", "must be at most %d characters", maxNameLength)
+	checkRegional(&errs, r.TimeZone, r.Locale, r.WeekStart)
+	return errs.Err()
 }
 
 // @Summary Create one user.
@@ -59,25 +104,12 @@ type updateUserRequest struct {
 // @Success 200 {object} createUserResponse
 // @Router /users [post]
 func (t *Controller) create(c *fiber.Ctx) error {
-	c.Request().Header.Set("Content-Type", "application/json")
-
-	var req CreateUserRequest
-
-	if err := c.BodyParser(&req); err != nil {
-		fmt.Println(err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request body",
-			"err":     err,
-		})
-	}
+	req := validation.Parsed[CreateUserRequest](c)
 
 	//Create user
-	_, err := t.storage.Create(req, c.Context())
+	_, err := t.storage.Create(req, c.UserContext())
 	if err != nil {
-		log.Println(err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to Create user",
-		})
+		return err
 	}
 	return c.Status(fiber.StatusCreated).JSON(createUserResponse{
 		ID: req.ID,
@@ -90,43 +122,34 @@ func (t *Controller) create(c *fiber.Ctx) error {
 // @Accept */*
 // @Produce json
 // @Param id path string true "User ID"
+// @Param userId header string true "User ID"
 // @Success 200 {object} UserDB
 // @Router /users/{id} [Get]
 func (t *Controller) get(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	// Get users
-	user, err := t.storage.Get(id, c.Context())
-
+	user, err := t.storage.Get(id, c.UserContext())
 	if err != nil {
-		if err.Error() == "mongo: no documents in result" {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "User does not exist",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Something went wrong",
-		})
+		return err
 	}
 
 	return c.JSON(user)
 }
 
 // @Summary Get all users.
-// @Description fetch every user available.
+// @Description fetch every user available, only for admins.
 // @Tags users
 // @Accept */*
 // @Produce json
+// @Param userId header string true "User ID"
 // @Success 200 {object} []UserDB
 // @Router /users [Get]
 func (t *Controller) getAll(c *fiber.Ctx) error {
 	// Get all users
-	users, err := t.storage.GetAll(c.Context())
+	users, err := t.storage.GetAll(c.UserContext())
 	if err != nil {
-		log.Println(err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to Get users",
-		})
+		return err
 	}
 
 	return c.JSON(users)
@@ -142,31 +165,19 @@ func (t *Controller) getAll(c *fiber.Ctx) error {
 // @Success 200 {object} UserDB
 // @Router /users [put]
 func (t *Controller) update(c *fiber.Ctx) error {
-	c.Request().Header.Set("Content-Type", "application/json")
-
 	userId := string(c.Request().Header.Peek("userId"))
 	if userId == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing userId header",
-		})
+		return apperror.Validation("Missing userId header")
 	}
 
-	// Parse the update request from the request body
-	var req updateUserRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Invalid request body",
-			"err":     err,
-		})
-	}
+	req := validation.Parsed[updateUserRequest](c)
 
 	// Fetch the existing user from the database
-	user, err := t.storage.Get(userId, c.Context())
+	user, err := t.storage.Get(userId, c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"message": "User Does Not Exist",
-		})
+		return err
 	}
+	before := user
 
 	// Update the user object with the new values
 	if req.FirstName != "" {
@@ -181,44 +192,55 @@ func (t *Controller) update(c *fiber.Ctx) error {
 	if req.Email != "" {
 		user.Email = req.Email
 	}
+	if req.TimeZone != "" {
+		user.TimeZone = req.TimeZone
+	}
+	if req.Locale != "" {
+		user.Locale = req.Locale
+	}
+	if req.WeekStart != "" {
+		user.WeekStart = strings.ToLower(req.WeekStart)
+	}
 
 	// Update the user in the database
-	result, err := t.storage.Update(user, c.Context())
+	result, err := t.storage.Update(user, c.UserContext())
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to update user",
-		})
+		return err
 	}
+	audit.Log(c, audit.EntryDB{
+		TargetID:   userId,
+		Action:     "users.update",
+		EntityType: "user",
+		EntityID:   userId,
+		Changes:    audit.Diff(before, result),
+	})
 
 	return c.JSON(result)
 }
 
 // @Summary Delete a user.
-// @Description delete a user by id with all its progress in all plugins.
+// @Description delete a user by id with all its progress in all plugins, users delete themselves and admins anyone.
 // @Tags users
 // @Accept */*
 // @Produce json
 // @Param id path string true "User ID"
+// @Param userId header string true "User ID"
 // @Success 200 {object} map[string]interface{}
 // @Router /users/{id} [delete]
 func (t *Controller) delete(c *fiber.Ctx) error {
 	id := c.Params("id")
 
-	err := t.storage.Delete(id, c.Context())
-	if err == nil {
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"message": "User deleted successfully",
-		})
+	if err := t.storage.Delete(id, c.UserContext()); err != nil {
+		return err
 	}
-	if err != nil {
-		// there is no user with this id
-		if err.Error() == "mongo: no documents in result" {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"message": "User does not exist",
-			})
-		}
-	}
-	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-		"message": "Failed to delete user",
+	// the data of all plugins is gone, the entry keeps no profile of the user
+	audit.Log(c, audit.EntryDB{
+		TargetID:   id,
+		Action:     "users.delete",
+		EntityType: "user",
+		EntityID:   id,
+	})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User deleted successfully",
 	})
 }
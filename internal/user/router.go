@@ -1,16 +1,24 @@
 package user
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"cmd/http/main.go/internal/auth"
+	"cmd/http/main.go/internal/validation"
 
-func Routes(app *fiber.App, controller *Controller) {
+	"github.com/gofiber/fiber/v2"
+)
+
+// accounts grant the roles of the callers
+func Routes(app fiber.Router, controller *Controller, accounts auth.Accounts) {
 	user := app.Group("/users")
 
 	// add middlewares here
 
 	// add routes here
-	user.Post("/", controller.create)
-	user.Put("/", controller.update)
-	user.Get("/", controller.getAll)
-	user.Get("/:id", controller.get)
-	user.Delete("/:id", controller.delete)
+	user.Post("/", validation.Body[CreateUserRequest](), controller.create)
+	user.Put("/", validation.Body[updateUserRequest](), controller.update)
+	user.Get("/", auth.Require(accounts, auth.PermissionListUsers), controller.getAll)
+	// users read their own profile
+	user.Get("/:id", auth.RequireSelfOr(accounts, auth.PermissionListUsers, "id"), controller.get)
+	// users delete their own account
+	user.Delete("/:id", auth.RequireSelfOr(accounts, auth.PermissionDeleteUsers, "id"), controller.delete)
 }
@@ -1,12 +1,19 @@
 package user
 
 import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/auth"
+	"cmd/http/main.go/internal/calendar"
 	"context"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // how the user is stored in the database
@@ -15,8 +22,28 @@ type UserDB struct {
 	LastName    string `json:"lastName" bson:"lastName"`
 	DateOfBirth string `json:"dateOfBirth" bson:"dateOfBirth"`
 	Email       string `json:"email" bson:"email"`
-	CreatedAt   int64  `json:"createdAt" bson:"createdAt"`
-	ID          string `json:"id" bson:"_id"`
+	// IANA time zone like Europe/Berlin
+	TimeZone string `json:"timeZone" bson:"timeZone"`
+	// BCP 47 language tag like de-CH
+	Locale string `json:"locale" bson:"locale"`
+	// first day of the week like monday
+	WeekStart string `json:"weekStart" bson:"weekStart"`
+	CreatedAt int64  `json:"createdAt" bson:"createdAt"`
+	ID        string `json:"id" bson:"_id"`
+	// empty for users of older versions, they are auth.RoleUser
+	Role auth.Role `json:"role,omitempty" bson:"role,omitempty"`
+	// unix seconds, suspended users cannot use the api
+	SuspendedAt      int64  `json:"suspendedAt,omitempty" bson:"suspendedAt,omitempty"`
+	SuspensionReason string `json:"suspensionReason,omitempty" bson:"suspensionReason,omitempty"`
+}
+
+// Calendar returns the calendar of the user, users of older versions get the defaults
+func (u UserDB) Calendar() calendar.Calendar {
+	cal, err := calendar.New(u.TimeZone, u.WeekStart)
+	if err != nil {
+		cal, _ = calendar.New("", "")
+	}
+	return cal
 }
 
 type Storage struct {
@@ -39,14 +66,25 @@ func (s *Storage) Create(createUserObject CreateUserRequest, ctx context.Context
 		LastName:    createUserObject.LastName,
 		DateOfBirth: createUserObject.DateOfBirth,
 		Email:       createUserObject.Email,
+		TimeZone:    createUserObject.TimeZone,
+		Locale:      createUserObject.Locale,
+		WeekStart:   strings.ToLower(createUserObject.WeekStart),
 		CreatedAt:   createdAt,
 		ID:          createUserObject.ID,
 	}
+	if insertObj.TimeZone == "" {
+		insertObj.TimeZone = calendar.DefaultTimeZone
+	}
+	if insertObj.Locale == "" {
+		insertObj.Locale = DefaultLocale
+	}
+	if insertObj.WeekStart == "" {
+		insertObj.WeekStart = strings.ToLower(calendar.DefaultWeekStart.String())
+	}
 
 	result, err := collection.InsertOne(ctx, insertObj)
 	if err != nil {
-		fmt.Println(err)
-		return "", err
+		return "", apperror.FromMongo(err, "user")
 	}
 
 	// convert the object id to a string
@@ -59,13 +97,8 @@ func (s *Storage) Get(id string, ctx context.Context) (UserDB, error) {
 	user := UserDB{}
 
 	// Handle if user does not exist
-
-	if result.Err() != nil {
-		return user, result.Err()
-	}
-
 	if err := result.Decode(&user); err != nil {
-		return user, err
+		return user, apperror.FromMongo(err, "user")
 	}
 
 	return user, nil
@@ -77,33 +110,129 @@ func (s *Storage) GetAll(ctx context.Context) ([]UserDB, error) {
 
 	cursor, err := collection.Find(ctx, bson.M{})
 	if err != nil {
-		return nil, err
+		return nil, apperror.FromMongo(err, "users")
 	}
 
 	users := make([]UserDB, 0)
 	if err = cursor.All(ctx, &users); err != nil {
-		return nil, err
+		return nil, apperror.FromMongo(err, "users")
 	}
 
 	return users, nil
 }
 
-func (s *Storage) Update(user UserDB, ctx context.Context) (UserDB, error) {
+// GetMany returns the users of ids by id, ids of deleted users are missing
+func (s *Storage) GetMany(ids []string, ctx context.Context) (map[string]UserDB, error) {
 	collection := s.db.Collection("users")
-	result := collection.FindOneAndUpdate(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"firstName": user.FirstName, "lastName": user.LastName, "dateOfBirth": user.DateOfBirth, "email": user.Email}}, nil)
 
-	if result.Err() != nil {
-		return user, result.Err()
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "users")
 	}
 
-	result = collection.FindOne(ctx, bson.M{"_id": user.ID})
+	var users []UserDB
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, apperror.FromMongo(err, "users")
+	}
+
+	byId := make(map[string]UserDB, len(users))
+	for _, user := range users {
+		byId[user.ID] = user
+	}
+	return byId, nil
+}
+
+// Account returns the role and suspension of a user for the auth checks
+func (s *Storage) Account(id string, ctx context.Context) (auth.Account, error) {
+	collection := s.db.Collection("users")
+
+	user := UserDB{}
+	err := collection.FindOne(ctx, bson.M{"_id": id}, options.FindOne().SetProjection(bson.M{"role": 1, "suspendedAt": 1})).Decode(&user)
+	if err != nil {
+		return auth.Account{}, apperror.FromMongo(err, "user")
+	}
+
+	account := auth.Account{Role: user.Role, Suspended: user.SuspendedAt > 0}
+	if account.Role == "" {
+		account.Role = auth.RoleUser
+	}
+	return account, nil
+}
+
+// Search returns the users whose name or email contains query, sorted by id
+func (s *Storage) Search(query string, limit int64, offset int64, ctx context.Context) ([]UserDB, error) {
+	collection := s.db.Collection("users")
+
+	filter := bson.M{}
+	if query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"firstName": pattern},
+			bson.M{"lastName": pattern},
+			bson.M{"email": pattern},
+			bson.M{"_id": pattern},
+		}
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetSkip(offset).SetLimit(limit))
+	if err != nil {
+		return nil, apperror.FromMongo(err, "users")
+	}
+
+	users := make([]UserDB, 0)
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, apperror.FromMongo(err, "users")
+	}
+	return users, nil
+}
+
+// SetRole changes the role of a user
+func (s *Storage) SetRole(id string, role auth.Role, ctx context.Context) (UserDB, error) {
+	return s.set(id, bson.M{"$set": bson.M{"role": role}}, ctx)
+}
+
+// GrantRole gives role to the existing users of ids, used to bootstrap the admins
+func (s *Storage) GrantRole(ids []string, role auth.Role, ctx context.Context) error {
+	collection := s.db.Collection("users")
+
+	_, err := collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return apperror.FromMongo(err, "users")
+	}
+	return nil
+}
+
+// Suspend blocks a user from the api until Unsuspend
+func (s *Storage) Suspend(id string, reason string, ctx context.Context) (UserDB, error) {
+	return s.set(id, bson.M{"$set": bson.M{"suspendedAt": time.Now().Unix(), "suspensionReason": reason}}, ctx)
+}
+
+func (s *Storage) Unsuspend(id string, ctx context.Context) (UserDB, error) {
+	return s.set(id, bson.M{"$unset": bson.M{"suspendedAt": "", "suspensionReason": ""}}, ctx)
+}
+
+func (s *Storage) set(id string, update bson.M, ctx context.Context) (UserDB, error) {
+	collection := s.db.Collection("users")
+
+	user := UserDB{}
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	if err != nil {
+		return user, apperror.FromMongo(err, "user")
+	}
+	return user, nil
+}
+
+func (s *Storage) Update(user UserDB, ctx context.Context) (UserDB, error) {
+	collection := s.db.Collection("users")
+	result := collection.FindOneAndUpdate(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"firstName": user.FirstName, "lastName": user.LastName, "dateOfBirth": user.DateOfBirth, "email": user.Email, "timeZone": user.TimeZone, "locale": user.Locale, "weekStart": user.WeekStart}}, nil)
 
 	if result.Err() != nil {
-		return user, result.Err()
+		return user, apperror.FromMongo(result.Err(), "user")
 	}
 
+	result = collection.FindOne(ctx, bson.M{"_id": user.ID})
+
 	if err := result.Decode(&user); err != nil {
-		return user, err
+		return user, apperror.FromMongo(err, "user")
 	}
 
 	return user, nil
@@ -128,32 +257,128 @@ func (s *Storage) Delete(id string, ctx context.Context) error {
 	}
 
 	// Initialize the finance collection
-	financeCollection := s.db.Collection("finance")
+	financeCollection := s.db.Collection("investment")
 	_, err = financeCollection.DeleteMany(ctx, bson.M{"userId": id})
 	if err != nil {
 		return fmt.Errorf("failed to delete from finance collection: %w", err)
 	}
 
-	// Initialize the settings collection
+	// Initialize the journal collection
+	journalCollection := s.db.Collection("journal")
+	_, err = journalCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from journal collection: %w", err)
+	}
+
+	// Initialize the sleep collection
+	sleepCollection := s.db.Collection("sleep")
+	_, err = sleepCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from sleep collection: %w", err)
+	}
+
+	// Initialize the hydration collection
+	hydrationCollection := s.db.Collection("hydration")
+	_, err = hydrationCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from hydration collection: %w", err)
+	}
+
+	// Initialize the hydration goals collection
+	hydrationGoalsCollection := s.db.Collection("hydrationGoals")
+	_, err = hydrationGoalsCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from hydrationGoals collection: %w", err)
+	}
+
+	// Initialize the workout collection
+	workoutCollection := s.db.Collection("workout")
+	_, err = workoutCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from workout collection: %w", err)
+	}
+
+	// Initialize the workout records collection
+	workoutRecordsCollection := s.db.Collection("workoutRecords")
+	_, err = workoutRecordsCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from workoutRecords collection: %w", err)
+	}
+
+	// Initialize the imports collection
+	importsCollection := s.db.Collection("imports")
+	_, err = importsCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from imports collection: %w", err)
+	}
+
+	// Initialize the sync collection
+	syncCollection := s.db.Collection("sync")
+	_, err = syncCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from sync collection: %w", err)
+	}
+
+	// Initialize the friendships collection, a friendship belongs to both users
+	friendshipsCollection := s.db.Collection("friendships")
+	_, err = friendshipsCollection.DeleteMany(ctx, bson.M{"users": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from friendships collection: %w", err)
+	}
+
+	// Initialize the progress events collection
+	progressEventsCollection := s.db.Collection("progressEvents")
+	_, err = progressEventsCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from progressEvents collection: %w", err)
+	}
+
+	// Initialize the leaderboard entries collection
+	leaderboardCollection := s.db.Collection("leaderboardEntries")
+	_, err = leaderboardCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from leaderboardEntries collection: %w", err)
+	}
+
+	// Initialize the challenges collection, the challenges stay for the other participants
+	challengesCollection := s.db.Collection("challenges")
+	_, err = challengesCollection.UpdateMany(ctx, bson.M{"participants": id}, bson.M{"$pull": bson.M{"participants": id, "results.participants": bson.M{"userId": id}}})
+	if err != nil {
+		return fmt.Errorf("failed to delete from challenges collection: %w", err)
+	}
+
+	// Initialize the organization members collection
+	organizationMembersCollection := s.db.Collection("organizationMembers")
+	_, err = organizationMembersCollection.DeleteMany(ctx, bson.M{"userId": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from organizationMembers collection: %w", err)
+	}
+
+	// Initialize the settings collection, settings and progress are keyed by the user id
 	settingsCollection := s.db.Collection("settings")
-	_, err = settingsCollection.DeleteMany(ctx, bson.M{"userId": id})
+	_, err = settingsCollection.DeleteMany(ctx, bson.M{"_id": id})
 	if err != nil {
 		return fmt.Errorf("failed to delete from settings collection: %w", err)
 	}
 
 	// Initialize the progress collection
-	progressCollection := s.db.Collection("progres")
-	_, err = progressCollection.DeleteMany(ctx, bson.M{"userId": id})
+	progressCollection := s.db.Collection("progress")
+	_, err = progressCollection.DeleteMany(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete from progress collection: %w", err)
+	}
+
+	// Initialize the privacy collection
+	privacyCollection := s.db.Collection("privacy")
+	_, err = privacyCollection.DeleteMany(ctx, bson.M{"_id": id})
 	if err != nil {
-		return fmt.Errorf("failed to delete from pogress collection: %w", err)
+		return fmt.Errorf("failed to delete from privacy collection: %w", err)
 	}
 
 	// Delete the user
 	err = collection.FindOneAndDelete(ctx, bson.M{"_id": id}).Err()
-
 	if err != nil {
-		fmt.Println(err, "error user delete")
-		return err
+		return apperror.FromMongo(err, "user")
 	}
 
 	return nil
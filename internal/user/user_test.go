@@ -9,6 +9,8 @@ import (
 	"testing"
 	"time"
 
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/auth"
 	"cmd/http/main.go/internal/storage"
 
 	"net/http/httptest"
@@ -26,7 +28,9 @@ type Suite struct {
 
 func (suite *Suite) SetupSuite() {
 	// Define Fiber app.
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
 	MONGODB_URI := "mongodb://localhost:27017"
 	MONGODB_NAME := "testing-user"
 
@@ -42,7 +46,7 @@ func (suite *Suite) SetupSuite() {
 
 	suite.store = NewStorage(db)
 	userController := NewController(suite.store)
-	Routes(app, userController)
+	Routes(app, userController, suite.store)
 
 	// // add health check
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -72,12 +76,20 @@ func (suite *Suite) BeforeTest(suiteName, testName string) {
 
 	suite.testUserId = testId
 
+	// an admin that may list and delete all users
+	if _, err := suite.store.Create(CreateUserRequest{FirstName: "admin", ID: "adminId"}, context.Background()); err != nil {
+		suite.T().Errorf("Could not create admin user: %v", err)
+	}
+	if _, err := suite.store.SetRole("adminId", auth.RoleAdmin, context.Background()); err != nil {
+		suite.T().Errorf("Could not make admin: %v", err)
+	}
 }
 
 func (suite *Suite) TestGetFast() {
 	tests := []struct {
 		description  string // description of the test case
 		route        string // route path to test
+		userId       string // caller of the request
 		expectedCode int    // expected HTTP status code
 	}{
 		{
@@ -88,23 +100,57 @@ func (suite *Suite) TestGetFast() {
 		{
 			description:  "get all users (fast)",
 			route:        "/users",
+			userId:       "adminId",
 			expectedCode: 200,
 		},
+		{
+			description:  "get all users as user",
+			route:        "/users",
+			userId:       suite.testUserId,
+			expectedCode: 403,
+		},
+		{
+			description:  "get all users without caller",
+			route:        "/users",
+			expectedCode: 401,
+		},
 		{
 			description:  "get nonex-users (fast)",
 			route:        "/users/123",
+			userId:       "adminId",
 			expectedCode: 404,
 		},
 		{
 			description:  "get existing users (fast)",
 			route:        "/users/" + suite.testUserId,
+			userId:       suite.testUserId,
 			expectedCode: 200,
 		},
+		{
+			description:  "get other user as user",
+			route:        "/users/adminId",
+			userId:       suite.testUserId,
+			expectedCode: 403,
+		},
+		{
+			description:  "get other user as admin",
+			route:        "/users/" + suite.testUserId,
+			userId:       "adminId",
+			expectedCode: 200,
+		},
+		{
+			description:  "get user without caller",
+			route:        "/users/" + suite.testUserId,
+			expectedCode: 401,
+		},
 	}
 
 	for _, test := range tests {
 		suite.T().Log(test.description)
 		req := httptest.NewRequest("GET", test.route, nil)
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		}
 		resp, _ := suite.app.Test(req, 1)
 		suite.Equal(test.expectedCode, resp.StatusCode)
 	}
@@ -121,9 +167,11 @@ func (suite *Suite) TestPost() {
 		{
 			description: "Create successfully",
 			user: map[string]string{
-				"userName":   "test",
-				"nonkeyword": "body",
-				"id":         "123",
+				"userName":    "test",
+				"nonkeyword":  "body",
+				"email":       "test@example.com",
+				"dateOfBirth": "1990-04-01",
+				"id":          "123",
 			},
 			expectedCode: fiber.StatusCreated,
 		},
@@ -131,17 +179,65 @@ func (suite *Suite) TestPost() {
 			description: "ID already exists",
 			user: map[string]string{
 				"username": "test",
+				"email":    "test@example.com",
 				"id":       "123",
 			},
-			expectedCode: fiber.StatusInternalServerError,
+			expectedCode: fiber.StatusConflict,
 		},
 		{
 			description: "ID is empty",
 			user: map[string]string{
 				"username": "test",
+				"email":    "test@example.com",
 				"id":       "",
 			},
-			expectedCode: fiber.StatusCreated, // TODO whut?
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Email is empty",
+			user: map[string]string{
+				"id": "456",
+			},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Malformed date of birth",
+			user: map[string]string{
+				"email":       "test@example.com",
+				"dateOfBirth": "01.04.1990",
+				"id":          "456",
+			},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Create with time zone, locale and week start",
+			user: map[string]string{
+				"email":     "test@example.com",
+				"id":        "789",
+				"timeZone":  "America/New_York",
+				"locale":    "en-US",
+				"weekStart": "Sunday",
+			},
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description: "Unknown time zone",
+			user: map[string]string{
+				"email":    "test@example.com",
+				"id":       "456",
+				"timeZone": "Mars/Olympus",
+			},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Invalid locale and week start",
+			user: map[string]string{
+				"email":     "test@example.com",
+				"id":        "456",
+				"locale":    "not a locale",
+				"weekStart": "someday",
+			},
+			expectedCode: fiber.StatusBadRequest,
 		},
 	}
 
@@ -214,6 +310,14 @@ func (suite *Suite) TestPutUser() {
 			user:         map[string]string{},
 			expectedCode: fiber.StatusOK, //
 		},
+		{
+			description: "Invalid email",
+			userId:      suite.testUserId,
+			user: map[string]string{
+				"email": "not-an-email",
+			},
+			expectedCode: fiber.StatusBadRequest,
+		},
 	}
 
 	for _, test := range tests {
@@ -247,16 +351,25 @@ func (suite *Suite) TestDeleteUser() {
 	tests := []struct {
 		description  string
 		userId       string
+		callerId     string
 		expectedCode int
 	}{
+		{
+			description:  "Delete other user as user",
+			userId:       "adminId",
+			callerId:     suite.testUserId,
+			expectedCode: fiber.StatusForbidden,
+		},
 		{
 			description:  "Delete existing user",
 			userId:       suite.testUserId,
+			callerId:     suite.testUserId,
 			expectedCode: fiber.StatusOK,
 		},
 		{
 			description:  "Delete non-existing user",
 			userId:       "nonexistent",
+			callerId:     "adminId",
 			expectedCode: fiber.StatusNotFound,
 		},
 	}
@@ -264,6 +377,7 @@ func (suite *Suite) TestDeleteUser() {
 	for _, test := range tests {
 		suite.T().Log(test.description)
 		req := httptest.NewRequest("DELETE", "/users/"+test.userId, nil)
+		req.Header.Set("userId", test.callerId)
 		resp, err := suite.app.Test(req, -1)
 		if err != nil {
 			suite.T().Errorf("Could not make request: %v", err)
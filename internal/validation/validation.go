@@ -0,0 +1,102 @@
+package validation
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/text/language"
+)
+
+// DateLayout is the format of calendar dates like the date of birth
+const DateLayout = "2006-01-02"
+
+const bodyKey = "validation.body"
+
+// Validator is implemented by every request DTO
+type Validator interface {
+	Validate() error
+}
+
+// Errors collects the field errors of one request
+type Errors []apperror.FieldError
+
+// Check adds an error for field if ok is false
+func (e *Errors) Check(ok bool, field string, format string, args ...interface{}) {
+	if !ok {
+		*e = append(*e, apperror.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// Err returns a validation error with all collected fields or nil
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return apperror.InvalidFields(e)
+}
+
+// Body parses the request body into T and validates it before the handler runs.
+// The handler gets the parsed body with Parsed.
+func Body[T any, PT interface {
+	*T
+	Validator
+}]() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Request().Header.Set("Content-Type", "application/json")
+
+		req := PT(new(T))
+		if err := c.BodyParser(req); err != nil {
+			return apperror.Validation("Invalid request body")
+		}
+		if err := req.Validate(); err != nil {
+			return err
+		}
+
+		c.Locals(bodyKey, req)
+		return c.Next()
+	}
+}
+
+// Parsed returns the body stored by the Body middleware
+func Parsed[T any](c *fiber.Ctx) T {
+	return *c.Locals(bodyKey).(*T)
+}
+
+func IsEmail(value string) bool {
+	address, err := mail.ParseAddress(value)
+	return err == nil && address.Address == value
+}
+
+// IsLocale checks for a BCP 47 language tag like de-CH
+func IsLocale(value string) bool {
+	tag, err := language.Parse(value)
+	return err == nil && tag != language.Und
+}
+
+// IsPastDate checks for a date in DateLayout that is not in the future
+func IsPastDate(value string) bool {
+	date, err := time.Parse(DateLayout, value)
+	return err == nil && !date.After(time.Now())
+}
+
+// bounds of timestamps sent by clients
+const (
+	// device clocks may run ahead of the server a little
+	MaxClockSkew = 5 * time.Minute
+	// entries logged offline are accepted for this long
+	MaxClientAge = 90 * 24 * time.Hour
+)
+
+// IsClientTime checks a unix timestamp of a client, it must not be further in
+// the future than MaxClockSkew or older than MaxClientAge
+func IsClientTime(value int64) bool {
+	now := time.Now()
+	return InRange(value, now.Add(-MaxClientAge).Unix(), now.Add(MaxClockSkew).Unix())
+}
+
+func InRange(value, min, max int64) bool {
+	return value >= min && value <= max
+}
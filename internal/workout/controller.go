@@ -0,0 +1,369 @@
+package workout
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/calendar"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/user"
+	"cmd/http/main.go/internal/validation"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Controller struct {
+	storage         *Storage
+	userStorage     *user.Storage
+	progressStorage *progress.Storage
+	settingsStorage *settings.Storage
+}
+
+func NewController(storage *Storage, userStorage *user.Storage, progressStorage *progress.Storage, settingsStorage *settings.Storage) *Controller {
+	return &Controller{
+		storage:         storage,
+		userStorage:     userStorage,
+		progressStorage: progressStorage,
+		settingsStorage: settingsStorage,
+	}
+}
+
+type WorkoutType string
+
+const (
+	WorkoutTypeStrength WorkoutType = "strength"
+	WorkoutTypeRunning  WorkoutType = "running"
+	WorkoutTypeCycling  WorkoutType = "cycling"
+	WorkoutTypeSwimming WorkoutType = "swimming"
+	WorkoutTypeYoga     WorkoutType = "yoga"
+	WorkoutTypeOther    WorkoutType = "other"
+)
+
+func (t WorkoutType) IsValid() bool {
+	return t == WorkoutTypeStrength || t == WorkoutTypeRunning || t == WorkoutTypeCycling || t == WorkoutTypeSwimming || t == WorkoutTypeYoga || t == WorkoutTypeOther
+}
+
+type Set struct {
+	Reps int `json:"reps" bson:"reps"`
+	// kg, 0 for body weight
+	Weight float64 `json:"weight" bson:"weight"`
+}
+
+type Exercise struct {
+	// records are kept per name, names are compared case insensitive
+	Name string `json:"name" bson:"name"`
+	Sets []Set  `json:"sets" bson:"sets"`
+}
+
+// Volume is the sum of reps times weight of all sets
+func (e Exercise) Volume() float64 {
+	var volume float64
+	for _, set := range e.Sets {
+		volume += float64(set.Reps) * set.Weight
+	}
+	return volume
+}
+
+// Heaviest returns the set with the most weight, false if all sets are body weight
+func (e Exercise) Heaviest() (Set, bool) {
+	var best Set
+	for _, set := range e.Sets {
+		if set.Weight > best.Weight || (set.Weight == best.Weight && set.Reps > best.Reps) {
+			best = set
+		}
+	}
+	return best, best.Weight > 0
+}
+
+type CreateWorkoutRequest struct {
+	Type WorkoutType `json:"type" bson:"type"`
+	// unix seconds on the client
+	StartTime int64 `json:"startTime" bson:"startTime"`
+	EndTime   int64 `json:"endTime" bson:"endTime"`
+	// perceived exertion from 1 (very light) to 10 (maximal)
+	Exertion int `json:"exertion" bson:"exertion"`
+	// optional
+	Exercises []Exercise `json:"exercises" bson:"exercises"`
+	Notes     string     `json:"notes" bson:"notes"`
+}
+
+// limits of one workout
+const (
+	maxWorkout     = 24 * time.Hour
+	maxExertion    = 10
+	maxExercises   = 50
+	maxExerciseLen = 100
+	maxSets        = 50
+	maxReps        = 1000
+	maxWeight      = 1000
+	maxNotes       = 2000
+)
+
+func (r CreateWorkoutRequest) Validate() error {
+	var errs validation.Errors
+	errs.Check(r.Type.IsValid(), "type", "must be one of %s, %s, %s, %s, %s, %s", WorkoutTypeStrength, WorkoutTypeRunning, WorkoutTypeCycling, WorkoutTypeSwimming, WorkoutTypeYoga, WorkoutTypeOther)
+	errs.Check(validation.IsClientTime(r.StartTime), "startTime", "must be a unix time of the last %d days", int(validation.MaxClientAge.Hours()/24))
+	errs.Check(validation.IsClientTime(r.EndTime), "endTime", "must be a unix time of the last %d days", int(validation.MaxClientAge.Hours()/24))
+	errs.Check(validation.InRange(r.EndTime-r.StartTime, 60, int64(maxWorkout.Seconds())), "endTime", "must be at least a minute after startTime and at most %d hours later", int(maxWorkout.Hours()))
+	errs.Check(validation.InRange(int64(r.Exertion), 1, maxExertion), "exertion", "must be between 1 and %d", maxExertion)
+	errs.Check(len(r.Exercises) <= maxExercises, "exercises", "must be at most %d", maxExercises)
+	errs.Check(len(r.Notes) <= maxNotes, "notes", "must be at most %d characters", maxNotes)
+
+	names := make(map[string]bool, len(r.Exercises))
+	for i, exercise := range r.Exercises {
+		field := "exercises[" + strconv.Itoa(i) + "]"
+		name := normalizeName(exercise.Name)
+		errs.Check(validation.InRange(int64(len(name)), 1, maxExerciseLen), field+".name", "must be between 1 and %d characters", maxExerciseLen)
+		errs.Check(!names[name], field+".name", "must be unique within the workout")
+		names[name] = true
+		errs.Check(validation.InRange(int64(len(exercise.Sets)), 1, maxSets), field+".sets", "must be between 1 and %d", maxSets)
+		for j, set := range exercise.Sets {
+			setField := field + ".sets[" + strconv.Itoa(j) + "]"
+			errs.Check(validation.InRange(int64(set.Reps), 1, maxReps), setField+".reps", "must be between 1 and %d", maxReps)
+			errs.Check(set.Weight >= 0 && set.Weight <= maxWeight, setField+".weight", "must be between 0 and %d kg", maxWeight)
+		}
+	}
+	return errs.Err()
+}
+
+// Duration is the length of the workout in minutes
+func (r CreateWorkoutRequest) Duration() int {
+	return int((r.EndTime - r.StartTime) / 60)
+}
+
+// normalizedExercises returns the exercises with the names records are kept by
+func (r CreateWorkoutRequest) normalizedExercises() []Exercise {
+	exercises := make([]Exercise, 0, len(r.Exercises))
+	for _, exercise := range r.Exercises {
+		exercise.Name = normalizeName(exercise.Name)
+		exercises = append(exercises, exercise)
+	}
+	return exercises
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+type createWorkoutResponse struct {
+	ID string `json:"id"`
+	// exercises with a new personal record
+	Records    []string `json:"records"`
+	Experience float64  `json:"experience"`
+}
+
+type statsResponse struct {
+	// first and last second of the period
+	StartTime int64                     `json:"startTime"`
+	EndTime   int64                     `json:"endTime"`
+	Workouts  int                       `json:"workouts"`
+	Minutes   int                       `json:"minutes"`
+	Volume    float64                   `json:"volume"`
+	ByType    map[WorkoutType]TypeStats `json:"byType"`
+	// workouts per week from the settings, 0 without a goal
+	WeeklyGoal int `json:"weeklyGoal"`
+}
+
+// weeklyGoal returns the workouts per week a user aims for, 0 without workout settings
+func (t *Controller) weeklyGoal(userId string, ctx context.Context) (int, error) {
+	userSettings, err := t.settingsStorage.Get(userId, string(settings.PluginNameWorkout), ctx)
+	if apperror.IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userSettings.Workout.WeeklyGoal, nil
+}
+
+// @Summary Create workout.
+// @Description Creates a new workout and detects personal records of its exercises, it must not overlap another workout of the user.
+// @Tags workout
+// @Accept */*
+// @Produce json
+// @Param workout body CreateWorkoutRequest true "Workout to create"
+// @Param userId header string true "User ID"
+// @Success 201 {object} createWorkoutResponse
+// @Router /workout [post]
+func (t *Controller) create(c *fiber.Ctx) error {
+	req := validation.Parsed[CreateWorkoutRequest](c)
+
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	//check if user exists
+	_, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	workout, err := t.storage.Create(req, userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	experience := progress.WorkoutExperience(workout.Duration, workout.Exertion, len(workout.Records))
+	err = t.progressStorage.AddExperience(userId, c.UserContext(), settings.PluginNameWorkout, experience)
+	if err != nil {
+		return err
+	}
+
+	records := workout.Records
+	if records == nil {
+		records = []string{}
+	}
+	return c.Status(fiber.StatusCreated).JSON(createWorkoutResponse{
+		ID:         workout.ID.Hex(),
+		Records:    records,
+		Experience: experience,
+	})
+}
+
+// @Summary Get workouts
+// @Description Fetch one or multiple workouts.
+// @Tags workout
+// @Param id query string false "Workout ID"
+// @Param startTime query int64 false "start time"
+// @Param endTime query int64 false "end time"
+// @Param type query string false "strength, running, cycling, swimming, yoga or other"
+// @Param period query string false "day, week or month in the time zone of the user, replaces start and end time"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []WorkoutDB
+// @Router /workout [Get]
+func (t *Controller) get(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	workoutId := c.Query("id")
+	if workoutId != "" {
+		// Get particular workout, the workouts of other users are private
+		workout, err := t.storage.Get(workoutId, c.UserContext())
+		if err != nil {
+			return err
+		}
+		if workout.UserID != userId {
+			return apperror.NotFound("workout does not exist")
+		}
+		// convert to array
+		return c.Status(fiber.StatusOK).JSON([]WorkoutDB{workout})
+	}
+
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	var errs validation.Errors
+	workoutType := WorkoutType(c.Query("type"))
+	errs.Check(workoutType == "" || workoutType.IsValid(), "type", "must be one of %s, %s, %s, %s, %s, %s", WorkoutTypeStrength, WorkoutTypeRunning, WorkoutTypeCycling, WorkoutTypeSwimming, WorkoutTypeYoga, WorkoutTypeOther)
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	startTime := convertToInt64(c.Query("startTime"))
+	endTime := convertToInt64(c.Query("endTime"))
+	// a period of the user's calendar replaces start and end time
+	if period := c.Query("period"); period != "" {
+		startTime, endTime, err = profile.Calendar().Range(calendar.Period(period), c.Query("date"), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	workouts, err := t.storage.GetAllOfOneUserBetweenTime(userId, startTime, endTime, workoutType, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(workouts)
+}
+
+// @Summary Get personal records
+// @Description The heaviest set of every exercise of the user.
+// @Tags workout
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} []RecordDB
+// @Router /workout/records [Get]
+func (t *Controller) records(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	_, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	records, err := t.storage.GetRecords(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(records)
+}
+
+// @Summary Get workout stats
+// @Description Workouts, minutes and volume per type within a period of the user's calendar.
+// @Tags workout
+// @Param period query string false "day, week or month, defaults to week"
+// @Param date query string false "day within the period (YYYY-MM-DD), defaults to today"
+// @Param userId header string true "User ID"
+// @Produce json
+// @Success 200 {object} statsResponse
+// @Router /workout/stats [Get]
+func (t *Controller) stats(c *fiber.Ctx) error {
+	userId := string(c.Request().Header.Peek("userId"))
+	if userId == "" {
+		return apperror.Validation("Missing userId header")
+	}
+
+	profile, err := t.userStorage.Get(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	period := calendar.Period(c.Query("period", string(calendar.PeriodWeek)))
+	startTime, endTime, err := profile.Calendar().Range(period, c.Query("date"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	weeklyGoal, err := t.weeklyGoal(userId, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	byType, err := t.storage.GetStats(userId, startTime, endTime, c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	response := statsResponse{
+		StartTime:  startTime,
+		EndTime:    endTime,
+		ByType:     byType,
+		WeeklyGoal: weeklyGoal,
+	}
+	for _, stats := range byType {
+		response.Workouts += stats.Workouts
+		response.Minutes += stats.Minutes
+		response.Volume += stats.Volume
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func convertToInt64(value string) int64 {
+	intValue, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return intValue
+}
@@ -0,0 +1,20 @@
+package workout
+
+import (
+	"cmd/http/main.go/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// idempotent guards the create route against duplicates from client retries
+func Routes(app fiber.Router, controller *Controller, idempotent fiber.Handler) {
+	workout := app.Group("/workout")
+
+	// add middlewares here
+
+	// add routes here
+	workout.Post("/", idempotent, validation.Body[CreateWorkoutRequest](), controller.create)
+	workout.Get("/", controller.get)
+	workout.Get("/records", controller.records)
+	workout.Get("/stats", controller.stats)
+}
@@ -0,0 +1,256 @@
+package workout
+
+import (
+	"cmd/http/main.go/internal/apperror"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WorkoutDB struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID string             `json:"userId" bson:"userId"`
+	Type   WorkoutType        `json:"type" bson:"type"`
+	// unix seconds of the client
+	StartTime int64 `json:"startTime" bson:"startTime"`
+	EndTime   int64 `json:"endTime" bson:"endTime"`
+	// minutes between start and end time
+	Duration int `json:"duration" bson:"duration"`
+	// perceived exertion from 1 (very light) to 10 (maximal)
+	Exertion  int        `json:"exertion" bson:"exertion"`
+	Exercises []Exercise `json:"exercises,omitempty" bson:"exercises,omitempty"`
+	// sum of reps times weight of all sets in kg
+	Volume float64 `json:"volume" bson:"volume"`
+	Notes  string  `json:"notes,omitempty" bson:"notes,omitempty"`
+	// exercises with a new personal record in this workout
+	Records []string `json:"records,omitempty" bson:"records,omitempty"`
+	// unix seconds when the server stored the workout
+	ServerTime int64 `json:"serverTime" bson:"serverTime"`
+}
+
+// RecordDB is the heaviest set of one exercise of a user
+type RecordDB struct {
+	// userId:exercise
+	ID        string  `json:"-" bson:"_id"`
+	UserID    string  `json:"userId" bson:"userId"`
+	Exercise  string  `json:"exercise" bson:"exercise"`
+	Weight    float64 `json:"weight" bson:"weight"`
+	Reps      int     `json:"reps" bson:"reps"`
+	WorkoutID string  `json:"workoutId" bson:"workoutId"`
+	Time      int64   `json:"time" bson:"time"`
+}
+
+// TypeStats are the totals of one workout type
+type TypeStats struct {
+	Workouts int     `json:"workouts" bson:"workouts"`
+	Minutes  int     `json:"minutes" bson:"minutes"`
+	Volume   float64 `json:"volume" bson:"volume"`
+	// average perceived exertion of the workouts
+	AverageExertion float64 `json:"averageExertion" bson:"averageExertion"`
+}
+
+type Storage struct {
+	db *mongo.Database
+}
+
+func NewStorage(db *mongo.Database) *Storage {
+	return &Storage{
+		db: db,
+	}
+}
+
+// EnsureIndexes creates the indexes for range queries and records
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	_, err := s.db.Collection("workout").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "endTime", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Collection("workoutRecords").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "exercise", Value: 1}},
+	})
+	return err
+}
+
+func (s *Storage) Create(request CreateWorkoutRequest, userId string, ctx context.Context) (WorkoutDB, error) {
+	collection := s.db.Collection("workout")
+
+	exercises := request.normalizedExercises()
+	workout := WorkoutDB{
+		ID:         primitive.NewObjectID(),
+		UserID:     userId,
+		Type:       request.Type,
+		StartTime:  request.StartTime,
+		EndTime:    request.EndTime,
+		Duration:   request.Duration(),
+		Exertion:   request.Exertion,
+		Exercises:  exercises,
+		Notes:      request.Notes,
+		ServerTime: time.Now().Unix(),
+	}
+	for _, exercise := range exercises {
+		workout.Volume += exercise.Volume()
+	}
+
+	// workouts of the same user cannot overlap, else the same time would earn experience twice
+	overlapping, err := collection.CountDocuments(ctx, bson.M{"userId": userId, "startTime": bson.M{"$lt": workout.EndTime}, "endTime": bson.M{"$gt": workout.StartTime}})
+	if err != nil {
+		return workout, apperror.FromMongo(err, "workout")
+	}
+	if overlapping > 0 {
+		return workout, apperror.Conflict("workout overlaps another workout")
+	}
+
+	// stored before the records, so a record never points to a missing workout
+	if _, err := collection.InsertOne(ctx, workout); err != nil {
+		return workout, apperror.FromMongo(err, "workout")
+	}
+
+	// a record needs a heavier set, so a retried workout breaks none
+	for _, exercise := range exercises {
+		isRecord, err := s.updateRecord(workout, exercise, ctx)
+		if err != nil {
+			return workout, err
+		}
+		if isRecord {
+			workout.Records = append(workout.Records, exercise.Name)
+		}
+	}
+	if len(workout.Records) == 0 {
+		return workout, nil
+	}
+
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": workout.ID}, bson.M{"$set": bson.M{"records": workout.Records}})
+	return workout, apperror.FromMongo(err, "workout")
+}
+
+// updateRecord stores the heaviest set of exercise if it beats the record of
+// the user. The first set of an exercise sets the record but does not count
+// as a new one.
+func (s *Storage) updateRecord(workout WorkoutDB, exercise Exercise, ctx context.Context) (bool, error) {
+	collection := s.db.Collection("workoutRecords")
+
+	best, ok := exercise.Heaviest()
+	if !ok {
+		return false, nil
+	}
+
+	id := workout.UserID + ":" + exercise.Name
+	// only matches a lighter record, an existing heavier one makes the upsert fail on the _id
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": id, "weight": bson.M{"$lt": best.Weight}},
+		bson.M{"$set": RecordDB{
+			ID:        id,
+			UserID:    workout.UserID,
+			Exercise:  exercise.Name,
+			Weight:    best.Weight,
+			Reps:      best.Reps,
+			WorkoutID: workout.ID.Hex(),
+			Time:      workout.EndTime,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, apperror.FromMongo(err, "workout record")
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (s *Storage) Get(workoutID string, ctx context.Context) (WorkoutDB, error) {
+	collection := s.db.Collection("workout")
+	workout := WorkoutDB{}
+
+	// an id that is no object id cannot exist
+	objectID, err := primitive.ObjectIDFromHex(workoutID)
+	if err != nil {
+		return workout, apperror.NotFound("workout does not exist")
+	}
+
+	cursor := collection.FindOne(ctx, bson.M{"_id": objectID})
+	if err := cursor.Decode(&workout); err != nil {
+		return workout, apperror.FromMongo(err, "workout")
+	}
+	return workout, nil
+}
+
+// GetAllOfOneUserBetweenTime returns the workouts of a user that ended between
+// startTime and endTime, an endTime of 0 is now and an empty type matches all
+func (s *Storage) GetAllOfOneUserBetweenTime(userId string, startTime int64, endTime int64, workoutType WorkoutType, ctx context.Context) ([]WorkoutDB, error) {
+	collection := s.db.Collection("workout")
+	if endTime == 0 {
+		endTime = time.Now().Unix()
+	}
+
+	query := bson.M{"userId": userId, "endTime": bson.M{"$gte": startTime, "$lte": endTime}}
+	if workoutType != "" {
+		query["type"] = workoutType
+	}
+	cursor, err := collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "endTime", Value: -1}}))
+	if err != nil {
+		return nil, apperror.FromMongo(err, "workout")
+	}
+
+	workouts := make([]WorkoutDB, 0)
+	if err := cursor.All(ctx, &workouts); err != nil {
+		return nil, apperror.FromMongo(err, "workout")
+	}
+	return workouts, nil
+}
+
+// GetRecords returns the personal records of a user by exercise name
+func (s *Storage) GetRecords(userId string, ctx context.Context) ([]RecordDB, error) {
+	collection := s.db.Collection("workoutRecords")
+
+	cursor, err := collection.Find(ctx, bson.M{"userId": userId}, options.Find().SetSort(bson.D{{Key: "exercise", Value: 1}}))
+	if err != nil {
+		return nil, apperror.FromMongo(err, "workout record")
+	}
+
+	records := make([]RecordDB, 0)
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, apperror.FromMongo(err, "workout record")
+	}
+	return records, nil
+}
+
+// GetStats returns the totals per type of the workouts of a user that ended
+// between startTime and endTime (unix seconds)
+func (s *Storage) GetStats(userId string, startTime int64, endTime int64, ctx context.Context) (map[WorkoutType]TypeStats, error) {
+	collection := s.db.Collection("workout")
+
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"userId": userId, "endTime": bson.M{"$gte": startTime, "$lte": endTime}}},
+		bson.M{"$group": bson.M{
+			"_id":             "$type",
+			"workouts":        bson.M{"$sum": 1},
+			"minutes":         bson.M{"$sum": "$duration"},
+			"volume":          bson.M{"$sum": "$volume"},
+			"averageExertion": bson.M{"$avg": "$exertion"},
+		}},
+	})
+	if err != nil {
+		return nil, apperror.FromMongo(err, "workout")
+	}
+
+	var groups []struct {
+		Type      WorkoutType `bson:"_id"`
+		TypeStats `bson:",inline"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, apperror.FromMongo(err, "workout")
+	}
+
+	stats := make(map[WorkoutType]TypeStats, len(groups))
+	for _, group := range groups {
+		stats[group.Type] = group.TypeStats
+	}
+	return stats, nil
+}
@@ -0,0 +1,403 @@
+package workout
+
+import (
+	"bytes"
+	"cmd/http/main.go/internal/apperror"
+	"cmd/http/main.go/internal/idempotency"
+	"cmd/http/main.go/internal/progress"
+	"cmd/http/main.go/internal/settings"
+	"cmd/http/main.go/internal/storage"
+	"cmd/http/main.go/internal/user"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Suite struct {
+	suite.Suite
+	app           *fiber.App
+	store         *Storage
+	userStore     *user.Storage
+	settingsStore *settings.Storage
+	testUserId    string
+	workoutId     string
+}
+
+func (suite *Suite) SetupSuite() {
+	// Define Fiber app.
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apperror.ErrorHandler,
+	})
+	MONGODB_URI := "mongodb://localhost:27017"
+	MONGODB_NAME := "testing-workout"
+
+	db, err := storage.BootstrapMongo(MONGODB_URI, MONGODB_NAME, 10*time.Second)
+
+	if err != nil {
+		suite.T().Errorf("Could not connect to database: %v", err)
+	}
+
+	userStore := user.NewStorage(db)
+	suite.userStore = userStore
+	suite.settingsStore = settings.NewStorage(db)
+
+	suite.store = NewStorage(db)
+	workoutCont := NewController(suite.store, userStore, progress.NewStorage(db), suite.settingsStore)
+	Routes(app, workoutCont, idempotency.New(idempotency.NewStorage(db)))
+
+	suite.app = app
+
+	log.Println("SETUP DONE")
+}
+
+func (suite *Suite) BeforeTest(suiteName, testName string) {
+	for _, collection := range []string{"users", "workout", "workoutRecords", "settings", "progress"} {
+		if err := suite.store.db.Collection(collection).Drop(context.Background()); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+
+	// create a test user (just for userId purposes)
+	testId := "testId"
+	_, err := suite.userStore.Create(user.CreateUserRequest{
+		ID:        testId,
+		FirstName: "test",
+		LastName:  "testId",
+	}, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test user: %v", err)
+	}
+
+	suite.testUserId = testId
+
+	// create a test strength workout of 45 minutes that sets the first record
+	workout, err := suite.store.Create(benchPress(60), testId, context.Background())
+
+	if err != nil {
+		suite.T().Errorf("Could not create test workout: %v", err)
+	}
+
+	suite.workoutId = workout.ID.Hex()
+}
+
+// benchPress is the workout of BeforeTest at weight
+func benchPress(weight float64) CreateWorkoutRequest {
+	return benchPressUntil(time.Now().Add(-time.Hour), weight)
+}
+
+func benchPressUntil(endTime time.Time, weight float64) CreateWorkoutRequest {
+	return CreateWorkoutRequest{
+		Type:      WorkoutTypeStrength,
+		StartTime: endTime.Add(-45 * time.Minute).Unix(),
+		EndTime:   endTime.Unix(),
+		Exertion:  6,
+		Exercises: []Exercise{{
+			Name: "Bench  Press",
+			Sets: []Set{{Reps: 8, Weight: weight - 10}, {Reps: 5, Weight: weight}},
+		}},
+	}
+}
+
+// run ends before the workout of BeforeTest starts
+func run(minutes time.Duration) CreateWorkoutRequest {
+	endTime := time.Now().Add(-2 * time.Hour)
+	return CreateWorkoutRequest{
+		Type:      WorkoutTypeRunning,
+		StartTime: endTime.Add(-minutes * time.Minute).Unix(),
+		EndTime:   endTime.Unix(),
+		Exertion:  7,
+	}
+}
+
+func (suite *Suite) TestPost() {
+	route := "/workout"
+
+	tests := []struct {
+		missingHeader bool
+		userId        string
+		description   string
+		expectedCode  int
+		body          interface{}
+	}{
+		{
+			description:  "Create successfully",
+			body:         benchPressUntil(time.Now().Add(-3*time.Hour), 80),
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "Overlaps the test workout",
+			body:         benchPress(80),
+			expectedCode: fiber.StatusConflict,
+		},
+		{
+			description:  "Create without exercises",
+			body:         run(30),
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			description:  "User does not exist",
+			userId:       "doesntexist",
+			body:         run(30),
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "Missing userId header",
+			missingHeader: true,
+			body:          run(30),
+			expectedCode:  fiber.StatusBadRequest,
+		},
+		{
+			description:  "End before start",
+			body:         run(-30),
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Invalid type",
+			body:         CreateWorkoutRequest{Type: "dancing", StartTime: run(30).StartTime, EndTime: run(30).EndTime, Exertion: 5},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "Exertion out of scale",
+			body:         CreateWorkoutRequest{Type: WorkoutTypeRunning, StartTime: run(30).StartTime, EndTime: run(30).EndTime, Exertion: 11},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Exercise without sets",
+			body: CreateWorkoutRequest{Type: WorkoutTypeStrength, StartTime: run(30).StartTime, EndTime: run(30).EndTime, Exertion: 5, Exercises: []Exercise{
+				{Name: "squat"},
+			}},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Same exercise twice",
+			body: CreateWorkoutRequest{Type: WorkoutTypeStrength, StartTime: run(30).StartTime, EndTime: run(30).EndTime, Exertion: 5, Exercises: []Exercise{
+				{Name: "squat", Sets: []Set{{Reps: 5, Weight: 100}}},
+				{Name: "Squat", Sets: []Set{{Reps: 5, Weight: 100}}},
+			}},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description: "Negative weight",
+			body: CreateWorkoutRequest{Type: WorkoutTypeStrength, StartTime: run(30).StartTime, EndTime: run(30).EndTime, Exertion: 5, Exercises: []Exercise{
+				{Name: "squat", Sets: []Set{{Reps: 5, Weight: -1}}},
+			}},
+			expectedCode: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		bodyJson, err := json.Marshal(test.body)
+		if err != nil {
+			suite.T().Errorf("Could not marshal workout: %v", err)
+		}
+
+		req := httptest.NewRequest("POST", route, bytes.NewReader(bodyJson))
+
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		} else {
+			req.Header.Set("userId", suite.testUserId)
+		}
+
+		if test.missingHeader {
+			req.Header.Del("userId")
+		}
+
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+func (suite *Suite) TestRecordsAndStats() {
+	// a goal of three workouts a week from the settings
+	err := suite.settingsStore.CreatePluginSettings(settings.WorkoutSettings{
+		PeriodNotifications: settings.NotificationTypeWeek,
+		WeeklyGoal:          3,
+	}, suite.testUserId, context.Background())
+	suite.NoError(err)
+
+	post := func(body CreateWorkoutRequest) createWorkoutResponse {
+		bodyJson, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", "/workout", bytes.NewReader(bodyJson))
+		req.Header.Set("userId", suite.testUserId)
+		resp, err := suite.app.Test(req, -1)
+		suite.NoError(err)
+		suite.Equal(fiber.StatusCreated, resp.StatusCode)
+
+		var created createWorkoutResponse
+		suite.NoError(json.NewDecoder(resp.Body).Decode(&created))
+		return created
+	}
+
+	// two workouts of a past day, apart from the workout of BeforeTest
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+
+	// beats the record of BeforeTest, 45 minutes at an exertion of 6 plus the record bonus
+	record := post(benchPressUntil(day.Add(10*time.Hour), 65))
+	suite.Equal([]string{"bench press"}, record.Records)
+	suite.Equal(float64(45*6/5+10), record.Experience)
+
+	// the same weight again is no new record
+	created := post(benchPressUntil(day.Add(11*time.Hour), 65))
+	suite.Empty(created.Records)
+
+	var progressDB progress.Db
+	err = suite.store.db.Collection("progress").FindOne(context.Background(), bson.M{"_id": suite.testUserId}).Decode(&progressDB)
+	suite.NoError(err)
+	suite.Equal(float64(2*45*6/5+10), progressDB.Experience[settings.PluginNameWorkout])
+
+	req := httptest.NewRequest("GET", "/workout/records", nil)
+	req.Header.Set("userId", suite.testUserId)
+	resp, err := suite.app.Test(req, -1)
+	suite.NoError(err)
+	suite.Equal(fiber.StatusOK, resp.StatusCode)
+
+	var records []RecordDB
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&records))
+	suite.Len(records, 1)
+	suite.Equal(float64(65), records[0].Weight)
+	suite.Equal(record.ID, records[0].WorkoutID, "the first workout at a weight keeps the record")
+
+	req = httptest.NewRequest("GET", "/workout/stats?period=day&date="+day.Format("2006-01-02"), nil)
+	req.Header.Set("userId", suite.testUserId)
+	resp, err = suite.app.Test(req, -1)
+	suite.NoError(err)
+	suite.Equal(fiber.StatusOK, resp.StatusCode)
+
+	var stats statsResponse
+	suite.NoError(json.NewDecoder(resp.Body).Decode(&stats))
+	suite.Equal(3, stats.WeeklyGoal)
+	suite.Equal(2, stats.Workouts)
+	suite.Equal(2*45, stats.Minutes)
+	suite.Equal(float64(2*(8*55+5*65)), stats.Volume)
+}
+
+func (suite *Suite) TestGet() {
+	route := "/workout"
+
+	tests := []struct {
+		missingHeader bool
+		userId        string
+		description   string
+		expectedCode  int
+		query         map[string]string
+	}{
+		{
+			description:  "simple test one",
+			query:        map[string]string{"id": suite.workoutId},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "this week",
+			query:        map[string]string{"period": "week"},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "strength workouts",
+			query:        map[string]string{"type": "strength"},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			description:  "invalid type",
+			query:        map[string]string{"type": "dancing"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "invalid period",
+			query:        map[string]string{"period": "year"},
+			expectedCode: fiber.StatusBadRequest,
+		},
+		{
+			description:  "id does not exist",
+			query:        map[string]string{"id": "nonexistingid"},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:  "id of another user",
+			userId:       "otherId",
+			query:        map[string]string{"id": suite.workoutId},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "id without userId header",
+			missingHeader: true,
+			query:         map[string]string{"id": suite.workoutId},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+		{
+			description:  "User does not exist",
+			userId:       "doesntexist",
+			query:        map[string]string{},
+			expectedCode: fiber.StatusNotFound,
+		},
+		{
+			description:   "Missing userId header",
+			missingHeader: true,
+			query:         map[string]string{},
+			expectedCode:  fiber.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		url := url.URL{
+			Path: route,
+		}
+
+		// Add query
+		q := url.Query()
+		for key, value := range test.query {
+			q.Add(key, value)
+		}
+		url.RawQuery = q.Encode()
+
+		req := httptest.NewRequest("GET", url.String(), nil)
+
+		// Add header
+		if test.userId != "" {
+			req.Header.Set("userId", test.userId)
+		} else {
+			req.Header.Set("userId", suite.testUserId)
+		}
+
+		if test.missingHeader {
+			req.Header.Del("userId")
+		}
+
+		resp, err := suite.app.Test(req, -1)
+		if err != nil {
+			suite.T().Errorf("Could not make request: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		suite.Equal(test.expectedCode, resp.StatusCode, "Error for (%v): %v ", test.description, string(body[:]))
+		suite.T().Logf("[✔] (%v) passed", test.description)
+	}
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestWorkoutTestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
@@ -6,10 +6,16 @@ import (
 	"syscall"
 )
 
-func Gracefully() {
+// Gracefully waits for a signal to stop, or returns the error of failed
+func Gracefully(failed <-chan error) error {
 	quit := make(chan os.Signal, 1)
-	defer close(quit)
+	defer signal.Stop(quit)
 
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+		return nil
+	case err := <-failed:
+		return err
+	}
 }
@@ -0,0 +1,104 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrTimeout is returned if the hooks did not finish within the timeout
+var ErrTimeout = errors.New("shutdown timed out")
+
+// Hook is a step of the shutdown, it should return once ctx is done
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	hook Hook
+}
+
+// Hooks stops the parts of the server in the reverse order they were added,
+// like deferred calls. Requests get a context that is canceled if they are
+// still running when the shutdown times out.
+type Hooks struct {
+	hooks []namedHook
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func New() *Hooks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Hooks{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Add registers a hook, it runs before the hooks added earlier
+func (h *Hooks) Add(name string, hook Hook) {
+	h.hooks = append(h.hooks, namedHook{name: name, hook: hook})
+}
+
+// Context is canceled when the shutdown times out or is done
+func (h *Hooks) Context() context.Context {
+	return h.ctx
+}
+
+// Middleware makes the context of the hooks the user context of a request,
+// so storages stop the work of requests that outlast the shutdown. It has to
+// come before the middleware that adds values to the user context.
+func (h *Hooks) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(h.ctx)
+		return c.Next()
+	}
+}
+
+// Run runs the hooks within timeout, the hooks after a timeout still run with
+// a done context to release what they can. The requests are canceled after
+// the first hook that times out.
+func (h *Hooks) Run(timeout time.Duration) error {
+	defer h.cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(h.hooks) - 1; i >= 0; i-- {
+		hook := h.hooks[i]
+		start := time.Now()
+		err := run(hook.hook, ctx)
+		if ctx.Err() != nil {
+			h.cancel()
+		}
+		if err != nil {
+			slog.Error("shutdown hook failed", "hook", hook.name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", hook.name, err))
+			continue
+		}
+		slog.Info("shutdown hook done", "hook", hook.name, "duration", time.Since(start))
+	}
+	if ctx.Err() != nil {
+		errs = append(errs, ErrTimeout)
+	}
+	return errors.Join(errs...)
+}
+
+// run waits for hook until ctx is done, a hook that ignores ctx keeps running
+// in the background
+func run(hook Hook, ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- hook(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
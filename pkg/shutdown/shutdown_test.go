@@ -0,0 +1,85 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRun(t *testing.T) {
+	hooks := New()
+	var order []string
+	for _, name := range []string{"mongo", "worker", "server"} {
+		name := name
+		hooks.Add(name, func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+	hooks.Add("failing", func(ctx context.Context) error {
+		return errors.New("could not stop")
+	})
+
+	err := hooks.Run(time.Second)
+	if err == nil || errors.Is(err, ErrTimeout) {
+		t.Errorf("got error %v, want the one of the failing hook", err)
+	}
+	if want := []string{"server", "worker", "mongo"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got order %v, want %v", order, want)
+	}
+	if hooks.Context().Err() == nil {
+		t.Errorf("got a context that is not canceled after the shutdown")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	hooks := New()
+	closed := make(chan struct{})
+	hooks.Add("mongo", func(ctx context.Context) error {
+		close(closed)
+		return nil
+	})
+
+	// a request that only returns when its context is canceled
+	app := fiber.New()
+	app.Use(hooks.Middleware())
+	app.Get("/", func(c *fiber.Ctx) error {
+		<-c.UserContext().Done()
+		return c.SendStatus(fiber.StatusServiceUnavailable)
+	})
+	responses := make(chan int, 1)
+	go func() {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil), -1)
+		if err != nil {
+			responses <- 0
+			return
+		}
+		responses <- resp.StatusCode
+	}()
+
+	hooks.Add("server", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	if err := hooks.Run(50 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("got a shutdown of %s", elapsed)
+	}
+	if status := <-responses; status != fiber.StatusServiceUnavailable {
+		t.Errorf("got status %d, want the request to be canceled", status)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Errorf("got hooks that did not run after the timeout")
+	}
+}